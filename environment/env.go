@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -24,6 +26,13 @@ type Env struct {
 	DSN string
 
 	BypassAuth bool
+
+	SchedulerInterval time.Duration // 定时消息的轮询间隔
+	JanitorInterval   time.Duration // 过期消息的清理间隔
+
+	ExportInterval time.Duration // 导出任务的轮询间隔
+
+	GroupCapacityTiers []int // 群容量档位对应的成员上限，升序排列，新建的群使用第一档
 }
 
 func Get() (Env, error) {
@@ -92,6 +101,53 @@ func Get() (Env, error) {
 		}
 	}
 
+	var schedulerInterval time.Duration
+	if os.Getenv("SCHEDULER_INTERVAL") == "" {
+		schedulerInterval = time.Second
+	} else {
+		schedulerInterval, err = time.ParseDuration(os.Getenv("SCHEDULER_INTERVAL"))
+		if err != nil {
+			return Env{}, err
+		}
+		if schedulerInterval <= 0 {
+			return Env{}, fmt.Errorf("scheduler interval must be positive: %s", schedulerInterval)
+		}
+	}
+
+	var janitorInterval time.Duration
+	if os.Getenv("JANITOR_INTERVAL") == "" {
+		janitorInterval = time.Minute
+	} else {
+		janitorInterval, err = time.ParseDuration(os.Getenv("JANITOR_INTERVAL"))
+		if err != nil {
+			return Env{}, err
+		}
+		if janitorInterval <= 0 {
+			return Env{}, fmt.Errorf("janitor interval must be positive: %s", janitorInterval)
+		}
+	}
+
+	var exportInterval time.Duration
+	if os.Getenv("EXPORT_INTERVAL") == "" {
+		exportInterval = 5 * time.Second
+	} else {
+		exportInterval, err = time.ParseDuration(os.Getenv("EXPORT_INTERVAL"))
+		if err != nil {
+			return Env{}, err
+		}
+		if exportInterval <= 0 {
+			return Env{}, fmt.Errorf("export interval must be positive: %s", exportInterval)
+		}
+	}
+
+	groupCapacityTiers := []int{200, 500, 2000}
+	if os.Getenv("GROUP_CAPACITY_TIERS") != "" {
+		groupCapacityTiers, err = parseCapacityTiers(os.Getenv("GROUP_CAPACITY_TIERS"))
+		if err != nil {
+			return Env{}, err
+		}
+	}
+
 	return Env{
 		AppName:             appName,
 		AppVersion:          appVersion,
@@ -101,9 +157,30 @@ func Get() (Env, error) {
 		WebsocketListenAddr: websocketListenAddr,
 		DSN:                 dsn,
 		BypassAuth:          bypassAuth,
+		SchedulerInterval:   schedulerInterval,
+		JanitorInterval:     janitorInterval,
+		ExportInterval:      exportInterval,
+		GroupCapacityTiers:  groupCapacityTiers,
 	}, nil
 }
 
+// parseCapacityTiers 解析以逗号分隔的升序正整数，如"200,500,2000"
+func parseCapacityTiers(s string) ([]int, error) {
+	var tiers []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid group capacity tiers %q: %w", s, err)
+		}
+		if n <= 0 || (len(tiers) > 0 && n <= tiers[len(tiers)-1]) {
+			return nil, fmt.Errorf("group capacity tiers must be positive and ascending: %q", s)
+		}
+		tiers = append(tiers, n)
+	}
+
+	return tiers, nil
+}
+
 var (
 	envLoaded = false
 	mu        sync.Mutex
@@ -0,0 +1,62 @@
+package environment
+
+import (
+	"testing"
+	"time"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("APP_NAME", "go-chat")
+	t.Setenv("APP_VERSION", "test")
+	t.Setenv("DSN", "postgres://localhost/chat")
+}
+
+func TestGetSchedulerInterval(t *testing.T) {
+	setRequired(t)
+
+	t.Setenv("SCHEDULER_INTERVAL", "500ms")
+	env, err := Get()
+	if err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if env.SchedulerInterval != 500*time.Millisecond {
+		t.Errorf("expected %s, but got %s", 500*time.Millisecond, env.SchedulerInterval)
+	}
+
+	for _, v := range []string{"0s", "-1s"} {
+		t.Setenv("SCHEDULER_INTERVAL", v)
+		if _, err = Get(); err == nil {
+			t.Errorf("expected error for SCHEDULER_INTERVAL=%s, but got nil", v)
+		}
+	}
+}
+
+func TestGetJanitorInterval(t *testing.T) {
+	setRequired(t)
+
+	env, err := Get()
+	if err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if env.JanitorInterval != time.Minute {
+		t.Errorf("expected %s, but got %s", time.Minute, env.JanitorInterval)
+	}
+
+	for _, v := range []string{"0s", "-1m"} {
+		t.Setenv("JANITOR_INTERVAL", v)
+		if _, err = Get(); err == nil {
+			t.Errorf("expected error for JANITOR_INTERVAL=%s, but got nil", v)
+		}
+	}
+}
+
+func TestGetExportInterval(t *testing.T) {
+	setRequired(t)
+
+	for _, v := range []string{"0s", "-5s"} {
+		t.Setenv("EXPORT_INTERVAL", v)
+		if _, err := Get(); err == nil {
+			t.Errorf("expected error for EXPORT_INTERVAL=%s, but got nil", v)
+		}
+	}
+}
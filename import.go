@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/importer"
+	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
+	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/internal/storage/postgres"
+)
+
+// runImport 导入聊天记录，用法：
+//
+//	go-chat import -format json export.json
+//	go-chat import -format slack -source acme slack-export.zip
+//	go-chat import -format slack -source acme ./slack-export/
+func runImport(ctx context.Context, env environment.Env, logging logger.Logger, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "json", "导入格式：json或slack")
+	source := flags.String("source", "", "slack格式的数据来源名称，用于重复导入时识别已导入的数据")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-format json|slack] [-source name] <path>")
+	}
+	path := flags.Arg(0)
+
+	var a *importer.Archive
+	switch *format {
+	case "json":
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if a, err = importer.ReadJSON(f); err != nil {
+			return err
+		}
+	case "slack":
+		var fsys fs.FS = os.DirFS(path)
+		if strings.HasSuffix(path, ".zip") {
+			zr, err := zip.OpenReader(path)
+			if err != nil {
+				return err
+			}
+			defer zr.Close()
+			fsys = zr
+		}
+		var err error
+		if a, err = importer.ReadSlack(fsys, *source); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid format: %s", *format)
+	}
+
+	st, err := postgres.New(env)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	u, err := user.New(env, st)
+	if err != nil {
+		return err
+	}
+	g, err := group.New(env, logging, st, attachment.New(st))
+	if err != nil {
+		return err
+	}
+	imp, err := importer.New(env, logging, st, u, g)
+	if err != nil {
+		return err
+	}
+
+	report, err := imp.Import(ctx, a)
+	if report != nil {
+		out, _ := json.Marshal(report)
+		logging.Infof("import report: %s", out)
+	}
+	return err
+}
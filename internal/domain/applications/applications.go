@@ -2,8 +2,12 @@ package applications
 
 import (
 	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/entity"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/infras/logger"
@@ -30,20 +34,32 @@ type Applications interface {
 
 	// GroupRequest 申请加群
 
-	CreateGroupRequest(ctx context.Context, sender string, groupID int64) error
+	CreateGroupRequest(ctx context.Context, sender string, groupID int64, answer string) (*entity.GroupRequestLog, error)
 	AgreeGroupRequest(ctx context.Context, id int64, approver string) error
 	RefuseGroupRequest(ctx context.Context, id int64, approver string) error
 	GetGroupRequest(ctx context.Context, id int64) (*entity.GroupRequestLog, error)
 	GroupRequestsFrom(ctx context.Context, sender string) ([]*entity.GroupRequestLog, error)
 	GroupRequestsTo(ctx context.Context, groupID int64) ([]*entity.GroupRequestLog, error)
+
+	// InviteLink 可分享的入群邀请链接
+
+	CreateInviteLink(ctx context.Context, creator string, groupID int64, input InviteLinkInput) (*entity.GroupInviteLink, error)
+	ListInviteLinks(ctx context.Context, groupID int64) ([]*entity.GroupInviteLink, error)
+	RevokeInviteLink(ctx context.Context, groupID, linkID int64) error
+	ListInviteLinkUses(ctx context.Context, groupID, linkID int64) ([]*entity.GroupInviteLinkUse, error)
+	RedeemInviteLink(ctx context.Context, subject, token string) (*Redemption, error)
 }
 
-func New(env environment.Env, logger logger.Logger, storage storage.Storage) (Applications, error) {
-	return &applications{storage: storage}, nil
+func New(env environment.Env, logger logger.Logger, storage storage.Storage, group group.Group) (Applications, error) {
+	return &applications{storage: storage, group: group, capacityTiers: env.GroupCapacityTiers}, nil
 }
 
+const maxJoinAnswerLen = 512
+
 type applications struct {
-	storage storage.Storage
+	storage       storage.Storage
+	group         group.Group
+	capacityTiers []int
 }
 
 func (a *applications) CreateFriendRequest(ctx context.Context, sender, receiver string) error {
@@ -239,6 +255,7 @@ func (a *applications) CreateGroupInvitation(ctx context.Context, sender, receiv
 	if err != nil {
 		return err
 	}
+	defer ses.Rollback()
 
 	if sender == receiver {
 		return errors.Newf(errors.InvalidArgument, nil, "不可以邀请自己入群")
@@ -262,6 +279,10 @@ func (a *applications) CreateGroupInvitation(ctx context.Context, sender, receiv
 		return errors.Newf(errors.AlreadyExists, nil, "[%s]已经是群[%d]成员了", receiver, groupID)
 	}
 
+	if err = a.checkNotBanned(ses, receiver, groupID); err != nil {
+		return err
+	}
+
 	got, err := a.storage.GetPendingGroupInvitationLog(ses, groupID, receiver)
 	if err != nil && errors.Code(err) != errors.NotFound {
 		return err
@@ -286,6 +307,9 @@ func (a *applications) CreateGroupInvitation(ctx context.Context, sender, receiv
 	}
 
 	if forupdate != nil {
+		if err = a.checkCapacity(ses, groupID); err != nil {
+			return err
+		}
 		if err = a.storage.UpdateGroupRequestLogStatus(ses, forupdate.ID, sender, entity.LogsStatusAgreed); err != nil {
 			return err
 		}
@@ -293,7 +317,6 @@ func (a *applications) CreateGroupInvitation(ctx context.Context, sender, receiv
 		e := &entity.GroupMember{
 			UserSubject: receiver,
 			GroupID:     groupID,
-			IsAdmin:     false,
 		}
 		if err = a.storage.InsertGroupMember(ses, e); err != nil {
 			return err
@@ -311,6 +334,36 @@ func (a *applications) CreateGroupInvitation(ctx context.Context, sender, receiv
 	return nil
 }
 
+// checkNotBanned 被群封禁的用户不能申请或被邀请入群
+func (a *applications) checkNotBanned(ses storage.Session, subject string, groupID int64) error {
+	banned, err := a.storage.IsBannedFromGroup(ses, subject, groupID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if banned {
+		return errors.Newf(errors.PermissionDenied, nil, "[%s]已被群[%d]封禁", subject, groupID)
+	}
+
+	return nil
+}
+
+// checkCapacity 锁住群并检查能否再加入一个成员，避免并发入群超过成员上限
+func (a *applications) checkCapacity(ses storage.Session, groupID int64) error {
+	grp, err := a.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return err
+	}
+	n, err := a.storage.CountGroupMembers(ses, groupID)
+	if err != nil {
+		return err
+	}
+	if limit := grp.MaxMembers(a.capacityTiers); n >= limit {
+		return errors.Newf(errors.ResourceExhausted, nil, "群[%d]已满：当前%d人，上限%d人，请提升容量档位", groupID, n, limit)
+	}
+
+	return nil
+}
+
 func (a *applications) AgreeGroupInvitation(ctx context.Context, id int64) error {
 	ses, err := a.storage.NewSession(ctx)
 	if err != nil {
@@ -320,6 +373,7 @@ func (a *applications) AgreeGroupInvitation(ctx context.Context, id int64) error
 	if err != nil {
 		return err
 	}
+	defer ses.Rollback()
 
 	forupdate, err := a.storage.GetGroupInvitationLogByIDForUpdate(ses, id)
 	if err != nil {
@@ -328,6 +382,12 @@ func (a *applications) AgreeGroupInvitation(ctx context.Context, id int64) error
 	if forupdate.Status != entity.LogsStatusPending {
 		return errors.Newf(errors.InvalidArgument, nil, "邀请入群已经被处理")
 	}
+	if err = a.checkNotBanned(ses, forupdate.Receiver, forupdate.GroupID); err != nil {
+		return err
+	}
+	if err = a.checkCapacity(ses, forupdate.GroupID); err != nil {
+		return err
+	}
 	if err = a.storage.UpdateGroupInvitationLogStatus(ses, id, entity.LogsStatusAgreed); err != nil {
 		return err
 	}
@@ -335,7 +395,6 @@ func (a *applications) AgreeGroupInvitation(ctx context.Context, id int64) error
 	i := &entity.GroupMember{
 		UserSubject: forupdate.Receiver,
 		GroupID:     forupdate.GroupID,
-		IsAdmin:     false,
 	}
 	if err = a.storage.InsertGroupMember(ses, i); err != nil {
 		return err
@@ -423,39 +482,58 @@ func (a *applications) GroupInvitationsTo(ctx context.Context, receiver string)
 	return res, nil
 }
 
-func (a *applications) CreateGroupRequest(ctx context.Context, sender string, groupID int64) error {
+// CreateGroupRequest 按群的入群方式处理申请：open直接入群，question需要回答问题，invite_only不接受申请。
+// 返回申请记录，状态为已接受时表示已经入群
+func (a *applications) CreateGroupRequest(ctx context.Context, sender string, groupID int64, answer string) (*entity.GroupRequestLog, error) {
 	ses, err := a.storage.NewSession(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ses, err = ses.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer ses.Rollback()
 
 	g, err := a.storage.GetGroupByID(ses, groupID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !g.IsPublic {
-		return errors.Newf(errors.PermissionDenied, nil, "群[%d]是非公开的群组", groupID)
+		return nil, errors.Newf(errors.PermissionDenied, nil, "群[%d]是非公开的群组", groupID)
+	}
+
+	switch g.JoinPolicy {
+	case entity.GroupJoinInviteOnly:
+		return nil, errors.Newf(errors.PermissionDenied, nil, "群[%d]只能通过邀请加入", groupID)
+	case entity.GroupJoinQuestion:
+		answer = strings.TrimSpace(answer)
+		if answer == "" || utf8.RuneCountInString(answer) > maxJoinAnswerLen {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "请回答入群问题且不能超过%d个字符", maxJoinAnswerLen)
+		}
+	default:
+		answer = ""
 	}
 
 	ok, err := a.storage.IsMemberOfGroup(ses, sender, groupID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if ok {
-		return errors.Newf(errors.AlreadyExists, nil, "[%s]已经是群[%d]成员了", sender, groupID)
+		return nil, errors.Newf(errors.AlreadyExists, nil, "[%s]已经是群[%d]成员了", sender, groupID)
+	}
+
+	if err = a.checkNotBanned(ses, sender, groupID); err != nil {
+		return nil, err
 	}
 
 	got, err := a.storage.GetPendingGroupRequestLog(ses, groupID, sender)
 	if err != nil && errors.Code(err) != errors.NotFound {
-		return err
+		return nil, err
 	}
 	if got != nil {
-		return errors.Newf(errors.AlreadyExists, nil, "已经存在[%s]发送给群[%d]的申请入群请求了", sender, groupID)
+		return nil, errors.Newf(errors.AlreadyExists, nil, "已经存在[%s]发送给群[%d]的申请入群请求了", sender, groupID)
 	}
 
 	// 不存在sender发送给groupID群的入群请求
@@ -463,39 +541,44 @@ func (a *applications) CreateGroupRequest(ctx context.Context, sender string, gr
 	// 检查是否已经有group邀请sender的且pending的入群请求，如果有，则双向同意
 	forUpdate, err := a.storage.GetPendingGroupInvitationLogForUpdate(ses, groupID, sender)
 	if err != nil && errors.Code(err) != errors.NotFound {
-		return err
+		return nil, err
 	}
 
 	insert := &entity.GroupRequestLog{
 		GroupID: groupID,
 		Sender:  sender,
 		Status:  entity.LogsStatusPending,
+		Answer:  answer,
 	}
 
 	if forUpdate != nil {
 		if err = a.storage.UpdateGroupInvitationLogStatus(ses, forUpdate.ID, entity.LogsStatusAgreed); err != nil {
-			return err
+			return nil, err
+		}
+	}
+	// 被邀请过或群允许直接入群时不需要审批，approver为空
+	if forUpdate != nil || g.JoinPolicy == entity.GroupJoinOpen {
+		if err = a.checkCapacity(ses, groupID); err != nil {
+			return nil, err
 		}
-
 		e := &entity.GroupMember{
 			UserSubject: sender,
 			GroupID:     groupID,
-			IsAdmin:     false,
 		}
 		if err = a.storage.InsertGroupMember(ses, e); err != nil {
-			return err
+			return nil, err
 		}
 		insert.Status = entity.LogsStatusAgreed
 	}
 
 	if err = a.storage.InsertGroupRequestLog(ses, insert); err != nil {
-		return err
+		return nil, err
 	}
 
 	if err = ses.Commit(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return insert, nil
 }
 
 func (a *applications) AgreeGroupRequest(ctx context.Context, id int64, approver string) error {
@@ -507,6 +590,7 @@ func (a *applications) AgreeGroupRequest(ctx context.Context, id int64, approver
 	if err != nil {
 		return err
 	}
+	defer ses.Rollback()
 
 	forUpdate, err := a.storage.GetGroupRequestLogByIDForUpdate(ses, id)
 	if err != nil {
@@ -515,14 +599,26 @@ func (a *applications) AgreeGroupRequest(ctx context.Context, id int64, approver
 	if forUpdate.Status != entity.LogsStatusPending {
 		return errors.Newf(errors.InvalidArgument, nil, "入群申请已经被处理")
 	}
+	if err = a.checkNotBanned(ses, forUpdate.Sender, forUpdate.GroupID); err != nil {
+		return err
+	}
+	if err = a.checkCapacity(ses, forUpdate.GroupID); err != nil {
+		return err
+	}
 	if err = a.storage.UpdateGroupRequestLogStatus(ses, id, approver, entity.LogsStatusAgreed); err != nil {
 		return err
 	}
+	// 通过邀请链接的申请在同意时才消耗链接的使用次数
+	if forUpdate.InviteLinkID != 0 {
+		use := &entity.GroupInviteLinkUse{LinkID: forUpdate.InviteLinkID, UserSubject: forUpdate.Sender}
+		if err = a.storage.InsertGroupInviteLinkUse(ses, use); err != nil {
+			return err
+		}
+	}
 
 	i := &entity.GroupMember{
 		UserSubject: forUpdate.Sender,
 		GroupID:     forUpdate.GroupID,
-		IsAdmin:     false,
 	}
 	if err = a.storage.InsertGroupMember(ses, i); err != nil {
 		return err
@@ -0,0 +1,224 @@
+package applications
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// maxInviteLinkUses 单个邀请链接最多的使用次数
+const maxInviteLinkUses = 10000
+
+// InviteLinkInput ttl为0表示永不过期，maxUses为0表示不限次数
+type InviteLinkInput struct {
+	TTL              time.Duration
+	MaxUses          int
+	RequiresApproval bool
+}
+
+// Redemption 使用邀请链接的结果，Joined为false时Request是等待审批的入群申请
+type Redemption struct {
+	GroupID int64                   `json:"group_id"`
+	Joined  bool                    `json:"joined"`
+	Request *entity.GroupRequestLog `json:"request"`
+}
+
+// CreateInviteLink 由调用方校验creator的权限
+func (a *applications) CreateInviteLink(ctx context.Context, creator string, groupID int64, input InviteLinkInput) (*entity.GroupInviteLink, error) {
+	if input.TTL < 0 {
+		return nil, errors.New(errors.InvalidArgument, nil, "有效期不能小于0")
+	}
+	if input.MaxUses < 0 || input.MaxUses > maxInviteLinkUses {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "使用次数不能小于0且不能超过%d", maxInviteLinkUses)
+	}
+
+	ses, err := a.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = a.storage.GetGroupByID(ses, groupID); err != nil {
+		return nil, err
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, err
+	}
+	link := &entity.GroupInviteLink{
+		GroupID:          groupID,
+		Token:            token,
+		CreatedBy:        creator,
+		MaxUses:          input.MaxUses,
+		RequiresApproval: input.RequiresApproval,
+	}
+	if input.TTL > 0 {
+		expiresAt := time.Now().UTC().Add(input.TTL)
+		link.ExpiresAt = &expiresAt
+	}
+	if err = a.storage.InsertGroupInviteLink(ses, link); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (a *applications) ListInviteLinks(ctx context.Context, groupID int64) ([]*entity.GroupInviteLink, error) {
+	ses, err := a.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := a.storage.ListGroupInviteLinksByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty invite links of group: %d", groupID)
+	}
+
+	return res, nil
+}
+
+func (a *applications) RevokeInviteLink(ctx context.Context, groupID, linkID int64) error {
+	ses, err := a.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = a.inviteLinkOf(ses, groupID, linkID); err != nil {
+		return err
+	}
+
+	return a.storage.RevokeGroupInviteLink(ses, linkID, time.Now().UTC())
+}
+
+// ListInviteLinkUses 列出使用过该链接的用户
+func (a *applications) ListInviteLinkUses(ctx context.Context, groupID, linkID int64) ([]*entity.GroupInviteLinkUse, error) {
+	ses, err := a.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = a.inviteLinkOf(ses, groupID, linkID); err != nil {
+		return nil, err
+	}
+
+	return a.storage.ListGroupInviteLinkUses(ses, linkID)
+}
+
+// inviteLinkOf 查询群的邀请链接，链接不属于该群时视为不存在
+func (a *applications) inviteLinkOf(ses storage.Session, groupID, linkID int64) (*entity.GroupInviteLink, error) {
+	link, err := a.storage.GetGroupInviteLink(ses, linkID)
+	if err != nil {
+		return nil, err
+	}
+	if link.GroupID != groupID {
+		return nil, errors.Newf(errors.NotFound, nil, "no invite link with id: %d found in group: %d", linkID, groupID)
+	}
+
+	return link, nil
+}
+
+// RedeemInviteLink subject使用邀请链接入群，链接的创建者须仍有邀请成员的权限。链接不需要审批时直接入群，
+// 消耗一次使用次数并记录一条已同意的入群申请；否则提交一条待审批的入群申请，审批同意时才消耗使用次数，
+// 被拒绝后可以再次使用。非公开的群也可以通过链接申请
+func (a *applications) RedeemInviteLink(ctx context.Context, subject, token string) (*Redemption, error) {
+	ses, err := a.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	link, err := a.storage.GetGroupInviteLinkByTokenForUpdate(ses, token)
+	if err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return nil, errors.New(errors.NotFound, err, "邀请链接无效")
+		}
+		return nil, err
+	}
+	if !link.Usable(time.Now().UTC()) {
+		return nil, errors.New(errors.FailedPrecondition, nil, "邀请链接已失效")
+	}
+	// 创建者离开群或被收回邀请权限后，链接随之失效
+	if err = a.group.Authorize(storage.WithContext(ctx, ses), link.GroupID, link.CreatedBy, entity.GroupPermInvite); err != nil {
+		if errors.Code(err) == errors.PermissionDenied {
+			return nil, errors.New(errors.FailedPrecondition, err, "邀请链接已失效")
+		}
+		return nil, err
+	}
+
+	ok, err := a.storage.IsMemberOfGroup(ses, subject, link.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, errors.Newf(errors.AlreadyExists, nil, "[%s]已经是群[%d]成员了", subject, link.GroupID)
+	}
+	if err = a.checkNotBanned(ses, subject, link.GroupID); err != nil {
+		return nil, err
+	}
+
+	got, err := a.storage.GetPendingGroupRequestLog(ses, link.GroupID, subject)
+	if err != nil && errors.Code(err) != errors.NotFound {
+		return nil, err
+	}
+	if got != nil {
+		return nil, errors.Newf(errors.AlreadyExists, nil, "已经存在[%s]发送给群[%d]的申请入群请求了", subject, link.GroupID)
+	}
+
+	used, err := a.storage.IsGroupInviteLinkUsedBy(ses, link.ID, subject)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, errors.New(errors.AlreadyExists, nil, "你已经使用过该邀请链接")
+	}
+
+	req := &entity.GroupRequestLog{
+		GroupID:      link.GroupID,
+		Sender:       subject,
+		Status:       entity.LogsStatusPending,
+		InviteLinkID: link.ID,
+	}
+	res := &Redemption{GroupID: link.GroupID, Request: req}
+	if !link.RequiresApproval {
+		// 没有人审批，approver留空，通过InviteLinkID可以追溯到链接及其创建者
+		req.Status = entity.LogsStatusAgreed
+		if err = a.checkCapacity(ses, link.GroupID); err != nil {
+			return nil, err
+		}
+		if err = a.storage.InsertGroupInviteLinkUse(ses, &entity.GroupInviteLinkUse{LinkID: link.ID, UserSubject: subject}); err != nil {
+			return nil, err
+		}
+		if err = a.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: subject, GroupID: link.GroupID}); err != nil {
+			return nil, err
+		}
+		res.Joined = true
+	}
+	if err = a.storage.InsertGroupRequestLog(ses, req); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
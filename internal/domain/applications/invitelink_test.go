@@ -0,0 +1,161 @@
+package applications
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSession struct{}
+
+func (s *fakeSession) Begin() (storage.Session, error)                    { return s, nil }
+func (s *fakeSession) Rollback() error                                    { return nil }
+func (s *fakeSession) Commit() error                                      { return nil }
+func (s *fakeSession) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (s *fakeSession) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (s *fakeSession) QueryRow(query string, args ...any) *sql.Row        { return nil }
+
+// linkStorage 只有一个邀请链接的群
+type linkStorage struct {
+	storage.Storage
+
+	link     *entity.GroupInviteLink
+	uses     map[string]bool
+	members  map[string]bool
+	requests []*entity.GroupRequestLog
+}
+
+func (s *linkStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	return &fakeSession{}, nil
+}
+
+func (s *linkStorage) GetGroupInviteLinkByTokenForUpdate(ses storage.Session, token string) (*entity.GroupInviteLink, error) {
+	return s.link, nil
+}
+
+func (s *linkStorage) IsMemberOfGroup(ses storage.Session, userSubject string, groupID int64) (bool, error) {
+	return s.members[userSubject], nil
+}
+
+func (s *linkStorage) IsBannedFromGroup(ses storage.Session, subject string, groupID int64, now time.Time) (bool, error) {
+	return false, nil
+}
+
+func (s *linkStorage) GetPendingGroupRequestLog(ses storage.Session, groupID int64, sender string) (*entity.GroupRequestLog, error) {
+	for _, r := range s.requests {
+		if r.Sender == sender && r.Status == entity.LogsStatusPending {
+			return r, nil
+		}
+	}
+	return nil, errors.New(errors.NotFound, nil, "no pending request")
+}
+
+func (s *linkStorage) GetGroupRequestLogByIDForUpdate(ses storage.Session, id int64) (*entity.GroupRequestLog, error) {
+	return s.requests[id-1], nil
+}
+
+func (s *linkStorage) UpdateGroupRequestLogStatus(ses storage.Session, id int64, approver string, status entity.LogsStatus) error {
+	s.requests[id-1].Status = status
+	return nil
+}
+
+func (s *linkStorage) IsGroupInviteLinkUsedBy(ses storage.Session, linkID int64, subject string) (bool, error) {
+	return s.uses[subject], nil
+}
+
+func (s *linkStorage) InsertGroupInviteLinkUse(ses storage.Session, i *entity.GroupInviteLinkUse) error {
+	s.uses[i.UserSubject] = true
+	s.link.Uses++
+	return nil
+}
+
+func (s *linkStorage) GetGroupByIDForUpdate(ses storage.Session, id int64) (*entity.Group, error) {
+	return &entity.Group{ID: id}, nil
+}
+
+func (s *linkStorage) CountGroupMembers(ses storage.Session, groupID int64) (int, error) {
+	return len(s.members), nil
+}
+
+func (s *linkStorage) InsertGroupMember(ses storage.Session, i *entity.GroupMember) error {
+	s.members[i.UserSubject] = true
+	return nil
+}
+
+func (s *linkStorage) InsertGroupRequestLog(ses storage.Session, i *entity.GroupRequestLog) error {
+	s.requests = append(s.requests, i)
+	i.ID = int64(len(s.requests))
+	return nil
+}
+
+// fakeGroup denied中的成员没有任何权限
+type fakeGroup struct {
+	group.Group
+
+	denied map[string]bool
+}
+
+func (g *fakeGroup) Authorize(ctx context.Context, groupID int64, subject string, perm entity.GroupPermission) error {
+	if g.denied[subject] {
+		return errors.Newf(errors.PermissionDenied, nil, "你没有%s的权限", perm)
+	}
+	return nil
+}
+
+func newTestApplications(requiresApproval bool) (*applications, *linkStorage, *fakeGroup) {
+	st := &linkStorage{
+		link:    &entity.GroupInviteLink{ID: 1, GroupID: 1, Token: "t", CreatedBy: "creator", MaxUses: 1, RequiresApproval: requiresApproval},
+		uses:    make(map[string]bool),
+		members: map[string]bool{"creator": true},
+	}
+	g := &fakeGroup{denied: make(map[string]bool)}
+	return &applications{storage: st, group: g, capacityTiers: []int{200}}, st, g
+}
+
+func TestRedeemInviteLinkJoins(t *testing.T) {
+	a, st, _ := newTestApplications(false)
+
+	res, err := a.RedeemInviteLink(context.Background(), "joiner", "t")
+	require.Nil(t, err)
+	require.True(t, res.Joined)
+	require.False(t, res.Request.Approver.Valid)
+	require.Equal(t, 1, st.link.Uses)
+	require.True(t, st.members["joiner"])
+}
+
+func TestRedeemInviteLinkCreatorLostPermission(t *testing.T) {
+	a, st, g := newTestApplications(false)
+	g.denied["creator"] = true
+
+	_, err := a.RedeemInviteLink(context.Background(), "joiner", "t")
+	require.Equal(t, errors.FailedPrecondition, errors.Code(err))
+	require.Zero(t, st.link.Uses)
+}
+
+func TestRedeemInviteLinkApprovalConsumesUseOnAgree(t *testing.T) {
+	a, st, _ := newTestApplications(true)
+	ctx := context.Background()
+
+	// 待审批的申请不消耗使用次数，被拒绝后可以再次使用
+	res, err := a.RedeemInviteLink(ctx, "joiner", "t")
+	require.Nil(t, err)
+	require.False(t, res.Joined)
+	require.Zero(t, st.link.Uses)
+	res.Request.Status = entity.LogsStatusRefused
+
+	res, err = a.RedeemInviteLink(ctx, "joiner", "t")
+	require.Nil(t, err)
+	require.Zero(t, st.link.Uses)
+
+	require.Nil(t, a.AgreeGroupRequest(ctx, res.Request.ID, "creator"))
+	require.Equal(t, 1, st.link.Uses)
+	require.True(t, st.members["joiner"])
+}
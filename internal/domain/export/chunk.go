@@ -0,0 +1,54 @@
+package export
+
+import (
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// chunkSize 导出文件每个分块的大小
+const chunkSize = 1 << 20
+
+// chunkWriter 将导出文件按chunkSize分块写入数据库，内存中最多保留一个分块
+type chunkWriter struct {
+	storage storage.Storage
+	ses     storage.Session
+	job     *entity.ExportJob
+
+	buf []byte
+	seq int
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := chunkSize - len(c.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		c.buf = append(c.buf, p[:m]...)
+		p = p[m:]
+		if len(c.buf) == chunkSize {
+			if err := c.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close 写入最后一个不满chunkSize的分块
+func (c *chunkWriter) Close() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	return c.flush()
+}
+
+func (c *chunkWriter) flush() error {
+	if err := c.storage.InsertExportJobChunk(c.ses, c.job.ID, c.job.Attempt, c.seq, c.buf); err != nil {
+		return err
+	}
+	c.buf = c.buf[:0]
+	c.seq++
+	return nil
+}
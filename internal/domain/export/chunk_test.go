@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	storage.Storage
+
+	chunks [][]byte
+}
+
+func (s *fakeStorage) InsertExportJobChunk(ses storage.Session, id int64, attempt, seq int, data []byte) error {
+	if seq != len(s.chunks) {
+		panic("chunks out of order")
+	}
+	s.chunks = append(s.chunks, append([]byte(nil), data...))
+	return nil
+}
+
+func TestChunkWriter(t *testing.T) {
+	st := &fakeStorage{}
+	w := &chunkWriter{storage: st, job: &entity.ExportJob{ID: 1, Attempt: 1}}
+
+	data := bytes.Repeat([]byte("0123456789"), chunkSize/4)
+	for i := 0; i < len(data); i += 4096 {
+		end := i + 4096
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err := w.Write(data[i:end])
+		require.Nil(t, err)
+	}
+	require.Nil(t, w.Close())
+
+	require.Len(t, st.chunks, 3)
+	for _, c := range st.chunks[:2] {
+		require.Len(t, c, chunkSize)
+	}
+	require.Equal(t, data, bytes.Join(st.chunks, nil))
+}
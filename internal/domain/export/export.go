@@ -0,0 +1,446 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+type CreateInput struct {
+	Owner   string
+	Kind    string
+	Peer    string
+	GroupID int64
+	Format  string
+}
+
+type Export interface {
+	CreateExportJob(ctx context.Context, input CreateInput) (int64, error)
+	GetExportJob(ctx context.Context, id int64) (*entity.ExportJob, error)
+	ListExportJobs(ctx context.Context, owner string) ([]*entity.ExportJob, error)
+
+	// WriteExportFile 将已完成的导出文件写入w，导出文件是包含聊天记录和附件的zip
+	WriteExportFile(ctx context.Context, job *entity.ExportJob, w io.Writer) error
+
+	// RunPendingJobs 依次执行所有待导出和租约已过期的任务，返回完成的任务数
+	RunPendingJobs(ctx context.Context) (int, error)
+}
+
+const (
+	// pageSize 每次从数据库读取的消息数
+	pageSize = 500
+	// leaseTimeout 导出中的任务超过该时间未续期，视为实例已崩溃，可以被重新领取
+	leaseTimeout = 2 * time.Minute
+)
+
+// attachmentDir 附件在导出文件中所在的目录
+const attachmentDir = "attachments"
+
+func New(logger logger.Logger, storage storage.Storage, attachments attachment.Store) Export {
+	return &export{
+		logger:      logger,
+		storage:     storage,
+		attachments: attachments,
+	}
+}
+
+type export struct {
+	logger logger.Logger
+
+	storage     storage.Storage
+	attachments attachment.Store
+}
+
+// CreateExportJob 创建导出任务，owner必须是私聊的一方或群成员
+func (e *export) CreateExportJob(ctx context.Context, input CreateInput) (int64, error) {
+	switch input.Format {
+	case entity.ExportFormatJSONL, entity.ExportFormatCSV, entity.ExportFormatHTML:
+	default:
+		return 0, errors.Newf(errors.InvalidArgument, nil, "invalid format: %s", input.Format)
+	}
+
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	i := &entity.ExportJob{
+		Owner:  input.Owner,
+		Kind:   input.Kind,
+		Format: input.Format,
+		Status: entity.ExportStatusPending,
+	}
+	switch input.Kind {
+	case entity.RecordKindPrivate:
+		_, err = e.storage.GetUserBySubject(ses, input.Peer)
+		if err != nil {
+			return 0, err
+		}
+		i.Peer = input.Peer
+	case entity.RecordKindGroup:
+		ok, err := e.storage.IsMemberOfGroup(ses, input.Owner, input.GroupID)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+		}
+		i.GroupID = input.GroupID
+	default:
+		return 0, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", input.Kind)
+	}
+
+	id, err := e.storage.InsertExportJob(ses, i)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (e *export) GetExportJob(ctx context.Context, id int64) (*entity.ExportJob, error) {
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.storage.GetExportJob(ses, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (e *export) ListExportJobs(ctx context.Context, owner string) ([]*entity.ExportJob, error) {
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.storage.ListExportJobsByOwner(ses, owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty export jobs with owner: %s", owner)
+	}
+
+	return res, nil
+}
+
+func (e *export) RunPendingJobs(ctx context.Context) (int, error) {
+	n := 0
+	for ctx.Err() == nil {
+		job, err := e.claim(ctx)
+		if err != nil {
+			return n, err
+		}
+		if job == nil {
+			break
+		}
+
+		status, reason := entity.ExportStatusDone, ""
+		name, err := e.run(ctx, job)
+		if err != nil {
+			e.logger.Errorf("export job %d failed: %v", job.ID, err)
+			status, reason = entity.ExportStatusFailed, errors.Code(err).String()
+		}
+
+		ok, err := e.finish(ctx, job, status, name, reason)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			e.logger.Warnf("export job %d was reclaimed by another worker, attempt %d discarded", job.ID, job.Attempt)
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// claim 领取一个待导出或租约已过期的任务并标记为导出中，没有可领取的任务时返回nil
+func (e *export) claim(ctx context.Context) (*entity.ExportJob, error) {
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	jobs, err := e.storage.ListClaimableExportJobsForUpdate(ses, leaseTimeout, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	job := jobs[0]
+	if job.Status == entity.ExportStatusRunning {
+		e.logger.Warnf("export job %d lease expired, reclaiming", job.ID)
+	}
+	if job.Attempt, err = e.storage.ClaimExportJob(ses, job.ID); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// finish 记录导出结果并删除之前中断的导出留下的分块，任务已被其他实例重新领取时返回false
+func (e *export) finish(ctx context.Context, job *entity.ExportJob, status entity.ExportStatus, name, reason string) (bool, error) {
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer ses.Rollback()
+
+	ok, err := e.storage.FinishExportJob(ses, job.ID, job.Attempt, status, name, reason)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err = e.storage.DeleteExportJobChunks(ses, job.ID, job.Attempt); err != nil {
+		return false, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// run 分页读取消息并分块写入数据库，每读一页续期一次租约，返回下载时的文件名。
+// 导出文件是zip，先写入聊天记录，再写入消息引用的附件（表情）
+func (e *export) run(ctx context.Context, job *entity.ExportJob) (string, error) {
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	names := &nicknames{storage: e.storage, ses: ses, cache: make(map[string]string)}
+	title, err := e.title(ses, job, names)
+	if err != nil {
+		return "", err
+	}
+
+	cw := &chunkWriter{storage: e.storage, ses: ses, job: job}
+	zw := zip.NewWriter(cw)
+	f, err := zw.Create(fmt.Sprintf("%d.%s", job.ID, job.Format))
+	if err != nil {
+		return "", errors.New(errors.Internal, err, "write export file failed")
+	}
+	w, err := newTranscriptWriter(job.Format, f, title)
+	if err != nil {
+		return "", errors.New(errors.Internal, err, "write export file failed")
+	}
+	stickers := &stickers{storage: e.storage, ses: ses, cache: make(map[int64]*entity.Sticker)}
+
+	var afterID int64
+	for {
+		if err = e.renew(ses, job); err != nil {
+			return "", err
+		}
+
+		rows, err := e.page(ses, job, afterID)
+		if err != nil {
+			return "", err
+		}
+		for _, r := range rows {
+			r.SenderNickname = names.get(r.Sender)
+			s, err := stickers.get(r.StickerID)
+			if err != nil {
+				return "", err
+			}
+			if s != nil {
+				r.Attachment = path.Join(attachmentDir, path.Base(s.FileKey))
+			}
+			if err = w.Write(r); err != nil {
+				return "", errors.New(errors.Internal, err, "write export file failed")
+			}
+			afterID = r.ID
+		}
+		if len(rows) < pageSize {
+			break
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		return "", errors.New(errors.Internal, err, "write export file failed")
+	}
+	for _, s := range stickers.list {
+		if err = e.writeAttachment(ctx, zw, s.FileKey); err != nil {
+			return "", err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return "", errors.New(errors.Internal, err, "write export file failed")
+	}
+	if err = cw.Close(); err != nil {
+		return "", errors.New(errors.Internal, err, "write export file failed")
+	}
+
+	return fmt.Sprintf("%d.zip", job.ID), nil
+}
+
+// writeAttachment 将附件写入导出文件的attachmentDir目录
+func (e *export) writeAttachment(ctx context.Context, zw *zip.Writer, key string) error {
+	r, err := e.attachments.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.Create(path.Join(attachmentDir, path.Base(key)))
+	if err != nil {
+		return errors.New(errors.Internal, err, "write export file failed")
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		return errors.New(errors.Internal, err, "write export file failed")
+	}
+	return nil
+}
+
+// renew 续期租约，任务已被其他实例重新领取时停止导出
+func (e *export) renew(ses storage.Session, job *entity.ExportJob) error {
+	ok, err := e.storage.RenewExportJobLease(ses, job.ID, job.Attempt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Newf(errors.Canceled, nil, "export job %d was reclaimed", job.ID)
+	}
+	return nil
+}
+
+// WriteExportFile 按顺序将已完成任务的文件分块写入w
+func (e *export) WriteExportFile(ctx context.Context, job *entity.ExportJob, w io.Writer) error {
+	if job.Status != entity.ExportStatusDone {
+		return errors.Newf(errors.FailedPrecondition, nil, "导出任务%s", job.Status.String())
+	}
+
+	ses, err := e.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	for seq := 0; ; seq++ {
+		data, err := e.storage.GetExportJobChunk(ses, job.ID, job.Attempt, seq)
+		if errors.Code(err) == errors.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return errors.New(errors.Internal, err, "write export file failed")
+		}
+	}
+}
+
+func (e *export) page(ses storage.Session, job *entity.ExportJob, afterID int64) ([]*row, error) {
+	var res []*row
+	switch job.Kind {
+	case entity.RecordKindPrivate:
+		rcds, err := e.storage.ListRecordPrivatesByPartyAfter(ses, job.Owner, job.Peer, afterID, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rcds {
+			res = append(res, &row{ID: r.ID, Sender: r.Sender, Receiver: r.Receiver, Content: r.Content, StickerID: r.StickerID, CreatedAt: r.CreatedAt})
+		}
+	case entity.RecordKindGroup:
+		rcds, err := e.storage.ListRecordGroupsByGroupAfter(ses, job.GroupID, afterID, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rcds {
+			res = append(res, &row{ID: r.ID, Sender: r.Sender, Content: r.Content, StickerID: r.StickerID, CreatedAt: r.CreatedAt})
+		}
+	}
+
+	return res, nil
+}
+
+func (e *export) title(ses storage.Session, job *entity.ExportJob, names *nicknames) (string, error) {
+	if job.Kind == entity.RecordKindGroup {
+		g, err := e.storage.GetGroupByID(ses, job.GroupID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("群「%s」的聊天记录", g.Name), nil
+	}
+
+	return fmt.Sprintf("%s与%s的聊天记录", names.get(job.Owner), names.get(job.Peer)), nil
+}
+
+// nicknames 缓存导出过程中已解析的昵称，用户不存在时使用subject
+type nicknames struct {
+	storage storage.Storage
+	ses     storage.Session
+	cache   map[string]string
+}
+
+func (n *nicknames) get(subject string) string {
+	if name, ok := n.cache[subject]; ok {
+		return name
+	}
+
+	name := subject
+	if u, err := n.storage.GetUserBySubject(n.ses, subject); err == nil {
+		name = u.Nickname
+	}
+	n.cache[subject] = name
+	return name
+}
+
+// stickers 缓存导出过程中消息引用的表情，list按首次引用的顺序保存需要写入导出文件的表情，
+// 表情已不存在时不导出附件
+type stickers struct {
+	storage storage.Storage
+	ses     storage.Session
+	cache   map[int64]*entity.Sticker
+	list    []*entity.Sticker
+}
+
+func (s *stickers) get(id int64) (*entity.Sticker, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	if st, ok := s.cache[id]; ok {
+		return st, nil
+	}
+
+	st, err := s.storage.GetSticker(s.ses, id)
+	switch {
+	case errors.Code(err) == errors.NotFound:
+		st = nil
+	case err != nil:
+		return nil, err
+	default:
+		s.list = append(s.list, st)
+	}
+	s.cache[id] = st
+	return st, nil
+}
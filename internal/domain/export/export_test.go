@@ -0,0 +1,91 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exportStorage a与b的私聊中有一条文字消息、一条表情消息和一条引用已删除表情的消息
+type exportStorage struct {
+	fakeStorage
+}
+
+func (s *exportStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	return nil, nil
+}
+
+func (s *exportStorage) GetUserBySubject(ses storage.Session, subject string) (*entity.User, error) {
+	return &entity.User{Subject: subject, Nickname: strings.ToUpper(subject)}, nil
+}
+
+func (s *exportStorage) RenewExportJobLease(ses storage.Session, id int64, attempt int) (bool, error) {
+	return true, nil
+}
+
+func (s *exportStorage) ListRecordPrivatesByPartyAfter(ses storage.Session, subject1, subject2 string, afterID int64, limit int) ([]*entity.RecordPrivate, error) {
+	if afterID > 0 {
+		return nil, nil
+	}
+	return []*entity.RecordPrivate{
+		{ID: 1, Sender: "a", Receiver: "b", Content: "hi"},
+		{ID: 2, Sender: "b", Receiver: "a", Content: "[表情] ok", StickerID: 7},
+		{ID: 3, Sender: "a", Receiver: "b", Content: "[表情] gone", StickerID: 8},
+	}, nil
+}
+
+func (s *exportStorage) GetSticker(ses storage.Session, id int64) (*entity.Sticker, error) {
+	if id != 7 {
+		return nil, errors.Newf(errors.NotFound, nil, "no sticker with id: %d found", id)
+	}
+	return &entity.Sticker{ID: 7, Name: "ok", FileKey: "stickers/abc.png"}, nil
+}
+
+type fakeAttachments struct {
+	attachment.Store
+}
+
+func (a *fakeAttachments) Open(ctx context.Context, key string) (io.ReadSeeker, error) {
+	return strings.NewReader("png:" + key), nil
+}
+
+func TestRunBundlesAttachments(t *testing.T) {
+	st := &exportStorage{}
+	e := &export{storage: st, attachments: &fakeAttachments{}}
+	job := &entity.ExportJob{ID: 1, Attempt: 1, Owner: "a", Kind: entity.RecordKindPrivate, Peer: "b", Format: entity.ExportFormatCSV}
+
+	name, err := e.run(context.Background(), job)
+	require.Nil(t, err)
+	require.Equal(t, "1.zip", name)
+
+	data := bytes.Join(st.chunks, nil)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.Nil(t, err)
+	require.Len(t, zr.File, 2)
+	require.Equal(t, "1.csv", zr.File[0].Name)
+	require.Equal(t, "attachments/abc.png", zr.File[1].Name)
+
+	transcript := readZipFile(t, zr.File[0])
+	require.Contains(t, transcript, "[表情] ok,attachments/abc.png,")
+	require.Contains(t, transcript, "[表情] gone,,")
+	require.Equal(t, "png:stickers/abc.png", readZipFile(t, zr.File[1]))
+}
+
+func readZipFile(t *testing.T, f *zip.File) string {
+	r, err := f.Open()
+	require.Nil(t, err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	require.Nil(t, err)
+	return string(b)
+}
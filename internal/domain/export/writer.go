@@ -0,0 +1,123 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+// row 导出的一条消息，发送者昵称已解析
+type row struct {
+	ID             int64     `json:"id"`
+	Sender         string    `json:"sender"`
+	SenderNickname string    `json:"sender_nickname"`
+	Receiver       string    `json:"receiver,omitempty"`
+	Content        string    `json:"content"`
+	Attachment     string    `json:"attachment,omitempty"` // 附件在导出文件中的路径
+	CreatedAt      time.Time `json:"created_at"`
+
+	StickerID int64 `json:"-"`
+}
+
+// transcriptWriter 逐条写出消息，不在内存中保留整个会话
+type transcriptWriter interface {
+	Write(r *row) error
+	Close() error
+}
+
+func newTranscriptWriter(format string, w io.Writer, title string) (transcriptWriter, error) {
+	switch format {
+	case entity.ExportFormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	case entity.ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "sender", "sender_nickname", "receiver", "content", "attachment", "created_at"}); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	case entity.ExportFormatHTML:
+		hw := &htmlWriter{w: bufio.NewWriter(w)}
+		if err := hw.header(title); err != nil {
+			return nil, err
+		}
+		return hw, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(r *row) error {
+	return j.enc.Encode(r)
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(r *row) error {
+	return c.w.Write([]string{
+		strconv.FormatInt(r.ID, 10),
+		r.Sender,
+		r.SenderNickname,
+		r.Receiver,
+		r.Content,
+		r.Attachment,
+		r.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// htmlWriter 生成不依赖外部资源的单文件聊天记录，附件以相对路径引用导出文件中的文件
+type htmlWriter struct {
+	w *bufio.Writer
+}
+
+const htmlStyle = `body{font-family:sans-serif;max-width:760px;margin:2em auto;color:#222}
+.msg{padding:.5em 0;border-bottom:1px solid #eee}
+.meta{color:#888;font-size:.85em}
+.content{white-space:pre-wrap;margin-top:.25em}
+.content img{max-width:160px}`
+
+func (h *htmlWriter) header(title string) error {
+	_, err := fmt.Fprintf(h.w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n",
+		html.EscapeString(title), htmlStyle, html.EscapeString(title))
+	return err
+}
+
+func (h *htmlWriter) Write(r *row) error {
+	content := html.EscapeString(r.Content)
+	if r.Attachment != "" {
+		content = fmt.Sprintf("<img src=\"%s\" alt=\"%s\">", html.EscapeString(r.Attachment), content)
+	}
+	_, err := fmt.Fprintf(h.w, "<div class=\"msg\"><div class=\"meta\"><b>%s</b> (%s) %s</div><div class=\"content\">%s</div></div>\n",
+		html.EscapeString(r.SenderNickname), html.EscapeString(r.Sender), r.CreatedAt.Format("2006-01-02 15:04:05"), content)
+	return err
+}
+
+func (h *htmlWriter) Close() error {
+	if _, err := h.w.WriteString("</body>\n</html>\n"); err != nil {
+		return err
+	}
+	return h.w.Flush()
+}
@@ -0,0 +1,89 @@
+package group
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// checkCapacity 检查群能否再加入adding个成员，调用方须已通过GetGroupByIDForUpdate锁住群
+func (g *group) checkCapacity(ses storage.Session, grp *entity.Group, adding int) error {
+	n, err := g.storage.CountGroupMembers(ses, grp.ID)
+	if err != nil {
+		return err
+	}
+	if limit := grp.MaxMembers(g.capacityTiers); n+adding > limit {
+		return errors.Newf(errors.ResourceExhausted, nil, "群[%d]已满：当前%d人，上限%d人，请提升容量档位", grp.ID, n, limit)
+	}
+
+	return nil
+}
+
+func (g *group) Capacity(ctx context.Context, groupID int64) (*entity.GroupCapacity, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grp, err := g.storage.GetGroupByID(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.capacityOf(ses, grp)
+}
+
+func (g *group) capacityOf(ses storage.Session, grp *entity.Group) (*entity.GroupCapacity, error) {
+	n, err := g.storage.CountGroupMembers(ses, grp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.GroupCapacity{
+		GroupID:    grp.ID,
+		Tier:       grp.CapacityTier,
+		MaxMembers: grp.MaxMembers(g.capacityTiers),
+		Members:    n,
+		Tiers:      g.capacityTiers,
+	}, nil
+}
+
+// RaiseCapacityTier 将群提升到更高的容量档位，不能降低档位
+func (g *group) RaiseCapacityTier(ctx context.Context, groupID int64, tier int) (*entity.GroupCapacity, error) {
+	if tier < 0 || tier >= len(g.capacityTiers) {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "容量档位须在0到%d之间", len(g.capacityTiers)-1)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if tier <= grp.CapacityTier {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "群[%d]当前已是第%d档，只能提升容量档位", groupID, grp.CapacityTier)
+	}
+	if err = g.storage.UpdateGroupCapacityTier(ses, groupID, tier); err != nil {
+		return nil, err
+	}
+	grp.CapacityTier = tier
+
+	res, err := g.capacityOf(ses, grp)
+	if err != nil {
+		return nil, err
+	}
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
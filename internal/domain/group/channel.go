@@ -0,0 +1,165 @@
+package group
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	maxChannelsPerGroup = 32
+	maxChannelNameLen   = 32
+	maxChannelTopicLen  = 256
+)
+
+// ChannelInput 新建或修改频道的内容
+type ChannelInput struct {
+	Name      string
+	Topic     string
+	AdminOnly bool // 只有拥有manage权限的成员可以发言
+}
+
+func (i *ChannelInput) normalize() error {
+	i.Name = strings.TrimSpace(i.Name)
+	i.Topic = strings.TrimSpace(i.Topic)
+	if i.Name == "" || utf8.RuneCountInString(i.Name) > maxChannelNameLen {
+		return errors.Newf(errors.InvalidArgument, nil, "频道名称不能为空且不能超过%d个字符", maxChannelNameLen)
+	}
+	if utf8.RuneCountInString(i.Topic) > maxChannelTopicLen {
+		return errors.Newf(errors.InvalidArgument, nil, "频道话题不能超过%d个字符", maxChannelTopicLen)
+	}
+	return nil
+}
+
+// CreateChannel 在群内新建频道，同一个群内频道名称不能重复
+func (g *group) CreateChannel(ctx context.Context, groupID int64, createdBy string, input ChannelInput) (*entity.GroupChannel, error) {
+	if err := input.normalize(); err != nil {
+		return nil, err
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 锁住群，避免并发创建超过上限
+	if _, err = g.storage.GetGroupByIDForUpdate(ses, groupID); err != nil {
+		return nil, err
+	}
+	channels, err := g.storage.ListGroupChannelsByGroup(ses, groupID, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) >= maxChannelsPerGroup {
+		return nil, errors.Newf(errors.ResourceExhausted, nil, "每个群最多%d个频道", maxChannelsPerGroup)
+	}
+
+	ch := &entity.GroupChannel{
+		GroupID:   groupID,
+		Name:      input.Name,
+		Topic:     input.Topic,
+		AdminOnly: input.AdminOnly,
+		CreatedBy: createdBy,
+	}
+	if err = g.storage.InsertGroupChannel(ses, ch); err != nil {
+		if errors.Code(err) == errors.AlreadyExists {
+			return nil, errors.Newf(errors.AlreadyExists, err, "频道[%s]已存在", input.Name)
+		}
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// UpdateChannel 修改频道的名称、话题以及是否只有拥有manage权限的成员可以发言
+func (g *group) UpdateChannel(ctx context.Context, groupID, channelID int64, input ChannelInput) (*entity.GroupChannel, error) {
+	if err := input.normalize(); err != nil {
+		return nil, err
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := g.channelOf(ses, groupID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	ch.Name, ch.Topic, ch.AdminOnly = input.Name, input.Topic, input.AdminOnly
+	if err = g.storage.UpdateGroupChannel(ses, ch); err != nil {
+		if errors.Code(err) == errors.AlreadyExists {
+			return nil, errors.Newf(errors.AlreadyExists, err, "频道[%s]已存在", input.Name)
+		}
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// ListChannels 列出群内的频道，附带subject在各频道的已读位置和未读数
+func (g *group) ListChannels(ctx context.Context, groupID int64, subject string) ([]*entity.GroupChannel, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.storage.ListGroupChannelsByGroup(ses, groupID, subject)
+}
+
+// MarkChannelRead 将subject在频道内的已读位置前移到seq，seq为0或超过最后一条消息时标记为全部已读
+func (g *group) MarkChannelRead(ctx context.Context, groupID, channelID int64, subject string, seq int64) error {
+	if seq < 0 {
+		return errors.Newf(errors.InvalidArgument, nil, "invalid seq: %d", seq)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	ch, err := g.channelOf(ses, groupID, channelID)
+	if err != nil {
+		return err
+	}
+
+	// 还没有消息的频道没有会话
+	var lastSeq int64
+	conv, err := g.storage.GetGroupConversation(ses, groupID, ch.ID)
+	if err != nil && errors.Code(err) != errors.NotFound {
+		return err
+	}
+	if conv != nil {
+		lastSeq = conv.LastSeq
+	}
+	if seq == 0 || seq > lastSeq {
+		seq = lastSeq
+	}
+
+	return g.storage.UpsertGroupChannelRead(ses, ch.ID, subject, seq, time.Now().UTC())
+}
+
+func (g *group) channelOf(ses storage.Session, groupID, channelID int64) (*entity.GroupChannel, error) {
+	ch, err := g.storage.GetGroupChannel(ses, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch.GroupID != groupID {
+		return nil, errors.Newf(errors.NotFound, nil, "群[%d]没有频道[%d]", groupID, channelID)
+	}
+
+	return ch, nil
+}
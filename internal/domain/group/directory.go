@@ -0,0 +1,73 @@
+package group
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+
+	// directoryActivityWindow 统计活跃度的时间窗口
+	directoryActivityWindow = 7 * 24 * time.Hour
+)
+
+type DirectoryInput struct {
+	Query  string
+	Type   *entity.GroupType
+	Sort   string // popular或recent，默认popular
+	Offset int
+	Limit  int
+}
+
+// SearchDirectory 检索公开群目录，返回结果和下一页的offset，没有下一页时为0。
+// 成员数和活跃度随时在变化，游标无法保证稳定，所以按offset分页
+func (g *group) SearchDirectory(ctx context.Context, input DirectoryInput) ([]*entity.GroupDirectoryEntry, int, error) {
+	switch input.Sort {
+	case "":
+		input.Sort = entity.GroupDirectorySortPopular
+	case entity.GroupDirectorySortPopular, entity.GroupDirectorySortRecent:
+	default:
+		return nil, 0, errors.Newf(errors.InvalidArgument, nil, "invalid sort: %s", input.Sort)
+	}
+	if input.Offset < 0 {
+		return nil, 0, errors.New(errors.InvalidArgument, nil, "invalid offset")
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultDirectoryLimit
+	}
+	if limit > maxDirectoryLimit {
+		limit = maxDirectoryLimit
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := &entity.GroupDirectoryFilter{
+		Query:       strings.TrimSpace(input.Query),
+		Type:        input.Type,
+		Sort:        input.Sort,
+		ActiveSince: time.Now().UTC().Add(-directoryActivityWindow),
+		Offset:      input.Offset,
+		Limit:       limit,
+	}
+	res, err := g.storage.SearchGroupDirectory(ses, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next int
+	if len(res) == limit {
+		next = input.Offset + limit
+	}
+
+	return res, next, nil
+}
@@ -2,10 +2,16 @@ package group
 
 import (
 	"context"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
 	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/infras/logger"
 	"fangaoxs.com/go-chat/internal/storage"
 )
 
@@ -22,25 +28,84 @@ type Group interface {
 	DeleteGroup(ctx context.Context, id int64) error
 	MakeGroupPrivate(ctx context.Context, id int64) error
 	MakeGroupPublic(ctx context.Context, id int64) error
+	SetJoinPolicy(ctx context.Context, id int64, policy entity.GroupJoinPolicy, question string) error
 	ListGroupsOfUser(ctx context.Context, userSubject string) ([]*entity.Group, error)
+	SearchDirectory(ctx context.Context, input DirectoryInput) ([]*entity.GroupDirectoryEntry, int, error)
 
 	AssignMembersToGroup(ctx context.Context, groupID int64, userSubject ...string) error
 	RemoveMembersFromGroup(ctx context.Context, groupID int64, userSubject ...string) error
 	IsMemberOfGroup(ctx context.Context, groupID int64, memberSubject string) (bool, error)
 	ListMembersOfGroup(ctx context.Context, groupID int64) ([]*entity.User, error)
+	ListMemberSubjectsOfGroup(ctx context.Context, groupID int64) ([]string, error)
+	Capacity(ctx context.Context, groupID int64) (*entity.GroupCapacity, error)
+	RaiseCapacityTier(ctx context.Context, groupID int64, tier int) (*entity.GroupCapacity, error)
 
 	AssignAdminsToGroup(ctx context.Context, groupID int64, adminSubject ...string) error
 	RemoveAdminsFromGroup(ctx context.Context, groupID int64, adminSubject ...string) error
 	IsAdminOfGroup(ctx context.Context, groupID int64, memberSubject string) (bool, error)
 	ListAdminsOfGroup(ctx context.Context, groupID int64) ([]*entity.User, error)
+
+	Authorize(ctx context.Context, groupID int64, subject string, perm entity.GroupPermission) error
+	ListGroupRoles(ctx context.Context, groupID int64) ([]*entity.GroupRole, error)
+	SaveGroupRole(ctx context.Context, groupID int64, name string, perms []entity.GroupPermission) (*entity.GroupRole, error)
+	DeleteGroupRole(ctx context.Context, groupID int64, name string) error
+	AssignRole(ctx context.Context, groupID int64, role string, subjects ...string) error
+	RenameGroup(ctx context.Context, groupID int64, name string) error
+
+	UpdateProfile(ctx context.Context, groupID int64, description string, tags []string) (*entity.Group, error)
+	SetAvatar(ctx context.Context, groupID int64, body io.Reader) (*entity.Group, error)
+	OpenAvatar(ctx context.Context, groupID int64) (io.ReadSeeker, error)
+	GetGroupMember(ctx context.Context, groupID int64, subject string) (*entity.GroupMember, error)
+	SetNickname(ctx context.Context, groupID int64, subject, nickname string) error
+
+	TransferOwnership(ctx context.Context, groupID int64, from, to string) (*entity.GroupOwnerLog, error)
+	LeaveGroup(ctx context.Context, groupID int64, subject string) (*entity.GroupOwnerLog, error)
+	ListOwnerHistory(ctx context.Context, groupID int64) ([]*entity.GroupOwnerLog, error)
+
+	MuteMember(ctx context.Context, groupID int64, operator, subject string, d time.Duration) (time.Time, error)
+	UnmuteMember(ctx context.Context, groupID int64, operator, subject string) (bool, error)
+	SetMuteAll(ctx context.Context, groupID int64, muted bool) (bool, error)
+	SetSlowMode(ctx context.Context, groupID int64, d time.Duration) (bool, error)
+	BanMember(ctx context.Context, groupID int64, operator, subject string, d time.Duration) (*entity.GroupBan, error)
+	UnbanMember(ctx context.Context, groupID int64, subject string) error
+	ListBans(ctx context.Context, groupID int64) ([]*entity.GroupBan, error)
+	LiftExpiredModeration(ctx context.Context) ([]*entity.GroupMember, []*entity.GroupBan, error)
+
+	CreateChannel(ctx context.Context, groupID int64, createdBy string, input ChannelInput) (*entity.GroupChannel, error)
+	UpdateChannel(ctx context.Context, groupID, channelID int64, input ChannelInput) (*entity.GroupChannel, error)
+	ListChannels(ctx context.Context, groupID int64, subject string) ([]*entity.GroupChannel, error)
+	MarkChannelRead(ctx context.Context, groupID, channelID int64, subject string, seq int64) error
+
+	PinRecord(ctx context.Context, groupID, recordID int64, pinnedBy string) (*entity.GroupPin, error)
+	UnpinRecord(ctx context.Context, groupID, recordID int64) error
+	ListPinsOfGroup(ctx context.Context, groupID int64) ([]*entity.GroupPin, error)
+
+	UpdateAnnouncement(ctx context.Context, groupID int64, content, editedBy string) error
+	ListAnnouncementHistory(ctx context.Context, groupID int64) ([]*entity.GroupAnnouncementLog, error)
 }
 
-func New(env environment.Env, storage storage.Storage) (Group, error) {
-	return &group{storage: storage}, nil
+// MaxPinsPerGroup 每个群最多置顶的消息数
+const MaxPinsPerGroup = 10
+
+const maxJoinQuestionLen = 256
+
+// MaxAnnouncementLen 群公告的最大长度
+const MaxAnnouncementLen = 1024
+
+func New(env environment.Env, logger logger.Logger, storage storage.Storage, attachments attachment.Store) (Group, error) {
+	return &group{
+		logger:        logger,
+		storage:       storage,
+		attachments:   attachments,
+		capacityTiers: env.GroupCapacityTiers,
+	}, nil
 }
 
 type group struct {
-	storage storage.Storage
+	logger        logger.Logger
+	storage       storage.Storage
+	attachments   attachment.Store
+	capacityTiers []int
 }
 
 func (g *group) CreateGroup(ctx context.Context, input CreateGroupInput) (int64, error) {
@@ -67,7 +132,7 @@ func (g *group) CreateGroup(ctx context.Context, input CreateGroupInput) (int64,
 	e := &entity.GroupMember{
 		UserSubject: input.CreatedBy,
 		GroupID:     gID,
-		IsAdmin:     true,
+		Role:        entity.GroupRoleOwner,
 	}
 	if err = g.storage.InsertGroupMember(ses, e); err != nil {
 		return 0, err
@@ -117,20 +182,33 @@ func (g *group) DeleteGroup(ctx context.Context, id int64) error {
 		return err
 	}
 
+	grp, err := g.storage.GetGroupByID(ses, id)
+	if err != nil {
+		return err
+	}
+
 	err = g.storage.DeleteGroupMembersByGroupID(ses, id)
 	if err != nil {
 		return err
 	}
 
-	err = g.storage.DeleteGroup(ses, id)
+	err = g.storage.DeleteInboxEntriesByGroup(ses, id)
 	if err != nil {
 		return err
 	}
 
-	if err = ses.Commit(); err != nil {
+	err = g.storage.DeleteGroup(ses, id)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	if grp.Avatar != "" {
+		if err = g.attachments.Delete(storage.WithContext(ctx, ses), grp.Avatar); err != nil {
+			return err
+		}
+	}
+
+	return ses.Commit()
 }
 
 func (g *group) MakeGroupPrivate(ctx context.Context, id int64) error {
@@ -161,6 +239,30 @@ func (g *group) MakeGroupPublic(ctx context.Context, id int64) error {
 	return nil
 }
 
+// SetJoinPolicy 修改入群方式，question方式必须设置问题，其他方式会清空问题
+func (g *group) SetJoinPolicy(ctx context.Context, id int64, policy entity.GroupJoinPolicy, question string) error {
+	if !policy.Valid() {
+		return errors.Newf(errors.InvalidArgument, nil, "invalid join policy: %s", policy)
+	}
+	question = strings.TrimSpace(question)
+	if policy != entity.GroupJoinQuestion {
+		question = ""
+	} else if question == "" || utf8.RuneCountInString(question) > maxJoinQuestionLen {
+		return errors.Newf(errors.InvalidArgument, nil, "入群问题不能为空且不能超过%d个字符", maxJoinQuestionLen)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = g.storage.GetGroupByID(ses, id); err != nil {
+		return err
+	}
+
+	return g.storage.UpdateGroupJoinPolicy(ses, id, policy, question)
+}
+
 func (g *group) ListGroupsOfUser(ctx context.Context, userSubject string) ([]*entity.Group, error) {
 	ses, err := g.storage.NewSession(ctx)
 	if err != nil {
@@ -198,12 +300,21 @@ func (g *group) AssignMembersToGroup(ctx context.Context, groupID int64, userSub
 	if err != nil {
 		return err
 	}
+	defer ses.Rollback()
+
+	// 锁住群，避免并发加入超过成员上限
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return err
+	}
+	if err = g.checkCapacity(ses, grp, len(userSubject)); err != nil {
+		return err
+	}
 
 	for _, subject := range userSubject {
 		i := &entity.GroupMember{
 			UserSubject: subject,
 			GroupID:     groupID,
-			IsAdmin:     false,
 		}
 		err = g.storage.InsertGroupMember(ses, i)
 		if err != nil {
@@ -228,10 +339,23 @@ func (g *group) RemoveMembersFromGroup(ctx context.Context, groupID int64, userS
 	}
 
 	for _, subject := range userSubject {
+		gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+		if err != nil {
+			return err
+		}
+		if gm.Role == entity.GroupRoleOwner {
+			return errors.New(errors.FailedPrecondition, nil, "不能移除群主")
+		}
+
 		err = g.storage.DeleteGroupMember(ses, subject, groupID)
 		if err != nil {
 			return err
 		}
+
+		err = g.storage.DeleteInboxEntry(ses, subject, entity.RecordKindGroup, "", groupID)
+		if err != nil {
+			return err
+		}
 	}
 
 	if err = ses.Commit(); err != nil {
@@ -282,66 +406,32 @@ func (g *group) ListMembersOfGroup(ctx context.Context, groupID int64) ([]*entit
 	return members, nil
 }
 
-func (g *group) AssignAdminsToGroup(ctx context.Context, groupID int64, adminSubject ...string) error {
+// ListMemberSubjectsOfGroup 只查询成员的subject，用于推送等不需要用户资料的场景
+func (g *group) ListMemberSubjectsOfGroup(ctx context.Context, groupID int64) ([]string, error) {
 	ses, err := g.storage.NewSession(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ses, err = ses.Begin()
+
+	gms, err := g.storage.ListGroupMembersByGroupID(ses, groupID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, subject := range adminSubject {
-		ok, err := g.storage.IsMemberOfGroup(ses, subject, groupID)
-		if err != nil {
-			return err
-		}
-		if !ok {
-			return errors.Newf(errors.NotFound, nil, "[%s]不在[%d]群里", subject, groupID)
-		}
-
-		err = g.storage.UpdateGroupMemberIsAdmin(ses, subject, groupID, true)
-		if err != nil {
-			return err
-		}
+	res := make([]string, 0, len(gms))
+	for _, gm := range gms {
+		res = append(res, gm.UserSubject)
 	}
 
-	if err = ses.Commit(); err != nil {
-		return err
-	}
-	return nil
+	return res, nil
 }
 
-func (g *group) RemoveAdminsFromGroup(ctx context.Context, groupID int64, adminSubject ...string) error {
-	ses, err := g.storage.NewSession(ctx)
-	if err != nil {
-		return err
-	}
-	ses, err = ses.Begin()
-	if err != nil {
-		return err
-	}
-
-	for _, subject := range adminSubject {
-		ok, err := g.storage.IsMemberOfGroup(ses, subject, groupID)
-		if err != nil {
-			return err
-		}
-		if !ok {
-			return errors.Newf(errors.NotFound, nil, "[%s]不在[%d]群里", subject, groupID)
-		}
-
-		err = g.storage.UpdateGroupMemberIsAdmin(ses, subject, groupID, false)
-		if err != nil {
-			return err
-		}
-	}
+func (g *group) AssignAdminsToGroup(ctx context.Context, groupID int64, adminSubject ...string) error {
+	return g.AssignRole(ctx, groupID, entity.GroupRoleAdmin, adminSubject...)
+}
 
-	if err = ses.Commit(); err != nil {
-		return err
-	}
-	return nil
+func (g *group) RemoveAdminsFromGroup(ctx context.Context, groupID int64, adminSubject ...string) error {
+	return g.AssignRole(ctx, groupID, entity.GroupRoleMember, adminSubject...)
 }
 
 func (g *group) IsAdminOfGroup(ctx context.Context, groupID int64, memberSubject string) (bool, error) {
@@ -385,3 +475,138 @@ func (g *group) ListAdminsOfGroup(ctx context.Context, groupID int64) ([]*entity
 
 	return members, nil
 }
+
+// PinRecord 置顶群消息，置顶数量达到MaxPinsPerGroup时拒绝
+func (g *group) PinRecord(ctx context.Context, groupID, recordID int64, pinnedBy string) (*entity.GroupPin, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 锁住群，避免并发置顶超过上限
+	if _, err = g.storage.GetGroupByIDForUpdate(ses, groupID); err != nil {
+		return nil, err
+	}
+
+	rcd, err := g.storage.GetRecordGroupByID(ses, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if rcd.GroupID != groupID {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "消息[%d]不属于群[%d]", recordID, groupID)
+	}
+
+	count, err := g.storage.CountGroupPinsByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxPinsPerGroup {
+		return nil, errors.Newf(errors.ResourceExhausted, nil, "群[%d]最多置顶%d条消息", groupID, MaxPinsPerGroup)
+	}
+
+	pin := &entity.GroupPin{
+		GroupID:  groupID,
+		RecordID: recordID,
+		PinnedBy: pinnedBy,
+		Record:   rcd,
+	}
+	if err = g.storage.InsertGroupPin(ses, pin); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+func (g *group) UnpinRecord(ctx context.Context, groupID, recordID int64) error {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	ok, err := g.storage.DeleteGroupPin(ses, groupID, recordID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Newf(errors.NotFound, nil, "消息[%d]没有在群[%d]置顶", recordID, groupID)
+	}
+
+	return nil
+}
+
+func (g *group) ListPinsOfGroup(ctx context.Context, groupID int64) ([]*entity.GroupPin, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := g.storage.ListGroupPinsByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty pins of group: %d", groupID)
+	}
+
+	return res, nil
+}
+
+// UpdateAnnouncement 更新群公告并记录编辑历史，content为空时清除公告
+func (g *group) UpdateAnnouncement(ctx context.Context, groupID int64, content, editedBy string) error {
+	if utf8.RuneCountInString(content) > MaxAnnouncementLen {
+		return errors.Newf(errors.InvalidArgument, nil, "群公告不能超过%d个字符", MaxAnnouncementLen)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return err
+	}
+	defer ses.Rollback()
+
+	if err = g.storage.UpdateGroupAnnouncement(ses, groupID, content); err != nil {
+		return err
+	}
+
+	i := &entity.GroupAnnouncementLog{
+		GroupID:  groupID,
+		Content:  content,
+		EditedBy: editedBy,
+	}
+	if err = g.storage.InsertGroupAnnouncementLog(ses, i); err != nil {
+		return err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (g *group) ListAnnouncementHistory(ctx context.Context, groupID int64) ([]*entity.GroupAnnouncementLog, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := g.storage.ListGroupAnnouncementLogsByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty announcement history of group: %d", groupID)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,41 @@
+package group
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// pinStorage 群1只置顶了消息1
+type pinStorage struct {
+	storage.Storage
+}
+
+func (s *pinStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	return nil, nil
+}
+
+func (s *pinStorage) DeleteGroupPin(ses storage.Session, groupID, recordID int64) (bool, error) {
+	return groupID == 1 && recordID == 1, nil
+}
+
+func TestUnpinRecordNotPinned(t *testing.T) {
+	g := &group{storage: &pinStorage{}}
+	if err := g.UnpinRecord(context.Background(), 1, 1); err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if err := g.UnpinRecord(context.Background(), 1, 2); errors.Code(err) != errors.NotFound {
+		t.Errorf("expected %v, but got %v", errors.NotFound, err)
+	}
+}
+
+func TestUpdateAnnouncementTooLong(t *testing.T) {
+	g := &group{}
+	err := g.UpdateAnnouncement(context.Background(), 1, strings.Repeat("公", MaxAnnouncementLen+1), "owner")
+	if errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected %v, but got %v", errors.InvalidArgument, err)
+	}
+}
@@ -0,0 +1,278 @@
+package group
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	// MaxMuteDuration 单次禁言的最长时间
+	MaxMuteDuration = 30 * 24 * time.Hour
+	// MaxSlowMode 慢速模式的最长间隔
+	MaxSlowMode = time.Hour
+
+	liftBatchSize = 100
+)
+
+// MuteMember 禁言成员d时长，重复禁言时以最后一次为准
+func (g *group) MuteMember(ctx context.Context, groupID int64, operator, subject string, d time.Duration) (time.Time, error) {
+	if d <= 0 || d > MaxMuteDuration {
+		return time.Time{}, errors.Newf(errors.InvalidArgument, nil, "禁言时长须大于0且不能超过%d天", int(MaxMuteDuration/(24*time.Hour)))
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer ses.Rollback()
+
+	gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err = g.checkModerationTarget(ses, groupID, operator, gm); err != nil {
+		return time.Time{}, err
+	}
+
+	until := time.Now().UTC().Add(d)
+	if err = g.storage.UpdateGroupMemberMutedUntil(ses, subject, groupID, &until); err != nil {
+		return time.Time{}, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// checkModerationTarget 不能处理自己和群主，只有群主可以处理管理员
+func (g *group) checkModerationTarget(ses storage.Session, groupID int64, operator string, target *entity.GroupMember) error {
+	if target.UserSubject == operator {
+		return errors.New(errors.InvalidArgument, nil, "无法操作自己")
+	}
+	if target.Role == entity.GroupRoleOwner {
+		return errors.New(errors.PermissionDenied, nil, "不能处理群主")
+	}
+	if target.Role != entity.GroupRoleAdmin {
+		return nil
+	}
+
+	op, err := g.storage.GetGroupMember(ses, operator, groupID)
+	if err != nil {
+		return err
+	}
+	if op.Role != entity.GroupRoleOwner {
+		return errors.New(errors.PermissionDenied, nil, "只有群主可以处理管理员")
+	}
+
+	return nil
+}
+
+// UnmuteMember 解除禁言，与禁言一样不能处理自己和群主，只有群主可以处理管理员，返回成员之前是否处于禁言中
+func (g *group) UnmuteMember(ctx context.Context, groupID int64, operator, subject string) (bool, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+	if err != nil {
+		return false, err
+	}
+	if err = g.checkModerationTarget(ses, groupID, operator, gm); err != nil {
+		return false, err
+	}
+	if gm.MutedUntil == nil {
+		return false, nil
+	}
+
+	if err = g.storage.UpdateGroupMemberMutedUntil(ses, subject, groupID, nil); err != nil {
+		return false, err
+	}
+
+	return gm.Muted(time.Now().UTC()), nil
+}
+
+// SetMuteAll 开启或关闭全员禁言，拥有禁言权限的成员不受限制，返回设置是否有变化
+func (g *group) SetMuteAll(ctx context.Context, groupID int64, muted bool) (bool, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer ses.Rollback()
+
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return false, err
+	}
+	if grp.MutedAll == muted {
+		return false, nil
+	}
+
+	if err = g.storage.UpdateGroupMutedAll(ses, groupID, muted); err != nil {
+		return false, err
+	}
+
+	return true, ses.Commit()
+}
+
+// SetSlowMode 设置慢速模式的间隔，d为0时关闭，返回设置是否有变化
+func (g *group) SetSlowMode(ctx context.Context, groupID int64, d time.Duration) (bool, error) {
+	if d < 0 || d > MaxSlowMode || d%time.Second != 0 {
+		return false, errors.Newf(errors.InvalidArgument, nil, "慢速模式的间隔须为0到%d秒的整数秒", int(MaxSlowMode/time.Second))
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	grp, err := g.storage.GetGroupByID(ses, groupID)
+	if err != nil {
+		return false, err
+	}
+	seconds := int(d / time.Second)
+	if grp.SlowMode == seconds {
+		return false, nil
+	}
+
+	return true, g.storage.UpdateGroupSlowMode(ses, groupID, seconds)
+}
+
+// BanMember 封禁用户d时长并将其移出群，d为0时永久封禁；被封禁的用户不能申请或被邀请入群
+func (g *group) BanMember(ctx context.Context, groupID int64, operator, subject string, d time.Duration) (*entity.GroupBan, error) {
+	if d < 0 {
+		return nil, errors.New(errors.InvalidArgument, nil, "封禁时长不能小于0")
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	if _, err = g.storage.GetUserBySubject(ses, subject); err != nil {
+		return nil, err
+	}
+
+	// 允许封禁还不在群里的用户
+	gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+	if err != nil && errors.Code(err) != errors.NotFound {
+		return nil, err
+	}
+	if gm != nil {
+		if err = g.checkModerationTarget(ses, groupID, operator, gm); err != nil {
+			return nil, err
+		}
+		if err = g.storage.DeleteGroupMember(ses, subject, groupID); err != nil {
+			return nil, err
+		}
+		if err = g.storage.DeleteInboxEntry(ses, subject, entity.RecordKindGroup, "", groupID); err != nil {
+			return nil, err
+		}
+	} else if subject == operator {
+		return nil, errors.New(errors.InvalidArgument, nil, "无法操作自己")
+	}
+
+	ban := &entity.GroupBan{
+		GroupID:     groupID,
+		UserSubject: subject,
+		BannedBy:    operator,
+	}
+	if d > 0 {
+		expiresAt := time.Now().UTC().Add(d)
+		ban.ExpiresAt = &expiresAt
+	}
+	if err = g.storage.UpsertGroupBan(ses, ban); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return ban, nil
+}
+
+func (g *group) UnbanMember(ctx context.Context, groupID int64, subject string) error {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	ok, err := g.storage.DeleteGroupBan(ses, groupID, subject)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Newf(errors.NotFound, nil, "[%s]没有被群[%d]封禁", subject, groupID)
+	}
+
+	return nil
+}
+
+func (g *group) ListBans(ctx context.Context, groupID int64) ([]*entity.GroupBan, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := g.storage.ListGroupBansByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty bans of group: %d", groupID)
+	}
+
+	return res, nil
+}
+
+// LiftExpiredModeration 分批解除已到期的禁言和封禁，返回被解除的成员和封禁
+func (g *group) LiftExpiredModeration(ctx context.Context) ([]*entity.GroupMember, []*entity.GroupBan, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mutes []*entity.GroupMember
+	for {
+		lifted, err := g.storage.LiftExpiredMutes(ses, time.Now().UTC(), liftBatchSize)
+		if err != nil {
+			return mutes, nil, err
+		}
+		mutes = append(mutes, lifted...)
+		if len(lifted) < liftBatchSize {
+			break
+		}
+	}
+
+	var bans []*entity.GroupBan
+	for {
+		lifted, err := g.storage.DeleteExpiredGroupBans(ses, time.Now().UTC(), liftBatchSize)
+		if err != nil {
+			return mutes, bans, err
+		}
+		bans = append(bans, lifted...)
+		if len(lifted) < liftBatchSize {
+			break
+		}
+	}
+
+	return mutes, bans, nil
+}
@@ -0,0 +1,66 @@
+package group
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+type memberStorage struct {
+	storage.Storage
+
+	members map[string]*entity.GroupMember
+}
+
+func (s *memberStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	return nil, nil
+}
+
+func (s *memberStorage) GetGroupMember(ses storage.Session, userSubject string, groupID int64) (*entity.GroupMember, error) {
+	gm, ok := s.members[userSubject]
+	if !ok {
+		return nil, errors.Newf(errors.NotFound, nil, "no member %s", userSubject)
+	}
+	return gm, nil
+}
+
+func (s *memberStorage) UpdateGroupMemberMutedUntil(ses storage.Session, userSubject string, groupID int64, until *time.Time) error {
+	s.members[userSubject].MutedUntil = until
+	return nil
+}
+
+func TestUnmuteMemberChecksTarget(t *testing.T) {
+	until := time.Now().UTC().Add(time.Hour)
+	st := &memberStorage{members: map[string]*entity.GroupMember{
+		"owner":  {UserSubject: "owner", Role: entity.GroupRoleOwner},
+		"admin":  {UserSubject: "admin", Role: entity.GroupRoleAdmin, MutedUntil: &until},
+		"admin2": {UserSubject: "admin2", Role: entity.GroupRoleAdmin, MutedUntil: &until},
+		"member": {UserSubject: "member", Role: entity.GroupRoleMember, MutedUntil: &until},
+	}}
+	g := &group{storage: st}
+	ctx := context.Background()
+
+	cases := []struct {
+		operator, subject string
+		code              errors.ErrorCode
+	}{
+		{"admin", "admin", errors.InvalidArgument},
+		{"admin", "owner", errors.PermissionDenied},
+		{"admin", "admin2", errors.PermissionDenied},
+		{"admin", "member", errors.OK},
+		{"owner", "admin2", errors.OK},
+	}
+	for _, c := range cases {
+		_, err := g.UnmuteMember(ctx, 1, c.operator, c.subject)
+		if errors.Code(err) != c.code {
+			t.Errorf("%s unmute %s: expected %v, but got %v", c.operator, c.subject, c.code, err)
+		}
+	}
+	if st.members["member"].MutedUntil != nil || st.members["admin2"].MutedUntil != nil {
+		t.Errorf("expected member and admin2 to be unmuted")
+	}
+}
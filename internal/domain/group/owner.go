@@ -0,0 +1,170 @@
+package group
+
+import (
+	"context"
+	"sort"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// TransferOwnership 群主将群转让给群内的其他成员，原群主成为管理员
+func (g *group) TransferOwnership(ctx context.Context, groupID int64, from, to string) (*entity.GroupOwnerLog, error) {
+	if from == to {
+		return nil, errors.New(errors.InvalidArgument, nil, "不能转让给自己")
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 锁住群，避免并发转让
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if grp.Owner != from {
+		return nil, errors.New(errors.PermissionDenied, nil, "只有群主可以转让群")
+	}
+	if _, err = g.storage.GetGroupMember(ses, to, groupID); err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return nil, errors.Newf(errors.NotFound, err, "[%s]不在[%d]群里", to, groupID)
+		}
+		return nil, err
+	}
+
+	res, err := g.changeOwner(ses, groupID, from, to, entity.GroupOwnerTransferred)
+	if err != nil {
+		return nil, err
+	}
+	if err = g.storage.UpdateGroupMemberRole(ses, from, groupID, entity.GroupRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LeaveGroup subject退出群，群主退出时由最早加入的管理员接任，没有管理员时由最早加入的成员接任。
+// 群主变更时返回变更记录，否则返回nil
+func (g *group) LeaveGroup(ctx context.Context, groupID int64, subject string) (*entity.GroupOwnerLog, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = g.storage.GetGroupMember(ses, subject, groupID); err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return nil, errors.New(errors.PermissionDenied, err, "你不是该群成员")
+		}
+		return nil, err
+	}
+
+	var res *entity.GroupOwnerLog
+	if grp.Owner == subject {
+		successor, err := g.successorOf(ses, groupID, subject)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = g.changeOwner(ses, groupID, subject, successor, entity.GroupOwnerLeft); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = g.storage.DeleteGroupMember(ses, subject, groupID); err != nil {
+		return nil, err
+	}
+	if err = g.storage.DeleteInboxEntry(ses, subject, entity.RecordKindGroup, "", groupID); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// successorOf 选出owner之外最早加入的管理员，没有管理员时选最早加入的成员
+func (g *group) successorOf(ses storage.Session, groupID int64, owner string) (string, error) {
+	gms, err := g.storage.ListGroupMembersByGroupID(ses, groupID)
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(gms, func(i, j int) bool {
+		return gms[i].CreatedAt.Before(gms[j].CreatedAt)
+	})
+
+	successor := ""
+	for _, gm := range gms {
+		if gm.UserSubject == owner {
+			continue
+		}
+		if gm.Role == entity.GroupRoleAdmin {
+			return gm.UserSubject, nil
+		}
+		if successor == "" {
+			successor = gm.UserSubject
+		}
+	}
+	if successor == "" {
+		return "", errors.New(errors.FailedPrecondition, nil, "你是群里唯一的成员，请解散该群")
+	}
+
+	return successor, nil
+}
+
+func (g *group) changeOwner(ses storage.Session, groupID int64, from, to string, reason entity.GroupOwnerChangeReason) (*entity.GroupOwnerLog, error) {
+	if err := g.storage.UpdateGroupOwner(ses, groupID, to); err != nil {
+		return nil, err
+	}
+	if err := g.storage.UpdateGroupMemberRole(ses, to, groupID, entity.GroupRoleOwner); err != nil {
+		return nil, err
+	}
+
+	log := &entity.GroupOwnerLog{
+		GroupID:     groupID,
+		FromSubject: from,
+		ToSubject:   to,
+		Reason:      reason,
+	}
+	if err := g.storage.InsertGroupOwnerLog(ses, log); err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
+
+func (g *group) ListOwnerHistory(ctx context.Context, groupID int64) ([]*entity.GroupOwnerLog, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := g.storage.ListGroupOwnerLogsByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "empty owner history of group: %d", groupID)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,170 @@
+package group
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	maxDescriptionLen = 512
+	maxTagsPerGroup   = 8
+	maxTagLen         = 16
+	maxNicknameLen    = 32
+	maxAvatarSize     = 1 << 20
+)
+
+// avatarExts 支持的头像格式及其扩展名
+var avatarExts = map[string]string{
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/jpeg": ".jpg",
+}
+
+// UpdateProfile 修改群简介和标签，标签去除首尾空白后去重
+func (g *group) UpdateProfile(ctx context.Context, groupID int64, description string, tags []string) (*entity.Group, error) {
+	description = strings.TrimSpace(description)
+	if utf8.RuneCountInString(description) > maxDescriptionLen {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "群简介不能超过%d个字符", maxDescriptionLen)
+	}
+	uniq := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagLen {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "标签不能超过%d个字符", maxTagLen)
+		}
+		seen[t] = true
+		uniq = append(uniq, t)
+	}
+	if len(uniq) > maxTagsPerGroup {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "每个群最多%d个标签", maxTagsPerGroup)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grp, err := g.storage.GetGroupByID(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err = g.storage.UpdateGroupProfile(ses, groupID, description, uniq); err != nil {
+		return nil, err
+	}
+
+	grp.Description, grp.Tags = description, uniq
+	return grp, nil
+}
+
+// SetAvatar 按文件内容识别格式保存群头像，旧头像随新头像一起提交后删除
+func (g *group) SetAvatar(ctx context.Context, groupID int64, body io.Reader) (*entity.Group, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := avatarExts[contentType]
+	if !ok {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "不支持的头像格式: %s", contentType)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 锁定群，并发修改头像时旧头像不会被遗漏
+	grp, err := g.storage.GetGroupByIDForUpdate(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	txCtx := storage.WithContext(ctx, ses)
+	key, _, err := g.attachments.Put(txCtx, "avatars", ext, io.MultiReader(bytes.NewReader(head[:n]), body), maxAvatarSize)
+	if err != nil {
+		return nil, err
+	}
+	if err = g.storage.UpdateGroupAvatar(ses, groupID, key); err != nil {
+		return nil, err
+	}
+	if grp.Avatar != "" {
+		if err = g.attachments.Delete(txCtx, grp.Avatar); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+
+	grp.Avatar = key
+	return grp, nil
+}
+
+// OpenAvatar 读取群头像的文件，由调用方校验访问权限
+func (g *group) OpenAvatar(ctx context.Context, groupID int64) (io.ReadSeeker, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grp, err := g.storage.GetGroupByID(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if grp.Avatar == "" {
+		return nil, errors.Newf(errors.NotFound, nil, "群[%d]没有设置头像", groupID)
+	}
+
+	return g.attachments.Open(storage.WithContext(ctx, ses), grp.Avatar)
+}
+
+func (g *group) GetGroupMember(ctx context.Context, groupID int64, subject string) (*entity.GroupMember, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.storage.GetGroupMember(ses, subject, groupID)
+}
+
+// SetNickname 修改subject在群内的昵称，nickname为空时清除群昵称
+func (g *group) SetNickname(ctx context.Context, groupID int64, subject, nickname string) error {
+	nickname = strings.TrimSpace(nickname)
+	if utf8.RuneCountInString(nickname) > maxNicknameLen {
+		return errors.Newf(errors.InvalidArgument, nil, "群昵称不能超过%d个字符", maxNicknameLen)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = g.storage.GetGroupMember(ses, subject, groupID); err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return errors.Newf(errors.PermissionDenied, err, "你不在群[%d]里", groupID)
+		}
+		return err
+	}
+
+	return g.storage.UpdateGroupMemberNickname(ses, subject, groupID, nickname)
+}
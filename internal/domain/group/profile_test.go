@@ -0,0 +1,124 @@
+package group
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+type txSession struct {
+	begun     bool
+	committed bool
+}
+
+func (s *txSession) Begin() (storage.Session, error) {
+	s.begun = true
+	return s, nil
+}
+
+func (s *txSession) Rollback() error { return nil }
+
+func (s *txSession) Commit() error {
+	s.committed = true
+	return nil
+}
+
+func (s *txSession) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (s *txSession) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (s *txSession) QueryRow(query string, args ...any) *sql.Row        { return nil }
+
+// avatarStorage 保存一个群和附件，记录附件是否在事务中写入
+type avatarStorage struct {
+	storage.Storage
+
+	ses         *txSession
+	grp         *entity.Group
+	locked      bool
+	failUpdate  bool
+	attachments map[string][]byte
+	outsideTx   bool
+}
+
+func (s *avatarStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	if ses := storage.FromContext(ctx); ses != nil {
+		return ses, nil
+	}
+	return s.ses, nil
+}
+
+func (s *avatarStorage) GetGroupByIDForUpdate(ses storage.Session, id int64) (*entity.Group, error) {
+	s.locked = true
+	grp := *s.grp
+	return &grp, nil
+}
+
+func (s *avatarStorage) UpdateGroupAvatar(ses storage.Session, id int64, avatar string) error {
+	if s.failUpdate {
+		return errors.New(errors.Internal, nil, "update failed")
+	}
+	s.grp.Avatar = avatar
+	return nil
+}
+
+func (s *avatarStorage) InsertAttachment(ses storage.Session, key string, data []byte) error {
+	s.outsideTx = s.outsideTx || !s.ses.begun
+	s.attachments[key] = data
+	return nil
+}
+
+func (s *avatarStorage) DeleteAttachment(ses storage.Session, key string) error {
+	s.outsideTx = s.outsideTx || !s.ses.begun
+	delete(s.attachments, key)
+	return nil
+}
+
+func TestSetAvatarReplacesOldAvatarInTx(t *testing.T) {
+	st := &avatarStorage{
+		ses:         &txSession{},
+		grp:         &entity.Group{ID: 1, Avatar: "avatars/old.png"},
+		attachments: map[string][]byte{"avatars/old.png": []byte("old")},
+	}
+	g := &group{storage: st, attachments: attachment.New(st)}
+
+	png := []byte("\x89PNG\r\n\x1a\nimage")
+	grp, err := g.SetAvatar(context.Background(), 1, bytes.NewReader(png))
+	if err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if !st.locked || !st.ses.committed || st.outsideTx {
+		t.Errorf("expected avatar to be replaced in a locked tx")
+	}
+	if _, ok := st.attachments["avatars/old.png"]; ok {
+		t.Errorf("expected old avatar to be deleted")
+	}
+	if !bytes.Equal(st.attachments[grp.Avatar], png) {
+		t.Errorf("expected new avatar %s to be saved", grp.Avatar)
+	}
+}
+
+func TestSetAvatarRollsBackOnFailure(t *testing.T) {
+	st := &avatarStorage{
+		ses:         &txSession{},
+		grp:         &entity.Group{ID: 1},
+		failUpdate:  true,
+		attachments: map[string][]byte{},
+	}
+	g := &group{storage: st, attachments: attachment.New(st)}
+
+	if _, err := g.SetAvatar(context.Background(), 1, bytes.NewReader([]byte("\x89PNG\r\n\x1a\nimage"))); err == nil {
+		t.Fatalf("expected error")
+	}
+	if st.ses.committed || st.outsideTx {
+		t.Errorf("expected new avatar to be written in the rolled back tx")
+	}
+
+	if _, err := g.SetAvatar(context.Background(), 1, bytes.NewReader([]byte("plain text"))); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
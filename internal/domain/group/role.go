@@ -0,0 +1,265 @@
+package group
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	maxGroupNameLen  = 64
+	maxRolesPerGroup = 16
+)
+
+// roleNamePattern 自定义角色名称只能包含小写字母、数字和下划线
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Authorize 群内操作权限判断的唯一入口，subject不在群里或其角色没有perm时返回PermissionDenied
+func (g *group) Authorize(ctx context.Context, groupID int64, subject string, perm entity.GroupPermission) error {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+	if err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return errors.Newf(errors.PermissionDenied, err, "你不在群[%d]里", groupID)
+		}
+		return err
+	}
+
+	role, err := g.roleOf(ses, groupID, gm.Role)
+	if err != nil {
+		return err
+	}
+	if !role.Has(perm) {
+		return errors.Newf(errors.PermissionDenied, nil, "你没有%s的权限", perm)
+	}
+
+	return nil
+}
+
+// roleOf 查询角色的权限，admin、member没有修改过时使用默认权限，已删除的自定义角色按member处理
+func (g *group) roleOf(ses storage.Session, groupID int64, name string) (*entity.GroupRole, error) {
+	if name == entity.GroupRoleOwner {
+		return ownerRole(groupID), nil
+	}
+
+	role, err := g.storage.GetGroupRole(ses, groupID, name)
+	if err == nil {
+		return role, nil
+	}
+	if errors.Code(err) != errors.NotFound {
+		return nil, err
+	}
+
+	if _, ok := entity.DefaultGroupRolePermissions[name]; !ok {
+		name = entity.GroupRoleMember
+	}
+	return defaultRole(groupID, name), nil
+}
+
+func ownerRole(groupID int64) *entity.GroupRole {
+	perms := append([]entity.GroupPermission{}, entity.GrantableGroupPermissions...)
+	perms = append(perms, entity.GroupPermManageRoles, entity.GroupPermDelete)
+	return &entity.GroupRole{GroupID: groupID, Name: entity.GroupRoleOwner, Permissions: perms, Builtin: true}
+}
+
+func defaultRole(groupID int64, name string) *entity.GroupRole {
+	return &entity.GroupRole{
+		GroupID:     groupID,
+		Name:        name,
+		Permissions: entity.DefaultGroupRolePermissions[name],
+		Builtin:     true,
+	}
+}
+
+// ListGroupRoles 列出群的权限矩阵，内置角色在前
+func (g *group) ListGroupRoles(ctx context.Context, groupID int64) ([]*entity.GroupRole, error) {
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := g.storage.ListGroupRolesByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*entity.GroupRole, len(stored))
+	for _, r := range stored {
+		byName[r.Name] = r
+	}
+
+	res := []*entity.GroupRole{ownerRole(groupID)}
+	for _, name := range []string{entity.GroupRoleAdmin, entity.GroupRoleMember} {
+		if r, ok := byName[name]; ok {
+			res = append(res, r)
+			continue
+		}
+		res = append(res, defaultRole(groupID, name))
+	}
+	for _, r := range stored {
+		if !r.Builtin {
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
+// SaveGroupRole 新建自定义角色或修改admin、member及自定义角色的权限，群主的权限不能修改
+func (g *group) SaveGroupRole(ctx context.Context, groupID int64, name string, perms []entity.GroupPermission) (*entity.GroupRole, error) {
+	if name == entity.GroupRoleOwner {
+		return nil, errors.New(errors.InvalidArgument, nil, "不能修改群主的权限")
+	}
+	if !roleNamePattern.MatchString(name) {
+		return nil, errors.New(errors.InvalidArgument, nil, "角色名称只能包含小写字母、数字和下划线且不能超过32个字符")
+	}
+	seen := make(map[entity.GroupPermission]bool, len(perms))
+	uniq := make([]entity.GroupPermission, 0, len(perms))
+	for _, p := range perms {
+		if !p.Grantable() {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "权限%q不能授予", string(p))
+		}
+		if !seen[p] {
+			seen[p] = true
+			uniq = append(uniq, p)
+		}
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 锁住群，避免并发创建超过上限
+	if _, err = g.storage.GetGroupByIDForUpdate(ses, groupID); err != nil {
+		return nil, err
+	}
+
+	if !entity.IsBuiltinGroupRole(name) {
+		stored, err := g.storage.ListGroupRolesByGroup(ses, groupID)
+		if err != nil {
+			return nil, err
+		}
+		custom, exists := 0, false
+		for _, r := range stored {
+			if !r.Builtin {
+				custom++
+			}
+			exists = exists || r.Name == name
+		}
+		if !exists && custom >= maxRolesPerGroup {
+			return nil, errors.Newf(errors.ResourceExhausted, nil, "每个群最多%d个自定义角色", maxRolesPerGroup)
+		}
+	}
+
+	role := &entity.GroupRole{GroupID: groupID, Name: name, Permissions: uniq, Builtin: entity.IsBuiltinGroupRole(name)}
+	if err = g.storage.UpsertGroupRole(ses, role); err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// DeleteGroupRole 删除自定义角色，拥有该角色的成员变为member；删除admin或member时恢复默认权限
+func (g *group) DeleteGroupRole(ctx context.Context, groupID int64, name string) error {
+	if name == entity.GroupRoleOwner {
+		return errors.New(errors.InvalidArgument, nil, "不能删除群主角色")
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return err
+	}
+	defer ses.Rollback()
+
+	if !entity.IsBuiltinGroupRole(name) {
+		if err = g.storage.ReplaceGroupMembersRole(ses, groupID, name, entity.GroupRoleMember); err != nil {
+			return err
+		}
+	}
+	if err = g.storage.DeleteGroupRole(ses, groupID, name); err != nil {
+		return err
+	}
+
+	return ses.Commit()
+}
+
+// AssignRole 修改成员的角色，群主的角色不能修改，也不能通过此方法指定群主
+func (g *group) AssignRole(ctx context.Context, groupID int64, role string, subjects ...string) error {
+	if role == entity.GroupRoleOwner {
+		return errors.New(errors.InvalidArgument, nil, "不能指定群主")
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return err
+	}
+	defer ses.Rollback()
+
+	if !entity.IsBuiltinGroupRole(role) {
+		if _, err = g.storage.GetGroupRole(ses, groupID, role); err != nil {
+			return err
+		}
+	}
+
+	for _, subject := range subjects {
+		gm, err := g.storage.GetGroupMember(ses, subject, groupID)
+		if err != nil {
+			if errors.Code(err) == errors.NotFound {
+				return errors.Newf(errors.NotFound, err, "[%s]不在[%d]群里", subject, groupID)
+			}
+			return err
+		}
+		if gm.Role == entity.GroupRoleOwner {
+			return errors.New(errors.FailedPrecondition, nil, "不能修改群主的角色")
+		}
+
+		if err = g.storage.UpdateGroupMemberRole(ses, subject, groupID, role); err != nil {
+			return err
+		}
+	}
+
+	return ses.Commit()
+}
+
+func (g *group) RenameGroup(ctx context.Context, groupID int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLen {
+		return errors.Newf(errors.InvalidArgument, nil, "群名称不能为空且不能超过%d个字符", maxGroupNameLen)
+	}
+
+	ses, err := g.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = g.storage.GetGroupByID(ses, groupID); err != nil {
+		return err
+	}
+
+	return g.storage.UpdateGroupName(ses, groupID, name)
+}
@@ -2,163 +2,465 @@ package hub
 
 import (
 	"context"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 
 	"github.com/gorilla/websocket"
 )
 
 type Client struct {
+	mu      sync.Mutex // websocket连接不支持并发写
 	conn    *websocket.Conn
+	device  string
 	loginAt time.Time
+
+	// allChannels 客户端认识群频道，接收所有频道的消息；否则只接收默认频道的消息
+	allChannels bool
+}
+
+// Device 客户端所在的设备，同一用户可以在多个设备上同时在线
+func (c *Client) Device() string {
+	return c.device
+}
+
+func (c *Client) WriteJSON(v any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.WriteJSON(v)
+}
+
+func (c *Client) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *Client) close(reason string) {
+	c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+	c.conn.Close()
 }
 
 type Hub interface {
 	Close() error
 
-	RegisterClient(ctx context.Context, subject string, conn *websocket.Conn) error
-	UnregisterClient(ctx context.Context, subject string) error
+	// RegisterClient 同一用户在同一设备上重复登录时，之前的连接被强制下线；
+	// allChannels为false时只推送群内默认频道的消息，兼容不认识频道的客户端
+	RegisterClient(ctx context.Context, subject, device string, allChannels bool, conn *websocket.Conn) (*Client, error)
+	UnregisterClient(ctx context.Context, subject string, c *Client) error
+
+	// Send*Message 重复发送的消息不再推送，直接返回先写入的消息
+	SendBroadcastMessage(ctx context.Context, sender, content string, opts records.SendOptions) (*records.SendResult, error)
+	SendGroupMessage(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions) (*records.SendResult, error)
+	SendGroupEvent(ctx context.Context, groupID int64, event map[string]any) error
+	SendPrivateMessage(ctx context.Context, sender, content, receiver string, opts records.SendOptions) (*records.SendResult, error)
+
+	// SendForwardMessages 所有转发消息在一个事务中写入，提交后再逐条推送，推送失败只记录日志
+	SendForwardMessages(ctx context.Context, sender string, target records.ForwardTarget, forwards []*entity.Forward) ([]*records.SendResult, error)
 
-	SendBroadcastMessage(ctx context.Context, sender, content string) error
-	SendGroupMessage(ctx context.Context, sender, content string, groupID int64) error
-	SendPrivateMessage(ctx context.Context, sender, content, receiver string) error
+	// Publish*Message 只推送已经写入的消息res，供写入所在的事务提交后再推送的场景使用，如定时消息的派发
+	PublishBroadcastMessage(ctx context.Context, sender, content string, opts records.SendOptions, res *records.SendResult) error
+	PublishGroupMessage(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions, res *records.SendResult) error
+	PublishPrivateMessage(ctx context.Context, sender, content, receiver string, opts records.SendOptions, res *records.SendResult) error
+
+	SendUserEvent(ctx context.Context, subject string, event map[string]any) error
+	// SyncUserEvent 将事件推送给subject除fromDevice外的其他在线设备
+	SyncUserEvent(ctx context.Context, subject, fromDevice string, event map[string]any) error
+	SendBroadcastEvent(ctx context.Context, event map[string]any) error
 }
 
 func NewHub(env environment.Env, logger logger.Logger, record records.Records, group group.Group) (Hub, error) {
 	return &hub{
-		clients: make(map[string]*Client),
+		logger:  logger,
+		clients: make(map[string]map[string]*Client),
 		record:  record,
 		group:   group,
 	}, nil
 }
 
 type hub struct {
-	clients map[string]*Client
+	logger logger.Logger
+
+	mu      sync.RWMutex
+	clients map[string]map[string]*Client // subject -> device -> client
 
 	record records.Records
 	group  group.Group
 }
 
 func (h *hub) Close() error {
-	for _, c := range h.clients {
-		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "服务器关闭"))
-		c.conn.Close()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, devices := range h.clients {
+		for _, c := range devices {
+			c.close("服务器关闭")
+		}
 	}
 
 	return nil
 }
 
-func (h *hub) RegisterClient(ctx context.Context, subject string, conn *websocket.Conn) error {
-	c, ok := h.clients[subject]
-	if ok {
-		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "你被强制下线"))
-		c.conn.Close()
-		delete(h.clients, subject)
+const defaultDevice = "default"
+
+const (
+	// MaxDeviceLen 设备标识的最大长度
+	MaxDeviceLen = 64
+	// MaxDevicesPerSubject 同一用户最多同时在线的设备数
+	MaxDevicesPerSubject = 10
+)
+
+func (h *hub) RegisterClient(ctx context.Context, subject, device string, allChannels bool, conn *websocket.Conn) (*Client, error) {
+	if device == "" {
+		device = defaultDevice
+	}
+	if utf8.RuneCountInString(device) > MaxDeviceLen {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "device不能超过%d个字符", MaxDeviceLen)
 	}
 
-	c = &Client{
-		conn:    conn,
-		loginAt: time.Now(),
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	devices, ok := h.clients[subject]
+	if !ok {
+		devices = make(map[string]*Client)
+		h.clients[subject] = devices
+	}
+	if c, ok := devices[device]; ok {
+		c.close("你被强制下线")
+	} else if len(devices) >= MaxDevicesPerSubject {
+		return nil, errors.Newf(errors.ResourceExhausted, nil, "最多同时在%d个设备上登录", MaxDevicesPerSubject)
 	}
 
-	h.clients[subject] = c
-	return nil
+	c := &Client{
+		conn:        conn,
+		device:      device,
+		loginAt:     time.Now(),
+		allChannels: allChannels,
+	}
+
+	devices[device] = c
+	return c, nil
 }
 
-func (h *hub) UnregisterClient(ctx context.Context, subject string) error {
-	c, ok := h.clients[subject]
-	if ok {
-		c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "注销"))
-		c.conn.Close()
-		delete(h.clients, subject)
+// UnregisterClient 只注销c本身，c已被同一设备的新连接替换时不影响新连接
+func (h *hub) UnregisterClient(ctx context.Context, subject string, c *Client) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	devices := h.clients[subject]
+	if cur, ok := devices[c.device]; ok && cur == c {
+		c.close("注销")
+		delete(devices, c.device)
+		if len(devices) == 0 {
+			delete(h.clients, subject)
+		}
 	}
 
 	return nil
 }
 
-func (h *hub) SendBroadcastMessage(ctx context.Context, sender, content string) error {
-	if err := h.record.InsertRecordBroadcast(ctx, sender, content); err != nil {
-		return err
+// clientsOf 返回subject所有在线设备的连接
+func (h *hub) clientsOf(subject string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	res := make([]*Client, 0, len(h.clients[subject]))
+	for _, c := range h.clients[subject] {
+		res = append(res, c)
 	}
+	return res
+}
 
-	for subject, c := range h.clients {
-		if sender == subject {
-			continue // 不发送给自己
-		}
-		m := map[string]any{
-			"type":    "broadcast",
-			"content": content,
-			"sender":  sender,
+// writeUser 将m推送给subject除exceptDevice外所有在线的设备
+func (h *hub) writeUser(subject, exceptDevice string, m map[string]any) {
+	for _, c := range h.clientsOf(subject) {
+		if c.device == exceptDevice {
+			continue
 		}
-		err := c.conn.WriteJSON(m)
+		err := c.WriteJSON(m)
 		if err != nil {
 			// TODO: 重试
 		}
 	}
+}
+
+func (h *hub) SendBroadcastMessage(ctx context.Context, sender, content string, opts records.SendOptions) (*records.SendResult, error) {
+	res, err := h.record.InsertRecordBroadcast(ctx, sender, content, opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.Duplicate {
+		return res, nil
+	}
+
+	if err = h.PublishBroadcastMessage(ctx, sender, content, opts, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
+func (h *hub) PublishBroadcastMessage(ctx context.Context, sender, content string, opts records.SendOptions, res *records.SendResult) error {
+	m := map[string]any{
+		"type":    "broadcast",
+		"content": content,
+		"sender":  sender,
+	}
+	withResult(m, res)
+	withOptions(m, opts)
+	// 不发送给自己
+	h.fanoutAll(sender, m)
+
+	return nil
+}
+
+// SendBroadcastEvent 将事件推送给所有在线用户
+func (h *hub) SendBroadcastEvent(ctx context.Context, event map[string]any) error {
+	h.fanoutAll("", event)
 	return nil
+}
+
+// fanoutAll 将m推送给除exclude外所有在线用户
+func (h *hub) fanoutAll(exclude string, m map[string]any) {
+	h.mu.RLock()
+	subjects := make([]string, 0, len(h.clients))
+	for subject := range h.clients {
+		subjects = append(subjects, subject)
+	}
+	h.mu.RUnlock()
+
+	for _, subject := range subjects {
+		if subject == exclude {
+			continue
+		}
+		h.writeUser(subject, "", m)
+	}
+}
+
+// SendUserEvent 将事件推送给在线的subject，subject不在线时忽略
+func (h *hub) SendUserEvent(ctx context.Context, subject string, event map[string]any) error {
+	h.writeUser(subject, "", event)
+	return nil
+}
+
+func (h *hub) SyncUserEvent(ctx context.Context, subject, fromDevice string, event map[string]any) error {
+	h.writeUser(subject, fromDevice, event)
+	return nil
+}
+
+// SendGroupMessage 所有频道共用群成员，消息推送给在线的群成员并附带channel_id，客户端据此归入对应的频道；
+// 非默认频道的消息只推送给接收所有频道的客户端
+func (h *hub) SendGroupMessage(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions) (*records.SendResult, error) {
+	res, err := h.record.InsertRecordGroup(ctx, sender, content, groupID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.Duplicate {
+		return res, nil
+	}
 
+	if err = h.PublishGroupMessage(ctx, sender, content, groupID, opts, res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func (h *hub) SendGroupMessage(ctx context.Context, sender, content string, groupID int64) error {
-	if err := h.record.InsertRecordGroup(ctx, sender, content, groupID); err != nil {
+func (h *hub) PublishGroupMessage(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions, res *records.SendResult) error {
+	if res.DraftCleared {
+		h.pushDraftCleared(sender, entity.RecordKindGroup, "", groupID)
+	}
+
+	m := map[string]any{
+		"type":     "group",
+		"group_id": groupID,
+		"content":  content,
+		"sender":   sender,
+	}
+	if res.SenderNickname != "" {
+		m["sender_nickname"] = res.SenderNickname
+	}
+	withResult(m, res)
+	withOptions(m, opts)
+	// 不发送给自己，系统消息发送给包括操作者在内的所有成员
+	exclude := sender
+	if opts.System {
+		exclude = ""
+	}
+	if err := h.fanoutGroup(ctx, groupID, exclude, !res.DefaultChannel, m); err != nil {
 		return err
 	}
 
-	members, err := h.group.ListMembersOfGroup(ctx, groupID)
+	entries, err := h.record.ListInboxEntriesOfGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		h.pushInboxEntry(entry)
+	}
+
+	return nil
+}
+
+// SendGroupEvent 将群事件（置顶、公告等）推送给所有在线的群成员
+func (h *hub) SendGroupEvent(ctx context.Context, groupID int64, event map[string]any) error {
+	return h.fanoutGroup(ctx, groupID, "", false, event)
+}
+
+// fanoutGroup 将m推送给除exclude外所有在线的群成员，channelOnly为true时只推送给接收所有频道的客户端
+func (h *hub) fanoutGroup(ctx context.Context, groupID int64, exclude string, channelOnly bool, m map[string]any) error {
+	members, err := h.group.ListMemberSubjectsOfGroup(ctx, groupID)
 	if err != nil {
 		return err
 	}
 
 	for _, member := range members {
-		if member.Subject == sender {
-			// 不发送给自己
+		if member == exclude {
 			continue
 		}
-		c, ok := h.clients[member.Subject]
-		if !ok {
-			// 群成员不在线
+		for _, c := range h.clientsOf(member) {
+			if channelOnly && !c.allChannels {
+				continue
+			}
+			if err := c.WriteJSON(m); err != nil {
+				// TODO: 重试
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *hub) SendPrivateMessage(ctx context.Context, sender, content, receiver string, opts records.SendOptions) (*records.SendResult, error) {
+	res, err := h.record.InsertRecordPrivate(ctx, sender, content, receiver, opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.Duplicate {
+		return res, nil
+	}
+
+	if err = h.PublishPrivateMessage(ctx, sender, content, receiver, opts, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h *hub) SendForwardMessages(ctx context.Context, sender string, target records.ForwardTarget, forwards []*entity.Forward) ([]*records.SendResult, error) {
+	res, err := h.record.InsertForwards(ctx, sender, target, forwards)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range res {
+		if r.Duplicate {
 			continue
 		}
-		m := map[string]any{
-			"type":     "group",
-			"group_id": groupID,
-			"content":  content,
-			"sender":   sender,
+		fwd := forwards[i]
+		opts := records.SendOptions{Forward: fwd, ChannelID: target.ChannelID}
+		if target.Kind == entity.RecordKindPrivate {
+			err = h.PublishPrivateMessage(ctx, sender, fwd.Summary(), target.Receiver, opts, r)
+		} else {
+			err = h.PublishGroupMessage(ctx, sender, fwd.Summary(), target.GroupID, opts, r)
 		}
-		err = c.conn.WriteJSON(m)
+		// 消息已经写入，推送失败时客户端可以通过同步补齐，不影响其余消息的推送
 		if err != nil {
-			// TODO: 重试
+			h.logger.Errorf("push forwarded %s record %d failed: %v", r.Kind, r.ID, err)
 		}
 	}
-
-	return nil
+	return res, nil
 }
 
-func (h *hub) SendPrivateMessage(ctx context.Context, sender, content, receiver string) error {
-	if err := h.record.InsertRecordPrivate(ctx, sender, content, receiver); err != nil {
-		return err
+func (h *hub) PublishPrivateMessage(ctx context.Context, sender, content, receiver string, opts records.SendOptions, res *records.SendResult) error {
+	if res.DraftCleared {
+		h.pushDraftCleared(sender, entity.RecordKindPrivate, receiver, 0)
 	}
 
-	c, ok := h.clients[receiver]
-	if !ok {
-		// 对方不在线
-		return nil
+	for _, owner := range []string{sender, receiver} {
+		peer := receiver
+		if owner == receiver {
+			peer = sender
+		}
+		entry, err := h.record.GetInboxEntry(ctx, owner, entity.RecordKindPrivate, peer, 0)
+		if err != nil {
+			return err
+		}
+		h.pushInboxEntry(entry)
 	}
+
 	m := map[string]any{
 		"type":     "private",
 		"content":  content,
 		"sender":   sender,
 		"receiver": receiver,
 	}
-	err := c.conn.WriteJSON(m)
-	if err != nil {
-		// TODO: 重试
-	}
+	withResult(m, res)
+	withOptions(m, opts)
+	h.writeUser(receiver, "", m)
 
 	return nil
 }
+
+// pushInboxEntry 通知在线的会话所有者该会话被置顶
+func (h *hub) pushInboxEntry(entry *entity.InboxEntry) {
+	m := map[string]any{
+		"type":         "inbox",
+		"conversation": entry,
+	}
+	h.writeUser(entry.Owner, "", m)
+}
+
+// pushDraftCleared 通知owner所有在线的设备该会话的草稿已随消息发送被清除
+func (h *hub) pushDraftCleared(owner, kind, peer string, groupID int64) {
+	m := map[string]any{
+		"type":  "draft",
+		"draft": &entity.Draft{Owner: owner, Kind: kind, Peer: peer, GroupID: groupID, UpdatedAt: time.Now().UTC()},
+	}
+	h.writeUser(owner, "", m)
+}
+
+// withResult 附带服务端ID、时间、群消息的频道和会话内的序号，接收方据此去重、排序和发现缺失的消息
+func withResult(m map[string]any, res *records.SendResult) {
+	m["id"] = res.ID
+	m["created_at"] = res.CreatedAt
+	if res.ChannelID != 0 {
+		m["channel_id"] = res.ChannelID
+	}
+	if res.ConversationID != 0 {
+		m["conversation_id"] = res.ConversationID
+		m["seq"] = res.Seq
+	}
+}
+
+// withOptions 阅后即焚的消息附带ttl（秒），客户端据此倒计时；转发的消息附带来源；投票消息附带投票；表情消息附带表情；
+// 加密消息的密文放在ciphertext中原样转发
+func withOptions(m map[string]any, opts records.SendOptions) {
+	if opts.TTL > 0 {
+		m["ttl"] = int64(opts.TTL / time.Second)
+	}
+	if opts.Forward != nil {
+		m["forward"] = opts.Forward
+	}
+	if opts.Poll != nil {
+		m["poll"] = opts.Poll
+	}
+	if opts.Sticker != nil {
+		m["content"] = opts.Sticker.Summary()
+		m["sticker"] = opts.Sticker
+	}
+	if opts.Encrypted {
+		m["ciphertext"] = m["content"]
+		m["content"] = entity.EncryptedContent
+	}
+	if opts.System {
+		m["system"] = true
+	}
+}
@@ -0,0 +1,31 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterClientLimits(t *testing.T) {
+	h := &hub{clients: make(map[string]map[string]*Client)}
+	ctx := context.Background()
+
+	_, err := h.RegisterClient(ctx, "a", strings.Repeat("d", MaxDeviceLen+1), false, nil)
+	require.Equal(t, errors.InvalidArgument, errors.Code(err))
+
+	for i := 0; i < MaxDevicesPerSubject; i++ {
+		_, err = h.RegisterClient(ctx, "a", fmt.Sprintf("device-%d", i), false, nil)
+		require.Nil(t, err)
+	}
+	_, err = h.RegisterClient(ctx, "a", "one-more", false, nil)
+	require.Equal(t, errors.ResourceExhausted, errors.Code(err))
+
+	// 其他用户不受影响
+	_, err = h.RegisterClient(ctx, "b", "", false, nil)
+	require.Nil(t, err)
+}
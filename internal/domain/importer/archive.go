@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Archive 待导入的数据，所有ID均为外部系统的ID
+//
+// JSON导入格式如下，users和groups中未出现、且此前也未从同一source导入过的用户或群，
+// 其相关的消息会被跳过。消息的group非空时为群聊消息，否则receiver非空时为私聊消息。
+//
+//	{
+//	  "source": "acme-chat",
+//	  "users": [
+//	    {"id": "u1", "username": "alice", "nickname": "Alice", "phone": ""}
+//	  ],
+//	  "groups": [
+//	    {"id": "g1", "name": "general", "created_by": "u1", "members": ["u1", "u2"], "admins": ["u1"]}
+//	  ],
+//	  "messages": [
+//	    {"id": "m1", "sender": "u1", "receiver": "u2", "content": "hi", "created_at": "2023-01-02T15:04:05Z"},
+//	    {"id": "m2", "sender": "u1", "group": "g1", "content": "hello", "created_at": "2023-01-02T15:04:06Z"}
+//	  ]
+//	}
+type Archive struct {
+	Source   string           `json:"source"`
+	Users    []ArchiveUser    `json:"users"`
+	Groups   []ArchiveGroup   `json:"groups"`
+	Messages []ArchiveMessage `json:"messages"`
+}
+
+type ArchiveUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+	Phone    string `json:"phone"`
+}
+
+type ArchiveGroup struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	CreatedBy string   `json:"created_by"`
+	Members   []string `json:"members"`
+	Admins    []string `json:"admins"`
+}
+
+type ArchiveMessage struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Receiver  string    `json:"receiver,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReadJSON 读取JSON格式的导入数据
+func ReadJSON(r io.Reader) (*Archive, error) {
+	var a Archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
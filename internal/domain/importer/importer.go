@@ -0,0 +1,396 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Report 导入结果，重复导入时已导入过的数据计入Skipped
+type Report struct {
+	UsersCreated     int `json:"users_created"`
+	GroupsCreated    int `json:"groups_created"`
+	MembershipsAdded int `json:"memberships_added"`
+	RecordsInserted  int `json:"records_inserted"`
+	RecordsSkipped   int `json:"records_skipped"`
+}
+
+type Importer interface {
+	// Import 导入a中的用户、群、群成员和消息，外部ID到本地ID的映射保证可以安全地重复导入
+	Import(ctx context.Context, a *Archive) (*Report, error)
+}
+
+const (
+	mappingKindUser   = "user"
+	mappingKindGroup  = "group"
+	mappingKindRecord = "record"
+
+	// batchSize 每个事务插入的消息数
+	batchSize = 500
+	// maxContentLength 与record表content字段的长度一致
+	maxContentLength = 256
+)
+
+func New(env environment.Env, logger logger.Logger, storage storage.Storage, user user.User, group group.Group) (Importer, error) {
+	return &importer{
+		logger:  logger,
+		storage: storage,
+		user:    user,
+		group:   group,
+	}, nil
+}
+
+type importer struct {
+	logger logger.Logger
+
+	storage storage.Storage
+	user    user.User
+	group   group.Group
+}
+
+func (i *importer) Import(ctx context.Context, a *Archive) (*Report, error) {
+	source := strings.TrimSpace(a.Source)
+	if source == "" {
+		return nil, errors.New(errors.InvalidArgument, nil, "empty source")
+	}
+
+	report := &Report{}
+	ids := &idResolver{storage: i.storage, source: source, users: make(map[string]string), groups: make(map[string]int64)}
+
+	for _, u := range a.Users {
+		subject, created, err := i.ensureUser(ctx, source, u)
+		if err != nil {
+			return report, err
+		}
+		ids.users[u.ID] = subject
+		if created {
+			report.UsersCreated++
+		}
+	}
+
+	for _, g := range a.Groups {
+		groupID, created, added, err := i.ensureGroup(ctx, source, g, ids)
+		if err != nil {
+			return report, err
+		}
+		ids.groups[g.ID] = groupID
+		if created {
+			report.GroupsCreated++
+		}
+		report.MembershipsAdded += added
+	}
+
+	for start := 0; start < len(a.Messages); start += batchSize {
+		end := start + batchSize
+		if end > len(a.Messages) {
+			end = len(a.Messages)
+		}
+		inserted, err := i.importMessages(ctx, source, a.Messages[start:end], ids)
+		if err != nil {
+			return report, err
+		}
+		report.RecordsInserted += inserted
+		report.RecordsSkipped += end - start - inserted
+	}
+
+	return report, nil
+}
+
+// ensureUser 通过user领域创建未导入过的用户，用户名加上source前缀以免与本地用户冲突
+func (i *importer) ensureUser(ctx context.Context, source string, u ArchiveUser) (string, bool, error) {
+	if u.ID == "" {
+		return "", false, errors.New(errors.InvalidArgument, nil, "empty user id")
+	}
+
+	ses, err := i.storage.NewSession(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	subject, err := i.storage.GetImportMapping(ses, source, mappingKindUser, u.ID)
+	if err == nil {
+		return subject, false, nil
+	}
+	if errors.Code(err) != errors.NotFound {
+		return "", false, err
+	}
+
+	username := u.Username
+	if username == "" {
+		username = u.ID
+	}
+	nickname := u.Nickname
+	if nickname == "" {
+		nickname = username
+	}
+	input := user.RegisterInput{
+		Nickname: nickname,
+		Username: source + "_" + username,
+		Password: uuid.NewString(), // 导入的用户需要重置密码后才能登陆
+		Phone:    u.Phone,
+	}
+
+	subject, err = i.registerUser(ctx, source, u.ID, input)
+	if errors.Code(err) == errors.AlreadyExists {
+		// 昵称已被占用
+		input.Nickname = fmt.Sprintf("%s (%s)", nickname, u.ID)
+		subject, err = i.registerUser(ctx, source, u.ID, input)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return subject, true, nil
+}
+
+func (i *importer) registerUser(ctx context.Context, source, foreignID string, input user.RegisterInput) (string, error) {
+	ses, err := i.storage.NewSession(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer ses.Rollback()
+
+	subject, err := i.user.RegisterUser(storage.WithContext(ctx, ses), input)
+	if err != nil {
+		return "", err
+	}
+	if err = i.storage.InsertImportMapping(ses, source, mappingKindUser, foreignID, subject); err != nil {
+		return "", err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return "", err
+	}
+	return subject, nil
+}
+
+// ensureGroup 通过group领域创建未导入过的群，并补齐群成员和管理员，返回新加入的成员数
+func (i *importer) ensureGroup(ctx context.Context, source string, g ArchiveGroup, ids *idResolver) (int64, bool, int, error) {
+	if g.ID == "" {
+		return 0, false, 0, errors.New(errors.InvalidArgument, nil, "empty group id")
+	}
+
+	ses, err := i.storage.NewSession(ctx)
+	if err != nil {
+		return 0, false, 0, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return 0, false, 0, err
+	}
+	defer ses.Rollback()
+	tctx := storage.WithContext(ctx, ses)
+
+	created := false
+	groupID, err := ids.group(ses, g.ID)
+	if errors.Code(err) == errors.NotFound {
+		createdBy, err := ids.user(ses, g.CreatedBy)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		groupID, err = i.group.CreateGroup(tctx, group.CreateGroupInput{
+			Name:      g.Name,
+			Type:      entity.DefaultGroupType,
+			CreatedBy: createdBy,
+		})
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if err = i.storage.InsertImportMapping(ses, source, mappingKindGroup, g.ID, strconv.FormatInt(groupID, 10)); err != nil {
+			return 0, false, 0, err
+		}
+		created = true
+	} else if err != nil {
+		return 0, false, 0, err
+	}
+
+	added := 0
+	for _, m := range g.Members {
+		subject, err := ids.user(ses, m)
+		if errors.Code(err) == errors.NotFound {
+			continue // 未导入的用户
+		}
+		if err != nil {
+			return 0, false, 0, err
+		}
+		ok, err := i.group.IsMemberOfGroup(tctx, groupID, subject)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if ok {
+			continue
+		}
+		if err = i.group.AssignMembersToGroup(tctx, groupID, subject); err != nil {
+			return 0, false, 0, err
+		}
+		added++
+	}
+
+	for _, m := range g.Admins {
+		subject, err := ids.user(ses, m)
+		if errors.Code(err) == errors.NotFound {
+			continue // 未导入的用户
+		}
+		if err != nil {
+			return 0, false, 0, err
+		}
+		ok, err := i.group.IsAdminOfGroup(tctx, groupID, subject)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if ok {
+			continue
+		}
+		if err = i.group.AssignAdminsToGroup(tctx, groupID, subject); err != nil {
+			return 0, false, 0, err
+		}
+	}
+
+	if err = ses.Commit(); err != nil {
+		return 0, false, 0, err
+	}
+	return groupID, created, added, nil
+}
+
+// importMessages 在一个事务中登记并插入一批消息，已导入过或无法解析发送者/接收者的消息被跳过
+func (i *importer) importMessages(ctx context.Context, source string, msgs []ArchiveMessage, ids *idResolver) (int, error) {
+	ses, err := i.storage.NewSession(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer ses.Rollback()
+
+	var privates []*entity.RecordPrivate
+	var groups []*entity.RecordGroup
+	foreignIDs := make([]string, 0, len(msgs))
+	resolved := make(map[string]any, len(msgs))
+	for _, m := range msgs {
+		if m.ID == "" {
+			continue
+		}
+		sender, err := ids.user(ses, m.Sender)
+		if err != nil {
+			if errors.Code(err) == errors.NotFound {
+				continue
+			}
+			return 0, err
+		}
+		content := truncate(m.Content, maxContentLength)
+
+		switch {
+		case m.Group != "":
+			groupID, err := ids.group(ses, m.Group)
+			if err != nil {
+				if errors.Code(err) == errors.NotFound {
+					continue
+				}
+				return 0, err
+			}
+			resolved[m.ID] = &entity.RecordGroup{GroupID: groupID, Content: content, Sender: sender, CreatedAt: m.CreatedAt.UTC()}
+		case m.Receiver != "":
+			receiver, err := ids.user(ses, m.Receiver)
+			if err != nil {
+				if errors.Code(err) == errors.NotFound {
+					continue
+				}
+				return 0, err
+			}
+			resolved[m.ID] = &entity.RecordPrivate{Content: content, Sender: sender, Receiver: receiver, CreatedAt: m.CreatedAt.UTC()}
+		default:
+			continue
+		}
+		foreignIDs = append(foreignIDs, m.ID)
+	}
+
+	claimed, err := i.storage.ClaimImportMappings(ses, source, mappingKindRecord, foreignIDs)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range claimed {
+		switch r := resolved[id].(type) {
+		case *entity.RecordPrivate:
+			privates = append(privates, r)
+		case *entity.RecordGroup:
+			groups = append(groups, r)
+		}
+	}
+
+	if err = i.storage.BulkInsertRecordPrivates(ses, privates); err != nil {
+		return 0, err
+	}
+	if err = i.storage.BulkInsertRecordGroups(ses, groups); err != nil {
+		return 0, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return 0, err
+	}
+	return len(privates) + len(groups), nil
+}
+
+// idResolver 将外部ID解析为本地ID，本次导入之外的ID从映射表中查询
+type idResolver struct {
+	storage storage.Storage
+	source  string
+	users   map[string]string
+	groups  map[string]int64
+}
+
+func (r *idResolver) user(ses storage.Session, foreignID string) (string, error) {
+	if subject, ok := r.users[foreignID]; ok {
+		return subject, nil
+	}
+
+	subject, err := r.storage.GetImportMapping(ses, r.source, mappingKindUser, foreignID)
+	if err != nil {
+		return "", err
+	}
+	r.users[foreignID] = subject
+	return subject, nil
+}
+
+func (r *idResolver) group(ses storage.Session, foreignID string) (int64, error) {
+	if id, ok := r.groups[foreignID]; ok {
+		return id, nil
+	}
+
+	localID, err := r.storage.GetImportMapping(ses, r.source, mappingKindGroup, foreignID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(localID, 10, 64)
+	if err != nil {
+		return 0, errors.Newf(errors.Internal, err, "invalid group mapping: %s", localID)
+	}
+	r.groups[foreignID] = id
+	return id, nil
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
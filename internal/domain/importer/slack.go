@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+		Phone       string `json:"phone"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Creator string   `json:"creator"`
+	Members []string `json:"members"`
+}
+
+type slackMessage struct {
+	Type    string `json:"type"`
+	Subtype string `json:"subtype"`
+	User    string `json:"user"`
+	Text    string `json:"text"`
+	TS      string `json:"ts"`
+}
+
+// ReadSlack 读取Slack导出的目录结构，fsys可以是解压后的目录(os.DirFS)或导出的zip文件(zip.Reader)
+//
+// 公开频道(channels.json)、私有频道(groups.json)和多人私信(mpims.json)导入为群，
+// 私信(dms.json)导入为私聊，只导入普通消息，加入/离开频道等系统消息会被忽略。
+func ReadSlack(fsys fs.FS, source string) (*Archive, error) {
+	a := &Archive{Source: source}
+
+	var users []slackUser
+	if err := readSlackFile(fsys, "users.json", &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		nickname := u.Profile.DisplayName
+		if nickname == "" {
+			nickname = u.RealName
+		}
+		if nickname == "" {
+			nickname = u.Name
+		}
+		a.Users = append(a.Users, ArchiveUser{
+			ID:       u.ID,
+			Username: u.Name,
+			Nickname: nickname,
+			Phone:    u.Profile.Phone,
+		})
+	}
+
+	for _, file := range []string{"channels.json", "groups.json", "mpims.json"} {
+		var channels []slackChannel
+		if err := readSlackFile(fsys, file, &channels); err != nil {
+			return nil, err
+		}
+		for _, c := range channels {
+			createdBy := c.Creator
+			if createdBy == "" && len(c.Members) > 0 {
+				createdBy = c.Members[0]
+			}
+			a.Groups = append(a.Groups, ArchiveGroup{
+				ID:        c.ID,
+				Name:      c.Name,
+				CreatedBy: createdBy,
+				Members:   c.Members,
+				Admins:    []string{createdBy},
+			})
+
+			msgs, err := readSlackMessages(fsys, c.Name, c.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range msgs {
+				m.Group = c.ID
+				a.Messages = append(a.Messages, m)
+			}
+		}
+	}
+
+	var dms []slackChannel
+	if err := readSlackFile(fsys, "dms.json", &dms); err != nil {
+		return nil, err
+	}
+	for _, dm := range dms {
+		if len(dm.Members) != 2 {
+			continue
+		}
+		msgs, err := readSlackMessages(fsys, dm.ID, dm.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			m.Receiver = dm.Members[0]
+			if m.Sender == m.Receiver {
+				m.Receiver = dm.Members[1]
+			}
+			a.Messages = append(a.Messages, m)
+		}
+	}
+
+	return a, nil
+}
+
+// readSlackFile 读取顶层的json文件，文件不存在时忽略
+func readSlackFile(fsys fs.FS, name string, v any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// readSlackMessages 按日期顺序读取dir目录下的消息，消息ID为channelID/ts
+func readSlackMessages(fsys fs.FS, dir, channelID string) ([]ArchiveMessage, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var res []ArchiveMessage
+	for _, file := range files {
+		var msgs []slackMessage
+		if err = readSlackFile(fsys, file, &msgs); err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Type != "message" || m.Subtype != "" || m.User == "" {
+				continue
+			}
+			createdAt, err := parseSlackTS(m.TS)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s failed: %w", file, err)
+			}
+			res = append(res, ArchiveMessage{
+				ID:        channelID + "/" + m.TS,
+				Sender:    m.User,
+				Content:   m.Text,
+				CreatedAt: createdAt,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// parseSlackTS 解析形如1503435956.000247的时间戳
+func parseSlackTS(ts string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid ts: %s", ts)
+	}
+
+	var us int64
+	if frac != "" {
+		frac = (frac + "000000")[:6]
+		if us, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid ts: %s", ts)
+		}
+	}
+
+	return time.Unix(s, us*int64(time.Microsecond)).UTC(), nil
+}
@@ -0,0 +1,100 @@
+package records
+
+import (
+	"context"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// channelStorage 群内有默认频道1和只有管理者可以发言的频道2
+type channelStorage struct {
+	groupStorage
+
+	roles  map[string]string
+	listed []int64
+}
+
+func (s *channelStorage) GetGroupByID(ses storage.Session, id int64) (*entity.Group, error) {
+	return &entity.Group{ID: id, Owner: "owner"}, nil
+}
+
+func (s *channelStorage) GetGroupMember(ses storage.Session, userSubject string, groupID int64) (*entity.GroupMember, error) {
+	return &entity.GroupMember{UserSubject: userSubject, GroupID: groupID, Role: s.roles[userSubject]}, nil
+}
+
+func (s *channelStorage) GetGroupChannel(ses storage.Session, id int64) (*entity.GroupChannel, error) {
+	if id != 2 {
+		return nil, errors.Newf(errors.NotFound, nil, "no group channel with id: %d found", id)
+	}
+	return &entity.GroupChannel{ID: 2, GroupID: 1, Name: "news", AdminOnly: true}, nil
+}
+
+func (s *channelStorage) ListRecordGroupsByChannel(ses storage.Session, channelID int64) ([]*entity.RecordGroup, error) {
+	s.listed = append(s.listed, channelID)
+	return []*entity.RecordGroup{{ChannelID: channelID}}, nil
+}
+
+func (s *channelStorage) ListRecordGroupsByGroup(ses storage.Session, groupID int64) ([]*entity.RecordGroup, error) {
+	s.listed = append(s.listed, AllChannels)
+	return []*entity.RecordGroup{{ChannelID: 1}, {ChannelID: 2}}, nil
+}
+
+func newChannelRecords() (*records, *channelStorage) {
+	roles := map[string]string{"admin": entity.GroupRoleAdmin, "mod": "moderator"}
+	st := &channelStorage{groupStorage: groupStorage{fakeStorage: fakeStorage{ses: &fakeSession{}}}, roles: roles}
+	r := &records{
+		storage: st,
+		group: &fakeGroup{roles: roles, perms: map[string][]entity.GroupPermission{
+			// admin被收回了管理权限，自定义角色moderator被授予了管理权限
+			entity.GroupRoleAdmin: {entity.GroupPermPost},
+			"moderator":           {entity.GroupPermPost, entity.GroupPermManage},
+		}},
+	}
+	return r, st
+}
+
+func TestAdminOnlyChannelUsesRolePermissions(t *testing.T) {
+	r, st := newChannelRecords()
+
+	res, err := r.InsertRecordGroup(context.Background(), "mod", "release", 1, SendOptions{ChannelID: 2})
+	require.Nil(t, err)
+	require.False(t, res.DefaultChannel)
+	// 自己发送的消息不计入未读
+	require.Equal(t, res.Seq, st.reads["mod"])
+
+	_, err = r.InsertRecordGroup(context.Background(), "admin", "release", 1, SendOptions{ChannelID: 2})
+	require.Equal(t, errors.PermissionDenied, errors.Code(err))
+	require.Len(t, st.groups, 1)
+}
+
+func TestListRecordGroupsDefaultsToDefaultChannel(t *testing.T) {
+	r, st := newChannelRecords()
+
+	res, err := r.ListRecordGroups(context.Background(), 1, 0)
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	res, err = r.ListRecordGroups(context.Background(), 1, AllChannels)
+	require.Nil(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, []int64{1, AllChannels}, st.listed)
+}
+
+func TestOnlyClientSendsClearDraft(t *testing.T) {
+	r, st := newChannelRecords()
+
+	// 定时消息等服务端代发的消息不清除草稿
+	res, err := r.InsertRecordGroup(context.Background(), "mod", "scheduled", 1, SendOptions{})
+	require.Nil(t, err)
+	require.False(t, res.DraftCleared)
+	require.Empty(t, st.draftsDeleted)
+
+	res, err = r.InsertRecordGroup(context.Background(), "mod", "hi", 1, SendOptions{ClearDraft: true})
+	require.Nil(t, err)
+	require.True(t, res.DraftCleared)
+	require.Equal(t, []string{"mod"}, st.draftsDeleted)
+}
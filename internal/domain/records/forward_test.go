@@ -0,0 +1,171 @@
+package records
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSession 与Tx一样第一次Begin开启事务，之后的Begin返回savepoint，只有顶层的Commit生效
+type fakeSession struct {
+	root      *fakeSession
+	begun     bool
+	committed bool
+}
+
+func (s *fakeSession) Begin() (storage.Session, error) {
+	if s.root == nil && !s.begun {
+		s.begun = true
+		return s, nil
+	}
+	if s.root == nil {
+		return &fakeSession{root: s}, nil
+	}
+	return &fakeSession{root: s.root}, nil
+}
+
+func (s *fakeSession) Rollback() error { return nil }
+
+func (s *fakeSession) Commit() error {
+	if s.root == nil {
+		s.committed = true
+	}
+	return nil
+}
+
+func (s *fakeSession) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (s *fakeSession) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (s *fakeSession) QueryRow(query string, args ...any) *sql.Row        { return nil }
+
+// fakeStorage 保存私聊消息，content为fail的消息写入失败
+type fakeStorage struct {
+	storage.Storage
+
+	ses      *fakeSession
+	privates map[int64]*entity.RecordPrivate
+	inserted []*entity.RecordPrivate
+}
+
+func (s *fakeStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	if ses := storage.FromContext(ctx); ses != nil {
+		return ses, nil
+	}
+	return s.ses, nil
+}
+
+func (s *fakeStorage) GetRecordPrivateByID(ses storage.Session, id int64) (*entity.RecordPrivate, error) {
+	rcd, ok := s.privates[id]
+	if !ok {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_private with id: %d found", id)
+	}
+	return rcd, nil
+}
+
+func (s *fakeStorage) IsFriendOfUser(ses storage.Session, userSubject, friendSubject string) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeStorage) GetUserBySubject(ses storage.Session, subject string) (*entity.User, error) {
+	return &entity.User{Subject: subject}, nil
+}
+
+func (s *fakeStorage) InsertRecordPrivate(ses storage.Session, i *entity.RecordPrivate) (int64, error) {
+	if i.Forward != nil && i.Forward.Items[0].Content == "fail" {
+		return 0, errors.New(errors.Internal, nil, "insert failed")
+	}
+	s.inserted = append(s.inserted, i)
+	i.ID = int64(len(s.inserted))
+	return i.ID, nil
+}
+
+func (s *fakeStorage) UpsertInboxEntriesForRecordPrivate(ses storage.Session, recordID int64, i *entity.RecordPrivate) error {
+	return nil
+}
+
+func (s *fakeStorage) DeleteDraft(ses storage.Session, owner, kind, peer string, groupID int64) (bool, error) {
+	return false, nil
+}
+
+func newTestRecords(privates ...*entity.RecordPrivate) (*records, *fakeStorage) {
+	st := &fakeStorage{ses: &fakeSession{}, privates: make(map[int64]*entity.RecordPrivate)}
+	for _, r := range privates {
+		st.privates[r.ID] = r
+	}
+	return &records{storage: st}, st
+}
+
+func TestBuildForwardCarriesExpiry(t *testing.T) {
+	soon := time.Now().UTC().Add(time.Hour)
+	r, _ := newTestRecords(
+		&entity.RecordPrivate{ID: 1, Sender: "a", Receiver: "b", Content: "secret", ExpiresAt: &soon},
+		&entity.RecordPrivate{ID: 2, Sender: "a", Receiver: "b", Content: "hi"},
+	)
+
+	res, err := r.BuildForward(context.Background(), "a", []ForwardSource{{Kind: entity.RecordKindPrivate, ID: 1}, {Kind: entity.RecordKindPrivate, ID: 2}}, true)
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, &soon, res[0].ExpiresAt())
+
+	opts := SendOptions{Forward: res[0], TTL: 24 * time.Hour}
+	require.Equal(t, soon, *opts.expiresAt())
+}
+
+func TestBuildForwardKeepsSticker(t *testing.T) {
+	r, _ := newTestRecords(&entity.RecordPrivate{ID: 1, Sender: "a", Receiver: "b", Content: "[表情] ok", StickerID: 7})
+
+	res, err := r.BuildForward(context.Background(), "b", []ForwardSource{{Kind: entity.RecordKindPrivate, ID: 1}}, false)
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, int64(7), res[0].Items[0].StickerID)
+}
+
+func TestBuildForwardKeepsNestedBundle(t *testing.T) {
+	bundle := &entity.Forward{Bundle: true, Items: []*entity.ForwardItem{
+		{Kind: entity.RecordKindPrivate, RecordID: 1, Sender: "c", Content: "one"},
+		{Kind: entity.RecordKindPrivate, RecordID: 2, Sender: "c", Content: "two"},
+	}}
+	r, _ := newTestRecords(&entity.RecordPrivate{ID: 3, Sender: "a", Receiver: "b", Content: bundle.Summary(), Forward: bundle})
+
+	res, err := r.BuildForward(context.Background(), "b", []ForwardSource{{Kind: entity.RecordKindPrivate, ID: 3}}, false)
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, int64(3), res[0].Items[0].RecordID)
+	require.Equal(t, bundle, res[0].Items[0].Forward)
+	require.Equal(t, 2, res[0].Depth())
+}
+
+func TestBuildForwardDepthLimit(t *testing.T) {
+	fwd := &entity.Forward{Bundle: true, Items: []*entity.ForwardItem{{Content: "leaf"}}}
+	for i := 1; i < MaxForwardDepth; i++ {
+		fwd = &entity.Forward{Bundle: true, Items: []*entity.ForwardItem{{Content: fwd.Summary(), Forward: fwd}}}
+	}
+	r, _ := newTestRecords(&entity.RecordPrivate{ID: 1, Sender: "a", Receiver: "b", Content: fwd.Summary(), Forward: fwd})
+
+	_, err := r.BuildForward(context.Background(), "a", []ForwardSource{{Kind: entity.RecordKindPrivate, ID: 1}}, false)
+	require.Equal(t, errors.InvalidArgument, errors.Code(err))
+}
+
+func TestInsertForwardsIsAtomic(t *testing.T) {
+	r, st := newTestRecords()
+	forwards := []*entity.Forward{
+		{Items: []*entity.ForwardItem{{Content: "ok"}}},
+		{Items: []*entity.ForwardItem{{Content: "fail"}}},
+	}
+
+	_, err := r.InsertForwards(context.Background(), "a", ForwardTarget{Kind: entity.RecordKindPrivate, Receiver: "b"}, forwards)
+	require.Equal(t, errors.Internal, errors.Code(err))
+	require.False(t, st.ses.committed)
+
+	r, st = newTestRecords()
+	res, err := r.InsertForwards(context.Background(), "a", ForwardTarget{Kind: entity.RecordKindPrivate, Receiver: "b"}, forwards[:1])
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	require.True(t, st.ses.committed)
+}
@@ -0,0 +1,64 @@
+package records
+
+import (
+	"context"
+	"testing"
+
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGroup 按角色名授权，perms为每个角色拥有的权限
+type fakeGroup struct {
+	group.Group
+
+	roles map[string]string
+	perms map[string][]entity.GroupPermission
+}
+
+func (g *fakeGroup) Authorize(ctx context.Context, groupID int64, subject string, perm entity.GroupPermission) error {
+	for _, p := range g.perms[g.roles[subject]] {
+		if p == perm {
+			return nil
+		}
+	}
+	return errors.Newf(errors.PermissionDenied, nil, "你没有%s的权限", perm)
+}
+
+type memberStorage struct {
+	fakeStorage
+
+	roles map[string]string
+}
+
+func (s *memberStorage) GetGroupMember(ses storage.Session, userSubject string, groupID int64) (*entity.GroupMember, error) {
+	return &entity.GroupMember{UserSubject: userSubject, GroupID: groupID, Role: s.roles[userSubject]}, nil
+}
+
+func TestCheckMutedUsesRolePermissions(t *testing.T) {
+	roles := map[string]string{"owner": entity.GroupRoleOwner, "admin": entity.GroupRoleAdmin, "mod": "moderator", "member": entity.GroupRoleMember}
+	st := &memberStorage{fakeStorage: fakeStorage{ses: &fakeSession{}}, roles: roles}
+	r := &records{
+		storage: st,
+		group: &fakeGroup{roles: roles, perms: map[string][]entity.GroupPermission{
+			entity.GroupRoleOwner: {entity.GroupPermMute},
+			// admin被收回了禁言权限，自定义角色moderator被授予了禁言权限
+			entity.GroupRoleAdmin: {entity.GroupPermPost},
+			"moderator":           {entity.GroupPermPost, entity.GroupPermMute},
+		}},
+	}
+	grp := &entity.Group{ID: 1, MutedAll: true}
+
+	for subject, allowed := range map[string]bool{"owner": true, "admin": false, "mod": true, "member": false} {
+		_, err := r.checkMuted(context.Background(), st.ses, subject, grp)
+		if allowed {
+			require.Nil(t, err, subject)
+		} else {
+			require.Equal(t, errors.PermissionDenied, errors.Code(err), subject)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package records
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	maxPollQuestionLen = 200
+	maxPollOptionLen   = 100
+	maxPollOptions     = 20
+
+	closePollBatchSize = 100
+)
+
+// validatePoll 校验并规范化投票的问题和选项
+func validatePoll(p *entity.Poll) error {
+	p.Question = strings.TrimSpace(p.Question)
+	if p.Question == "" {
+		return errors.New(errors.InvalidArgument, nil, "empty question")
+	}
+	if utf8.RuneCountInString(p.Question) > maxPollQuestionLen {
+		return errors.Newf(errors.InvalidArgument, nil, "问题不能超过%d个字符", maxPollQuestionLen)
+	}
+
+	if len(p.Options) < 2 || len(p.Options) > maxPollOptions {
+		return errors.Newf(errors.InvalidArgument, nil, "选项数量须在2到%d之间", maxPollOptions)
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i, o := range p.Options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			return errors.New(errors.InvalidArgument, nil, "empty option")
+		}
+		if utf8.RuneCountInString(o) > maxPollOptionLen {
+			return errors.Newf(errors.InvalidArgument, nil, "选项不能超过%d个字符", maxPollOptionLen)
+		}
+		if seen[o] {
+			return errors.Newf(errors.InvalidArgument, nil, "重复的选项: %s", o)
+		}
+		seen[o] = true
+		p.Options[i] = o
+	}
+
+	if p.ClosesAt != nil {
+		if !p.ClosesAt.After(time.Now()) {
+			return errors.New(errors.InvalidArgument, nil, "截止时间必须晚于当前时间")
+		}
+		t := p.ClosesAt.UTC()
+		p.ClosesAt = &t
+	}
+
+	return nil
+}
+
+// VotePoll 群成员投票，再次投票时替换之前的选择，返回最新的统计结果
+func (r *records) VotePoll(ctx context.Context, voter string, pollID int64, options []int) (*entity.PollTally, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	poll, err := r.storage.GetPollForUpdate(ses, pollID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := r.storage.IsMemberOfGroup(ses, voter, poll.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+	}
+	if poll.Closed(time.Now().UTC()) {
+		return nil, errors.New(errors.FailedPrecondition, nil, "投票已截止")
+	}
+
+	if len(options) == 0 {
+		return nil, errors.New(errors.InvalidArgument, nil, "empty options")
+	}
+	if !poll.MultiChoice && len(options) > 1 {
+		return nil, errors.New(errors.InvalidArgument, nil, "该投票为单选")
+	}
+	seen := make(map[int]bool, len(options))
+	for _, o := range options {
+		if o < 0 || o >= len(poll.Options) {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "invalid option: %d", o)
+		}
+		if seen[o] {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "duplicate option: %d", o)
+		}
+		seen[o] = true
+	}
+
+	if err = r.storage.ReplacePollVotes(ses, pollID, voter, options); err != nil {
+		return nil, err
+	}
+
+	res, err := r.pollTally(ses, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetPollTally 群成员查看投票结果，匿名投票不返回投票者
+func (r *records) GetPollTally(ctx context.Context, subject string, pollID int64) (*entity.PollTally, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, err := r.storage.GetPoll(ses, pollID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := r.storage.IsMemberOfGroup(ses, subject, poll.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+	}
+
+	return r.pollTally(ses, poll)
+}
+
+// CloseDuePolls 分批截止已到截止时间的投票，返回它们的最终结果
+func (r *records) CloseDuePolls(ctx context.Context) ([]*entity.PollTally, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*entity.PollTally
+	for {
+		polls, err := r.storage.CloseDuePolls(ses, time.Now().UTC(), closePollBatchSize)
+		if err != nil {
+			return res, err
+		}
+		for _, poll := range polls {
+			tally, err := r.pollTally(ses, poll)
+			if err != nil {
+				return res, err
+			}
+			res = append(res, tally)
+		}
+		if len(polls) < closePollBatchSize {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+func (r *records) pollTally(ses storage.Session, poll *entity.Poll) (*entity.PollTally, error) {
+	votes, err := r.storage.ListPollVotes(ses, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entity.PollTally{
+		Poll:   poll,
+		Counts: make([]int, len(poll.Options)),
+	}
+	if !poll.Anonymous {
+		res.OptionVoters = make([][]string, len(poll.Options))
+	}
+	voters := make(map[string]bool)
+	for _, v := range votes {
+		if v.Option < 0 || v.Option >= len(poll.Options) {
+			continue
+		}
+		res.Counts[v.Option]++
+		voters[v.Voter] = true
+		if !poll.Anonymous {
+			res.OptionVoters[v.Option] = append(res.OptionVoters[v.Option], v.Voter)
+		}
+	}
+	res.Voters = len(voters)
+
+	return res, nil
+}
@@ -2,102 +2,591 @@ package records
 
 import (
 	"context"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 	"fangaoxs.com/go-chat/internal/storage"
 )
 
 type Records interface {
-	InsertRecordBroadcast(ctx context.Context, sender, content string) error
-	InsertRecordGroup(ctx context.Context, sender, content string, groupID int64) error
-	InsertRecordPrivate(ctx context.Context, sender, content, receiver string) error
+	// Insert* 携带ClientMsgID时同一发送者的重复消息只写入一次，返回先写入的消息
+
+	InsertRecordBroadcast(ctx context.Context, sender, content string, opts SendOptions) (*SendResult, error)
+	InsertRecordGroup(ctx context.Context, sender, content string, groupID int64, opts SendOptions) (*SendResult, error)
+	InsertRecordPrivate(ctx context.Context, sender, content, receiver string, opts SendOptions) (*SendResult, error)
 
 	ListAllRecordBroadcasts(ctx context.Context) ([]*entity.RecordBroadcast, error)
 	ListRecordBroadcastsBySender(ctx context.Context, sender string) ([]*entity.RecordBroadcast, error)
-	ListRecordGroups(ctx context.Context, groupID int64) ([]*entity.RecordGroup, error)
+	// ListRecordGroups channelID为0时返回默认频道的消息，为AllChannels时返回群内所有频道的消息
+	ListRecordGroups(ctx context.Context, groupID, channelID int64) ([]*entity.RecordGroup, error)
 	ListRecordPrivate(ctx context.Context, sender, receiver string) ([]*entity.RecordPrivate, error)
+
+	SearchRecords(ctx context.Context, subject string, input SearchInput) ([]*entity.RecordSearchResult, string, error)
+
+	// ListRecordsBySeq 返回会话中序号在[fromSeq, toSeq]内的消息，客户端发现序号不连续时据此补齐
+	ListRecordsBySeq(ctx context.Context, subject string, conversationID, fromSeq, toSeq int64) (*SeqRange, error)
+
+	// BuildForward 校验subject可以查看所有原消息，返回待发送的转发来源
+	BuildForward(ctx context.Context, subject string, sources []ForwardSource, bundle bool) ([]*entity.Forward, error)
+	// InsertForwards 原子地写入BuildForward返回的所有转发消息
+	InsertForwards(ctx context.Context, sender string, target ForwardTarget, forwards []*entity.Forward) ([]*SendResult, error)
+
+	// Inbox 会话列表
+
+	ListInbox(ctx context.Context, owner, cursor string, limit int) ([]*entity.InboxEntry, string, error)
+	GetInboxEntry(ctx context.Context, owner, kind, peer string, groupID int64) (*entity.InboxEntry, error)
+	ListInboxEntriesOfGroup(ctx context.Context, groupID int64) ([]*entity.InboxEntry, error)
+	MarkInboxRead(ctx context.Context, owner, kind, peer string, groupID int64) error
+
+	// Bookmark 收藏
+
+	AddBookmark(ctx context.Context, owner, kind string, recordID int64, note string) (*entity.Bookmark, error)
+	RemoveBookmark(ctx context.Context, owner, kind string, recordID int64) error
+	ListBookmarks(ctx context.Context, owner, cursor string, limit int) ([]*entity.Bookmark, string, error)
+
+	// Poll 群投票
+
+	VotePoll(ctx context.Context, voter string, pollID int64, options []int) (*entity.PollTally, error)
+	GetPollTally(ctx context.Context, subject string, pollID int64) (*entity.PollTally, error)
+	CloseDuePolls(ctx context.Context) ([]*entity.PollTally, error)
+
+	// Sticker 表情包，群表情包只对群成员可见且只能在本群中使用
+
+	CreateStickerPack(ctx context.Context, creator string, groupID int64, name string, uploads []StickerUpload) (*entity.StickerPack, error)
+	ListStickerPacks(ctx context.Context, subject string) ([]*entity.StickerPack, error)
+	GetSticker(ctx context.Context, subject string, id int64) (*entity.Sticker, error)
+	OpenSticker(ctx context.Context, subject string, id int64) (*entity.Sticker, io.ReadSeeker, error)
+
+	// Draft 草稿，发送消息时自动清除
+
+	SaveDraft(ctx context.Context, owner, kind, peer string, groupID int64, content string) (*entity.Draft, error)
+	ListDrafts(ctx context.Context, owner string) ([]*entity.Draft, error)
+
+	// Retention 消息保留策略
+
+	SetPrivateRetention(ctx context.Context, subject, peer string, maxAge time.Duration) error
+	GetPrivateRetention(ctx context.Context, subject, peer string) (*entity.RetentionPolicy, error)
+	SetGroupRetention(ctx context.Context, groupID int64, maxAge time.Duration, updatedBy string) error
+	GetGroupRetention(ctx context.Context, groupID int64) (*entity.RetentionPolicy, error)
+	PurgeExpiredRecords(ctx context.Context) ([]*entity.ExpiredRecord, error)
+}
+
+// SendOptions 发送消息的可选项
+type SendOptions struct {
+	TTL     time.Duration   // 阅后即焚，大于0时消息在TTL后被清理
+	Forward *entity.Forward // 转发的来源，广播消息不支持转发
+	Poll    *entity.Poll    // 投票，只用于群消息，写入后Poll.ID被赋值
+	Sticker *entity.Sticker // 表情，广播消息不支持表情，按ID校验后其余字段被赋值
+
+	ChannelID int64 // 群消息所在的频道，为0时发送到默认频道
+
+	// Encrypted 端到端加密的私聊消息，content是客户端加密后的密文，服务端原样保存和转发
+	Encrypted bool
+
+	// System 服务端生成的群系统消息，如禁言、封禁的通知，发送者固定为entity.SystemSubject，不受禁言限制
+	System bool
+
+	// ClearDraft 客户端主动发送的消息清除发送者在该会话的草稿，定时消息等服务端代发的消息不清除
+	ClearDraft bool
+
+	ClientMsgID string // 客户端生成的消息ID，用于重试时去重
+}
+
+// SendResult 发送成功后回执给客户端的服务端ID和时间
+type SendResult struct {
+	Kind           string    `json:"kind"`
+	ID             int64     `json:"id"`
+	ChannelID      int64     `json:"channel_id,omitempty"`
+	ConversationID int64     `json:"conversation_id,omitempty"`
+	Seq            int64     `json:"seq,omitempty"`
+	ClientMsgID    string    `json:"client_msg_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	Duplicate      bool      `json:"duplicate"` // 重复发送，消息未再次写入
+
+	DraftCleared bool `json:"-"` // 发送者在该会话的草稿被清除
+	// DefaultChannel 群消息发送到了默认频道，不认识频道的客户端只接收默认频道的消息
+	DefaultChannel bool `json:"-"`
+	// SenderNickname 发送者的群昵称，只用于推送
+	SenderNickname string `json:"-"`
+}
+
+// MaxClientMsgIDLen 客户端消息ID的最大长度
+const MaxClientMsgIDLen = 64
+
+// ScheduledClientMsgIDPrefix 定时消息派发时使用的消息ID前缀，客户端不能使用，避免与定时消息冲突
+const ScheduledClientMsgIDPrefix = "schedule-"
+
+// ScheduledClientMsgID 定时消息id派发时的消息ID，重复派发时据此去重
+func ScheduledClientMsgID(id int64) string {
+	return fmt.Sprintf("%s%d", ScheduledClientMsgIDPrefix, id)
 }
 
-func New(env environment.Env, logger logger.Logger, storage storage.Storage) (Records, error) {
+// MaxCiphertextLen 加密消息密文的最大长度
+const MaxCiphertextLen = 64 << 10
+
+// MaxContentLen 消息内容的最大字符数，与消息表content列的长度一致
+const MaxContentLen = 256
+
+// SeqRange 会话中一段序号内的消息，按Conversation.Kind只有Privates或Groups有值，已被清理的消息不返回
+type SeqRange struct {
+	Conversation *entity.Conversation    `json:"conversation"`
+	Privates     []*entity.RecordPrivate `json:"privates,omitempty"`
+	Groups       []*entity.RecordGroup   `json:"groups,omitempty"`
+}
+
+// MaxSeqRange 一次最多补齐的序号数
+const MaxSeqRange = 500
+
+// ForwardSource 被转发的原消息，Kind为private或group
+type ForwardSource struct {
+	Kind string
+	ID   int64
+}
+
+// MaxForwardSources 一次最多转发的消息数
+const MaxForwardSources = 100
+
+// MaxForwardDepth 聊天记录中最多嵌套的聊天记录层数
+const MaxForwardDepth = 3
+
+// ForwardTarget 转发的目标会话，Kind为private时Receiver有效，为group时GroupID和ChannelID有效
+type ForwardTarget struct {
+	Kind      string
+	Receiver  string
+	GroupID   int64
+	ChannelID int64 // 为0时转发到默认频道
+}
+
+// AllChannels 查询群内所有频道的消息
+const AllChannels int64 = -1
+
+func (o SendOptions) validate(kind string) error {
+	if len(o.ClientMsgID) > MaxClientMsgIDLen {
+		return errors.Newf(errors.InvalidArgument, nil, "client_msg_id不能超过%d个字符", MaxClientMsgIDLen)
+	}
+	if o.Poll != nil {
+		if kind != entity.RecordKindGroup {
+			return errors.New(errors.InvalidArgument, nil, "投票只能发送到群聊")
+		}
+		return validatePoll(o.Poll)
+	}
+	if o.ChannelID != 0 && kind != entity.RecordKindGroup {
+		return errors.New(errors.InvalidArgument, nil, "只有群消息可以指定频道")
+	}
+	if o.Sticker != nil && kind == entity.RecordKindBroadcast {
+		return errors.New(errors.InvalidArgument, nil, "广播消息不支持表情")
+	}
+	if o.Encrypted {
+		if kind != entity.RecordKindPrivate {
+			return errors.New(errors.InvalidArgument, nil, "只有私聊消息可以加密")
+		}
+		if o.Forward != nil || o.Sticker != nil {
+			return errors.New(errors.InvalidArgument, nil, "加密消息不支持转发和表情")
+		}
+	}
+	return nil
+}
+
+// expiresAt 消息的过期时间，转发的消息不晚于原消息过期
+func (o SendOptions) expiresAt() *time.Time {
+	var res *time.Time
+	if o.TTL > 0 {
+		t := time.Now().UTC().Add(o.TTL)
+		res = &t
+	}
+	if o.Forward != nil {
+		res = entity.EarliestTime(res, o.Forward.ExpiresAt())
+	}
+	return res
+}
+
+type SearchInput struct {
+	Query   string
+	Sender  string
+	Peer    string
+	GroupID int64
+	From    time.Time
+	To      time.Time
+	Cursor  string
+	Limit   int
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+
+	purgeBatchSize = 500
+
+	maxBookmarkNoteLen = 256
+	maxDraftLen        = 256
+)
+
+func New(env environment.Env, logger logger.Logger, storage storage.Storage, group group.Group, attachments attachment.Store) (Records, error) {
 	return &records{
-		logger:  logger,
-		storage: storage,
+		logger:      logger,
+		storage:     storage,
+		attachments: attachments,
+		group:       group,
 	}, nil
 }
 
 type records struct {
 	logger logger.Logger
 
-	storage storage.Storage
+	storage     storage.Storage
+	attachments attachment.Store
+	group       group.Group
 }
 
-func (r *records) InsertRecordBroadcast(ctx context.Context, sender, content string) error {
+func (r *records) InsertRecordBroadcast(ctx context.Context, sender, content string, opts SendOptions) (*SendResult, error) {
+	if err := opts.validate(entity.RecordKindBroadcast); err != nil {
+		return nil, err
+	}
+
 	ses, err := r.storage.NewSession(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if opts.ClientMsgID != "" {
+		res, err := r.duplicateRecordBroadcast(ses, sender, opts.ClientMsgID)
+		if errors.Code(err) != errors.NotFound {
+			return res, err
+		}
 	}
 
 	rcd := &entity.RecordBroadcast{
-		Content: content,
-		Sender:  sender,
+		Content:     content,
+		Sender:      sender,
+		ClientMsgID: opts.ClientMsgID,
+		ExpiresAt:   opts.expiresAt(),
 	}
 	_, err = r.storage.InsertRecordBroadcast(ses, rcd)
+	if errors.Code(err) == errors.AlreadyExists && opts.ClientMsgID != "" {
+		// 并发重试时唯一索引冲突，返回先写入的消息
+		return r.duplicateRecordBroadcast(ses, sender, opts.ClientMsgID)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &SendResult{Kind: entity.RecordKindBroadcast, ID: rcd.ID, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt}, nil
+}
+
+func (r *records) duplicateRecordBroadcast(ses storage.Session, sender, clientMsgID string) (*SendResult, error) {
+	rcd, err := r.storage.GetRecordBroadcastByClientMsgID(ses, sender, clientMsgID)
+	if err != nil {
+		return nil, err
+	}
+	return &SendResult{Kind: entity.RecordKindBroadcast, ID: rcd.ID, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt, Duplicate: true}, nil
 }
 
-func (r *records) InsertRecordGroup(ctx context.Context, sender, content string, groupID int64) error {
+func (r *records) InsertRecordGroup(ctx context.Context, sender, content string, groupID int64, opts SendOptions) (*SendResult, error) {
+	if err := opts.validate(entity.RecordKindGroup); err != nil {
+		return nil, err
+	}
+	if opts.System {
+		sender = entity.SystemSubject
+	}
+
 	ses, err := r.storage.NewSession(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = r.storage.GetGroupByID(ses, groupID)
+	grp, err := r.storage.GetGroupByID(ses, groupID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if opts.ClientMsgID != "" {
+		res, err := r.duplicateRecordGroup(ses, sender, opts.ClientMsgID)
+		if errors.Code(err) != errors.NotFound {
+			return res, err
+		}
+	}
+
+	ch, err := r.channelOf(ses, groupID, opts.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var nickname string
+	var slowMode time.Duration
+	if !opts.System {
+		gm, err := r.checkMuted(ctx, ses, sender, grp)
+		if err != nil {
+			return nil, err
+		}
+		nickname = gm.Nickname
+		if ch.AdminOnly {
+			ok, err := r.can(ctx, ses, groupID, sender, entity.GroupPermManage)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errors.Newf(errors.PermissionDenied, nil, "频道[%s]只有拥有%s权限的成员可以发言", ch.Name, entity.GroupPermManage)
+			}
+		}
+		if grp.SlowMode > 0 {
+			// 可以设置慢速模式的成员不受其限制
+			exempt, err := r.can(ctx, ses, groupID, sender, entity.GroupPermMute)
+			if err != nil {
+				return nil, err
+			}
+			if !exempt {
+				slowMode = time.Duration(grp.SlowMode) * time.Second
+			}
+		}
+	}
+
+	if opts.Sticker != nil {
+		if err = r.checkSticker(ses, sender, opts.Sticker, groupID); err != nil {
+			return nil, err
+		}
+		content = opts.Sticker.Summary()
 	}
 
 	rcd := &entity.RecordGroup{
-		GroupID: groupID,
-		Content: content,
-		Sender:  sender,
+		GroupID:     groupID,
+		ChannelID:   ch.ID,
+		Content:     content,
+		Sender:      sender,
+		ClientMsgID: opts.ClientMsgID,
+		Forward:     opts.Forward,
+		ExpiresAt:   opts.expiresAt(),
+		System:      opts.System,
+	}
+	if opts.Sticker != nil {
+		rcd.StickerID = opts.Sticker.ID
+	}
+	draftCleared, err := r.insertRecordGroup(ses, rcd, opts.Poll, slowMode, opts.ClearDraft)
+	if errors.Code(err) == errors.AlreadyExists && opts.ClientMsgID != "" {
+		// 并发重试时唯一索引冲突，返回先写入的消息
+		return r.duplicateRecordGroup(ses, sender, opts.ClientMsgID)
 	}
-	_, err = r.storage.InsertRecordGroup(ses, rcd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &SendResult{Kind: entity.RecordKindGroup, ID: rcd.ID, ChannelID: rcd.ChannelID, ConversationID: rcd.ConversationID, Seq: rcd.Seq, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt, DraftCleared: draftCleared, SenderNickname: nickname, DefaultChannel: ch.IsDefault}, nil
+}
+
+// channelOf 查询群内的频道，channelID为0时返回默认频道
+func (r *records) channelOf(ses storage.Session, groupID, channelID int64) (*entity.GroupChannel, error) {
+	if channelID == 0 {
+		return r.storage.GetDefaultGroupChannel(ses, groupID)
+	}
+
+	ch, err := r.storage.GetGroupChannel(ses, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch.GroupID != groupID {
+		return nil, errors.Newf(errors.NotFound, nil, "群[%d]没有频道[%d]", groupID, channelID)
+	}
+
+	return ch, nil
+}
+
+// checkMuted 被禁言的成员不能发言，全员禁言时只有拥有禁言权限的成员可以发言，返回发送者的成员信息
+func (r *records) checkMuted(ctx context.Context, ses storage.Session, sender string, grp *entity.Group) (*entity.GroupMember, error) {
+	gm, err := r.storage.GetGroupMember(ses, sender, grp.ID)
+	if err != nil {
+		if errors.Code(err) == errors.NotFound {
+			return nil, errors.New(errors.PermissionDenied, err, "你不是该群成员")
+		}
+		return nil, err
+	}
+
+	if gm.Muted(time.Now().UTC()) {
+		return nil, errors.Newf(errors.PermissionDenied, nil, "你已被禁言，解除时间%s", gm.MutedUntil.Format(time.DateTime))
+	}
+	if grp.MutedAll {
+		ok, err := r.can(ctx, ses, grp.ID, sender, entity.GroupPermMute)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "全员禁言中")
+		}
+	}
+
+	return gm, nil
 }
 
-func (r *records) InsertRecordPrivate(ctx context.Context, sender, content, receiver string) error {
+// can 按群的角色权限判断sender是否拥有perm，与群管理使用同一套权限
+func (r *records) can(ctx context.Context, ses storage.Session, groupID int64, sender string, perm entity.GroupPermission) (bool, error) {
+	err := r.group.Authorize(storage.WithContext(ctx, ses), groupID, sender, perm)
+	if errors.Code(err) == errors.PermissionDenied {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// insertRecordGroup 在一个事务中写入投票、群消息，更新群成员的会话，clearDraft为true时清除发送者在该群的草稿，返回草稿是否被清除。
+// slowMode大于0时先占用发言间隔，写入失败时随事务回滚
+func (r *records) insertRecordGroup(ses storage.Session, rcd *entity.RecordGroup, poll *entity.Poll, slowMode time.Duration, clearDraft bool) (bool, error) {
+	ses, err := ses.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer ses.Rollback()
+
+	if slowMode > 0 {
+		if err = r.claimPostSlot(ses, rcd.Sender, rcd.GroupID, slowMode); err != nil {
+			return false, err
+		}
+	}
+
+	if poll != nil {
+		poll.GroupID, poll.CreatedBy = rcd.GroupID, rcd.Sender
+		if err = r.storage.InsertPoll(ses, poll); err != nil {
+			return false, err
+		}
+		rcd.PollID = poll.ID
+	}
+
+	id, err := r.storage.InsertRecordGroup(ses, rcd)
+	if err != nil {
+		return false, err
+	}
+
+	// 自己发送的消息不计入未读
+	if err = r.storage.UpsertGroupChannelRead(ses, rcd.ChannelID, rcd.Sender, rcd.Seq, time.Now().UTC()); err != nil {
+		return false, err
+	}
+	if err = r.storage.UpsertInboxEntriesForRecordGroup(ses, id, rcd); err != nil {
+		return false, err
+	}
+
+	// 系统消息没有真实的发送者，不涉及草稿
+	var draftCleared bool
+	if clearDraft && !rcd.System {
+		if draftCleared, err = r.storage.DeleteDraft(ses, rcd.Sender, entity.RecordKindGroup, "", rcd.GroupID); err != nil {
+			return false, err
+		}
+	}
+
+	return draftCleared, ses.Commit()
+}
+
+func (r *records) duplicateRecordGroup(ses storage.Session, sender, clientMsgID string) (*SendResult, error) {
+	rcd, err := r.storage.GetRecordGroupByClientMsgID(ses, sender, clientMsgID)
+	if err != nil {
+		return nil, err
+	}
+	return &SendResult{Kind: entity.RecordKindGroup, ID: rcd.ID, ChannelID: rcd.ChannelID, ConversationID: rcd.ConversationID, Seq: rcd.Seq, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt, Duplicate: true}, nil
+}
+
+func (r *records) InsertRecordPrivate(ctx context.Context, sender, content, receiver string, opts SendOptions) (*SendResult, error) {
+	if err := opts.validate(entity.RecordKindPrivate); err != nil {
+		return nil, err
+	}
+
 	ses, err := r.storage.NewSession(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	_, err = r.storage.GetUserBySubject(ses, receiver)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if opts.ClientMsgID != "" {
+		res, err := r.duplicateRecordPrivate(ses, sender, opts.ClientMsgID)
+		if errors.Code(err) != errors.NotFound {
+			return res, err
+		}
+	}
+
+	if opts.Sticker != nil {
+		if err = r.checkSticker(ses, sender, opts.Sticker, 0); err != nil {
+			return nil, err
+		}
+		content = opts.Sticker.Summary()
+	}
+	var ciphertext string
+	if opts.Encrypted {
+		if content == "" || len(content) > MaxCiphertextLen {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "密文不能为空且不能超过%d字节", MaxCiphertextLen)
+		}
+		ciphertext, content = content, entity.EncryptedContent
 	}
 
 	rcd := &entity.RecordPrivate{
-		Content:  content,
-		Sender:   sender,
-		Receiver: receiver,
+		Content:     content,
+		Sender:      sender,
+		Receiver:    receiver,
+		ClientMsgID: opts.ClientMsgID,
+		Forward:     opts.Forward,
+		Ciphertext:  ciphertext,
+		ExpiresAt:   opts.expiresAt(),
+	}
+	if opts.Sticker != nil {
+		rcd.StickerID = opts.Sticker.ID
+	}
+	draftCleared, err := r.insertRecordPrivate(ses, rcd, opts.ClearDraft)
+	if errors.Code(err) == errors.AlreadyExists && opts.ClientMsgID != "" {
+		// 并发重试时唯一索引冲突，返回先写入的消息
+		return r.duplicateRecordPrivate(ses, sender, opts.ClientMsgID)
 	}
-	_, err = r.storage.InsertRecordPrivate(ses, rcd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &SendResult{Kind: entity.RecordKindPrivate, ID: rcd.ID, ConversationID: rcd.ConversationID, Seq: rcd.Seq, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt, DraftCleared: draftCleared}, nil
+}
+
+// insertRecordPrivate 在一个事务中写入私聊消息，更新双方的会话，clearDraft为true时清除发送者在该私聊的草稿，返回草稿是否被清除
+func (r *records) insertRecordPrivate(ses storage.Session, rcd *entity.RecordPrivate, clearDraft bool) (bool, error) {
+	ses, err := ses.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer ses.Rollback()
+
+	id, err := r.storage.InsertRecordPrivate(ses, rcd)
+	if err != nil {
+		return false, err
+	}
+
+	if err = r.storage.UpsertInboxEntriesForRecordPrivate(ses, id, rcd); err != nil {
+		return false, err
+	}
+
+	var draftCleared bool
+	if clearDraft {
+		if draftCleared, err = r.storage.DeleteDraft(ses, rcd.Sender, entity.RecordKindPrivate, rcd.Receiver, 0); err != nil {
+			return false, err
+		}
+	}
+
+	return draftCleared, ses.Commit()
+}
+
+func (r *records) duplicateRecordPrivate(ses storage.Session, sender, clientMsgID string) (*SendResult, error) {
+	rcd, err := r.storage.GetRecordPrivateByClientMsgID(ses, sender, clientMsgID)
+	if err != nil {
+		return nil, err
+	}
+	return &SendResult{Kind: entity.RecordKindPrivate, ID: rcd.ID, ConversationID: rcd.ConversationID, Seq: rcd.Seq, ClientMsgID: rcd.ClientMsgID, CreatedAt: rcd.CreatedAt, Duplicate: true}, nil
 }
 
 func (r *records) ListAllRecordBroadcasts(ctx context.Context) ([]*entity.RecordBroadcast, error) {
@@ -134,8 +623,8 @@ func (r *records) ListRecordBroadcastsBySender(ctx context.Context, sender strin
 	return res, nil
 }
 
-// ListRecordGroups 查询groupID群的群聊记录，当且仅当groupID存在时
-func (r *records) ListRecordGroups(ctx context.Context, groupID int64) ([]*entity.RecordGroup, error) {
+// ListRecordGroups 查询groupID群的群聊记录，当且仅当groupID存在时；channelID为0时查询默认频道，为AllChannels时查询所有频道
+func (r *records) ListRecordGroups(ctx context.Context, groupID, channelID int64) ([]*entity.RecordGroup, error) {
 	ses, err := r.storage.NewSession(ctx)
 	if err != nil {
 		return nil, err
@@ -146,12 +635,21 @@ func (r *records) ListRecordGroups(ctx context.Context, groupID int64) ([]*entit
 		return nil, err
 	}
 
-	res, err := r.storage.ListRecordGroupsByGroup(ses, groupID)
+	var res []*entity.RecordGroup
+	if channelID == AllChannels {
+		res, err = r.storage.ListRecordGroupsByGroup(ses, groupID)
+	} else {
+		var ch *entity.GroupChannel
+		if ch, err = r.channelOf(ses, groupID, channelID); err != nil {
+			return nil, err
+		}
+		res, err = r.storage.ListRecordGroupsByChannel(ses, ch.ID)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if len(res) == 0 {
-		return nil, errors.Newf(errors.NotFound, nil, "empty record_group with group: %d", groupID)
+		return nil, errors.Newf(errors.NotFound, nil, "empty record_group with group: %d and channel: %d", groupID, channelID)
 	}
 
 	return res, nil
@@ -183,3 +681,665 @@ func (r *records) ListRecordPrivate(ctx context.Context, subject1, subject2 stri
 
 	return res, nil
 }
+
+// SearchRecords 在subject可见的私聊和群聊记录中检索，返回结果和下一页的游标
+func (r *records) SearchRecords(ctx context.Context, subject string, input SearchInput) ([]*entity.RecordSearchResult, string, error) {
+	query := strings.TrimSpace(input.Query)
+	if query == "" {
+		return nil, "", errors.New(errors.InvalidArgument, nil, "empty query")
+	}
+	if input.Peer != "" && input.GroupID != 0 {
+		return nil, "", errors.New(errors.InvalidArgument, nil, "peer and group_id are mutually exclusive")
+	}
+
+	cursor, err := entity.DecodeCursor(input.Cursor)
+	if err != nil {
+		return nil, "", errors.New(errors.InvalidArgument, err, "invalid cursor")
+	}
+
+	limit := pageLimit(input.Limit)
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filter := &entity.RecordSearchFilter{
+		Query:   query,
+		Trigram: containsHan(query),
+		Sender:  input.Sender,
+		Peer:    input.Peer,
+		GroupID: input.GroupID,
+		From:    input.From,
+		To:      input.To,
+		Cursor:  cursor,
+		Limit:   limit,
+	}
+	res, err := r.storage.SearchRecords(ses, subject, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, rcd := range res {
+		if filter.Trigram {
+			rcd.Snippet = highlight(rcd.Content, query)
+			continue
+		}
+		rcd.Snippet = markSnippet(rcd.Snippet)
+	}
+
+	var next string
+	if len(res) == limit {
+		last := res[len(res)-1]
+		next = (&entity.Cursor{CreatedAt: last.CreatedAt, Kind: last.Kind, ID: last.ID}).Encode()
+	}
+
+	return res, next, nil
+}
+
+// ListRecordsBySeq subject须是私聊的一方或群成员，toSeq为0时返回fromSeq之后的至多MaxSeqRange条
+func (r *records) ListRecordsBySeq(ctx context.Context, subject string, conversationID, fromSeq, toSeq int64) (*SeqRange, error) {
+	if fromSeq <= 0 {
+		return nil, errors.New(errors.InvalidArgument, nil, "invalid from_seq")
+	}
+	if toSeq == 0 {
+		toSeq = fromSeq + MaxSeqRange - 1
+	}
+	if toSeq < fromSeq {
+		return nil, errors.New(errors.InvalidArgument, nil, "to_seq must not be less than from_seq")
+	}
+	if toSeq-fromSeq >= MaxSeqRange {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "一次最多获取%d条消息", MaxSeqRange)
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.storage.GetConversationByID(ses, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SeqRange{Conversation: c}
+	switch c.Kind {
+	case entity.RecordKindPrivate:
+		if !c.HasParty(subject) {
+			return nil, errors.New(errors.PermissionDenied, nil, "你无法查看该会话")
+		}
+		if res.Privates, err = r.storage.ListRecordPrivatesBySeq(ses, c.ID, fromSeq, toSeq); err != nil {
+			return nil, err
+		}
+	case entity.RecordKindGroup:
+		ok, err := r.storage.IsMemberOfGroup(ses, subject, c.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "你无法查看该会话")
+		}
+		if res.Groups, err = r.storage.ListRecordGroupsBySeq(ses, c.ID, fromSeq, toSeq); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// BuildForward bundle为true时所有原消息合并为一条聊天记录，否则每条原消息单独转发
+func (r *records) BuildForward(ctx context.Context, subject string, sources []ForwardSource, bundle bool) ([]*entity.Forward, error) {
+	if len(sources) == 0 {
+		return nil, errors.New(errors.InvalidArgument, nil, "empty records")
+	}
+	if len(sources) > MaxForwardSources {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "一次最多转发%d条消息", MaxForwardSources)
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*entity.ForwardItem, 0, len(sources))
+	for _, src := range sources {
+		item, err := r.forwardItem(ses, subject, src)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	var res []*entity.Forward
+	if bundle {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		})
+		res = []*entity.Forward{{Bundle: true, Items: items}}
+	} else {
+		res = make([]*entity.Forward, 0, len(items))
+		for _, item := range items {
+			res = append(res, &entity.Forward{Items: []*entity.ForwardItem{item}})
+		}
+	}
+
+	for _, fwd := range res {
+		if fwd.Depth() > MaxForwardDepth {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "聊天记录最多嵌套%d层", MaxForwardDepth)
+		}
+	}
+	return res, nil
+}
+
+// InsertForwards 在一个事务中将forwards逐条发送到target，任意一条失败时全部不发送
+func (r *records) InsertForwards(ctx context.Context, sender string, target ForwardTarget, forwards []*entity.Forward) ([]*SendResult, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	ctx = storage.WithContext(ctx, ses)
+	res := make([]*SendResult, 0, len(forwards))
+	for _, fwd := range forwards {
+		opts := SendOptions{Forward: fwd, ChannelID: target.ChannelID, ClearDraft: true}
+		var rs *SendResult
+		switch target.Kind {
+		case entity.RecordKindPrivate:
+			rs, err = r.InsertRecordPrivate(ctx, sender, fwd.Summary(), target.Receiver, opts)
+		case entity.RecordKindGroup:
+			rs, err = r.InsertRecordGroup(ctx, sender, fwd.Summary(), target.GroupID, opts)
+		default:
+			return nil, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", target.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rs)
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// forwardItem 读取原消息并校验subject是私聊的一方且仍是好友，或仍是群成员
+func (r *records) forwardItem(ses storage.Session, subject string, src ForwardSource) (*entity.ForwardItem, error) {
+	var item *entity.ForwardItem
+	var fwd *entity.Forward
+	switch src.Kind {
+	case entity.RecordKindPrivate:
+		rcd, err := r.storage.GetRecordPrivateByID(ses, src.ID)
+		if err != nil {
+			return nil, err
+		}
+		peer := rcd.Receiver
+		if rcd.Receiver == subject {
+			peer = rcd.Sender
+		} else if rcd.Sender != subject {
+			return nil, errors.Newf(errors.PermissionDenied, nil, "你不可以转发消息%d", src.ID)
+		}
+		ok, err := r.storage.IsFriendOfUser(ses, subject, peer)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "对方不是你的好友")
+		}
+		// 服务端无法为新的接收者重新加密
+		if rcd.Encrypted() {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "加密消息%d不能转发", src.ID)
+		}
+		item = &entity.ForwardItem{Kind: src.Kind, RecordID: rcd.ID, Sender: rcd.Sender, Receiver: rcd.Receiver, Content: rcd.Content, StickerID: rcd.StickerID, CreatedAt: rcd.CreatedAt, ExpiresAt: rcd.ExpiresAt}
+		fwd = rcd.Forward
+	case entity.RecordKindGroup:
+		rcd, err := r.storage.GetRecordGroupByID(ses, src.ID)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := r.storage.IsMemberOfGroup(ses, subject, rcd.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+		}
+		item = &entity.ForwardItem{Kind: src.Kind, RecordID: rcd.ID, Sender: rcd.Sender, GroupID: rcd.GroupID, Content: rcd.Content, PollID: rcd.PollID, StickerID: rcd.StickerID, CreatedAt: rcd.CreatedAt, ExpiresAt: rcd.ExpiresAt}
+		fwd = rcd.Forward
+	default:
+		return nil, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", src.Kind)
+	}
+
+	if fwd == nil {
+		return item, nil
+	}
+	// 转发一条转发的消息时保留最初的来源，转发合并的聊天记录时保留其内容
+	if !fwd.Bundle && len(fwd.Items) == 1 {
+		orig := *fwd.Items[0]
+		orig.ExpiresAt = entity.EarliestTime(orig.ExpiresAt, item.ExpiresAt)
+		return &orig, nil
+	}
+	item.Forward = fwd
+	return item, nil
+}
+
+// containsHan 中文不以空格分词，tsvector的simple解析器无法切分，需要走trigram匹配
+func containsHan(s string) bool {
+	for _, c := range s {
+		if unicode.Is(unicode.Han, c) {
+			return true
+		}
+	}
+	return false
+}
+
+const snippetRadius = 20
+
+// highlight 截取keyword附近的片段并用<b></b>标记关键词，片段中的内容做HTML转义
+func highlight(content, keyword string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	kw := []rune(strings.ToLower(keyword))
+
+	idx := -1
+	for i := 0; i+len(kw) <= len(lower); i++ {
+		if string(lower[i:i+len(kw)]) == string(kw) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || len(lower) != len(runes) {
+		return html.EscapeString(content)
+	}
+
+	start, end := idx-snippetRadius, idx+len(kw)+snippetRadius
+	prefix, suffix := "...", "..."
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(runes) {
+		end, suffix = len(runes), ""
+	}
+
+	return prefix + html.EscapeString(string(runes[start:idx])) +
+		"<b>" + html.EscapeString(string(runes[idx:idx+len(kw)])) + "</b>" +
+		html.EscapeString(string(runes[idx+len(kw):end])) + suffix
+}
+
+// snippetMarker 转义ts_headline返回的片段后，将标记关键词的控制字符替换为<b></b>
+var snippetMarker = strings.NewReplacer(entity.SnippetStartSel, "<b>", entity.SnippetStopSel, "</b>")
+
+func markSnippet(snippet string) string {
+	return snippetMarker.Replace(html.EscapeString(snippet))
+}
+
+// ListInbox 按最后活跃时间倒序列出owner的会话，返回结果和下一页的游标
+func (r *records) ListInbox(ctx context.Context, owner, cursor string, limit int) ([]*entity.InboxEntry, string, error) {
+	c, err := entity.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", errors.New(errors.InvalidArgument, err, "invalid cursor")
+	}
+	limit = pageLimit(limit)
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, err := r.storage.ListInboxEntriesByOwner(ses, owner, c, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(res) == limit {
+		last := res[len(res)-1]
+		next = (&entity.Cursor{CreatedAt: last.LastAt, Kind: last.Kind, ID: last.ID}).Encode()
+	}
+
+	return res, next, nil
+}
+
+func (r *records) GetInboxEntry(ctx context.Context, owner, kind, peer string, groupID int64) (*entity.InboxEntry, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.storage.GetInboxEntry(ses, owner, kind, peer, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *records) ListInboxEntriesOfGroup(ctx context.Context, groupID int64) ([]*entity.InboxEntry, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.storage.ListInboxEntriesByGroup(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// MarkInboxRead 清空owner在该会话的未读数，群会话会将所有频道标记为已读
+func (r *records) MarkInboxRead(ctx context.Context, owner, kind, peer string, groupID int64) error {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.storage.GetInboxEntry(ses, owner, kind, peer, groupID)
+	if err != nil {
+		return err
+	}
+
+	if kind == entity.RecordKindGroup {
+		return r.storage.MarkGroupChannelsRead(ses, groupID, owner, time.Now().UTC())
+	}
+	if err = r.storage.ResetInboxEntryUnreadCount(ses, owner, kind, peer, groupID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddBookmark 收藏owner可以查看的消息，重复收藏时更新备注
+func (r *records) AddBookmark(ctx context.Context, owner, kind string, recordID int64, note string) (*entity.Bookmark, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > maxBookmarkNoteLen {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "备注不能超过%d个字符", maxBookmarkNoteLen)
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &entity.Bookmark{Owner: owner, Kind: kind, RecordID: recordID, Note: note}
+	switch kind {
+	case entity.RecordKindPrivate:
+		rcd, err := r.storage.GetRecordPrivateByID(ses, recordID)
+		if err != nil {
+			return nil, err
+		}
+		if rcd.Sender != owner && rcd.Receiver != owner {
+			return nil, errors.Newf(errors.PermissionDenied, nil, "你无法查看消息%d", recordID)
+		}
+		res.Sender, res.Receiver, res.Content, res.RecordCreatedAt = rcd.Sender, rcd.Receiver, rcd.Content, &rcd.CreatedAt
+	case entity.RecordKindGroup:
+		rcd, err := r.storage.GetRecordGroupByID(ses, recordID)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := r.storage.IsMemberOfGroup(ses, owner, rcd.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+		}
+		res.Sender, res.GroupID, res.Content, res.RecordCreatedAt = rcd.Sender, rcd.GroupID, rcd.Content, &rcd.CreatedAt
+	case entity.RecordKindBroadcast:
+		rcd, err := r.storage.GetRecordBroadcastByID(ses, recordID)
+		if err != nil {
+			return nil, err
+		}
+		res.Sender, res.Content, res.RecordCreatedAt = rcd.Sender, rcd.Content, &rcd.CreatedAt
+	default:
+		return nil, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", kind)
+	}
+
+	if err = r.storage.UpsertBookmark(ses, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *records) RemoveBookmark(ctx context.Context, owner, kind string, recordID int64) error {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.storage.DeleteBookmark(ses, owner, kind, recordID)
+}
+
+// ListBookmarks 按收藏时间倒序列出owner的收藏，返回结果和下一页的游标
+func (r *records) ListBookmarks(ctx context.Context, owner, cursor string, limit int) ([]*entity.Bookmark, string, error) {
+	c, err := entity.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", errors.New(errors.InvalidArgument, err, "invalid cursor")
+	}
+	limit = pageLimit(limit)
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, err := r.storage.ListBookmarksByOwner(ses, owner, c, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(res) == limit {
+		last := res[len(res)-1]
+		next = (&entity.Cursor{CreatedAt: last.CreatedAt, Kind: last.Kind, ID: last.ID}).Encode()
+	}
+
+	return res, next, nil
+}
+
+// SaveDraft 保存owner在会话中的草稿，content为空时清除草稿
+func (r *records) SaveDraft(ctx context.Context, owner, kind, peer string, groupID int64, content string) (*entity.Draft, error) {
+	if utf8.RuneCountInString(content) > maxDraftLen {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "草稿不能超过%d个字符", maxDraftLen)
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case entity.RecordKindPrivate:
+		if _, err = r.storage.GetUserBySubject(ses, peer); err != nil {
+			return nil, err
+		}
+		groupID = 0
+	case entity.RecordKindGroup:
+		ok, err := r.storage.IsMemberOfGroup(ses, owner, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "你不是该群成员")
+		}
+		peer = ""
+	default:
+		return nil, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", kind)
+	}
+
+	res := &entity.Draft{Owner: owner, Kind: kind, Peer: peer, GroupID: groupID, Content: content}
+	if strings.TrimSpace(content) == "" {
+		if _, err = r.storage.DeleteDraft(ses, owner, kind, peer, groupID); err != nil {
+			return nil, err
+		}
+		res.Content, res.UpdatedAt = "", time.Now().UTC()
+		return res, nil
+	}
+
+	if err = r.storage.UpsertDraft(ses, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *records) ListDrafts(ctx context.Context, owner string) ([]*entity.Draft, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.storage.ListDraftsByOwner(ses, owner)
+}
+
+// SetPrivateRetention 设置subject和peer私聊的保留时长，maxAge为0时取消保留策略
+func (r *records) SetPrivateRetention(ctx context.Context, subject, peer string, maxAge time.Duration) error {
+	if maxAge < 0 {
+		return errors.New(errors.InvalidArgument, nil, "negative retention")
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.storage.GetUserBySubject(ses, peer)
+	if err != nil {
+		return err
+	}
+
+	if maxAge == 0 {
+		return r.storage.DeletePrivateRetentionPolicy(ses, subject, peer)
+	}
+	return r.storage.UpsertPrivateRetentionPolicy(ses, subject, peer, maxAge, subject)
+}
+
+func (r *records) GetPrivateRetention(ctx context.Context, subject, peer string) (*entity.RetentionPolicy, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.storage.GetPrivateRetentionPolicy(ses, subject, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// SetGroupRetention 设置群消息的保留时长，maxAge为0时取消保留策略
+func (r *records) SetGroupRetention(ctx context.Context, groupID int64, maxAge time.Duration, updatedBy string) error {
+	if maxAge < 0 {
+		return errors.New(errors.InvalidArgument, nil, "negative retention")
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.storage.GetGroupByID(ses, groupID)
+	if err != nil {
+		return err
+	}
+
+	if maxAge == 0 {
+		return r.storage.DeleteGroupRetentionPolicy(ses, groupID)
+	}
+	return r.storage.UpsertGroupRetentionPolicy(ses, groupID, maxAge, updatedBy)
+}
+
+func (r *records) GetGroupRetention(ctx context.Context, groupID int64) (*entity.RetentionPolicy, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.storage.GetGroupRetentionPolicy(ses, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// PurgeExpiredRecords 分批清理TTL到期或超过保留策略的消息，返回所有被清理的消息
+func (r *records) PurgeExpiredRecords(ctx context.Context) ([]*entity.ExpiredRecord, error) {
+	purges := []struct {
+		kind  string
+		purge func(ses storage.Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error)
+	}{
+		{entity.RecordKindPrivate, r.storage.PurgeExpiredRecordPrivates},
+		{entity.RecordKindGroup, r.storage.PurgeExpiredRecordGroups},
+		{entity.RecordKindBroadcast, r.storage.PurgeExpiredRecordBroadcasts},
+	}
+
+	var res []*entity.ExpiredRecord
+	for _, p := range purges {
+		for {
+			batch, err := r.purgeBatch(ctx, p.kind, p.purge)
+			if err != nil {
+				return res, err
+			}
+			res = append(res, batch...)
+			if len(batch) < purgeBatchSize {
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// purgeBatch 在一个事务中清理一批消息，并清空以这些消息为最后一条消息的会话预览
+func (r *records) purgeBatch(ctx context.Context, kind string, purge func(ses storage.Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error)) ([]*entity.ExpiredRecord, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	res, err := purge(ses, time.Now().UTC(), purgeBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind != entity.RecordKindBroadcast {
+		ids := make([]int64, 0, len(res))
+		for _, rcd := range res {
+			ids = append(ids, rcd.ID)
+		}
+		if err = r.storage.ClearInboxEntriesPreview(ses, kind, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
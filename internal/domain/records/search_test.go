@@ -0,0 +1,19 @@
+package records
+
+import "testing"
+
+func TestHighlightEscapesContent(t *testing.T) {
+	got := highlight(`<i onclick=x> hello`, "hello")
+	expected := "&lt;i onclick=x&gt; <b>hello</b>"
+	if got != expected {
+		t.Errorf("expected %s, but got %s", expected, got)
+	}
+}
+
+func TestMarkSnippet(t *testing.T) {
+	got := markSnippet("<script>\x02hello\x03</script>")
+	expected := "&lt;script&gt;<b>hello</b>&lt;/script&gt;"
+	if got != expected {
+		t.Errorf("expected %s, but got %s", expected, got)
+	}
+}
@@ -0,0 +1,45 @@
+package records
+
+import (
+	"fmt"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// SlowModeError 慢速模式下发言过于频繁，RetryAt之后才能再次发言。错误码为ResourceExhausted
+type SlowModeError struct {
+	GroupID int64
+	RetryAt time.Time
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("群[%d]开启了慢速模式，请在%s之后再发言", e.GroupID, e.RetryAt.Format(time.DateTime))
+}
+
+func (e *SlowModeError) Unwrap() error {
+	return errors.New(errors.ResourceExhausted, nil, "slow mode")
+}
+
+// RetryAfter 距离可以再次发言的时间，向上取整到秒
+func (e *SlowModeError) RetryAfter(now time.Time) time.Duration {
+	d := e.RetryAt.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	return (d + time.Second - 1).Truncate(time.Second)
+}
+
+// claimPostSlot 占用sender在群内的发言间隔，距上次发言不足d时返回SlowModeError，时间以数据库为准
+func (r *records) claimPostSlot(ses storage.Session, sender string, groupID int64, d time.Duration) error {
+	retryAt, err := r.storage.ClaimGroupPostSlot(ses, sender, groupID, d)
+	if err != nil {
+		return err
+	}
+	if retryAt == nil {
+		return nil
+	}
+
+	return &SlowModeError{GroupID: groupID, RetryAt: *retryAt}
+}
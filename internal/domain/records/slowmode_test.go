@@ -0,0 +1,79 @@
+package records
+
+import (
+	"context"
+	stderr "errors"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowModeErrorRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		retryAt time.Time
+		want    time.Duration
+	}{
+		{now.Add(-time.Second), 0},
+		{now, 0},
+		{now.Add(time.Millisecond), time.Second},
+		{now.Add(2 * time.Second), 2 * time.Second},
+		{now.Add(2*time.Second + time.Nanosecond), 3 * time.Second},
+	}
+	for _, c := range cases {
+		e := &SlowModeError{GroupID: 1, RetryAt: c.retryAt}
+		require.Equal(t, c.want, e.RetryAfter(now), c.retryAt)
+	}
+
+	var err error = &SlowModeError{GroupID: 1, RetryAt: now}
+	require.Equal(t, errors.ResourceExhausted, errors.Code(err))
+}
+
+// slowStorage 群开启了慢速模式，成员总是处于发言间隔内
+type slowStorage struct {
+	groupStorage
+
+	roles   map[string]string
+	retryAt time.Time
+	claimed []string
+}
+
+func (s *slowStorage) GetGroupByID(ses storage.Session, id int64) (*entity.Group, error) {
+	return &entity.Group{ID: id, Owner: "owner", SlowMode: 30}, nil
+}
+
+func (s *slowStorage) GetGroupMember(ses storage.Session, userSubject string, groupID int64) (*entity.GroupMember, error) {
+	return &entity.GroupMember{UserSubject: userSubject, GroupID: groupID, Role: s.roles[userSubject]}, nil
+}
+
+func (s *slowStorage) ClaimGroupPostSlot(ses storage.Session, userSubject string, groupID int64, interval time.Duration) (*time.Time, error) {
+	s.claimed = append(s.claimed, userSubject)
+	return &s.retryAt, nil
+}
+
+func TestSlowModeExemptionUsesRolePermissions(t *testing.T) {
+	roles := map[string]string{"admin": entity.GroupRoleAdmin, "mod": "moderator"}
+	st := &slowStorage{groupStorage: groupStorage{fakeStorage: fakeStorage{ses: &fakeSession{}}}, roles: roles, retryAt: time.Now().UTC().Add(time.Minute)}
+	r := &records{
+		storage: st,
+		group: &fakeGroup{roles: roles, perms: map[string][]entity.GroupPermission{
+			// admin被收回了禁言权限，自定义角色moderator被授予了禁言权限
+			entity.GroupRoleAdmin: {entity.GroupPermPost},
+			"moderator":           {entity.GroupPermPost, entity.GroupPermMute},
+		}},
+	}
+
+	_, err := r.InsertRecordGroup(context.Background(), "mod", "hi", 1, SendOptions{})
+	require.Nil(t, err)
+
+	_, err = r.InsertRecordGroup(context.Background(), "admin", "hi", 1, SendOptions{})
+	var slow *SlowModeError
+	require.True(t, stderr.As(err, &slow))
+	require.Equal(t, st.retryAt, slow.RetryAt)
+	require.Equal(t, []string{"admin"}, st.claimed)
+}
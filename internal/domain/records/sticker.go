@@ -0,0 +1,178 @@
+package records
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+const (
+	maxStickerPackNameLen = 64
+	maxStickerNameLen     = 32
+	maxStickersPerPack    = 64
+	maxStickerSize        = 512 << 10
+)
+
+// stickerExts 支持的表情格式及其扩展名
+var stickerExts = map[string]string{
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/jpeg": ".jpg",
+}
+
+// StickerUpload 上传的一个表情，格式由文件内容识别
+type StickerUpload struct {
+	Name string
+	Body io.Reader
+}
+
+// CreateStickerPack groupID为0时创建全局表情包，由调用方校验creator的权限
+func (r *records) CreateStickerPack(ctx context.Context, creator string, groupID int64, name string, uploads []StickerUpload) (*entity.StickerPack, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxStickerPackNameLen {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "表情包名称不能为空且不能超过%d个字符", maxStickerPackNameLen)
+	}
+	if len(uploads) == 0 || len(uploads) > maxStickersPerPack {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "表情包须包含1到%d个表情", maxStickersPerPack)
+	}
+	for _, u := range uploads {
+		if u.Name == "" || utf8.RuneCountInString(u.Name) > maxStickerNameLen {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "表情名称不能为空且不能超过%d个字符", maxStickerNameLen)
+		}
+	}
+
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupID != 0 {
+		if _, err = r.storage.GetGroupByID(ses, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	// 表情文件和表情包在同一个事务中写入，失败时一起回滚
+	txCtx := storage.WithContext(ctx, ses)
+	pack := &entity.StickerPack{GroupID: groupID, Name: name, CreatedBy: creator}
+	for _, u := range uploads {
+		s, err := r.putSticker(txCtx, u)
+		if err != nil {
+			return nil, err
+		}
+		pack.Stickers = append(pack.Stickers, s)
+	}
+
+	if err = r.storage.InsertStickerPack(ses, pack); err != nil {
+		return nil, err
+	}
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+
+	return pack, nil
+}
+
+// putSticker 按文件内容识别格式并保存到附件存储
+func (r *records) putSticker(ctx context.Context, u StickerUpload) (*entity.Sticker, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(u.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := stickerExts[contentType]
+	if !ok {
+		return nil, errors.Newf(errors.InvalidArgument, nil, "不支持的表情格式: %s", contentType)
+	}
+
+	key, size, err := r.attachments.Put(ctx, "stickers", ext, io.MultiReader(bytes.NewReader(head[:n]), u.Body), maxStickerSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.Sticker{Name: u.Name, ContentType: contentType, Size: size, FileKey: key}, nil
+}
+
+// ListStickerPacks 列出subject可以使用的表情包
+func (r *records) ListStickerPacks(ctx context.Context, subject string) ([]*entity.StickerPack, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.storage.ListStickerPacksBySubject(ses, subject)
+}
+
+// GetSticker 查询subject可以使用的表情，群表情包只对群成员可见
+func (r *records) GetSticker(ctx context.Context, subject string, id int64) (*entity.Sticker, error) {
+	ses, err := r.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.stickerOf(ses, subject, id)
+}
+
+// OpenSticker 读取表情的文件
+func (r *records) OpenSticker(ctx context.Context, subject string, id int64) (*entity.Sticker, io.ReadSeeker, error) {
+	s, err := r.GetSticker(ctx, subject, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := r.attachments.Open(ctx, s.FileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, f, nil
+}
+
+func (r *records) stickerOf(ses storage.Session, subject string, id int64) (*entity.Sticker, error) {
+	s, err := r.storage.GetSticker(ses, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.GroupID == 0 {
+		return s, nil
+	}
+
+	ok, err := r.storage.IsMemberOfGroup(ses, subject, s.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Newf(errors.PermissionDenied, nil, "你无法使用表情%d", id)
+	}
+
+	return s, nil
+}
+
+// checkSticker 校验sender可以在该会话中发送表情，群表情包只能在本群中使用，groupID为0表示私聊
+func (r *records) checkSticker(ses storage.Session, sender string, sticker *entity.Sticker, groupID int64) error {
+	s, err := r.stickerOf(ses, sender, sticker.ID)
+	if err != nil {
+		return err
+	}
+	if s.GroupID != 0 && s.GroupID != groupID {
+		return errors.New(errors.PermissionDenied, nil, "群表情只能在本群中使用")
+	}
+
+	*sticker = *s
+	return nil
+}
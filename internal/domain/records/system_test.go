@@ -0,0 +1,66 @@
+package records
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// groupStorage 记录写入的群消息和被删除草稿的成员
+type groupStorage struct {
+	fakeStorage
+
+	groups        []*entity.RecordGroup
+	draftsDeleted []string
+	reads         map[string]int64
+}
+
+func (s *groupStorage) GetGroupByID(ses storage.Session, id int64) (*entity.Group, error) {
+	return &entity.Group{ID: id, Owner: "owner", MutedAll: true}, nil
+}
+
+func (s *groupStorage) GetDefaultGroupChannel(ses storage.Session, groupID int64) (*entity.GroupChannel, error) {
+	return &entity.GroupChannel{ID: 1, GroupID: groupID, IsDefault: true}, nil
+}
+
+func (s *groupStorage) InsertRecordGroup(ses storage.Session, i *entity.RecordGroup) (int64, error) {
+	s.groups = append(s.groups, i)
+	i.ID = int64(len(s.groups))
+	i.Seq = i.ID
+	return i.ID, nil
+}
+
+func (s *groupStorage) UpsertGroupChannelRead(ses storage.Session, channelID int64, subject string, seq int64, now time.Time) error {
+	if s.reads == nil {
+		s.reads = make(map[string]int64)
+	}
+	s.reads[subject] = seq
+	return nil
+}
+
+func (s *groupStorage) UpsertInboxEntriesForRecordGroup(ses storage.Session, recordID int64, i *entity.RecordGroup) error {
+	return nil
+}
+
+func (s *groupStorage) DeleteDraft(ses storage.Session, owner, kind, peer string, groupID int64) (bool, error) {
+	s.draftsDeleted = append(s.draftsDeleted, owner)
+	return true, nil
+}
+
+func TestSystemMessageUsesNeutralSender(t *testing.T) {
+	st := &groupStorage{fakeStorage: fakeStorage{ses: &fakeSession{}}}
+	r := &records{storage: st}
+
+	res, err := r.InsertRecordGroup(context.Background(), "owner", "member 被禁言", 1, SendOptions{System: true})
+	require.Nil(t, err)
+	require.False(t, res.DraftCleared)
+	require.Len(t, st.groups, 1)
+	require.Equal(t, entity.SystemSubject, st.groups[0].Sender)
+	require.True(t, st.groups[0].System)
+	require.Empty(t, st.draftsDeleted)
+}
@@ -0,0 +1,346 @@
+package schedule
+
+import (
+	"context"
+	stderr "errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+type CreateInput struct {
+	Sender   string
+	Kind     string
+	Receiver string
+	GroupID  int64
+	// ChannelID 群消息所在的频道，为0时发送到默认频道
+	ChannelID int64
+	Content   string
+	SendAt    time.Time
+}
+
+type Schedule interface {
+	CreateScheduledMessage(ctx context.Context, input CreateInput) (int64, error)
+	GetScheduledMessage(ctx context.Context, id int64) (*entity.ScheduledMessage, error)
+	ListPendingScheduledMessages(ctx context.Context, sender string) ([]*entity.ScheduledMessage, error)
+	UpdateScheduledMessage(ctx context.Context, id int64, content string, sendAt time.Time) error
+	CancelScheduledMessage(ctx context.Context, id int64) error
+
+	// DispatchDueMessages 通过hub发送所有到期的消息，返回发送的条数
+	DispatchDueMessages(ctx context.Context, hub hub.Hub) (int, error)
+}
+
+// dispatchBatchSize 每轮最多锁定并发送的消息数
+const dispatchBatchSize = 100
+
+func New(env environment.Env, logger logger.Logger, storage storage.Storage, record records.Records, group group.Group) (Schedule, error) {
+	return &schedule{
+		logger:  logger,
+		storage: storage,
+		record:  record,
+		group:   group,
+	}, nil
+}
+
+type schedule struct {
+	logger logger.Logger
+
+	storage storage.Storage
+	record  records.Records
+	group   group.Group
+}
+
+// checkContent 定时消息的内容不能为空，长度限制与立即发送的消息相同
+func checkContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errors.New(errors.InvalidArgument, nil, "empty content")
+	}
+	if utf8.RuneCountInString(content) > records.MaxContentLen {
+		return "", errors.Newf(errors.InvalidArgument, nil, "消息不能超过%d个字符", records.MaxContentLen)
+	}
+	return content, nil
+}
+
+func (s *schedule) CreateScheduledMessage(ctx context.Context, input CreateInput) (int64, error) {
+	content, err := checkContent(input.Content)
+	if err != nil {
+		return 0, err
+	}
+	if !input.SendAt.After(time.Now()) {
+		return 0, errors.New(errors.InvalidArgument, nil, "发送时间必须晚于当前时间")
+	}
+
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	i := &entity.ScheduledMessage{
+		Sender:  input.Sender,
+		Kind:    input.Kind,
+		Content: content,
+		SendAt:  input.SendAt.UTC(),
+		Status:  entity.ScheduleStatusPending,
+	}
+	switch input.Kind {
+	case entity.RecordKindPrivate:
+		ok, err := s.storage.IsFriendOfUser(ses, input.Sender, input.Receiver)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New(errors.PermissionDenied, nil, "对方不是你的好友")
+		}
+		i.Receiver = input.Receiver
+	case entity.RecordKindGroup:
+		if err = s.group.Authorize(ctx, input.GroupID, input.Sender, entity.GroupPermPost); err != nil {
+			return 0, err
+		}
+		if input.ChannelID != 0 {
+			ch, err := s.storage.GetGroupChannel(ses, input.ChannelID)
+			if err != nil {
+				return 0, err
+			}
+			if ch.GroupID != input.GroupID {
+				return 0, errors.Newf(errors.NotFound, nil, "群[%d]没有频道[%d]", input.GroupID, input.ChannelID)
+			}
+		}
+		i.GroupID, i.ChannelID = input.GroupID, input.ChannelID
+	case entity.RecordKindBroadcast:
+	default:
+		return 0, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", input.Kind)
+	}
+
+	id, err := s.storage.InsertScheduledMessage(ses, i)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *schedule) GetScheduledMessage(ctx context.Context, id int64) (*entity.ScheduledMessage, error) {
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.storage.GetScheduledMessage(ses, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *schedule) ListPendingScheduledMessages(ctx context.Context, sender string) ([]*entity.ScheduledMessage, error) {
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.storage.ListScheduledMessagesBySender(ses, sender, entity.ScheduleStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no pending scheduled messages from %s", sender)
+	}
+
+	return res, nil
+}
+
+func (s *schedule) UpdateScheduledMessage(ctx context.Context, id int64, content string, sendAt time.Time) error {
+	content, err := checkContent(content)
+	if err != nil {
+		return err
+	}
+	if !sendAt.After(time.Now()) {
+		return errors.New(errors.InvalidArgument, nil, "发送时间必须晚于当前时间")
+	}
+
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.storage.UpdatePendingScheduledMessage(ses, id, content, sendAt.UTC())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Newf(errors.FailedPrecondition, nil, "定时消息[%d]已经发送或取消", id)
+	}
+
+	return nil
+}
+
+func (s *schedule) CancelScheduledMessage(ctx context.Context, id int64) error {
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.storage.UpdateScheduledMessageStatus(ses, id, entity.ScheduleStatusPending, entity.ScheduleStatusCanceled, "")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Newf(errors.FailedPrecondition, nil, "定时消息[%d]已经发送或取消", id)
+	}
+
+	return nil
+}
+
+// delivery 已写入、待事务提交后推送的定时消息
+type delivery struct {
+	m    *entity.ScheduledMessage
+	opts records.SendOptions
+	res  *records.SendResult
+}
+
+// DispatchDueMessages 在同一个事务中锁定到期消息、写入聊天记录并标记为已发送，
+// 事务提交前其它实例会跳过这些被锁定的行，重启后未提交的消息会被重新发送，从而保证只写入一次。
+// 事务提交后才通过hub推送，客户端不会收到没有写入的消息，推送时也不再持有行锁
+func (s *schedule) DispatchDueMessages(ctx context.Context, hub hub.Hub) (int, error) {
+	delivered, err := s.dispatchDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range delivered {
+		if err = s.publish(ctx, hub, d); err != nil {
+			// 消息已经写入，客户端可以通过拉取补齐，推送失败不影响发送结果
+			s.logger.Warnf("publish scheduled message %d failed: %v", d.m.ID, err)
+		}
+	}
+
+	return len(delivered), nil
+}
+
+// dispatchDue 写入到期的消息并提交，返回提交成功且需要推送的消息
+func (s *schedule) dispatchDue(ctx context.Context) ([]*delivery, error) {
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ses, err = ses.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer ses.Rollback()
+
+	due, err := s.storage.ListDueScheduledMessagesForUpdate(ses, time.Now().UTC(), dispatchBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivered []*delivery
+	for _, m := range due {
+		// 每条消息一个savepoint，单条失败不影响同批次的其它消息
+		sp, err := ses.Begin()
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := s.deliver(storage.WithContext(ctx, sp), m)
+		if err != nil {
+			if rbErr := sp.Rollback(); rbErr != nil {
+				return nil, rbErr
+			}
+			// 慢速模式下推迟到可以发言的时间，而不是直接失败
+			var slow *records.SlowModeError
+			if stderr.As(err, &slow) {
+				s.logger.Infof("postpone scheduled message %d to %s: %v", m.ID, slow.RetryAt, err)
+				if _, err = s.storage.UpdatePendingScheduledMessage(ses, m.ID, m.Content, slow.RetryAt); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			s.logger.Warnf("dispatch scheduled message %d failed: %v", m.ID, err)
+			if _, err = s.storage.UpdateScheduledMessageStatus(ses, m.ID, entity.ScheduleStatusPending, entity.ScheduleStatusFailed, errors.Code(err).String()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err = s.storage.UpdateScheduledMessageStatus(sp, m.ID, entity.ScheduleStatusPending, entity.ScheduleStatusSent, ""); err != nil {
+			return nil, err
+		}
+		if err = sp.Commit(); err != nil {
+			return nil, err
+		}
+		// 重试时已经写入过的消息不再推送
+		if !d.res.Duplicate {
+			delivered = append(delivered, d)
+		}
+	}
+
+	if err = ses.Commit(); err != nil {
+		return nil, err
+	}
+	return delivered, nil
+}
+
+// deliver 发送前重新校验好友关系和群内的发言权限，它们可能在预约之后发生了变化；只写入聊天记录，不推送
+func (s *schedule) deliver(ctx context.Context, m *entity.ScheduledMessage) (*delivery, error) {
+	ses, err := s.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 以预约消息ID作为客户端消息ID，派发重试时不会重复写入
+	d := &delivery{m: m, opts: records.SendOptions{ClientMsgID: records.ScheduledClientMsgID(m.ID), ChannelID: m.ChannelID}}
+	switch m.Kind {
+	case entity.RecordKindPrivate:
+		ok, err := s.storage.IsFriendOfUser(ses, m.Sender, m.Receiver)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "对方不是你的好友")
+		}
+		if d.res, err = s.record.InsertRecordPrivate(ctx, m.Sender, m.Content, m.Receiver, d.opts); err != nil {
+			return nil, err
+		}
+	case entity.RecordKindGroup:
+		if err = s.group.Authorize(ctx, m.GroupID, m.Sender, entity.GroupPermPost); err != nil {
+			return nil, err
+		}
+		if d.res, err = s.record.InsertRecordGroup(ctx, m.Sender, m.Content, m.GroupID, d.opts); err != nil {
+			return nil, err
+		}
+	case entity.RecordKindBroadcast:
+		if d.res, err = s.record.InsertRecordBroadcast(ctx, m.Sender, m.Content, d.opts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", m.Kind)
+	}
+
+	return d, nil
+}
+
+func (s *schedule) publish(ctx context.Context, hub hub.Hub, d *delivery) error {
+	m := d.m
+	switch m.Kind {
+	case entity.RecordKindPrivate:
+		return hub.PublishPrivateMessage(ctx, m.Sender, m.Content, m.Receiver, d.opts, d.res)
+	case entity.RecordKindGroup:
+		return hub.PublishGroupMessage(ctx, m.Sender, m.Content, m.GroupID, d.opts, d.res)
+	case entity.RecordKindBroadcast:
+		return hub.PublishBroadcastMessage(ctx, m.Sender, m.Content, d.opts, d.res)
+	}
+
+	return nil
+}
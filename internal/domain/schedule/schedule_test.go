@@ -0,0 +1,321 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/environment"
+	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSession 记录顶层事务是否已提交，与Tx一样第一次Begin开启事务，之后的Begin返回savepoint
+type fakeSession struct {
+	root      *fakeSession
+	begun     bool
+	committed bool
+	commitErr error
+}
+
+func (s *fakeSession) Begin() (storage.Session, error) {
+	if s.root == nil && !s.begun {
+		s.begun = true
+		return s, nil
+	}
+	if s.root == nil {
+		return &fakeSession{root: s}, nil
+	}
+	return &fakeSession{root: s.root}, nil
+}
+
+func (s *fakeSession) Rollback() error { return nil }
+
+func (s *fakeSession) Commit() error {
+	if s.root != nil {
+		return nil
+	}
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	s.committed = true
+	return nil
+}
+
+func (s *fakeSession) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (s *fakeSession) Query(query string, args ...any) (*sql.Rows, error) { return nil, nil }
+func (s *fakeSession) QueryRow(query string, args ...any) *sql.Row        { return nil }
+
+type fakeStorage struct {
+	storage.Storage
+
+	ses      *fakeSession
+	due      []*entity.ScheduledMessage
+	statuses map[int64]entity.ScheduleStatus
+	reasons  map[int64]string
+	sendAts  map[int64]time.Time
+}
+
+func (s *fakeStorage) NewSession(ctx context.Context) (storage.Session, error) {
+	if ses := storage.FromContext(ctx); ses != nil {
+		return ses, nil
+	}
+	return s.ses, nil
+}
+
+func (s *fakeStorage) ListDueScheduledMessagesForUpdate(ses storage.Session, now time.Time, limit int) ([]*entity.ScheduledMessage, error) {
+	return s.due, nil
+}
+
+func (s *fakeStorage) UpdateScheduledMessageStatus(ses storage.Session, id int64, from, to entity.ScheduleStatus, reason string) (bool, error) {
+	s.statuses[id], s.reasons[id] = to, reason
+	return true, nil
+}
+
+func (s *fakeStorage) UpdatePendingScheduledMessage(ses storage.Session, id int64, content string, sendAt time.Time) (bool, error) {
+	s.sendAts[id] = sendAt
+	return true, nil
+}
+
+// GetGroupChannel 频道2属于群1，频道3属于群2
+func (s *fakeStorage) GetGroupChannel(ses storage.Session, id int64) (*entity.GroupChannel, error) {
+	return &entity.GroupChannel{ID: id, GroupID: id - 1}, nil
+}
+
+func (s *fakeStorage) IsFriendOfUser(ses storage.Session, userSubject, friendSubject string) (bool, error) {
+	return true, nil
+}
+
+// fakeGroup 只有denied中的成员没有发言权限
+type fakeGroup struct {
+	group.Group
+
+	denied map[string]bool
+}
+
+func (g *fakeGroup) Authorize(ctx context.Context, groupID int64, subject string, perm entity.GroupPermission) error {
+	if g.denied[subject] {
+		return errors.Newf(errors.PermissionDenied, nil, "你没有%s的权限", perm)
+	}
+	return nil
+}
+
+// slowRetryAt 内容为slow的消息在慢速模式下可以再次发言的时间
+var slowRetryAt = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeRecords 按内容决定写入结果：fail写入失败，dup为重复发送，slow触发慢速模式
+type fakeRecords struct {
+	records.Records
+}
+
+func (r *fakeRecords) insert(kind, content string) (*records.SendResult, error) {
+	switch content {
+	case "fail":
+		return nil, errors.New(errors.PermissionDenied, nil, "denied")
+	case "dup":
+		return &records.SendResult{Kind: kind, ID: 1, Duplicate: true}, nil
+	case "slow":
+		return nil, &records.SlowModeError{GroupID: 1, RetryAt: slowRetryAt}
+	}
+	return &records.SendResult{Kind: kind, ID: 1}, nil
+}
+
+func (r *fakeRecords) InsertRecordBroadcast(ctx context.Context, sender, content string, opts records.SendOptions) (*records.SendResult, error) {
+	return r.insert(entity.RecordKindBroadcast, content)
+}
+
+func (r *fakeRecords) InsertRecordGroup(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions) (*records.SendResult, error) {
+	return r.insert(entity.RecordKindGroup, content)
+}
+
+func (r *fakeRecords) InsertRecordPrivate(ctx context.Context, sender, content, receiver string, opts records.SendOptions) (*records.SendResult, error) {
+	return r.insert(entity.RecordKindPrivate, content)
+}
+
+// fakeHub 记录推送的消息，以及推送时事务是否已经提交
+type fakeHub struct {
+	hub.Hub
+
+	ses       *fakeSession
+	published []string
+	committed []bool
+	channels  []int64
+}
+
+func (h *fakeHub) publish(kind string) error {
+	h.published = append(h.published, kind)
+	h.committed = append(h.committed, h.ses.committed)
+	return nil
+}
+
+func (h *fakeHub) PublishBroadcastMessage(ctx context.Context, sender, content string, opts records.SendOptions, res *records.SendResult) error {
+	return h.publish(entity.RecordKindBroadcast)
+}
+
+func (h *fakeHub) PublishGroupMessage(ctx context.Context, sender, content string, groupID int64, opts records.SendOptions, res *records.SendResult) error {
+	h.channels = append(h.channels, opts.ChannelID)
+	return h.publish(entity.RecordKindGroup)
+}
+
+func (h *fakeHub) PublishPrivateMessage(ctx context.Context, sender, content, receiver string, opts records.SendOptions, res *records.SendResult) error {
+	return h.publish(entity.RecordKindPrivate)
+}
+
+func newTestSchedule(due ...*entity.ScheduledMessage) (*schedule, *fakeStorage, *fakeHub) {
+	st := &fakeStorage{
+		ses:      &fakeSession{},
+		due:      due,
+		statuses: make(map[int64]entity.ScheduleStatus),
+		reasons:  make(map[int64]string),
+		sendAts:  make(map[int64]time.Time),
+	}
+	s := &schedule{
+		logger:  logger.New(environment.Env{LogLevel: "FATAL"}),
+		storage: st,
+		record:  &fakeRecords{},
+		group:   &fakeGroup{denied: map[string]bool{"muted": true}},
+	}
+	return s, st, &fakeHub{ses: st.ses}
+}
+
+func TestDispatchPublishesAfterCommit(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindPrivate, Sender: "a", Receiver: "b", Content: "hi"},
+		&entity.ScheduledMessage{ID: 2, Kind: entity.RecordKindGroup, Sender: "a", GroupID: 1, Content: "hi"},
+		&entity.ScheduledMessage{ID: 3, Kind: entity.RecordKindBroadcast, Sender: "a", Content: "hi"},
+	)
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, []string{entity.RecordKindPrivate, entity.RecordKindGroup, entity.RecordKindBroadcast}, h.published)
+	require.Equal(t, []bool{true, true, true}, h.committed)
+	for id := int64(1); id <= 3; id++ {
+		require.Equal(t, entity.ScheduleStatusSent, st.statuses[id])
+	}
+}
+
+func TestDispatchFailedMessage(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindPrivate, Sender: "a", Receiver: "b", Content: "fail"},
+		&entity.ScheduledMessage{ID: 2, Kind: entity.RecordKindPrivate, Sender: "a", Receiver: "b", Content: "hi"},
+	)
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, entity.ScheduleStatusFailed, st.statuses[1])
+	require.Equal(t, errors.PermissionDenied.String(), st.reasons[1])
+	require.Equal(t, entity.ScheduleStatusSent, st.statuses[2])
+	require.Equal(t, []string{entity.RecordKindPrivate}, h.published)
+}
+
+func TestDispatchCommitFailureDoesNotPublish(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindGroup, Sender: "a", GroupID: 1, Content: "hi"},
+	)
+	st.ses.commitErr = errors.New(errors.Unavailable, nil, "connection lost")
+
+	_, err := s.DispatchDueMessages(context.Background(), h)
+	require.Equal(t, errors.Unavailable, errors.Code(err))
+	require.Empty(t, h.published)
+}
+
+func TestDispatchDuplicateIsNotPublishedAgain(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindGroup, Sender: "a", GroupID: 1, Content: "dup"},
+	)
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, entity.ScheduleStatusSent, st.statuses[1])
+	require.Empty(t, h.published)
+}
+
+func TestDispatchPostponesSlowModeMessage(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindGroup, Sender: "a", GroupID: 1, Content: "slow"},
+	)
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+	// 保持待发送，推迟到可以再次发言的时间
+	_, ok := st.statuses[1]
+	require.False(t, ok)
+	require.Equal(t, slowRetryAt, st.sendAts[1])
+	require.True(t, st.ses.committed)
+	require.Empty(t, h.published)
+}
+
+func TestDispatchChecksPostPermission(t *testing.T) {
+	s, st, h := newTestSchedule(
+		&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindGroup, Sender: "muted", GroupID: 1, Content: "hi"},
+	)
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, entity.ScheduleStatusFailed, st.statuses[1])
+	require.Equal(t, errors.PermissionDenied.String(), st.reasons[1])
+	require.Empty(t, h.published)
+}
+
+func TestCreateScheduledMessageChecksPostPermission(t *testing.T) {
+	s, _, _ := newTestSchedule()
+
+	_, err := s.CreateScheduledMessage(context.Background(), CreateInput{
+		Sender:  "muted",
+		Kind:    entity.RecordKindGroup,
+		GroupID: 1,
+		Content: "hi",
+		SendAt:  time.Now().Add(time.Hour),
+	})
+	require.Equal(t, errors.PermissionDenied, errors.Code(err))
+}
+
+func TestScheduledMessageKeepsChannel(t *testing.T) {
+	s, _, h := newTestSchedule(&entity.ScheduledMessage{ID: 1, Kind: entity.RecordKindGroup, Sender: "a", GroupID: 1, ChannelID: 2, Content: "hi"})
+
+	_, err := s.CreateScheduledMessage(context.Background(), CreateInput{
+		Sender:    "a",
+		Kind:      entity.RecordKindGroup,
+		GroupID:   1,
+		ChannelID: 3,
+		Content:   "hi",
+		SendAt:    time.Now().Add(time.Hour),
+	})
+	require.Equal(t, errors.NotFound, errors.Code(err))
+
+	n, err := s.DispatchDueMessages(context.Background(), h)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []int64{2}, h.channels)
+}
+
+func TestScheduledMessageContentTooLong(t *testing.T) {
+	s, _, _ := newTestSchedule()
+	content := strings.Repeat("长", records.MaxContentLen+1)
+
+	_, err := s.CreateScheduledMessage(context.Background(), CreateInput{
+		Sender:   "a",
+		Kind:     entity.RecordKindPrivate,
+		Receiver: "b",
+		Content:  content,
+		SendAt:   time.Now().Add(time.Hour),
+	})
+	require.Equal(t, errors.InvalidArgument, errors.Code(err))
+
+	err = s.UpdateScheduledMessage(context.Background(), 1, content, time.Now().Add(time.Hour))
+	require.Equal(t, errors.InvalidArgument, errors.Code(err))
+}
@@ -0,0 +1,77 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+const (
+	maxDeviceLen = 64
+	// maxPublicKeyLen base64编码后公钥和签名的最大长度
+	maxPublicKeyLen = 1024
+)
+
+// UploadDeviceKey 上传subject在device上的公钥，同一设备重复上传时替换
+func (u *user) UploadDeviceKey(ctx context.Context, key *entity.DeviceKey) error {
+	key.Device = strings.TrimSpace(key.Device)
+	if key.Device == "" || len(key.Device) > maxDeviceLen {
+		return errors.Newf(errors.InvalidArgument, nil, "设备标识不能为空且不能超过%d个字符", maxDeviceLen)
+	}
+	for name, v := range map[string]string{
+		"identity_key":            key.IdentityKey,
+		"signed_prekey":           key.SignedPreKey,
+		"signed_prekey_signature": key.SignedPreKeySignature,
+	} {
+		if err := validatePublicKey(v); err != nil {
+			return errors.Newf(errors.InvalidArgument, err, "invalid %s", name)
+		}
+	}
+
+	ses, err := u.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.storage.UpsertDeviceKey(ses, key)
+}
+
+func validatePublicKey(v string) error {
+	if v == "" || len(v) > maxPublicKeyLen {
+		return errors.Newf(errors.InvalidArgument, nil, "不能为空且不能超过%d个字符", maxPublicKeyLen)
+	}
+	_, err := base64.StdEncoding.DecodeString(v)
+	return err
+}
+
+func (u *user) DeleteDeviceKey(ctx context.Context, subject, device string) error {
+	ses, err := u.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	return u.storage.DeleteDeviceKey(ses, subject, device)
+}
+
+// ListDeviceKeys 列出subject所有设备的公钥，只有本人和好友可以查询
+func (u *user) ListDeviceKeys(ctx context.Context, requester, subject string) ([]*entity.DeviceKey, error) {
+	ses, err := u.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if requester != subject {
+		ok, err := u.storage.IsFriendOfUser(ses, requester, subject)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New(errors.PermissionDenied, nil, "对方不是你的好友")
+		}
+	}
+
+	return u.storage.ListDeviceKeysBySubject(ses, subject)
+}
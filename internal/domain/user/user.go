@@ -27,6 +27,12 @@ type User interface {
 	IsFriendOfUser(ctx context.Context, userSubject, friendSubject string) (bool, error)
 	RemoveFriendsFromUser(ctx context.Context, userSubject string, friendSubject ...string) error
 	ListFriendsOfUser(ctx context.Context, userSubject string) ([]*entity.User, error)
+
+	// DeviceKey 端到端加密的公钥目录
+
+	UploadDeviceKey(ctx context.Context, key *entity.DeviceKey) error
+	DeleteDeviceKey(ctx context.Context, subject, device string) error
+	ListDeviceKeys(ctx context.Context, requester, subject string) ([]*entity.DeviceKey, error)
 }
 
 func New(env environment.Env, storage storage.Storage) (User, error) {
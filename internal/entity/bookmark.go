@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// Bookmark 收藏的消息，原消息被撤回或过期后Tombstone为true，原消息的字段为空
+type Bookmark struct {
+	ID       int64  `json:"id"`
+	Owner    string `json:"owner"`
+	Kind     string `json:"kind"` // private, group or broadcast
+	RecordID int64  `json:"record_id"`
+	Note     string `json:"note"`
+
+	Tombstone       bool       `json:"tombstone"`
+	Sender          string     `json:"sender,omitempty"`
+	Receiver        string     `json:"receiver,omitempty"`
+	GroupID         int64      `json:"group_id,omitempty"`
+	Content         string     `json:"content,omitempty"`
+	RecordCreatedAt *time.Time `json:"record_created_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// Conversation 会话，每对私聊双方和每个群频道各对应一个会话
+type Conversation struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Party1    string `json:"party1,omitempty"` // 私聊双方，按字典序排列
+	Party2    string `json:"party2,omitempty"`
+	GroupID   int64  `json:"group_id,omitempty"`
+	ChannelID int64  `json:"channel_id,omitempty"` // 群会话所属的频道
+	LastSeq   int64  `json:"last_seq"`             // 会话内最后一条消息的序号
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasParty subject是否是私聊的一方
+func (c *Conversation) HasParty(subject string) bool {
+	return c.Party1 == subject || c.Party2 == subject
+}
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor 游标分页的位置，按(CreatedAt, Kind, ID)倒序排列
+type Cursor struct {
+	CreatedAt time.Time
+	Kind      string
+	ID        int64
+}
+
+func (c *Cursor) Encode() string {
+	if c == nil {
+		return ""
+	}
+
+	raw := fmt.Sprintf("%d:%s:%d", c.CreatedAt.UnixNano(), c.Kind, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	splits := strings.SplitN(string(raw), ":", 3)
+	if len(splits) != 3 {
+		return nil, fmt.Errorf("invalid cursor: %s", raw)
+	}
+	nano, err := strconv.ParseInt(splits[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	id, err := strconv.ParseInt(splits[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return &Cursor{
+		CreatedAt: time.Unix(0, nano).UTC(),
+		Kind:      splits[1],
+		ID:        id,
+	}, nil
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// DeviceKey 设备的端到端加密公钥，由客户端生成并上传，服务端只负责分发
+type DeviceKey struct {
+	Subject               string `json:"subject"`
+	Device                string `json:"device"`
+	IdentityKey           string `json:"identity_key"` // base64编码的身份公钥
+	SignedPreKeyID        int64  `json:"signed_prekey_id"`
+	SignedPreKey          string `json:"signed_prekey"`           // base64编码的签名预共享公钥
+	SignedPreKeySignature string `json:"signed_prekey_signature"` // 身份私钥对SignedPreKey的签名
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// Draft 会话中未发送的草稿，Content为空表示草稿已被清除
+type Draft struct {
+	Owner   string `json:"owner"`
+	Kind    string `json:"kind"`               // private or group
+	Peer    string `json:"peer,omitempty"`     // 私聊对象
+	GroupID int64  `json:"group_id,omitempty"` // 群
+	Content string `json:"content"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	ExportFormatJSONL = "jsonl"
+	ExportFormatCSV   = "csv"
+	ExportFormatHTML  = "html"
+)
+
+type ExportStatus int
+
+const (
+	ExportStatusPending ExportStatus = iota
+	ExportStatusRunning
+	ExportStatusDone
+	ExportStatusFailed
+)
+
+var exportStatusString = map[ExportStatus]string{
+	ExportStatusPending: "待导出",
+	ExportStatusRunning: "导出中",
+	ExportStatusDone:    "已完成",
+	ExportStatusFailed:  "导出失败",
+}
+
+var exportStatusID = map[string]ExportStatus{
+	"待导出":  ExportStatusPending,
+	"导出中":  ExportStatusRunning,
+	"已完成":  ExportStatusDone,
+	"导出失败": ExportStatusFailed,
+}
+
+func (s ExportStatus) String() string {
+	return exportStatusString[s]
+}
+
+func (s ExportStatus) Value() (driver.Value, error) {
+	return exportStatusString[s], nil
+}
+
+func (s *ExportStatus) Scan(value interface{}) error {
+	*s = exportStatusID[value.(string)]
+	return nil
+}
+
+// ExportJob 聊天记录导出任务，Kind为private时Peer有效，为group时GroupID有效
+type ExportJob struct {
+	ID       int64        `json:"id"`
+	Owner    string       `json:"owner"`
+	Kind     string       `json:"kind"`
+	Peer     string       `json:"peer,omitempty"`
+	GroupID  int64        `json:"group_id,omitempty"`
+	Format   string       `json:"format"`
+	Status   ExportStatus `json:"status"`
+	FilePath string       `json:"-"`                // 下载时的文件名，文件内容分块保存在数据库中
+	Reason   string       `json:"reason,omitempty"` // 导出失败的原因
+	Attempt  int          `json:"-"`                // 第几次领取，只有当前attempt写入的分块有效
+
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"` // 最近一次续期租约的时间
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,93 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ForwardItem 被转发的一条原消息
+type ForwardItem struct {
+	Kind      string    `json:"kind"` // 原消息所在的会话类型
+	RecordID  int64     `json:"record_id"`
+	Sender    string    `json:"sender"` // 原发送者
+	Receiver  string    `json:"receiver,omitempty"`
+	GroupID   int64     `json:"group_id,omitempty"`
+	Content   string    `json:"content"`
+	PollID    int64     `json:"poll_id,omitempty"`    // 原消息是投票时引用原投票
+	StickerID int64     `json:"sticker_id,omitempty"` // 原消息是表情时引用原表情
+	CreatedAt time.Time `json:"created_at"`
+
+	Forward   *Forward   `json:"forward,omitempty"`    // 原消息本身是合并转发的聊天记录时，保留其内容
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 原消息的过期时间，转发后的消息不晚于该时间过期
+}
+
+// Forward 转发消息的来源，Bundle为true时为合并转发的聊天记录，Items按原消息的时间排列
+type Forward struct {
+	Bundle bool           `json:"bundle"`
+	Items  []*ForwardItem `json:"items"`
+}
+
+// Summary 转发消息的内容，合并转发时为固定的摘要
+func (f *Forward) Summary() string {
+	if f.Bundle || len(f.Items) != 1 {
+		return "[聊天记录]"
+	}
+	return f.Items[0].Content
+}
+
+// ExpiresAt 所有原消息（包括嵌套的聊天记录）中最早的过期时间，都不过期时返回nil
+func (f *Forward) ExpiresAt() *time.Time {
+	var res *time.Time
+	for _, item := range f.Items {
+		res = EarliestTime(res, item.ExpiresAt)
+		if item.Forward != nil {
+			res = EarliestTime(res, item.Forward.ExpiresAt())
+		}
+	}
+	return res
+}
+
+// Depth 聊天记录的嵌套层数，不含嵌套时为1
+func (f *Forward) Depth() int {
+	depth := 0
+	for _, item := range f.Items {
+		if item.Forward != nil {
+			if d := item.Forward.Depth(); d > depth {
+				depth = d
+			}
+		}
+	}
+	return depth + 1
+}
+
+// EarliestTime 返回a和b中较早的时间，nil表示不限
+func EarliestTime(a, b *time.Time) *time.Time {
+	if a == nil {
+		return b
+	}
+	if b == nil || a.Before(*b) {
+		return a
+	}
+	return b
+}
+
+func (f *Forward) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return json.Marshal(f)
+}
+
+func (f *Forward) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	}
+	return fmt.Errorf("invalid forward: %v", value)
+}
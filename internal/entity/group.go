@@ -11,6 +11,20 @@ type Group struct {
 	Type      GroupType `json:"type"`
 	IsPublic  bool      `json:"is_public"` // 是否公开的群
 	CreatedBy string    `json:"created_by"`
+	Owner     string    `json:"owner"`     // 当前群主，转让或群主退群后与created_by不同
+	MutedAll  bool      `json:"muted_all"` // 全员禁言，群主和管理员不受限制
+
+	JoinPolicy   GroupJoinPolicy `json:"join_policy"`
+	JoinQuestion string          `json:"join_question,omitempty"` // JoinPolicy为question时申请人需要回答的问题
+
+	CapacityTier int `json:"capacity_tier"` // 容量档位，决定群的成员上限
+	SlowMode     int `json:"slow_mode"`     // 慢速模式的间隔秒数，0表示关闭
+
+	Announcement string `json:"announcement"` // 群公告
+
+	Description string   `json:"description"`
+	Avatar      string   `json:"avatar,omitempty"` // 头像在附件存储中的key，为空表示没有头像
+	Tags        []string `json:"tags"`
 
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -56,10 +70,107 @@ func GroupTypeFromString(s string) (GroupType, bool) {
 	return v, ok
 }
 
+// MaxMembers 按容量档位得出的成员上限，档位超出tiers时使用最高档
+func (g *Group) MaxMembers(tiers []int) int {
+	if len(tiers) == 0 {
+		return 0
+	}
+	if g.CapacityTier < 0 {
+		return tiers[0]
+	}
+	if g.CapacityTier >= len(tiers) {
+		return tiers[len(tiers)-1]
+	}
+	return tiers[g.CapacityTier]
+}
+
+// GroupJoinPolicy 用户申请入群时的处理方式
+type GroupJoinPolicy string
+
+const (
+	GroupJoinOpen       GroupJoinPolicy = "open"        // 直接入群
+	GroupJoinApproval   GroupJoinPolicy = "approval"    // 需要管理员审批
+	GroupJoinInviteOnly GroupJoinPolicy = "invite_only" // 不接受申请，只能被邀请
+	GroupJoinQuestion   GroupJoinPolicy = "question"    // 回答问题后由管理员审批
+)
+
+func (p GroupJoinPolicy) Valid() bool {
+	switch p {
+	case GroupJoinOpen, GroupJoinApproval, GroupJoinInviteOnly, GroupJoinQuestion:
+		return true
+	}
+	return false
+}
+
+// GroupCapacity 群当前的容量
+type GroupCapacity struct {
+	GroupID    int64 `json:"group_id"`
+	Tier       int   `json:"tier"`
+	MaxMembers int   `json:"max_members"`
+	Members    int   `json:"members"`
+	Tiers      []int `json:"tiers"` // 所有档位对应的成员上限
+}
+
 type GroupMember struct {
 	UserSubject string `json:"user_subject"`
 	GroupID     int64  `json:"group_id"`
-	IsAdmin     bool   `json:"is_admin"`
+	Role        string `json:"role"`               // owner、admin、member或群的自定义角色
+	Nickname    string `json:"nickname,omitempty"` // 群昵称，为空时使用用户自己的昵称
+
+	MutedUntil *time.Time `json:"muted_until,omitempty"` // 禁言的截止时间
+	// LastPostedAt 慢速模式下最近一次发言的时间
+	LastPostedAt *time.Time `json:"last_posted_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Muted 成员在now时是否处于禁言中
+func (m *GroupMember) Muted(now time.Time) bool {
+	return m.MutedUntil != nil && m.MutedUntil.After(now)
+}
+
+// GroupBan 群的封禁名单，被封禁的用户不能申请或被邀请入群
+type GroupBan struct {
+	GroupID     int64      `json:"group_id"`
+	UserSubject string     `json:"user_subject"`
+	BannedBy    string     `json:"banned_by"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 为空表示永久封禁
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GroupAnnouncementLog struct {
+	ID       int64  `json:"id"`
+	GroupID  int64  `json:"group_id"`
+	Content  string `json:"content"`
+	EditedBy string `json:"edited_by"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GroupOwnerChangeReason string
+
+const (
+	GroupOwnerTransferred GroupOwnerChangeReason = "transfer"   // 群主主动转让
+	GroupOwnerLeft        GroupOwnerChangeReason = "owner_left" // 群主退群，自动由最早加入的管理员或成员接任
+)
+
+// GroupOwnerLog 群主变更记录
+type GroupOwnerLog struct {
+	ID          int64                  `json:"id"`
+	GroupID     int64                  `json:"group_id"`
+	FromSubject string                 `json:"from_subject"`
+	ToSubject   string                 `json:"to_subject"`
+	Reason      GroupOwnerChangeReason `json:"reason"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GroupPin struct {
+	GroupID  int64        `json:"group_id"`
+	RecordID int64        `json:"record_id"`
+	PinnedBy string       `json:"pinned_by"`
+	Record   *RecordGroup `json:"record"`
 
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// DefaultGroupChannelName 建群时自动创建的默认频道的名称
+const DefaultGroupChannelName = "general"
+
+// GroupChannel 群内的频道（话题），所有群成员共享，每个频道有独立的会话、消息序号和已读位置
+type GroupChannel struct {
+	ID        int64  `json:"id"`
+	GroupID   int64  `json:"group_id"`
+	Name      string `json:"name"`
+	Topic     string `json:"topic,omitempty"`
+	AdminOnly bool   `json:"admin_only"` // 只有拥有manage权限的成员可以发言
+	IsDefault bool   `json:"is_default"` // 不指定频道的消息发送到默认频道
+	CreatedBy string `json:"created_by"`
+
+	// 以下字段只在按成员列出频道时有值
+	ConversationID int64 `json:"conversation_id,omitempty"`
+	LastSeq        int64 `json:"last_seq"` // 频道内最后一条消息的序号
+	ReadSeq        int64 `json:"read_seq"` // 成员已读的最后一条消息的序号
+	UnreadCount    int64 `json:"unread_count"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
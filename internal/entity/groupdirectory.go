@@ -0,0 +1,58 @@
+package entity
+
+import "time"
+
+const (
+	GroupDirectorySortPopular = "popular" // 按成员数和近期消息数倒序
+	GroupDirectorySortRecent  = "recent"  // 按创建时间倒序
+)
+
+// GroupDirectoryFilter 公开群目录的查询条件，只会返回公开的群
+type GroupDirectoryFilter struct {
+	Query string     // 按群名称匹配，前缀匹配的排在前面
+	Type  *GroupType // 为空时不限类型
+	Sort  string
+
+	ActiveSince time.Time // 统计近期消息数的起始时间
+
+	Offset int
+	Limit  int
+}
+
+// GroupActivity 群的活跃程度，由近期消息数得出
+type GroupActivity string
+
+const (
+	GroupActivityInactive GroupActivity = "inactive"
+	GroupActivityLow      GroupActivity = "low"
+	GroupActivityMedium   GroupActivity = "medium"
+	GroupActivityHigh     GroupActivity = "high"
+)
+
+func GroupActivityOf(recentMessages int) GroupActivity {
+	switch {
+	case recentMessages == 0:
+		return GroupActivityInactive
+	case recentMessages < 100:
+		return GroupActivityLow
+	case recentMessages < 1000:
+		return GroupActivityMedium
+	default:
+		return GroupActivityHigh
+	}
+}
+
+// GroupDirectoryEntry 公开群目录中的一项，只包含可以对非成员展示的信息
+type GroupDirectoryEntry struct {
+	ID             int64           `json:"id"`
+	Name           string          `json:"name"`
+	Type           GroupType       `json:"type"`
+	Announcement   string          `json:"announcement"`
+	JoinPolicy     GroupJoinPolicy `json:"join_policy"`
+	JoinQuestion   string          `json:"join_question,omitempty"`
+	MemberCount    int             `json:"member_count"`
+	RecentMessages int             `json:"recent_messages"`
+	Activity       GroupActivity   `json:"activity"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// GroupInviteLink 可分享的入群邀请链接，持有Token的用户可以直接入群，或在RequiresApproval时提交入群申请
+type GroupInviteLink struct {
+	ID               int64      `json:"id"`
+	GroupID          int64      `json:"group_id"`
+	Token            string     `json:"token"`
+	CreatedBy        string     `json:"created_by"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"` // 为空表示永不过期
+	MaxUses          int        `json:"max_uses"`             // 0表示不限次数
+	Uses             int        `json:"uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Usable 链接在now时是否还可以使用
+func (l *GroupInviteLink) Usable(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	if l.ExpiresAt != nil && !l.ExpiresAt.After(now) {
+		return false
+	}
+	return l.MaxUses == 0 || l.Uses < l.MaxUses
+}
+
+// GroupInviteLinkUse 邀请链接的一次使用
+type GroupInviteLinkUse struct {
+	LinkID      int64  `json:"link_id"`
+	UserSubject string `json:"user_subject"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
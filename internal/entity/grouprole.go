@@ -0,0 +1,104 @@
+package entity
+
+import "time"
+
+// GroupPermission 群内的一项操作权限
+type GroupPermission string
+
+const (
+	GroupPermInvite        GroupPermission = "invite"           // 邀请成员
+	GroupPermApprove       GroupPermission = "approve_requests" // 审批入群申请
+	GroupPermPost          GroupPermission = "post"             // 发言
+	GroupPermPin           GroupPermission = "pin"              // 置顶消息
+	GroupPermRename        GroupPermission = "rename"           // 修改群名称
+	GroupPermRemoveMembers GroupPermission = "remove_members"   // 移除成员
+	GroupPermAnnounce      GroupPermission = "announce"         // 发布群公告
+	GroupPermManage        GroupPermission = "manage"           // 修改公开、消息保留等群设置
+	GroupPermMute          GroupPermission = "mute"             // 禁言成员及全员禁言
+
+	// 以下权限只属于群主，不能授予其他角色
+
+	GroupPermManageRoles GroupPermission = "manage_roles" // 管理角色及成员的角色
+	GroupPermDelete      GroupPermission = "delete_group" // 解散群
+)
+
+var groupPermissionString = map[GroupPermission]string{
+	GroupPermInvite:        "邀请成员",
+	GroupPermApprove:       "审批入群申请",
+	GroupPermPost:          "发言",
+	GroupPermPin:           "置顶消息",
+	GroupPermRename:        "修改群名称",
+	GroupPermRemoveMembers: "移除成员",
+	GroupPermAnnounce:      "发布群公告",
+	GroupPermManage:        "修改群设置",
+	GroupPermMute:          "禁言成员",
+	GroupPermManageRoles:   "管理角色",
+	GroupPermDelete:        "解散群",
+}
+
+func (p GroupPermission) String() string {
+	if s, ok := groupPermissionString[p]; ok {
+		return s
+	}
+	return string(p)
+}
+
+// GrantableGroupPermissions 可以授予群主以外角色的权限
+var GrantableGroupPermissions = []GroupPermission{
+	GroupPermInvite,
+	GroupPermApprove,
+	GroupPermPost,
+	GroupPermPin,
+	GroupPermRename,
+	GroupPermRemoveMembers,
+	GroupPermAnnounce,
+	GroupPermManage,
+	GroupPermMute,
+}
+
+func (p GroupPermission) Grantable() bool {
+	for _, g := range GrantableGroupPermissions {
+		if g == p {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+// DefaultGroupRolePermissions 群没有修改过admin、member的权限时使用的默认权限
+var DefaultGroupRolePermissions = map[string][]GroupPermission{
+	GroupRoleAdmin:  GrantableGroupPermissions,
+	GroupRoleMember: {GroupPermInvite, GroupPermPost},
+}
+
+func IsBuiltinGroupRole(name string) bool {
+	return name == GroupRoleOwner || name == GroupRoleAdmin || name == GroupRoleMember
+}
+
+// GroupRole 群内的角色及其权限，群主拥有全部权限
+type GroupRole struct {
+	GroupID     int64             `json:"group_id"`
+	Name        string            `json:"name"`
+	Permissions []GroupPermission `json:"permissions"`
+	Builtin     bool              `json:"builtin"` // owner、admin和member不能删除
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r *GroupRole) Has(p GroupPermission) bool {
+	if r.Name == GroupRoleOwner {
+		return true
+	}
+	for _, v := range r.Permissions {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
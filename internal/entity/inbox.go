@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// InboxEntry 会话列表中的一项，每个用户在每个私聊/群聊中各有一条
+type InboxEntry struct {
+	ID           int64     `json:"id"`
+	Owner        string    `json:"owner"`
+	Kind         string    `json:"kind"`               // private or group
+	Peer         string    `json:"peer,omitempty"`     // 私聊对象
+	GroupID      int64     `json:"group_id,omitempty"` // 群
+	LastRecordID int64     `json:"last_record_id"`
+	LastContent  string    `json:"last_content"`
+	LastSender   string    `json:"last_sender"`
+	LastAt       time.Time `json:"last_at"`
+	UnreadCount  int       `json:"unread_count"`
+}
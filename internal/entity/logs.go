@@ -69,5 +69,8 @@ type GroupRequestLog struct {
 	Approver NullString `json:"approver"`
 	Status   LogsStatus `json:"status"`
 
+	InviteLinkID int64  `json:"invite_link_id,omitempty"` // 通过邀请链接产生的申请
+	Answer       string `json:"answer,omitempty"`         // 对入群问题的回答
+
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,43 @@
+package entity
+
+import "time"
+
+// Poll 群投票，ClosesAt为空时不自动截止
+type Poll struct {
+	ID          int64      `json:"id"`
+	GroupID     int64      `json:"group_id"`
+	Question    string     `json:"question"`
+	Options     []string   `json:"options"`
+	MultiChoice bool       `json:"multi_choice"`
+	Anonymous   bool       `json:"anonymous"` // 匿名投票不公开每个选项的投票者
+	CreatedBy   string     `json:"created_by"`
+	ClosesAt    *time.Time `json:"closes_at,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Closed 投票已被截止，或已过截止时间但还未被清理任务关闭
+func (p *Poll) Closed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !p.ClosesAt.After(now))
+}
+
+// Summary 投票消息在会话列表和通知中显示的内容
+func (p *Poll) Summary() string {
+	return "[投票] " + p.Question
+}
+
+type PollVote struct {
+	PollID    int64     `json:"poll_id"`
+	Voter     string    `json:"voter"`
+	Option    int       `json:"option"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PollTally 投票的统计结果，OptionVoters只在非匿名投票中返回
+type PollTally struct {
+	Poll         *Poll      `json:"poll"`
+	Counts       []int      `json:"counts"`
+	Voters       int        `json:"voters"` // 参与投票的人数
+	OptionVoters [][]string `json:"option_voters,omitempty"`
+}
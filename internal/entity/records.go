@@ -7,7 +7,9 @@ type RecordBroadcast struct {
 	Content string `json:"content"`
 	Sender  string `json:"sender"`
 
-	CreatedAt time.Time `json:"created_at"`
+	ClientMsgID string     `json:"client_msg_id,omitempty"` // 客户端生成的消息ID
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`    // 阅后即焚的过期时间
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type RecordGroup struct {
@@ -16,7 +18,17 @@ type RecordGroup struct {
 	Content string `json:"content"`
 	Sender  string `json:"sender"`
 
-	CreatedAt time.Time `json:"created_at"`
+	ChannelID      int64 `json:"channel_id"` // 消息所在的频道，每个频道对应一个会话
+	ConversationID int64 `json:"conversation_id"`
+	Seq            int64 `json:"seq"` // 会话内连续递增的序号
+
+	ClientMsgID string     `json:"client_msg_id,omitempty"` // 客户端生成的消息ID
+	Forward     *Forward   `json:"forward,omitempty"`       // 转发的来源
+	PollID      int64      `json:"poll_id,omitempty"`       // 投票消息的投票
+	StickerID   int64      `json:"sticker_id,omitempty"`    // 表情消息的表情
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`    // 阅后即焚的过期时间
+	System      bool       `json:"system,omitempty"`        // 系统消息，如禁言、封禁的通知
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
 type RecordPrivate struct {
@@ -25,5 +37,21 @@ type RecordPrivate struct {
 	Sender   string `json:"sender"`
 	Receiver string `json:"receiver"`
 
-	CreatedAt time.Time `json:"created_at"`
+	ConversationID int64 `json:"conversation_id"`
+	Seq            int64 `json:"seq"` // 会话内连续递增的序号
+
+	ClientMsgID string     `json:"client_msg_id,omitempty"` // 客户端生成的消息ID
+	Forward     *Forward   `json:"forward,omitempty"`       // 转发的来源
+	StickerID   int64      `json:"sticker_id,omitempty"`    // 表情消息的表情
+	Ciphertext  string     `json:"ciphertext,omitempty"`    // 端到端加密消息的密文，非空时Content为占位内容
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`    // 阅后即焚的过期时间
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// EncryptedContent 加密消息在content中保存的占位内容
+const EncryptedContent = "[加密消息]"
+
+// Encrypted 是否为端到端加密消息
+func (r *RecordPrivate) Encrypted() bool {
+	return r.Ciphertext != ""
 }
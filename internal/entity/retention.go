@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// RetentionPolicy 会话的消息保留策略，超过MaxAge的消息会被清理
+type RetentionPolicy struct {
+	Kind      string        `json:"kind"`
+	Peer      string        `json:"peer,omitempty"`
+	GroupID   int64         `json:"group_id,omitempty"`
+	MaxAge    time.Duration `json:"max_age"`
+	UpdatedBy string        `json:"updated_by"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExpiredRecord 被清理的消息，用于通知客户端移除
+type ExpiredRecord struct {
+	Kind     string `json:"kind"`
+	ID       int64  `json:"id"`
+	GroupID  int64  `json:"group_id,omitempty"`
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver,omitempty"`
+}
@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+type ScheduleStatus int
+
+const (
+	ScheduleStatusPending ScheduleStatus = iota
+	ScheduleStatusSent
+	ScheduleStatusCanceled
+	ScheduleStatusFailed
+)
+
+var scheduleStatusString = map[ScheduleStatus]string{
+	ScheduleStatusPending:  "待发送",
+	ScheduleStatusSent:     "已发送",
+	ScheduleStatusCanceled: "已取消",
+	ScheduleStatusFailed:   "发送失败",
+}
+
+var scheduleStatusID = map[string]ScheduleStatus{
+	"待发送":  ScheduleStatusPending,
+	"已发送":  ScheduleStatusSent,
+	"已取消":  ScheduleStatusCanceled,
+	"发送失败": ScheduleStatusFailed,
+}
+
+func (s ScheduleStatus) String() string {
+	return scheduleStatusString[s]
+}
+
+func (s ScheduleStatus) Value() (driver.Value, error) {
+	return scheduleStatusString[s], nil
+}
+
+func (s *ScheduleStatus) Scan(value interface{}) error {
+	*s = scheduleStatusID[value.(string)]
+	return nil
+}
+
+// ScheduledMessage 定时发送的消息，Kind为private时Receiver有效，为group时GroupID有效
+type ScheduledMessage struct {
+	ID       int64  `json:"id"`
+	Sender   string `json:"sender"`
+	Kind     string `json:"kind"`
+	Receiver string `json:"receiver,omitempty"`
+	GroupID  int64  `json:"group_id,omitempty"`
+	// ChannelID 群消息所在的频道，为0时发送到默认频道
+	ChannelID int64          `json:"channel_id,omitempty"`
+	Content   string         `json:"content"`
+	SendAt    time.Time      `json:"send_at"`
+	Status    ScheduleStatus `json:"status"`
+	Reason    string         `json:"reason,omitempty"` // 发送失败的原因
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+const (
+	RecordKindPrivate   = "private"
+	RecordKindGroup     = "group"
+	RecordKindBroadcast = "broadcast"
+)
+
+// 全文检索返回的片段中标记关键词起止的控制字符，展示前须转义片段并替换为HTML标签
+const (
+	SnippetStartSel = "\x02"
+	SnippetStopSel  = "\x03"
+)
+
+type RecordSearchFilter struct {
+	Query   string
+	Trigram bool // 使用pg_trgm做子串匹配，适用于中文等不以空格分词的文本
+
+	Sender  string    // 发送者
+	Peer    string    // 私聊对象，非空时只查询私聊
+	GroupID int64     // 群，非0时只查询群聊
+	From    time.Time // 起始时间（包含）
+	To      time.Time // 截止时间（不包含）
+
+	Cursor *Cursor
+	Limit  int
+}
+
+type RecordSearchResult struct {
+	Kind     string `json:"kind"`
+	ID       int64  `json:"id"`
+	GroupID  int64  `json:"group_id,omitempty"`
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver,omitempty"`
+	Content  string `json:"content"`
+	Snippet  string `json:"snippet"` // 关键词高亮片段，内容已做HTML转义，关键词用<b></b>标记
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// StickerPack 表情包，GroupID为0时是管理员上传的全局表情包，否则只能在该群中使用
+type StickerPack struct {
+	ID        int64      `json:"id"`
+	GroupID   int64      `json:"group_id,omitempty"`
+	Name      string     `json:"name"`
+	CreatedBy string     `json:"created_by"`
+	Stickers  []*Sticker `json:"stickers"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sticker 表情包中的一个表情，文件存放在附件存储中
+type Sticker struct {
+	ID          int64  `json:"id"`
+	PackID      int64  `json:"pack_id"`
+	GroupID     int64  `json:"group_id,omitempty"` // 所属表情包的群
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	FileKey     string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Summary 表情消息的内容
+func (s *Sticker) Summary() string {
+	return "[表情] " + s.Name
+}
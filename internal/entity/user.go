@@ -4,6 +4,9 @@ import (
 	"time"
 )
 
+// SystemSubject 群系统消息的发送者，由迁移创建，不对应真实用户
+const SystemSubject = "system"
+
 type User struct {
 	Subject  string `json:"subject"`
 	Nickname string `json:"nickname"`
@@ -0,0 +1,83 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"path"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// Store 附件存储，文件以Put返回的key寻址，key由存储生成
+// ctx中带有事务时，写入和删除随该事务一起提交或回滚
+type Store interface {
+	// Put 写入r中的全部内容，超过maxSize字节时返回InvalidArgument，maxSize为0时不限制
+	Put(ctx context.Context, prefix, ext string, r io.Reader, maxSize int64) (key string, size int64, err error)
+	Open(ctx context.Context, key string) (io.ReadSeeker, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New 将附件保存在数据库中，所有实例都可以读取
+func New(storage storage.Storage) Store {
+	return &db{storage: storage}
+}
+
+type db struct {
+	storage storage.Storage
+}
+
+func (d *db) Put(ctx context.Context, prefix, ext string, r io.Reader, maxSize int64) (string, int64, error) {
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return "", 0, errors.Newf(errors.InvalidArgument, nil, "附件不能超过%d字节", maxSize)
+	}
+
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	key := path.Join(prefix, hex.EncodeToString(b)+ext)
+
+	ses, err := d.storage.NewSession(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = d.storage.InsertAttachment(ses, key, data); err != nil {
+		return "", 0, err
+	}
+
+	return key, int64(len(data)), nil
+}
+
+func (d *db) Open(ctx context.Context, key string) (io.ReadSeeker, error) {
+	ses, err := d.storage.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := d.storage.GetAttachment(ses, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+func (d *db) Delete(ctx context.Context, key string) error {
+	ses, err := d.storage.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	return d.storage.DeleteAttachment(ses, key)
+}
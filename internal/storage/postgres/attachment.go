@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertAttachment(ses storage.Session, key string, data []byte) error {
+	sqlstr := rebind(`INSERT INTO "attachment"
+                  (key, data)
+                  VALUES
+                  (?, ?);`)
+
+	if _, err := ses.Exec(sqlstr, key, data); err != nil {
+		return wrapPGErrorf(err, "insert attachment %s failed", key)
+	}
+
+	return nil
+}
+
+func (p *postgres) GetAttachment(ses storage.Session, key string) ([]byte, error) {
+	sqlstr := rebind(`SELECT data
+                  FROM "attachment"
+                  WHERE key = ?;`)
+
+	var data []byte
+	if err := ses.QueryRow(sqlstr, key).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Newf(errors.NotFound, nil, "attachment %s not found", key)
+		}
+		return nil, wrapPGErrorf(err, "get attachment %s failed", key)
+	}
+
+	return data, nil
+}
+
+func (p *postgres) DeleteAttachment(ses storage.Session, key string) error {
+	sqlstr := rebind(`DELETE FROM "attachment"
+                  WHERE key = ?;`)
+
+	if _, err := ses.Exec(sqlstr, key); err != nil {
+		return wrapPGErrorf(err, "delete attachment %s failed", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+func (s *postgresSuite) TestAttachment() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	s.Require().Nil(s.storage.InsertAttachment(ses, "avatars/a.png", []byte("png")))
+
+	data, err := s.storage.GetAttachment(ses, "avatars/a.png")
+	s.Require().Nil(err)
+	s.Require().Equal([]byte("png"), data)
+
+	s.Require().Nil(s.storage.DeleteAttachment(ses, "avatars/a.png"))
+	_, err = s.storage.GetAttachment(ses, "avatars/a.png")
+	s.Require().Equal(errors.NotFound, errors.Code(err))
+}
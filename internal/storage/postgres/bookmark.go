@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// UpsertBookmark 收藏消息，已收藏时只更新备注
+func (p *postgres) UpsertBookmark(ses storage.Session, i *entity.Bookmark) error {
+	sqlstr := rebind(`INSERT INTO "bookmark"
+                  (owner, kind, record_id, note)
+                  VALUES
+                  (?, ?, ?, ?)
+                  ON CONFLICT (owner, kind, record_id) DO UPDATE
+                  SET note = EXCLUDED.note
+                  RETURNING id, created_at;`)
+
+	err := ses.QueryRow(sqlstr, i.Owner, i.Kind, i.RecordID, i.Note).Scan(&i.ID, &i.CreatedAt)
+	if err != nil {
+		return wrapPGErrorf(err, "failed to upsert bookmark")
+	}
+
+	return nil
+}
+
+func (p *postgres) DeleteBookmark(ses storage.Session, owner, kind string, recordID int64) error {
+	sqlstr := rebind(`DELETE FROM "bookmark" WHERE owner = ? AND kind = ? AND record_id = ?;`)
+	if _, err := ses.Exec(sqlstr, owner, kind, recordID); err != nil {
+		return wrapPGErrorf(err, "delete bookmark with owner: %s, kind: %s and record_id: %d failed", owner, kind, recordID)
+	}
+
+	return nil
+}
+
+// ListBookmarksByOwner 按收藏时间倒序列出owner的收藏，原消息已被删除或过期的作为墓碑返回
+func (p *postgres) ListBookmarksByOwner(ses storage.Session, owner string, cursor *entity.Cursor, limit int) ([]*entity.Bookmark, error) {
+	now := time.Now().UTC()
+	sqlstr := `SELECT b.id, b.owner, b.kind, b.record_id, b.note, b.created_at,
+                      COALESCE(rp.sender, rg.sender, rb.sender, ''),
+                      COALESCE(rp.receiver, ''),
+                      COALESCE(rg.group_id, 0),
+                      COALESCE(rp.content, rg.content, rb.content, ''),
+                      COALESCE(rp.created_at, rg.created_at, rb.created_at)
+                  FROM "bookmark" b
+                  LEFT JOIN "record_private" rp ON b.kind = ? AND rp.id = b.record_id AND (rp.expires_at IS NULL OR rp.expires_at > ?)
+                  LEFT JOIN "record_group" rg ON b.kind = ? AND rg.id = b.record_id AND (rg.expires_at IS NULL OR rg.expires_at > ?)
+                  LEFT JOIN "record_broadcast" rb ON b.kind = ? AND rb.id = b.record_id AND (rb.expires_at IS NULL OR rb.expires_at > ?)
+                  WHERE b.owner = ?`
+	args := []any{
+		entity.RecordKindPrivate, now,
+		entity.RecordKindGroup, now,
+		entity.RecordKindBroadcast, now,
+		owner,
+	}
+	if cursor != nil {
+		sqlstr += ` AND (b.created_at, b.kind, b.id) < (?, ?, ?)`
+		args = append(args, cursor.CreatedAt, cursor.Kind, cursor.ID)
+	}
+	sqlstr += ` ORDER BY b.created_at DESC, b.kind DESC, b.id DESC LIMIT ?;`
+	args = append(args, limit)
+
+	rows, err := ses.Query(rebind(sqlstr), args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list bookmarks with owner: %s failed", owner)
+	}
+	defer rows.Close()
+
+	var res []*entity.Bookmark
+	for rows.Next() {
+		r := entity.Bookmark{}
+		if err = rows.Scan(&r.ID, &r.Owner, &r.Kind, &r.RecordID, &r.Note, &r.CreatedAt,
+			&r.Sender, &r.Receiver, &r.GroupID, &r.Content, &r.RecordCreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan bookmark")
+		}
+		r.Tombstone = r.RecordCreatedAt == nil
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
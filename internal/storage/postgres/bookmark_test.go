@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestListBookmarksByOwner() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	sender, receiver := s.addUser(ses), s.addUser(ses)
+	rcd := &entity.RecordPrivate{Content: "hello", Sender: sender.Subject, Receiver: receiver.Subject}
+	id, err := s.storage.InsertRecordPrivate(ses, rcd)
+	s.Require().Nil(err)
+
+	s.Require().Nil(s.storage.UpsertBookmark(ses, &entity.Bookmark{Owner: receiver.Subject, Kind: entity.RecordKindPrivate, RecordID: id}))
+	// 重复收藏只更新备注
+	s.Require().Nil(s.storage.UpsertBookmark(ses, &entity.Bookmark{Owner: receiver.Subject, Kind: entity.RecordKindPrivate, RecordID: id, Note: "note"}))
+	// 原消息已被删除
+	s.Require().Nil(s.storage.UpsertBookmark(ses, &entity.Bookmark{Owner: receiver.Subject, Kind: entity.RecordKindGroup, RecordID: -1}))
+
+	res, err := s.storage.ListBookmarksByOwner(ses, receiver.Subject, nil, 10)
+	s.Require().Nil(err)
+	s.Require().Len(res, 2)
+
+	byKind := make(map[string]*entity.Bookmark)
+	for _, b := range res {
+		byKind[b.Kind] = b
+	}
+	s.Require().False(byKind[entity.RecordKindPrivate].Tombstone)
+	s.Require().Equal("note", byKind[entity.RecordKindPrivate].Note)
+	s.Require().Equal("hello", byKind[entity.RecordKindPrivate].Content)
+	s.Require().True(byKind[entity.RecordKindGroup].Tombstone)
+	s.Require().Empty(byKind[entity.RecordKindGroup].Content)
+
+	s.Require().Nil(s.storage.DeleteBookmark(ses, receiver.Subject, entity.RecordKindGroup, -1))
+	res, err = s.storage.ListBookmarksByOwner(ses, receiver.Subject, nil, 10)
+	s.Require().Nil(err)
+	s.Require().Len(res, 1)
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// reserveConversationSeqs 不存在时创建会话，并为n条消息预留连续的序号，返回会话id和预留的最后一个序号
+// 会话行在事务结束前保持锁定，须与消息写入在同一事务中调用才能保证序号没有空洞。群会话以频道区分
+func (p *postgres) reserveConversationSeqs(ses storage.Session, kind, party1, party2 string, groupID, channelID int64, n int) (int64, int64, error) {
+	sqlstr := rebind(`INSERT INTO "conversation"
+                  (kind, party1, party2, group_id, channel_id, last_seq)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (kind, party1, party2, group_id, channel_id) DO UPDATE
+                  SET last_seq = "conversation".last_seq + EXCLUDED.last_seq
+                  RETURNING id, last_seq;`)
+
+	var id, lastSeq int64
+	err := ses.QueryRow(sqlstr, kind, party1, party2, groupID, channelID, n).Scan(&id, &lastSeq)
+	if err != nil {
+		return 0, 0, wrapPGErrorf(err, "failed to reserve seqs of conversation with kind: %s, party: %s, %s, group_id: %d and channel_id: %d", kind, party1, party2, groupID, channelID)
+	}
+
+	return id, lastSeq, nil
+}
+
+// ensurePrivateConversation 不存在时创建subject1和subject2的私聊会话
+func (p *postgres) ensurePrivateConversation(ses storage.Session, subject1, subject2 string) (int64, error) {
+	id, _, err := p.reserveConversationSeqs(ses, entity.RecordKindPrivate, party1(subject1, subject2), party2(subject1, subject2), 0, 0, 0)
+	return id, err
+}
+
+func (p *postgres) listConversations(ses storage.Session, where *entity.Where) ([]*entity.Conversation, error) {
+	projection := []string{
+		"id",
+		"kind",
+		"party1",
+		"party2",
+		"group_id",
+		"channel_id",
+		"last_seq",
+		"created_at",
+	}
+
+	var args []any
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "conversation"`, strings.Join(projection, ", "))
+	if where != nil {
+		sel, selArgs, err := where.Parse()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, selArgs...)
+		sqlstr += sel
+	}
+
+	sqlstr = rebind(sqlstr)
+	rows, err := ses.Query(sqlstr, args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to list conversation")
+	}
+	defer rows.Close()
+
+	var res []*entity.Conversation
+	for rows.Next() {
+		r := entity.Conversation{}
+		if err = rows.Scan(&r.ID, &r.Kind, &r.Party1, &r.Party2, &r.GroupID, &r.ChannelID, &r.LastSeq, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan conversation")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetConversationByID(ses storage.Session, id int64) (*entity.Conversation, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listConversations(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get conversation with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no conversation with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetPrivateConversation(ses storage.Session, subject1, subject2 string) (*entity.Conversation, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"kind", "party1", "party2", "group_id", "channel_id"},
+		FieldValues: []any{entity.RecordKindPrivate, party1(subject1, subject2), party2(subject1, subject2), 0, 0},
+	}
+
+	res, err := p.listConversations(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get conversation with party: %s, %s failed", subject1, subject2)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no conversation with party: %s, %s found", subject1, subject2)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetGroupConversation(ses storage.Session, groupID, channelID int64) (*entity.Conversation, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"kind", "party1", "party2", "group_id", "channel_id"},
+		FieldValues: []any{entity.RecordKindGroup, "", "", groupID, channelID},
+	}
+
+	res, err := p.listConversations(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get conversation with group_id: %d and channel_id: %d failed", groupID, channelID)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no conversation with group_id: %d and channel_id: %d found", groupID, channelID)
+	}
+
+	return res[0], nil
+}
+
+// 无论subject1和subject2交换与否，私聊会话的party1和party2一致
+func party1(subject1, subject2 string) string {
+	if subject1 < subject2 {
+		return subject1
+	}
+	return subject2
+}
+
+func party2(subject1, subject2 string) string {
+	if subject1 < subject2 {
+		return subject2
+	}
+	return subject1
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// UpsertDeviceKey 设备重新上传时替换之前的公钥
+func (p *postgres) UpsertDeviceKey(ses storage.Session, i *entity.DeviceKey) error {
+	sqlstr := rebind(`INSERT INTO "device_key"
+                  (subject, device, identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (subject, device) DO UPDATE
+                  SET identity_key = EXCLUDED.identity_key,
+                      signed_prekey_id = EXCLUDED.signed_prekey_id,
+                      signed_prekey = EXCLUDED.signed_prekey,
+                      signed_prekey_signature = EXCLUDED.signed_prekey_signature,
+                      updated_at = now()
+                  RETURNING updated_at;`)
+	args := []any{
+		i.Subject,
+		i.Device,
+		i.IdentityKey,
+		i.SignedPreKeyID,
+		i.SignedPreKey,
+		i.SignedPreKeySignature,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.UpdatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to upsert device_key")
+	}
+
+	return nil
+}
+
+func (p *postgres) DeleteDeviceKey(ses storage.Session, subject, device string) error {
+	sqlstr := rebind(`DELETE FROM "device_key" WHERE subject = ? AND device = ?;`)
+	if _, err := ses.Exec(sqlstr, subject, device); err != nil {
+		return wrapPGErrorf(err, "delete device_key with subject: %s and device: %s failed", subject, device)
+	}
+
+	return nil
+}
+
+func (p *postgres) ListDeviceKeysBySubject(ses storage.Session, subject string) ([]*entity.DeviceKey, error) {
+	sqlstr := rebind(`SELECT subject, device, identity_key, signed_prekey_id, signed_prekey, signed_prekey_signature, updated_at
+                  FROM "device_key"
+                  WHERE subject = ?
+                  ORDER BY device;`)
+
+	rows, err := ses.Query(sqlstr, subject)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list device_key with subject: %s failed", subject)
+	}
+	defer rows.Close()
+
+	var res []*entity.DeviceKey
+	for rows.Next() {
+		r := entity.DeviceKey{}
+		if err = rows.Scan(&r.Subject, &r.Device, &r.IdentityKey, &r.SignedPreKeyID, &r.SignedPreKey, &r.SignedPreKeySignature, &r.UpdatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan device_key")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestUpsertDeviceKey() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	u := s.addUser(ses)
+	key := &entity.DeviceKey{Subject: u.Subject, Device: "phone", IdentityKey: "aWQ=", SignedPreKeyID: 1, SignedPreKey: "cHJl", SignedPreKeySignature: "c2ln"}
+	s.Require().Nil(s.storage.UpsertDeviceKey(ses, key))
+	s.Require().Nil(s.storage.UpsertDeviceKey(ses, &entity.DeviceKey{Subject: u.Subject, Device: "desktop", IdentityKey: "aWQy", SignedPreKeyID: 1, SignedPreKey: "cHJl", SignedPreKeySignature: "c2ln"}))
+	// 同一设备重新上传时替换
+	key.SignedPreKeyID, key.SignedPreKey = 2, "cHJlMg=="
+	s.Require().Nil(s.storage.UpsertDeviceKey(ses, key))
+
+	res, err := s.storage.ListDeviceKeysBySubject(ses, u.Subject)
+	s.Require().Nil(err)
+	s.Require().Len(res, 2)
+	s.Require().Equal("desktop", res[0].Device)
+	s.Require().Equal(int64(2), res[1].SignedPreKeyID)
+
+	s.Require().Nil(s.storage.DeleteDeviceKey(ses, u.Subject, "desktop"))
+	res, err = s.storage.ListDeviceKeysBySubject(ses, u.Subject)
+	s.Require().Nil(err)
+	s.Require().Len(res, 1)
+}
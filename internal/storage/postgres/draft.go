@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) UpsertDraft(ses storage.Session, i *entity.Draft) error {
+	sqlstr := rebind(`INSERT INTO "draft"
+                  (owner, kind, peer, group_id, content)
+                  VALUES
+                  (?, ?, ?, ?, ?)
+                  ON CONFLICT (owner, kind, peer, group_id) DO UPDATE
+                  SET content = EXCLUDED.content,
+                      updated_at = now()
+                  RETURNING updated_at;`)
+
+	err := ses.QueryRow(sqlstr, i.Owner, i.Kind, i.Peer, i.GroupID, i.Content).Scan(&i.UpdatedAt)
+	if err != nil {
+		return wrapPGErrorf(err, "failed to upsert draft")
+	}
+
+	return nil
+}
+
+// DeleteDraft 删除草稿，返回草稿是否存在
+func (p *postgres) DeleteDraft(ses storage.Session, owner, kind, peer string, groupID int64) (bool, error) {
+	sqlstr := rebind(`DELETE FROM "draft" WHERE owner = ? AND kind = ? AND peer = ? AND group_id = ?;`)
+	res, err := ses.Exec(sqlstr, owner, kind, peer, groupID)
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete draft with owner: %s, kind: %s, peer: %s and group_id: %d failed", owner, kind, peer, groupID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete draft with owner: %s, kind: %s, peer: %s and group_id: %d failed", owner, kind, peer, groupID)
+	}
+
+	return n > 0, nil
+}
+
+func (p *postgres) ListDraftsByOwner(ses storage.Session, owner string) ([]*entity.Draft, error) {
+	sqlstr := rebind(`SELECT owner, kind, peer, group_id, content, updated_at
+                  FROM "draft"
+                  WHERE owner = ?
+                  ORDER BY updated_at DESC;`)
+
+	rows, err := ses.Query(sqlstr, owner)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list drafts with owner: %s failed", owner)
+	}
+	defer rows.Close()
+
+	var res []*entity.Draft
+	for rows.Next() {
+		r := entity.Draft{}
+		if err = rows.Scan(&r.Owner, &r.Kind, &r.Peer, &r.GroupID, &r.Content, &r.UpdatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan draft")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestUpsertDraft() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, peer := s.addUser(ses), s.addUser(ses)
+	d := &entity.Draft{Owner: owner.Subject, Kind: entity.RecordKindPrivate, Peer: peer.Subject, Content: "hel"}
+	s.Require().Nil(s.storage.UpsertDraft(ses, d))
+	// 同一会话只保留一份草稿
+	d.Content = "hello"
+	s.Require().Nil(s.storage.UpsertDraft(ses, d))
+
+	res, err := s.storage.ListDraftsByOwner(ses, owner.Subject)
+	s.Require().Nil(err)
+	s.Require().Len(res, 1)
+	s.Require().Equal("hello", res[0].Content)
+
+	ok, err := s.storage.DeleteDraft(ses, owner.Subject, entity.RecordKindPrivate, peer.Subject, 0)
+	s.Require().Nil(err)
+	s.Require().True(ok)
+	ok, err = s.storage.DeleteDraft(ses, owner.Subject, entity.RecordKindPrivate, peer.Subject, 0)
+	s.Require().Nil(err)
+	s.Require().False(ok)
+
+	res, err = s.storage.ListDraftsByOwner(ses, owner.Subject)
+	s.Require().Nil(err)
+	s.Require().Empty(res)
+}
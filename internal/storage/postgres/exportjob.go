@@ -0,0 +1,230 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertExportJob(ses storage.Session, i *entity.ExportJob) (int64, error) {
+	sqlstr := rebind(`INSERT INTO "export_job"
+                  (owner, kind, peer, group_id, format, status)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?)
+                  RETURNING id;`)
+	args := []any{
+		i.Owner,
+		i.Kind,
+		i.Peer,
+		i.GroupID,
+		i.Format,
+		i.Status,
+	}
+
+	var id int64
+	if err := ses.QueryRow(sqlstr, args...).Scan(&id); err != nil {
+		return 0, wrapPGErrorf(err, "failed to insert export job")
+	}
+
+	return id, nil
+}
+
+var exportJobProjection = []string{
+	"id",
+	"owner",
+	"kind",
+	"peer",
+	"group_id",
+	"format",
+	"status",
+	"file_path",
+	"reason",
+	"created_at",
+	"started_at",
+	"finished_at",
+	"attempt",
+}
+
+func (p *postgres) listExportJobs(ses storage.Session, where *entity.Where) ([]*entity.ExportJob, error) {
+	var args []any
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "export_job"`, strings.Join(exportJobProjection, ", "))
+	if where != nil {
+		sel, selArgs, err := where.Parse()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, selArgs...)
+		sqlstr += sel
+	}
+	sqlstr += ` ORDER BY id DESC`
+
+	sqlstr = rebind(sqlstr)
+	rows, err := ses.Query(sqlstr, args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to list export jobs")
+	}
+	defer rows.Close()
+
+	return scanExportJobs(rows)
+}
+
+func scanExportJobs(rows *sql.Rows) ([]*entity.ExportJob, error) {
+	var res []*entity.ExportJob
+	for rows.Next() {
+		r := entity.ExportJob{}
+		if err := rows.Scan(&r.ID, &r.Owner, &r.Kind, &r.Peer, &r.GroupID, &r.Format, &r.Status, &r.FilePath, &r.Reason, &r.CreatedAt, &r.StartedAt, &r.FinishedAt, &r.Attempt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan export job")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetExportJob(ses storage.Session, id int64) (*entity.ExportJob, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listExportJobs(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get export job with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no export job with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) ListExportJobsByOwner(ses storage.Session, owner string) ([]*entity.ExportJob, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"owner"},
+		FieldValues: []any{owner},
+	}
+
+	res, err := p.listExportJobs(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list export jobs with owner: %s failed", owner)
+	}
+
+	return res, nil
+}
+
+// ListClaimableExportJobsForUpdate 锁定待导出的任务，以及租约超过lease未续期的导出中任务，
+// SKIP LOCKED保证多个实例不会重复领取同一个
+func (p *postgres) ListClaimableExportJobsForUpdate(ses storage.Session, lease time.Duration, limit int) ([]*entity.ExportJob, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s
+                  FROM "export_job"
+                  WHERE status = ?
+                     OR (status = ? AND started_at < now() - ? * interval '1 second')
+                  ORDER BY id
+                  LIMIT ?
+                  FOR UPDATE SKIP LOCKED;`, strings.Join(exportJobProjection, ", ")))
+
+	rows, err := ses.Query(sqlstr, entity.ExportStatusPending, entity.ExportStatusRunning, lease.Seconds(), limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list claimable export jobs failed")
+	}
+	defer rows.Close()
+
+	return scanExportJobs(rows)
+}
+
+// ClaimExportJob 将任务标记为导出中并开始新的租约，返回本次领取的attempt
+func (p *postgres) ClaimExportJob(ses storage.Session, id int64) (int, error) {
+	sqlstr := rebind(`UPDATE "export_job"
+                  SET status = ?, started_at = now(), attempt = attempt + 1
+                  WHERE id = ?
+                  RETURNING attempt;`)
+
+	var attempt int
+	if err := ses.QueryRow(sqlstr, entity.ExportStatusRunning, id).Scan(&attempt); err != nil {
+		return 0, wrapPGErrorf(err, "claim export job with id: %d failed", id)
+	}
+
+	return attempt, nil
+}
+
+// RenewExportJobLease 续期导出任务的租约，任务已被其他实例重新领取时返回false
+func (p *postgres) RenewExportJobLease(ses storage.Session, id int64, attempt int) (bool, error) {
+	sqlstr := rebind(`UPDATE "export_job"
+                  SET started_at = now()
+                  WHERE id = ? AND attempt = ? AND status = ?;`)
+
+	res, err := ses.Exec(sqlstr, id, attempt, entity.ExportStatusRunning)
+	if err != nil {
+		return false, wrapPGErrorf(err, "renew lease of export job with id: %d failed", id)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "renew lease of export job with id: %d failed", id)
+	}
+
+	return n > 0, nil
+}
+
+// FinishExportJob 记录导出结果，status为已完成或导出失败，任务已被其他实例重新领取时返回false
+func (p *postgres) FinishExportJob(ses storage.Session, id int64, attempt int, status entity.ExportStatus, filePath, reason string) (bool, error) {
+	sqlstr := rebind(`UPDATE "export_job"
+                  SET status = ?, file_path = ?, reason = ?, finished_at = now()
+                  WHERE id = ? AND attempt = ? AND status = ?;`)
+
+	res, err := ses.Exec(sqlstr, status, filePath, reason, id, attempt, entity.ExportStatusRunning)
+	if err != nil {
+		return false, wrapPGErrorf(err, "finish export job with id: %d failed", id)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "finish export job with id: %d failed", id)
+	}
+
+	return n > 0, nil
+}
+
+func (p *postgres) InsertExportJobChunk(ses storage.Session, id int64, attempt, seq int, data []byte) error {
+	sqlstr := rebind(`INSERT INTO "export_job_chunk"
+                  (job_id, attempt, seq, data)
+                  VALUES
+                  (?, ?, ?, ?);`)
+
+	if _, err := ses.Exec(sqlstr, id, attempt, seq, data); err != nil {
+		return wrapPGErrorf(err, "insert chunk %d of export job with id: %d failed", seq, id)
+	}
+
+	return nil
+}
+
+func (p *postgres) GetExportJobChunk(ses storage.Session, id int64, attempt, seq int) ([]byte, error) {
+	sqlstr := rebind(`SELECT data
+                  FROM "export_job_chunk"
+                  WHERE job_id = ? AND attempt = ? AND seq = ?;`)
+
+	var data []byte
+	if err := ses.QueryRow(sqlstr, id, attempt, seq).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Newf(errors.NotFound, nil, "no chunk %d of export job with id: %d found", seq, id)
+		}
+		return nil, wrapPGErrorf(err, "get chunk %d of export job with id: %d failed", seq, id)
+	}
+
+	return data, nil
+}
+
+// DeleteExportJobChunks 删除任务中不属于attempt的文件分块，即之前被中断的导出留下的分块
+func (p *postgres) DeleteExportJobChunks(ses storage.Session, id int64, attempt int) error {
+	sqlstr := rebind(`DELETE FROM "export_job_chunk"
+                  WHERE job_id = ? AND attempt <> ?;`)
+
+	if _, err := ses.Exec(sqlstr, id, attempt); err != nil {
+		return wrapPGErrorf(err, "delete chunks of export job with id: %d failed", id)
+	}
+
+	return nil
+}
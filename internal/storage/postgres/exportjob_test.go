@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestReclaimStaleExportJob() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	a, b := s.addUser(ses), s.addUser(ses)
+	id, err := s.storage.InsertExportJob(ses, &entity.ExportJob{Owner: a.Subject, Kind: entity.RecordKindPrivate, Peer: b.Subject, Format: entity.ExportFormatJSONL, Status: entity.ExportStatusPending})
+	s.Require().Nil(err)
+
+	first, err := s.storage.ClaimExportJob(ses, id)
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertExportJobChunk(ses, id, first, 0, []byte("partial")))
+
+	// 租约未过期时不能被重新领取
+	jobs, err := s.storage.ListClaimableExportJobsForUpdate(ses, time.Minute, 10)
+	s.Require().Nil(err)
+	for _, j := range jobs {
+		s.Require().NotEqual(id, j.ID)
+	}
+
+	_, err = ses.Exec(rebind(`UPDATE "export_job" SET started_at = started_at - interval '1 hour' WHERE id = ?;`), id)
+	s.Require().Nil(err)
+	jobs, err = s.storage.ListClaimableExportJobsForUpdate(ses, time.Minute, 10)
+	s.Require().Nil(err)
+	found := false
+	for _, j := range jobs {
+		found = found || j.ID == id
+	}
+	s.Require().True(found)
+
+	second, err := s.storage.ClaimExportJob(ses, id)
+	s.Require().Nil(err)
+	s.Require().Equal(first+1, second)
+
+	// 旧的attempt不能续期也不能完成任务
+	ok, err := s.storage.RenewExportJobLease(ses, id, first)
+	s.Require().Nil(err)
+	s.Require().False(ok)
+	ok, err = s.storage.FinishExportJob(ses, id, first, entity.ExportStatusDone, "x.jsonl", "")
+	s.Require().Nil(err)
+	s.Require().False(ok)
+
+	s.Require().Nil(s.storage.InsertExportJobChunk(ses, id, second, 0, []byte("done")))
+	ok, err = s.storage.FinishExportJob(ses, id, second, entity.ExportStatusDone, "x.jsonl", "")
+	s.Require().Nil(err)
+	s.Require().True(ok)
+	s.Require().Nil(s.storage.DeleteExportJobChunks(ses, id, second))
+
+	_, err = s.storage.GetExportJobChunk(ses, id, first, 0)
+	s.Require().NotNil(err)
+	data, err := s.storage.GetExportJobChunk(ses, id, second, 0)
+	s.Require().Nil(err)
+	s.Require().Equal("done", string(data))
+}
@@ -1,25 +1,38 @@
 package postgres
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"fangaoxs.com/go-chat/internal/entity"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
 )
 
+// InsertGroup 写入群并在同一条语句中创建默认频道
 func (p *postgres) InsertGroup(ses storage.Session, i *entity.Group) (int64, error) {
-	sqlstr := rebind(`INSERT INTO "group" 
-                  (name, "type", is_public, created_by)
-                  VALUES
-                  (?, ?, ?, ?)
-                  RETURNING id;`)
+	sqlstr := rebind(`WITH g AS (
+                      INSERT INTO "group"
+                      (name, "type", is_public, created_by, owner)
+                      VALUES
+                      (?, ?, ?, ?, ?)
+                      RETURNING id, owner
+                  )
+                  INSERT INTO "group_channel"
+                  (group_id, name, is_default, created_by)
+                  SELECT id, ?, true, owner FROM g
+                  RETURNING group_id;`)
 	args := []any{
 		i.Name,
 		i.Type,
 		i.IsPublic,
 		i.CreatedBy,
+		i.CreatedBy,
+		entity.DefaultGroupChannelName,
 	}
 
 	var id int64
@@ -39,6 +52,16 @@ func (p *postgres) listGroups(ses storage.Session, where *entity.Where) ([]*enti
 		"type",
 		"is_public",
 		"created_by",
+		"owner",
+		"muted_all",
+		"join_policy",
+		"join_question",
+		"capacity_tier",
+		"slow_mode",
+		"announcement",
+		"description",
+		"avatar",
+		"tags",
 		"created_at",
 	}
 
@@ -63,7 +86,7 @@ func (p *postgres) listGroups(ses storage.Session, where *entity.Where) ([]*enti
 	var res []*entity.Group
 	for rows.Next() {
 		r := entity.Group{}
-		if err = rows.Scan(&r.ID, &r.Name, &r.Type, &r.IsPublic, &r.CreatedBy, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.ID, &r.Name, &r.Type, &r.IsPublic, &r.CreatedBy, &r.Owner, &r.MutedAll, &r.JoinPolicy, &r.JoinQuestion, &r.CapacityTier, &r.SlowMode, &r.Announcement, &r.Description, &r.Avatar, pq.Array(&r.Tags), &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan group")
 		}
 		res = append(res, &r)
@@ -89,6 +112,24 @@ func (p *postgres) GetGroupByID(ses storage.Session, id int64) (*entity.Group, e
 	return groups[0], nil
 }
 
+// GetGroupByIDForUpdate 锁定群，用于串行化同一个群上的并发修改
+func (p *postgres) GetGroupByIDForUpdate(ses storage.Session, id int64) (*entity.Group, error) {
+	sqlstr := rebind(`SELECT id, name, "type", is_public, created_by, owner, muted_all, join_policy, join_question, capacity_tier, slow_mode, announcement, description, avatar, tags, created_at
+                  FROM "group"
+                  WHERE id = ?
+                  FOR UPDATE;`)
+
+	var res entity.Group
+	err := ses.QueryRow(sqlstr, id).Scan(
+		&res.ID, &res.Name, &res.Type, &res.IsPublic, &res.CreatedBy, &res.Owner, &res.MutedAll, &res.JoinPolicy, &res.JoinQuestion, &res.CapacityTier, &res.SlowMode, &res.Announcement, &res.Description, &res.Avatar, pq.Array(&res.Tags), &res.CreatedAt,
+	)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get group for update with id: %d failed", id)
+	}
+
+	return &res, nil
+}
+
 func (p *postgres) ListGroupsByCreatedBy(ses storage.Session, createdBy string) ([]*entity.Group, error) {
 	w := &entity.Where{
 		FieldNames:  []string{"created_by"},
@@ -112,6 +153,51 @@ func (p *postgres) DeleteGroup(ses storage.Session, id int64) error {
 	return nil
 }
 
+func (p *postgres) UpdateGroupJoinPolicy(ses storage.Session, id int64, policy entity.GroupJoinPolicy, question string) error {
+	sqlstr := rebind(`UPDATE "group" SET join_policy = ?, join_question = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, policy, question, id); err != nil {
+		return wrapPGErrorf(err, "update join_policy of group with id: %d to %s failed", id, policy)
+	}
+
+	return nil
+}
+
+func (p *postgres) UpdateGroupProfile(ses storage.Session, id int64, description string, tags []string) error {
+	sqlstr := rebind(`UPDATE "group" SET description = ?, tags = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, description, pq.Array(tags), id); err != nil {
+		return wrapPGErrorf(err, "update profile of group with id: %d failed", id)
+	}
+
+	return nil
+}
+
+func (p *postgres) UpdateGroupAvatar(ses storage.Session, id int64, avatar string) error {
+	sqlstr := rebind(`UPDATE "group" SET avatar = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, avatar, id); err != nil {
+		return wrapPGErrorf(err, "update avatar of group with id: %d failed", id)
+	}
+
+	return nil
+}
+
+func (p *postgres) UpdateGroupCapacityTier(ses storage.Session, id int64, tier int) error {
+	sqlstr := rebind(`UPDATE "group" SET capacity_tier = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, tier, id); err != nil {
+		return wrapPGErrorf(err, "update capacity_tier of group with id: %d to %d failed", id, tier)
+	}
+
+	return nil
+}
+
+func (p *postgres) UpdateGroupSlowMode(ses storage.Session, id int64, seconds int) error {
+	sqlstr := rebind(`UPDATE "group" SET slow_mode = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, seconds, id); err != nil {
+		return wrapPGErrorf(err, "update slow_mode of group with id: %d to %d failed", id, seconds)
+	}
+
+	return nil
+}
+
 func (p *postgres) UpdateGroupIsPublic(ses storage.Session, id int64, isPublic bool) error {
 	sqlstr := rebind(`UPDATE "group" 
                   SET is_public = ? 
@@ -127,16 +213,43 @@ func (p *postgres) UpdateGroupIsPublic(ses storage.Session, id int64, isPublic b
 	return nil
 }
 
+func (p *postgres) UpdateGroupName(ses storage.Session, id int64, name string) error {
+	sqlstr := rebind(`UPDATE "group" SET name = ? WHERE id = ?;`)
+	_, err := ses.Exec(sqlstr, name, id)
+	if err != nil {
+		return wrapPGErrorf(err, "update name of group with id: %d failed", id)
+	}
+
+	return nil
+}
+
+func (p *postgres) UpdateGroupAnnouncement(ses storage.Session, id int64, announcement string) error {
+	sqlstr := rebind(`UPDATE "group" 
+                  SET announcement = ? 
+                  WHERE id = ?;`)
+
+	_, err := ses.Exec(sqlstr, announcement, id)
+	if err != nil {
+		return wrapPGErrorf(err, "update announcement of group with id: %d failed", id)
+	}
+
+	return nil
+}
+
 func (p *postgres) InsertGroupMember(ses storage.Session, i *entity.GroupMember) error {
 	sqlstr := rebind(`INSERT INTO "group_member"
-                  (user_subject, group_id, is_admin)
+                  (user_subject, group_id, role)
                   VALUES
                   (?, ?, ?);`)
 
+	role := i.Role
+	if role == "" {
+		role = entity.GroupRoleMember
+	}
 	args := []any{
 		i.UserSubject,
 		i.GroupID,
-		i.IsAdmin,
+		role,
 	}
 
 	_, err := ses.Exec(sqlstr, args...)
@@ -144,7 +257,8 @@ func (p *postgres) InsertGroupMember(ses storage.Session, i *entity.GroupMember)
 		return wrapPGErrorf(err, "failed to insert group member")
 	}
 
-	return nil
+	// 入群前的消息不计入新成员的未读数
+	return p.MarkGroupChannelsRead(ses, i.GroupID, i.UserSubject, time.Now().UTC())
 }
 
 func (p *postgres) DeleteGroupMembersByGroupID(ses storage.Session, groupID int64) error {
@@ -167,11 +281,65 @@ func (p *postgres) DeleteGroupMember(ses storage.Session, userSubject string, gr
 	return nil
 }
 
+func (p *postgres) UpdateGroupMemberNickname(ses storage.Session, userSubject string, groupID int64, nickname string) error {
+	sqlstr := rebind(`UPDATE "group_member" SET nickname = ? WHERE user_subject = ? AND group_id = ?;`)
+	if _, err := ses.Exec(sqlstr, nickname, userSubject, groupID); err != nil {
+		return wrapPGErrorf(err, "update nickname of group member with user_subject: %s and group_id: %d failed", userSubject, groupID)
+	}
+
+	return nil
+}
+
+// ClaimGroupPostSlot 成员上次发言距数据库当前时间不少于interval时将发言时间更新为now()并返回nil，
+// 否则返回可以再次发言的时间。以数据库时间为准，条件更新在一条语句中完成，多个实例并发发言时只有一个能成功
+func (p *postgres) ClaimGroupPostSlot(ses storage.Session, userSubject string, groupID int64, interval time.Duration) (*time.Time, error) {
+	sqlstr := rebind(`UPDATE "group_member"
+                  SET last_posted_at = now()
+                  WHERE user_subject = ? AND group_id = ?
+                  AND (last_posted_at IS NULL OR last_posted_at <= now() - ? * interval '1 second')
+                  RETURNING user_subject;`)
+
+	var subject string
+	err := ses.QueryRow(sqlstr, userSubject, groupID, interval.Seconds()).Scan(&subject)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, wrapPGErrorf(err, "claim post slot of group member with user_subject: %s and group_id: %d failed", userSubject, groupID)
+	}
+
+	// 没有抢到时重新读取发言时间，并发时读到的是抢到的一方写入的时间，可发言时间不早于now()
+	sqlstr = rebind(`SELECT GREATEST(now(), last_posted_at + ? * interval '1 second')
+                  FROM "group_member"
+                  WHERE user_subject = ? AND group_id = ?;`)
+
+	var retryAt time.Time
+	if err = ses.QueryRow(sqlstr, interval.Seconds(), userSubject, groupID).Scan(&retryAt); err != nil {
+		return nil, wrapPGErrorf(err, "get post slot of group member with user_subject: %s and group_id: %d failed", userSubject, groupID)
+	}
+
+	return &retryAt, nil
+}
+
+func (p *postgres) CountGroupMembers(ses storage.Session, groupID int64) (int, error) {
+	sqlstr := rebind(`SELECT COUNT(*) FROM "group_member" WHERE group_id = ?;`)
+
+	var n int
+	if err := ses.QueryRow(sqlstr, groupID).Scan(&n); err != nil {
+		return 0, wrapPGErrorf(err, "count group members with group_id: %d failed", groupID)
+	}
+
+	return n, nil
+}
+
 func (p *postgres) listGroupMembers(ses storage.Session, where *entity.Where) ([]*entity.GroupMember, error) {
 	projection := []string{
 		"user_subject",
 		"group_id",
-		"is_admin",
+		"role",
+		"nickname",
+		"muted_until",
+		"last_posted_at",
 		"created_at",
 	}
 	var args []any
@@ -195,7 +363,7 @@ func (p *postgres) listGroupMembers(ses storage.Session, where *entity.Where) ([
 	var res []*entity.GroupMember
 	for rows.Next() {
 		r := entity.GroupMember{}
-		if err = rows.Scan(&r.UserSubject, &r.GroupID, &r.IsAdmin, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.UserSubject, &r.GroupID, &r.Role, &r.Nickname, &r.MutedUntil, &r.LastPostedAt, &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan group member")
 		}
 		res = append(res, &r)
@@ -252,17 +420,25 @@ func (p *postgres) ListGroupMembersByGroupID(ses storage.Session, groupID int64)
 	return res, nil
 }
 
+// ListGroupAdminsByGroupID 列出群主和管理员
 func (p *postgres) ListGroupAdminsByGroupID(ses storage.Session, groupID int64) ([]*entity.GroupMember, error) {
 	w := &entity.Where{
-		FieldNames:  []string{"group_id", "is_admin"},
-		FieldValues: []any{groupID, true},
+		FieldNames:  []string{"group_id"},
+		FieldValues: []any{groupID},
 	}
 
-	res, err := p.listGroupMembers(ses, w)
+	members, err := p.listGroupMembers(ses, w)
 	if err != nil {
 		return nil, wrapPGErrorf(err, "list group admins with group_id: %d failed", groupID)
 	}
 
+	var res []*entity.GroupMember
+	for _, m := range members {
+		if m.Role == entity.GroupRoleOwner || m.Role == entity.GroupRoleAdmin {
+			res = append(res, m)
+		}
+	}
+
 	return res, nil
 }
 
@@ -280,20 +456,32 @@ func (p *postgres) ListGroupMembersByUserSubject(ses storage.Session, userSubjec
 	return res, nil
 }
 
+// IsAdminOfGroup 群主和管理员都视为管理员
 func (p *postgres) IsAdminOfGroup(ses storage.Session, subject string, groupID int64) (bool, error) {
 	gm, err := p.GetGroupMember(ses, subject, groupID)
 	if err != nil {
 		return false, err
 	}
 
-	return gm.IsAdmin, nil
+	return gm.Role == entity.GroupRoleOwner || gm.Role == entity.GroupRoleAdmin, nil
+}
+
+func (p *postgres) UpdateGroupMemberRole(ses storage.Session, subject string, groupID int64, role string) error {
+	sqlstr := rebind(`UPDATE "group_member" SET role = ? WHERE user_subject = ? AND group_id = ?;`)
+	_, err := ses.Exec(sqlstr, role, subject, groupID)
+	if err != nil {
+		return wrapPGErrorf(err, "update role of group member with user_subject: %s and group_id: %d to %s failed", subject, groupID, role)
+	}
+
+	return nil
 }
 
-func (p *postgres) UpdateGroupMemberIsAdmin(ses storage.Session, subject string, groupID int64, isAdmin bool) error {
-	sqlstr := rebind(`UPDATE "group_member" SET is_admin = ? WHERE user_subject = ? AND group_id = ?;`)
-	_, err := ses.Exec(sqlstr, isAdmin, subject, groupID)
+// ReplaceGroupMembersRole 将群中角色为from的成员改为to，用于删除自定义角色
+func (p *postgres) ReplaceGroupMembersRole(ses storage.Session, groupID int64, from, to string) error {
+	sqlstr := rebind(`UPDATE "group_member" SET role = ? WHERE group_id = ? AND role = ?;`)
+	_, err := ses.Exec(sqlstr, to, groupID, from)
 	if err != nil {
-		return wrapPGErrorf(err, "update is_admin of group member with user_subject: %s and group_id: %d to %t failed", subject, groupID, isAdmin)
+		return wrapPGErrorf(err, "replace role of group members with group_id: %d from %s to %s failed", groupID, from, to)
 	}
 
 	return nil
@@ -1 +1,173 @@
 package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestGroupJoinPolicy() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, sender := s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "join policy", Type: entity.DefaultGroupType, IsPublic: true, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	// 默认需要审批
+	grp, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(entity.GroupJoinApproval, grp.JoinPolicy)
+
+	s.Require().Nil(s.storage.UpdateGroupJoinPolicy(ses, groupID, entity.GroupJoinQuestion, "why?"))
+	grp, err = s.storage.GetGroupByIDForUpdate(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(entity.GroupJoinQuestion, grp.JoinPolicy)
+	s.Require().Equal("why?", grp.JoinQuestion)
+
+	req := &entity.GroupRequestLog{GroupID: groupID, Sender: sender.Subject, Status: entity.LogsStatusPending, Answer: "because"}
+	s.Require().Nil(s.storage.InsertGroupRequestLog(ses, req))
+	s.Require().NotZero(req.ID)
+
+	got, err := s.storage.GetGroupRequestLog(ses, req.ID)
+	s.Require().Nil(err)
+	s.Require().Equal("because", got.Answer)
+}
+
+func (s *postgresSuite) TestGroupProfile() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner := s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "profile", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: owner.Subject, GroupID: groupID, Role: entity.GroupRoleOwner}))
+
+	grp, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Empty(grp.Tags)
+	s.Require().Empty(grp.Avatar)
+
+	s.Require().Nil(s.storage.UpdateGroupProfile(ses, groupID, "desc", []string{"go", "chat"}))
+	s.Require().Nil(s.storage.UpdateGroupAvatar(ses, groupID, "avatars/foo.png"))
+	grp, err = s.storage.GetGroupByIDForUpdate(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal("desc", grp.Description)
+	s.Require().Equal([]string{"go", "chat"}, grp.Tags)
+	s.Require().Equal("avatars/foo.png", grp.Avatar)
+
+	s.Require().Nil(s.storage.UpdateGroupMemberNickname(ses, owner.Subject, groupID, "boss"))
+	gm, err := s.storage.GetGroupMember(ses, owner.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal("boss", gm.Nickname)
+}
+
+func (s *postgresSuite) TestGroupCapacity() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, member := s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "capacity", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: owner.Subject, GroupID: groupID, Role: entity.GroupRoleOwner}))
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: groupID}))
+
+	n, err := s.storage.CountGroupMembers(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(2, n)
+
+	tiers := []int{2, 10}
+	grp, err := s.storage.GetGroupByIDForUpdate(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(0, grp.CapacityTier)
+	s.Require().Equal(2, grp.MaxMembers(tiers))
+
+	s.Require().Nil(s.storage.UpdateGroupCapacityTier(ses, groupID, 1))
+	grp, err = s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(10, grp.MaxMembers(tiers))
+}
+
+func (s *postgresSuite) TestGroupSlowMode() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner := s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "slow", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: owner.Subject, GroupID: groupID, Role: entity.GroupRoleOwner}))
+
+	s.Require().Nil(s.storage.UpdateGroupSlowMode(ses, groupID, 30))
+	grp, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(30, grp.SlowMode)
+
+	retryAt, err := s.storage.ClaimGroupPostSlot(ses, owner.Subject, groupID, 30*time.Second)
+	s.Require().Nil(err)
+	s.Require().Nil(retryAt)
+
+	// 间隔内再次发言失败，返回以数据库时间计算的可发言时间
+	retryAt, err = s.storage.ClaimGroupPostSlot(ses, owner.Subject, groupID, 30*time.Second)
+	s.Require().Nil(err)
+	s.Require().NotNil(retryAt)
+
+	gm, err := s.storage.GetGroupMember(ses, owner.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().NotNil(gm.LastPostedAt)
+	s.Require().True(gm.LastPostedAt.Add(30 * time.Second).Equal(*retryAt))
+
+	// 其他实例抢到发言时间后，返回的可发言时间以抢到的一方写入的时间为准
+	_, err = ses.Exec(rebind(`UPDATE "group_member" SET last_posted_at = now() + interval '1 hour' WHERE user_subject = ? AND group_id = ?;`), owner.Subject, groupID)
+	s.Require().Nil(err)
+	retryAt, err = s.storage.ClaimGroupPostSlot(ses, owner.Subject, groupID, 30*time.Second)
+	s.Require().Nil(err)
+	s.Require().NotNil(retryAt)
+	gm, err = s.storage.GetGroupMember(ses, owner.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().True(gm.LastPostedAt.Add(30 * time.Second).Equal(*retryAt))
+
+	// 事务内now()不变，间隔为0时可以再次发言
+	retryAt, err = s.storage.ClaimGroupPostSlot(ses, owner.Subject, groupID, 0)
+	s.Require().Nil(err)
+	s.Require().Nil(retryAt)
+}
+
+func (s *postgresSuite) TestGroupAnnouncement() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner := s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "announcement", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	// 公告按字符而不是字节限制长度
+	content := strings.Repeat("公", 1024)
+	s.Require().Nil(s.storage.UpdateGroupAnnouncement(ses, groupID, content))
+	s.Require().Nil(s.storage.InsertGroupAnnouncementLog(ses, &entity.GroupAnnouncementLog{GroupID: groupID, Content: content, EditedBy: owner.Subject}))
+
+	grp, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(content, grp.Announcement)
+
+	logs, err := s.storage.ListGroupAnnouncementLogsByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(logs, 1)
+	s.Require().Equal(owner.Subject, logs[0].EditedBy)
+}
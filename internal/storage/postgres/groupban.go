@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// UpdateGroupMemberMutedUntil until为nil时解除禁言
+func (p *postgres) UpdateGroupMemberMutedUntil(ses storage.Session, subject string, groupID int64, until *time.Time) error {
+	sqlstr := rebind(`UPDATE "group_member" SET muted_until = ? WHERE user_subject = ? AND group_id = ?;`)
+	if _, err := ses.Exec(sqlstr, until, subject, groupID); err != nil {
+		return wrapPGErrorf(err, "update muted_until of group member with user_subject: %s and group_id: %d failed", subject, groupID)
+	}
+
+	return nil
+}
+
+// LiftExpiredMutes 解除一批已到期的禁言并返回被解除的成员
+func (p *postgres) LiftExpiredMutes(ses storage.Session, now time.Time, limit int) ([]*entity.GroupMember, error) {
+	sqlstr := rebind(`UPDATE "group_member"
+                  SET muted_until = NULL
+                  WHERE (user_subject, group_id) IN (
+                      SELECT user_subject, group_id
+                      FROM "group_member"
+                      WHERE muted_until <= ?
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING user_subject, group_id, role, created_at;`)
+
+	rows, err := ses.Query(sqlstr, now, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "lift expired mutes failed")
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupMember
+	for rows.Next() {
+		r := entity.GroupMember{}
+		if err = rows.Scan(&r.UserSubject, &r.GroupID, &r.Role, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group member")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) UpdateGroupMutedAll(ses storage.Session, id int64, mutedAll bool) error {
+	sqlstr := rebind(`UPDATE "group" SET muted_all = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, mutedAll, id); err != nil {
+		return wrapPGErrorf(err, "update muted_all of group with id: %d to %t failed", id, mutedAll)
+	}
+
+	return nil
+}
+
+// UpsertGroupBan 重复封禁时更新封禁人和截止时间
+func (p *postgres) UpsertGroupBan(ses storage.Session, i *entity.GroupBan) error {
+	sqlstr := rebind(`INSERT INTO "group_ban"
+                  (group_id, user_subject, banned_by, expires_at)
+                  VALUES
+                  (?, ?, ?, ?)
+                  ON CONFLICT (group_id, user_subject) DO UPDATE
+                  SET banned_by = EXCLUDED.banned_by,
+                      expires_at = EXCLUDED.expires_at,
+                      created_at = now()
+                  RETURNING created_at;`)
+	args := []any{
+		i.GroupID,
+		i.UserSubject,
+		i.BannedBy,
+		i.ExpiresAt,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to upsert group_ban")
+	}
+
+	return nil
+}
+
+// DeleteGroupBan 返回封禁是否存在
+func (p *postgres) DeleteGroupBan(ses storage.Session, groupID int64, subject string) (bool, error) {
+	sqlstr := rebind(`DELETE FROM "group_ban" WHERE group_id = ? AND user_subject = ?;`)
+	res, err := ses.Exec(sqlstr, groupID, subject)
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete group_ban with group_id: %d and user_subject: %s failed", groupID, subject)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete group_ban with group_id: %d and user_subject: %s failed", groupID, subject)
+	}
+
+	return n > 0, nil
+}
+
+// IsBannedFromGroup 已到期但还未被清理的封禁不生效
+func (p *postgres) IsBannedFromGroup(ses storage.Session, subject string, groupID int64, now time.Time) (bool, error) {
+	sqlstr := rebind(`SELECT EXISTS (
+                      SELECT 1 FROM "group_ban"
+                      WHERE group_id = ? AND user_subject = ? AND (expires_at IS NULL OR expires_at > ?)
+                  );`)
+
+	var ok bool
+	if err := ses.QueryRow(sqlstr, groupID, subject, now).Scan(&ok); err != nil {
+		return false, wrapPGErrorf(err, "check group_ban with group_id: %d and user_subject: %s failed", groupID, subject)
+	}
+
+	return ok, nil
+}
+
+func (p *postgres) ListGroupBansByGroup(ses storage.Session, groupID int64) ([]*entity.GroupBan, error) {
+	sqlstr := rebind(`SELECT group_id, user_subject, banned_by, expires_at, created_at
+                  FROM "group_ban"
+                  WHERE group_id = ?
+                  ORDER BY created_at DESC;`)
+
+	rows, err := ses.Query(sqlstr, groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group_ban with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	return scanGroupBans(rows)
+}
+
+// DeleteExpiredGroupBans 删除一批已到期的封禁并返回它们
+func (p *postgres) DeleteExpiredGroupBans(ses storage.Session, now time.Time, limit int) ([]*entity.GroupBan, error) {
+	sqlstr := rebind(`DELETE FROM "group_ban"
+                  WHERE (group_id, user_subject) IN (
+                      SELECT group_id, user_subject
+                      FROM "group_ban"
+                      WHERE expires_at <= ?
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING group_id, user_subject, banned_by, expires_at, created_at;`)
+
+	rows, err := ses.Query(sqlstr, now, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "delete expired group bans failed")
+	}
+	defer rows.Close()
+
+	return scanGroupBans(rows)
+}
+
+func scanGroupBans(rows *sql.Rows) ([]*entity.GroupBan, error) {
+	var res []*entity.GroupBan
+	for rows.Next() {
+		r := entity.GroupBan{}
+		if err := rows.Scan(&r.GroupID, &r.UserSubject, &r.BannedBy, &r.ExpiresAt, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group_ban")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
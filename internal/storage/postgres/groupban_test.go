@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestGroupMuteAndBan() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, member, outsider := s.addUser(ses), s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "moderation", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: groupID}))
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	s.Require().Nil(s.storage.UpdateGroupMemberMutedUntil(ses, member.Subject, groupID, &past))
+	gm, err := s.storage.GetGroupMember(ses, member.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().NotNil(gm.MutedUntil)
+	s.Require().False(gm.Muted(now))
+
+	// 到期的禁言被解除
+	lifted, err := s.storage.LiftExpiredMutes(ses, now, 1000)
+	s.Require().Nil(err)
+	found := false
+	for _, m := range lifted {
+		found = found || (m.GroupID == groupID && m.UserSubject == member.Subject)
+	}
+	s.Require().True(found)
+	gm, err = s.storage.GetGroupMember(ses, member.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().Nil(gm.MutedUntil)
+
+	s.Require().Nil(s.storage.UpdateGroupMutedAll(ses, groupID, true))
+	g, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().True(g.MutedAll)
+
+	// 永久封禁和已到期的封禁
+	s.Require().Nil(s.storage.UpsertGroupBan(ses, &entity.GroupBan{GroupID: groupID, UserSubject: outsider.Subject, BannedBy: owner.Subject}))
+	s.Require().Nil(s.storage.UpsertGroupBan(ses, &entity.GroupBan{GroupID: groupID, UserSubject: member.Subject, BannedBy: owner.Subject, ExpiresAt: &past}))
+
+	banned, err := s.storage.IsBannedFromGroup(ses, outsider.Subject, groupID, now)
+	s.Require().Nil(err)
+	s.Require().True(banned)
+	banned, err = s.storage.IsBannedFromGroup(ses, member.Subject, groupID, now)
+	s.Require().Nil(err)
+	s.Require().False(banned)
+
+	expired, err := s.storage.DeleteExpiredGroupBans(ses, now, 1000)
+	s.Require().Nil(err)
+	found = false
+	for _, b := range expired {
+		found = found || (b.GroupID == groupID && b.UserSubject == member.Subject)
+	}
+	s.Require().True(found)
+
+	bans, err := s.storage.ListGroupBansByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(bans, 1)
+	s.Require().Nil(bans[0].ExpiresAt)
+
+	ok, err := s.storage.DeleteGroupBan(ses, groupID, outsider.Subject)
+	s.Require().Nil(err)
+	s.Require().True(ok)
+	ok, err = s.storage.DeleteGroupBan(ses, groupID, outsider.Subject)
+	s.Require().Nil(err)
+	s.Require().False(ok)
+}
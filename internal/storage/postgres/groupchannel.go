@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertGroupChannel(ses storage.Session, i *entity.GroupChannel) error {
+	sqlstr := rebind(`INSERT INTO "group_channel"
+                  (group_id, name, topic, admin_only, created_by)
+                  VALUES
+                  (?, ?, ?, ?, ?)
+                  RETURNING id, created_at;`)
+	args := []any{
+		i.GroupID,
+		i.Name,
+		i.Topic,
+		i.AdminOnly,
+		i.CreatedBy,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert group channel")
+	}
+
+	return nil
+}
+
+var groupChannelProjection = []string{
+	"ch.id",
+	"ch.group_id",
+	"ch.name",
+	"ch.topic",
+	"ch.admin_only",
+	"ch.is_default",
+	"ch.created_by",
+	"ch.created_at",
+}
+
+func scanGroupChannel(row interface{ Scan(...any) error }, r *entity.GroupChannel, extra ...any) error {
+	dest := []any{&r.ID, &r.GroupID, &r.Name, &r.Topic, &r.AdminOnly, &r.IsDefault, &r.CreatedBy, &r.CreatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func (p *postgres) GetGroupChannel(ses storage.Session, id int64) (*entity.GroupChannel, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s FROM "group_channel" ch WHERE ch.id = ?;`, strings.Join(groupChannelProjection, ", ")))
+
+	var res entity.GroupChannel
+	if err := scanGroupChannel(ses.QueryRow(sqlstr, id), &res); err != nil {
+		return nil, wrapPGErrorf(err, "get group channel with id: %d failed", id)
+	}
+
+	return &res, nil
+}
+
+func (p *postgres) GetDefaultGroupChannel(ses storage.Session, groupID int64) (*entity.GroupChannel, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s FROM "group_channel" ch WHERE ch.group_id = ? AND ch.is_default;`, strings.Join(groupChannelProjection, ", ")))
+
+	var res entity.GroupChannel
+	if err := scanGroupChannel(ses.QueryRow(sqlstr, groupID), &res); err != nil {
+		return nil, wrapPGErrorf(err, "get default group channel with group_id: %d failed", groupID)
+	}
+
+	return &res, nil
+}
+
+// ListGroupChannelsByGroup 默认频道在前，其余按创建顺序排列，并附带subject在各频道的已读位置
+func (p *postgres) ListGroupChannelsByGroup(ses storage.Session, groupID int64, subject string) ([]*entity.GroupChannel, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s, COALESCE(c.id, 0), COALESCE(c.last_seq, 0), COALESCE(r.read_seq, 0)
+                  FROM "group_channel" ch
+                  LEFT JOIN "conversation" c ON c.kind = ? AND c.party1 = '' AND c.party2 = '' AND c.group_id = ch.group_id AND c.channel_id = ch.id
+                  LEFT JOIN "group_channel_read" r ON r.channel_id = ch.id AND r.user_subject = ?
+                  WHERE ch.group_id = ?
+                  ORDER BY ch.is_default DESC, ch.id;`, strings.Join(groupChannelProjection, ", ")))
+
+	rows, err := ses.Query(sqlstr, entity.RecordKindGroup, subject, groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group channels with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupChannel
+	for rows.Next() {
+		r := entity.GroupChannel{}
+		if err = scanGroupChannel(rows, &r, &r.ConversationID, &r.LastSeq, &r.ReadSeq); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group channel")
+		}
+		if r.LastSeq > r.ReadSeq {
+			r.UnreadCount = r.LastSeq - r.ReadSeq
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) UpdateGroupChannel(ses storage.Session, i *entity.GroupChannel) error {
+	sqlstr := rebind(`UPDATE "group_channel" SET name = ?, topic = ?, admin_only = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, i.Name, i.Topic, i.AdminOnly, i.ID); err != nil {
+		return wrapPGErrorf(err, "update group channel with id: %d failed", i.ID)
+	}
+
+	return nil
+}
+
+// UpsertGroupChannelRead 更新subject在频道内的已读位置，已读位置只前进不后退
+func (p *postgres) UpsertGroupChannelRead(ses storage.Session, channelID int64, subject string, seq int64, now time.Time) error {
+	sqlstr := rebind(`INSERT INTO "group_channel_read"
+                  (channel_id, user_subject, read_seq, updated_at)
+                  VALUES
+                  (?, ?, ?, ?)
+                  ON CONFLICT (channel_id, user_subject) DO UPDATE
+                  SET read_seq   = GREATEST("group_channel_read".read_seq, EXCLUDED.read_seq),
+                      updated_at = EXCLUDED.updated_at;`)
+	if _, err := ses.Exec(sqlstr, channelID, subject, seq, now); err != nil {
+		return wrapPGErrorf(err, "upsert read seq of group channel with id: %d and user_subject: %s failed", channelID, subject)
+	}
+
+	return nil
+}
+
+// MarkGroupChannelsRead 将subject在群内所有频道的已读位置推进到频道会话的最新序号
+func (p *postgres) MarkGroupChannelsRead(ses storage.Session, groupID int64, subject string, now time.Time) error {
+	sqlstr := rebind(`INSERT INTO "group_channel_read"
+                  (channel_id, user_subject, read_seq, updated_at)
+                  SELECT ch.id, ?, c.last_seq, ?
+                  FROM "group_channel" ch
+                  JOIN "conversation" c ON c.kind = ? AND c.party1 = '' AND c.party2 = '' AND c.group_id = ch.group_id AND c.channel_id = ch.id
+                  WHERE ch.group_id = ?
+                  ON CONFLICT (channel_id, user_subject) DO UPDATE
+                  SET read_seq   = GREATEST("group_channel_read".read_seq, EXCLUDED.read_seq),
+                      updated_at = EXCLUDED.updated_at;`)
+	if _, err := ses.Exec(sqlstr, subject, now, entity.RecordKindGroup, groupID); err != nil {
+		return wrapPGErrorf(err, "mark group channels with group_id: %d read for user_subject: %s failed", groupID, subject)
+	}
+
+	return nil
+}
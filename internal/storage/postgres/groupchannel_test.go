@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestGroupChannel() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner := s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "channel", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	// 建群时自动创建默认频道
+	general, err := s.storage.GetDefaultGroupChannel(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(entity.DefaultGroupChannelName, general.Name)
+	s.Require().Equal(owner.Subject, general.CreatedBy)
+
+	news := &entity.GroupChannel{GroupID: groupID, Name: "news", AdminOnly: true, CreatedBy: owner.Subject}
+	s.Require().Nil(s.storage.InsertGroupChannel(ses, news))
+	s.Require().NotZero(news.ID)
+
+	// 不指定频道时写入默认频道，每个频道的序号独立递增
+	r1 := &entity.RecordGroup{GroupID: groupID, Content: "hi", Sender: owner.Subject}
+	_, err = s.storage.InsertRecordGroup(ses, r1)
+	s.Require().Nil(err)
+	s.Require().Equal(general.ID, r1.ChannelID)
+	r2 := &entity.RecordGroup{GroupID: groupID, ChannelID: news.ID, Content: "release", Sender: owner.Subject}
+	_, err = s.storage.InsertRecordGroup(ses, r2)
+	s.Require().Nil(err)
+	r3 := &entity.RecordGroup{GroupID: groupID, ChannelID: news.ID, Content: "hotfix", Sender: owner.Subject}
+	_, err = s.storage.InsertRecordGroup(ses, r3)
+	s.Require().Nil(err)
+	s.Require().NotEqual(r1.ConversationID, r2.ConversationID)
+	s.Require().Equal(int64(1), r1.Seq)
+	s.Require().Equal(int64(2), r3.Seq)
+
+	rcds, err := s.storage.ListRecordGroupsByChannel(ses, news.ID)
+	s.Require().Nil(err)
+	s.Require().Len(rcds, 2)
+	s.Require().Equal(news.ID, rcds[0].ChannelID)
+	rcds, err = s.storage.ListRecordGroupsByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(rcds, 3)
+
+	conv, err := s.storage.GetGroupConversation(ses, groupID, news.ID)
+	s.Require().Nil(err)
+	s.Require().Equal(r2.ConversationID, conv.ID)
+	s.Require().Equal(int64(2), conv.LastSeq)
+
+	// 已读位置只前进不后退
+	now := time.Now().UTC()
+	s.Require().Nil(s.storage.UpsertGroupChannelRead(ses, news.ID, owner.Subject, 1, now))
+	s.Require().Nil(s.storage.UpsertGroupChannelRead(ses, news.ID, owner.Subject, 0, now))
+
+	channels, err := s.storage.ListGroupChannelsByGroup(ses, groupID, owner.Subject)
+	s.Require().Nil(err)
+	s.Require().Len(channels, 2)
+	s.Require().True(channels[0].IsDefault)
+	s.Require().Equal(int64(1), channels[0].UnreadCount)
+	s.Require().Equal(news.ID, channels[1].ID)
+	s.Require().Equal(int64(1), channels[1].ReadSeq)
+	s.Require().Equal(int64(1), channels[1].UnreadCount)
+
+	// 入群前的消息不计入未读，群会话的未读数为各频道未读数之和
+	member := s.addUser(ses)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: groupID}))
+	r4 := &entity.RecordGroup{GroupID: groupID, ChannelID: news.ID, Content: "rollback", Sender: owner.Subject}
+	id, err := s.storage.InsertRecordGroup(ses, r4)
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.UpsertInboxEntriesForRecordGroup(ses, id, r4))
+	e, err := s.storage.GetInboxEntry(ses, member.Subject, entity.RecordKindGroup, "", groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(1, e.UnreadCount)
+
+	s.Require().Nil(s.storage.MarkGroupChannelsRead(ses, groupID, member.Subject, now))
+	e, err = s.storage.GetInboxEntry(ses, member.Subject, entity.RecordKindGroup, "", groupID)
+	s.Require().Nil(err)
+	s.Require().Zero(e.UnreadCount)
+	channels, err = s.storage.ListGroupChannelsByGroup(ses, groupID, member.Subject)
+	s.Require().Nil(err)
+	s.Require().Zero(channels[0].UnreadCount)
+	s.Require().Zero(channels[1].UnreadCount)
+
+	news.Topic, news.AdminOnly = "版本发布", false
+	s.Require().Nil(s.storage.UpdateGroupChannel(ses, news))
+	got, err := s.storage.GetGroupChannel(ses, news.ID)
+	s.Require().Nil(err)
+	s.Require().Equal("版本发布", got.Topic)
+	s.Require().False(got.AdminOnly)
+}
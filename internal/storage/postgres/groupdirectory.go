@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// SearchGroupDirectory 检索公开群目录，私有群无论条件如何都不会返回
+func (p *postgres) SearchGroupDirectory(ses storage.Session, filter *entity.GroupDirectoryFilter) ([]*entity.GroupDirectoryEntry, error) {
+	conds := []string{"g.is_public"}
+	var condArgs []any
+	if filter.Query != "" {
+		conds = append(conds, "g.name ILIKE ?")
+		condArgs = append(condArgs, "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.Type != nil {
+		conds = append(conds, `g."type" = ?`)
+		condArgs = append(condArgs, *filter.Type)
+	}
+
+	args := []any{filter.ActiveSince}
+	args = append(args, condArgs...)
+
+	var orders []string
+	if filter.Query != "" {
+		orders = append(orders, "(g.name ILIKE ?) DESC")
+		args = append(args, escapeLike(filter.Query)+"%")
+	}
+	switch filter.Sort {
+	case entity.GroupDirectorySortRecent:
+		orders = append(orders, "g.created_at DESC")
+	default:
+		orders = append(orders, "member_count DESC", "recent_messages DESC")
+	}
+	orders = append(orders, "g.id DESC")
+
+	sqlstr := fmt.Sprintf(`SELECT g.id, g.name, g."type", g.announcement, g.join_policy, g.join_question, g.created_at,
+                  (SELECT COUNT(*) FROM "group_member" m WHERE m.group_id = g.id) AS member_count,
+                  (SELECT COUNT(*) FROM "record_group" r WHERE r.group_id = g.id AND r.created_at >= ? AND NOT r.system) AS recent_messages
+                  FROM "group" g
+                  WHERE %s
+                  ORDER BY %s
+                  LIMIT ? OFFSET ?;`, strings.Join(conds, " AND "), strings.Join(orders, ", "))
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := ses.Query(rebind(sqlstr), args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to search group directory")
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupDirectoryEntry
+	for rows.Next() {
+		r := entity.GroupDirectoryEntry{}
+		if err = rows.Scan(&r.ID, &r.Name, &r.Type, &r.Announcement, &r.JoinPolicy, &r.JoinQuestion, &r.CreatedAt, &r.MemberCount, &r.RecentMessages); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group directory entry")
+		}
+		r.Activity = entity.GroupActivityOf(r.RecentMessages)
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
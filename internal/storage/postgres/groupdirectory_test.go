@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+func (s *postgresSuite) TestSearchGroupDirectory() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, member := s.addUser(ses), s.addUser(ses)
+	prefix := uuid.NewString()[:8]
+
+	small, err := s.storage.InsertGroup(ses, &entity.Group{Name: prefix + " small", Type: entity.GameGroupType, IsPublic: true, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	big, err := s.storage.InsertGroup(ses, &entity.Group{Name: prefix + " big", Type: entity.GameGroupType, IsPublic: true, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: owner.Subject, GroupID: big}))
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: big}))
+	_, err = s.storage.InsertGroup(ses, &entity.Group{Name: prefix + " private", Type: entity.GameGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	_, err = s.storage.InsertGroup(ses, &entity.Group{Name: prefix + " study", Type: entity.StudyGroupType, IsPublic: true, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	typ := entity.GameGroupType
+	filter := &entity.GroupDirectoryFilter{
+		Query:       prefix,
+		Type:        &typ,
+		Sort:        entity.GroupDirectorySortPopular,
+		ActiveSince: time.Now().UTC().Add(-time.Hour),
+		Limit:       10,
+	}
+	res, err := s.storage.SearchGroupDirectory(ses, filter)
+	s.Require().Nil(err)
+	// 私有群和其他类型的群不返回
+	s.Require().Len(res, 2)
+	s.Require().Equal(big, res[0].ID)
+	s.Require().Equal(2, res[0].MemberCount)
+	s.Require().Equal(entity.GroupActivityInactive, res[0].Activity)
+
+	filter.Sort = entity.GroupDirectorySortRecent
+	res, err = s.storage.SearchGroupDirectory(ses, filter)
+	s.Require().Nil(err)
+	s.Require().Len(res, 2)
+	s.Require().Equal(big, res[0].ID)
+
+	filter.Offset, filter.Limit = 1, 1
+	res, err = s.storage.SearchGroupDirectory(ses, filter)
+	s.Require().Nil(err)
+	s.Require().Len(res, 1)
+	s.Require().Equal(small, res[0].ID)
+}
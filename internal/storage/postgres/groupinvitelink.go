@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertGroupInviteLink(ses storage.Session, i *entity.GroupInviteLink) error {
+	sqlstr := rebind(`INSERT INTO "group_invite_link"
+                  (group_id, token, created_by, expires_at, max_uses, requires_approval)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?)
+                  RETURNING id, created_at;`)
+	args := []any{
+		i.GroupID,
+		i.Token,
+		i.CreatedBy,
+		i.ExpiresAt,
+		i.MaxUses,
+		i.RequiresApproval,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert group invite link")
+	}
+
+	return nil
+}
+
+var groupInviteLinkProjection = []string{
+	"id",
+	"group_id",
+	"token",
+	"created_by",
+	"expires_at",
+	"max_uses",
+	"uses",
+	"requires_approval",
+	"revoked_at",
+	"created_at",
+}
+
+func scanGroupInviteLink(row interface{ Scan(...any) error }, r *entity.GroupInviteLink) error {
+	return row.Scan(&r.ID, &r.GroupID, &r.Token, &r.CreatedBy, &r.ExpiresAt, &r.MaxUses, &r.Uses, &r.RequiresApproval, &r.RevokedAt, &r.CreatedAt)
+}
+
+func (p *postgres) GetGroupInviteLink(ses storage.Session, id int64) (*entity.GroupInviteLink, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s FROM "group_invite_link" WHERE id = ?;`, strings.Join(groupInviteLinkProjection, ", ")))
+
+	var res entity.GroupInviteLink
+	if err := scanGroupInviteLink(ses.QueryRow(sqlstr, id), &res); err != nil {
+		return nil, wrapPGErrorf(err, "get group invite link with id: %d failed", id)
+	}
+
+	return &res, nil
+}
+
+// GetGroupInviteLinkByTokenForUpdate 锁定链接，用于串行化并发使用
+func (p *postgres) GetGroupInviteLinkByTokenForUpdate(ses storage.Session, token string) (*entity.GroupInviteLink, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s FROM "group_invite_link" WHERE token = ? FOR UPDATE;`, strings.Join(groupInviteLinkProjection, ", ")))
+
+	var res entity.GroupInviteLink
+	if err := scanGroupInviteLink(ses.QueryRow(sqlstr, token), &res); err != nil {
+		return nil, wrapPGErrorf(err, "get group invite link for update by token failed")
+	}
+
+	return &res, nil
+}
+
+func (p *postgres) ListGroupInviteLinksByGroup(ses storage.Session, groupID int64) ([]*entity.GroupInviteLink, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s
+                  FROM "group_invite_link"
+                  WHERE group_id = ?
+                  ORDER BY created_at DESC, id DESC;`, strings.Join(groupInviteLinkProjection, ", ")))
+
+	rows, err := ses.Query(sqlstr, groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group invite links with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupInviteLink
+	for rows.Next() {
+		r := entity.GroupInviteLink{}
+		if err = scanGroupInviteLink(rows, &r); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group invite link")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+// RevokeGroupInviteLink 已撤销的链接保持第一次撤销的时间
+func (p *postgres) RevokeGroupInviteLink(ses storage.Session, id int64, now time.Time) error {
+	sqlstr := rebind(`UPDATE "group_invite_link" SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, now, id); err != nil {
+		return wrapPGErrorf(err, "revoke group invite link with id: %d failed", id)
+	}
+
+	return nil
+}
+
+// InsertGroupInviteLinkUse 记录一次使用并累加链接的使用次数，同一用户重复使用时返回AlreadyExists
+func (p *postgres) InsertGroupInviteLinkUse(ses storage.Session, i *entity.GroupInviteLinkUse) error {
+	sqlstr := rebind(`INSERT INTO "group_invite_link_use"
+                  (link_id, user_subject)
+                  VALUES
+                  (?, ?)
+                  RETURNING created_at;`)
+	if err := ses.QueryRow(sqlstr, i.LinkID, i.UserSubject).Scan(&i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert group invite link use")
+	}
+
+	sqlstr = rebind(`UPDATE "group_invite_link" SET uses = uses + 1 WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, i.LinkID); err != nil {
+		return wrapPGErrorf(err, "increase uses of group invite link with id: %d failed", i.LinkID)
+	}
+
+	return nil
+}
+
+// IsGroupInviteLinkUsedBy 查询用户是否已经使用过该链接
+func (p *postgres) IsGroupInviteLinkUsedBy(ses storage.Session, linkID int64, subject string) (bool, error) {
+	sqlstr := rebind(`SELECT EXISTS (SELECT 1 FROM "group_invite_link_use" WHERE link_id = ? AND user_subject = ?);`)
+
+	var ok bool
+	if err := ses.QueryRow(sqlstr, linkID, subject).Scan(&ok); err != nil {
+		return false, wrapPGErrorf(err, "check use of group invite link with id: %d failed", linkID)
+	}
+
+	return ok, nil
+}
+
+func (p *postgres) ListGroupInviteLinkUses(ses storage.Session, linkID int64) ([]*entity.GroupInviteLinkUse, error) {
+	sqlstr := rebind(`SELECT link_id, user_subject, created_at
+                  FROM "group_invite_link_use"
+                  WHERE link_id = ?
+                  ORDER BY created_at DESC;`)
+
+	rows, err := ses.Query(sqlstr, linkID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group invite link uses with link_id: %d failed", linkID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupInviteLinkUse
+	for rows.Next() {
+		r := entity.GroupInviteLinkUse{}
+		if err = rows.Scan(&r.LinkID, &r.UserSubject, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group invite link use")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
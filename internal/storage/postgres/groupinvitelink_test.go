@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+func (s *postgresSuite) TestGroupInviteLink() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, joiner := s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "invite link", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	expiresAt := time.Now().UTC().Add(time.Hour)
+	link := &entity.GroupInviteLink{GroupID: groupID, Token: "test-token-" + joiner.Subject, CreatedBy: owner.Subject, ExpiresAt: &expiresAt, MaxUses: 1, RequiresApproval: true}
+	s.Require().Nil(s.storage.InsertGroupInviteLink(ses, link))
+	s.Require().NotZero(link.ID)
+
+	got, err := s.storage.GetGroupInviteLinkByTokenForUpdate(ses, link.Token)
+	s.Require().Nil(err)
+	s.Require().Equal(link.ID, got.ID)
+	s.Require().True(got.RequiresApproval)
+	s.Require().True(got.Usable(time.Now().UTC()))
+
+	// 使用后达到次数上限
+	used, err := s.storage.IsGroupInviteLinkUsedBy(ses, link.ID, joiner.Subject)
+	s.Require().Nil(err)
+	s.Require().False(used)
+	s.Require().Nil(s.storage.InsertGroupInviteLinkUse(ses, &entity.GroupInviteLinkUse{LinkID: link.ID, UserSubject: joiner.Subject}))
+	used, err = s.storage.IsGroupInviteLinkUsedBy(ses, link.ID, joiner.Subject)
+	s.Require().Nil(err)
+	s.Require().True(used)
+	got, err = s.storage.GetGroupInviteLink(ses, link.ID)
+	s.Require().Nil(err)
+	s.Require().Equal(1, got.Uses)
+	s.Require().False(got.Usable(time.Now().UTC()))
+
+	uses, err := s.storage.ListGroupInviteLinkUses(ses, link.ID)
+	s.Require().Nil(err)
+	s.Require().Len(uses, 1)
+	s.Require().Equal(joiner.Subject, uses[0].UserSubject)
+
+	// 通过链接产生的申请记录链接ID
+	s.Require().Nil(s.storage.InsertGroupRequestLog(ses, &entity.GroupRequestLog{GroupID: groupID, Sender: joiner.Subject, Status: entity.LogsStatusPending, InviteLinkID: link.ID}))
+	req, err := s.storage.GetPendingGroupRequestLogForUpdate(ses, groupID, joiner.Subject)
+	s.Require().Nil(err)
+	s.Require().Equal(link.ID, req.InviteLinkID)
+
+	// 重复撤销保留第一次撤销的时间
+	first := time.Now().UTC().Add(-time.Minute)
+	s.Require().Nil(s.storage.RevokeGroupInviteLink(ses, link.ID, first))
+	s.Require().Nil(s.storage.RevokeGroupInviteLink(ses, link.ID, time.Now().UTC()))
+	links, err := s.storage.ListGroupInviteLinksByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(links, 1)
+	s.Require().NotNil(links[0].RevokedAt)
+	s.Require().WithinDuration(first, *links[0].RevokedAt, time.Second)
+
+	// 同一用户重复使用，事务在此之后不可再用
+	err = s.storage.InsertGroupInviteLinkUse(ses, &entity.GroupInviteLinkUse{LinkID: link.ID, UserSubject: joiner.Subject})
+	s.Require().Equal(errors.AlreadyExists, errors.Code(err))
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) UpdateGroupOwner(ses storage.Session, id int64, owner string) error {
+	sqlstr := rebind(`UPDATE "group" SET owner = ? WHERE id = ?;`)
+	if _, err := ses.Exec(sqlstr, owner, id); err != nil {
+		return wrapPGErrorf(err, "update owner of group with id: %d to %s failed", id, owner)
+	}
+
+	return nil
+}
+
+func (p *postgres) InsertGroupOwnerLog(ses storage.Session, i *entity.GroupOwnerLog) error {
+	sqlstr := rebind(`INSERT INTO "group_owner_log"
+                  (group_id, from_subject, to_subject, reason)
+                  VALUES
+                  (?, ?, ?, ?)
+                  RETURNING id, created_at;`)
+	args := []any{
+		i.GroupID,
+		i.FromSubject,
+		i.ToSubject,
+		i.Reason,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert group owner log")
+	}
+
+	return nil
+}
+
+func (p *postgres) ListGroupOwnerLogsByGroup(ses storage.Session, groupID int64) ([]*entity.GroupOwnerLog, error) {
+	sqlstr := rebind(`SELECT id, group_id, from_subject, to_subject, reason, created_at
+                  FROM "group_owner_log"
+                  WHERE group_id = ?
+                  ORDER BY created_at DESC, id DESC;`)
+
+	rows, err := ses.Query(sqlstr, groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group owner logs with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupOwnerLog
+	for rows.Next() {
+		r := entity.GroupOwnerLog{}
+		if err = rows.Scan(&r.ID, &r.GroupID, &r.FromSubject, &r.ToSubject, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group owner log")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
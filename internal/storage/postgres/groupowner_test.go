@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestGroupOwner() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	creator, heir := s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "owner", Type: entity.DefaultGroupType, CreatedBy: creator.Subject})
+	s.Require().Nil(err)
+
+	g, err := s.storage.GetGroupByID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(creator.Subject, g.Owner)
+
+	s.Require().Nil(s.storage.UpdateGroupOwner(ses, groupID, heir.Subject))
+	log := &entity.GroupOwnerLog{GroupID: groupID, FromSubject: creator.Subject, ToSubject: heir.Subject, Reason: entity.GroupOwnerTransferred}
+	s.Require().Nil(s.storage.InsertGroupOwnerLog(ses, log))
+
+	// created_by保留群的创建者
+	g, err = s.storage.GetGroupByIDForUpdate(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(heir.Subject, g.Owner)
+	s.Require().Equal(creator.Subject, g.CreatedBy)
+
+	logs, err := s.storage.ListGroupOwnerLogsByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(logs, 1)
+	s.Require().Equal(log.ID, logs[0].ID)
+	s.Require().Equal(entity.GroupOwnerTransferred, logs[0].Reason)
+}
@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertGroupPin(ses storage.Session, i *entity.GroupPin) error {
+	sqlstr := rebind(`INSERT INTO "group_pin"
+                  (group_id, record_id, pinned_by)
+                  VALUES
+                  (?, ?, ?);`)
+	args := []any{
+		i.GroupID,
+		i.RecordID,
+		i.PinnedBy,
+	}
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to insert group pin")
+	}
+
+	return nil
+}
+
+// DeleteGroupPin 返回置顶是否存在
+func (p *postgres) DeleteGroupPin(ses storage.Session, groupID, recordID int64) (bool, error) {
+	sqlstr := rebind(`DELETE FROM "group_pin" WHERE group_id = ? AND record_id = ?;`)
+	res, err := ses.Exec(sqlstr, groupID, recordID)
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete group pin with group_id: %d and record_id: %d failed", groupID, recordID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "delete group pin with group_id: %d and record_id: %d failed", groupID, recordID)
+	}
+
+	return n > 0, nil
+}
+
+func (p *postgres) CountGroupPinsByGroup(ses storage.Session, groupID int64) (int, error) {
+	sqlstr := rebind(`SELECT count(*) FROM "group_pin" WHERE group_id = ?;`)
+
+	var count int
+	if err := ses.QueryRow(sqlstr, groupID).Scan(&count); err != nil {
+		return 0, wrapPGErrorf(err, "count group pins with group_id: %d failed", groupID)
+	}
+
+	return count, nil
+}
+
+func (p *postgres) ListGroupPinsByGroup(ses storage.Session, groupID int64) ([]*entity.GroupPin, error) {
+	projection := []string{
+		"p.group_id",
+		"p.record_id",
+		"p.pinned_by",
+		"p.created_at",
+		"r.id",
+		"r.group_id",
+		"r.content",
+		"r.sender",
+		"r.forward",
+		"r.created_at",
+	}
+
+	sqlstr := fmt.Sprintf(`SELECT %s 
+                  FROM "group_pin" p 
+                  JOIN "record_group" r ON r.id = p.record_id
+                  WHERE p.group_id = ?
+                  ORDER BY p.created_at DESC;`, strings.Join(projection, ", "))
+
+	rows, err := ses.Query(rebind(sqlstr), groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group pins with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupPin
+	for rows.Next() {
+		r := entity.GroupPin{Record: &entity.RecordGroup{}}
+		if err = rows.Scan(
+			&r.GroupID, &r.RecordID, &r.PinnedBy, &r.CreatedAt,
+			&r.Record.ID, &r.Record.GroupID, &r.Record.Content, &r.Record.Sender, &r.Record.Forward, &r.Record.CreatedAt,
+		); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group pin")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) InsertGroupAnnouncementLog(ses storage.Session, i *entity.GroupAnnouncementLog) error {
+	sqlstr := rebind(`INSERT INTO "group_announcement_log"
+                  (group_id, content, edited_by)
+                  VALUES
+                  (?, ?, ?);`)
+	args := []any{
+		i.GroupID,
+		i.Content,
+		i.EditedBy,
+	}
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to insert group announcement log")
+	}
+
+	return nil
+}
+
+func (p *postgres) ListGroupAnnouncementLogsByGroup(ses storage.Session, groupID int64) ([]*entity.GroupAnnouncementLog, error) {
+	sqlstr := rebind(`SELECT id, group_id, content, edited_by, created_at
+                  FROM "group_announcement_log"
+                  WHERE group_id = ?
+                  ORDER BY created_at DESC, id DESC;`)
+
+	rows, err := ses.Query(sqlstr, groupID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group announcement logs with group_id: %d failed", groupID)
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupAnnouncementLog
+	for rows.Next() {
+		r := entity.GroupAnnouncementLog{}
+		if err = rows.Scan(&r.ID, &r.GroupID, &r.Content, &r.EditedBy, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan group announcement log")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
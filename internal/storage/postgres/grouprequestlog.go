@@ -11,37 +11,40 @@ import (
 
 func (p *postgres) InsertGroupRequestLog(ses storage.Session, i *entity.GroupRequestLog) error {
 	sqlstr := rebind(`INSERT INTO "group_request_log" 
-                  (group_id, sender, approver, status)
+                  (group_id, sender, approver, status, invite_link_id, answer)
                   VALUES
-                  (?, ?, ?, ?);`)
+                  (?, ?, ?, ?, NULLIF(?::bigint, 0), ?)
+                  RETURNING id, created_at;`)
 	args := []any{
 		i.GroupID,
 		i.Sender,
 		i.Approver,
 		i.Status,
+		i.InviteLinkID,
+		i.Answer,
 	}
 
-	var err error
-	_, err = ses.Exec(sqlstr, args...)
-	if err != nil {
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
 		return wrapPGErrorf(err, "failed to insert group request log")
 	}
 
 	return nil
 }
 
-func (p *postgres) listGroupRequestLogs(ses storage.Session, where *entity.Where) ([]*entity.GroupRequestLog, error) {
-	projection := []string{
-		"id",
-		"group_id",
-		"sender",
-		"approver",
-		"status",
-		"created_at",
-	}
+var groupRequestLogProjection = []string{
+	"id",
+	"group_id",
+	"sender",
+	"approver",
+	"status",
+	"COALESCE(invite_link_id, 0)",
+	"answer",
+	"created_at",
+}
 
+func (p *postgres) listGroupRequestLogs(ses storage.Session, where *entity.Where) ([]*entity.GroupRequestLog, error) {
 	var args []any
-	sqlstr := fmt.Sprintf(`SELECT %s FROM "group_request_log"`, strings.Join(projection, ", "))
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "group_request_log"`, strings.Join(groupRequestLogProjection, ", "))
 	if where != nil {
 		sel, selArgs, err := where.Parse()
 		if err != nil {
@@ -61,7 +64,7 @@ func (p *postgres) listGroupRequestLogs(ses storage.Session, where *entity.Where
 	var res []*entity.GroupRequestLog
 	for rows.Next() {
 		r := entity.GroupRequestLog{}
-		if err = rows.Scan(&r.ID, &r.GroupID, &r.Sender, &r.Approver, &r.Status, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.ID, &r.GroupID, &r.Sender, &r.Approver, &r.Status, &r.InviteLinkID, &r.Answer, &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan group request log")
 		}
 		res = append(res, &r)
@@ -129,17 +132,17 @@ func (p *postgres) GetPendingGroupRequestLog(ses storage.Session, groupID int64,
 }
 
 func (p *postgres) GetPendingGroupRequestLogForUpdate(ses storage.Session, groupID int64, sender string) (*entity.GroupRequestLog, error) {
-	sqlstr := rebind(`SELECT * 
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s
                   FROM "group_request_log" 
                   WHERE group_id = ? 
                   AND sender = ?
                   AND status = ?
-                  FOR UPDATE;`)
+                  FOR UPDATE;`, strings.Join(groupRequestLogProjection, ", ")))
 
 	var res entity.GroupRequestLog
 	var err error
 	err = ses.QueryRow(sqlstr, groupID, sender, entity.LogsStatusPending).Scan(
-		&res.ID, &res.GroupID, &res.Sender, &res.Approver, &res.Status, &res.CreatedAt,
+		&res.ID, &res.GroupID, &res.Sender, &res.Approver, &res.Status, &res.InviteLinkID, &res.Answer, &res.CreatedAt,
 	)
 	if err != nil {
 		return nil, wrapPGErrorf(err, "get pending group request log for update with group_id: %d and sender: %s failed", groupID, sender)
@@ -149,12 +152,12 @@ func (p *postgres) GetPendingGroupRequestLogForUpdate(ses storage.Session, group
 }
 
 func (p *postgres) GetGroupRequestLogByIDForUpdate(ses storage.Session, id int64) (*entity.GroupRequestLog, error) {
-	sqlstr := rebind(`SELECT * FROM "group_request_log" WHERE id = ? FOR UPDATE;`)
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s FROM "group_request_log" WHERE id = ? FOR UPDATE;`, strings.Join(groupRequestLogProjection, ", ")))
 
 	var res entity.GroupRequestLog
 	var err error
 	err = ses.QueryRow(sqlstr, id).Scan(
-		&res.ID, &res.GroupID, &res.Sender, &res.Approver, &res.Status, &res.CreatedAt,
+		&res.ID, &res.GroupID, &res.Sender, &res.Approver, &res.Status, &res.InviteLinkID, &res.Answer, &res.CreatedAt,
 	)
 	if err != nil {
 		return nil, wrapPGErrorf(err, "get group request log for update with id: %d failed", id)
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+// UpsertGroupRole 新建角色或替换已有角色的权限
+func (p *postgres) UpsertGroupRole(ses storage.Session, i *entity.GroupRole) error {
+	sqlstr := rebind(`INSERT INTO "group_role"
+                  (group_id, name, permissions)
+                  VALUES
+                  (?, ?, ?)
+                  ON CONFLICT (group_id, name) DO UPDATE
+                  SET permissions = EXCLUDED.permissions,
+                      updated_at = now()
+                  RETURNING updated_at;`)
+
+	perms := make([]string, 0, len(i.Permissions))
+	for _, v := range i.Permissions {
+		perms = append(perms, string(v))
+	}
+	args := []any{
+		i.GroupID,
+		i.Name,
+		pq.Array(perms),
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.UpdatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to upsert group_role")
+	}
+
+	return nil
+}
+
+func (p *postgres) GetGroupRole(ses storage.Session, groupID int64, name string) (*entity.GroupRole, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"group_id", "name"},
+		FieldValues: []any{groupID, name},
+	}
+
+	res, err := p.listGroupRoles(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get group role with group_id: %d and name: %s failed", groupID, name)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no group role with group_id: %d and name: %s found", groupID, name)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) ListGroupRolesByGroup(ses storage.Session, groupID int64) ([]*entity.GroupRole, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"group_id"},
+		FieldValues: []any{groupID},
+	}
+
+	res, err := p.listGroupRoles(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list group roles with group_id: %d failed", groupID)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) DeleteGroupRole(ses storage.Session, groupID int64, name string) error {
+	sqlstr := rebind(`DELETE FROM "group_role" WHERE group_id = ? AND name = ?;`)
+	if _, err := ses.Exec(sqlstr, groupID, name); err != nil {
+		return wrapPGErrorf(err, "delete group role with group_id: %d and name: %s failed", groupID, name)
+	}
+
+	return nil
+}
+
+func (p *postgres) listGroupRoles(ses storage.Session, w *entity.Where) ([]*entity.GroupRole, error) {
+	sel, args, err := w.Parse()
+	if err != nil {
+		return nil, err
+	}
+	sqlstr := rebind(`SELECT group_id, name, permissions, updated_at FROM "group_role"` + sel + ` ORDER BY name;`)
+
+	rows, err := ses.Query(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*entity.GroupRole
+	for rows.Next() {
+		r := entity.GroupRole{}
+		var perms []string
+		if err = rows.Scan(&r.GroupID, &r.Name, pq.Array(&perms), &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		for _, v := range perms {
+			r.Permissions = append(r.Permissions, entity.GroupPermission(v))
+		}
+		r.Builtin = entity.IsBuiltinGroupRole(r.Name)
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
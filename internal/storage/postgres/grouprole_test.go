@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestGroupRole() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, admin, member := s.addUser(ses), s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "role", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: owner.Subject, GroupID: groupID, Role: entity.GroupRoleOwner}))
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: admin.Subject, GroupID: groupID, Role: entity.GroupRoleAdmin}))
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: groupID}))
+
+	gm, err := s.storage.GetGroupMember(ses, member.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(entity.GroupRoleMember, gm.Role)
+
+	// 群主和管理员都算管理员
+	admins, err := s.storage.ListGroupAdminsByGroupID(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Len(admins, 2)
+	ok, err := s.storage.IsAdminOfGroup(ses, owner.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().True(ok)
+
+	role := &entity.GroupRole{GroupID: groupID, Name: "moderator", Permissions: []entity.GroupPermission{entity.GroupPermPin, entity.GroupPermPost}}
+	s.Require().Nil(s.storage.UpsertGroupRole(ses, role))
+	role.Permissions = []entity.GroupPermission{entity.GroupPermPin}
+	s.Require().Nil(s.storage.UpsertGroupRole(ses, role))
+
+	got, err := s.storage.GetGroupRole(ses, groupID, "moderator")
+	s.Require().Nil(err)
+	s.Require().False(got.Builtin)
+	s.Require().Equal([]entity.GroupPermission{entity.GroupPermPin}, got.Permissions)
+
+	s.Require().Nil(s.storage.UpdateGroupMemberRole(ses, member.Subject, groupID, "moderator"))
+	s.Require().Nil(s.storage.ReplaceGroupMembersRole(ses, groupID, "moderator", entity.GroupRoleMember))
+	gm, err = s.storage.GetGroupMember(ses, member.Subject, groupID)
+	s.Require().Nil(err)
+	s.Require().Equal(entity.GroupRoleMember, gm.Role)
+
+	s.Require().Nil(s.storage.DeleteGroupRole(ses, groupID, "moderator"))
+	roles, err := s.storage.ListGroupRolesByGroup(ses, groupID)
+	s.Require().Nil(err)
+	s.Require().Empty(roles)
+}
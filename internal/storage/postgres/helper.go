@@ -1,8 +1,6 @@
 package postgres
 
 import (
-	"hash/fnv"
-	"math"
 	"strconv"
 	"strings"
 )
@@ -24,12 +22,8 @@ func rebind(query string) string {
 	return sb.String()
 }
 
-func hashCode(str string) int64 {
-	hash := fnv.New64()
-	hash.Write([]byte(str))
-	hc := hash.Sum64()
-	if hc > math.MaxInt64 {
-		return int64(hc - math.MaxUint64 - 1)
-	}
-	return int64(hc)
+// `50%_off` => `50\%\_off`
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
 }
@@ -15,3 +15,11 @@ func TestRebind(t *testing.T) {
 		t.Errorf("expected %s, but got %s", expected, got)
 	}
 }
+
+func TestEscapeLike(t *testing.T) {
+	got := escapeLike(`50%_off\`)
+	expected := `50\%\_off\\`
+	if got != expected {
+		t.Errorf("expected %s, but got %s", expected, got)
+	}
+}
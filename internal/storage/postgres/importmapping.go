@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+// GetImportMapping 返回外部ID对应的本地ID
+func (p *postgres) GetImportMapping(ses storage.Session, source, kind, foreignID string) (string, error) {
+	sqlstr := rebind(`SELECT local_id FROM "import_mapping" WHERE source = ? AND kind = ? AND foreign_id = ?;`)
+
+	var localID string
+	if err := ses.QueryRow(sqlstr, source, kind, foreignID).Scan(&localID); err != nil {
+		return "", wrapPGErrorf(err, "get import mapping with source: %s, kind: %s and foreign_id: %s failed", source, kind, foreignID)
+	}
+
+	return localID, nil
+}
+
+func (p *postgres) InsertImportMapping(ses storage.Session, source, kind, foreignID, localID string) error {
+	sqlstr := rebind(`INSERT INTO "import_mapping"
+                  (source, kind, foreign_id, local_id)
+                  VALUES
+                  (?, ?, ?, ?);`)
+
+	if _, err := ses.Exec(sqlstr, source, kind, foreignID, localID); err != nil {
+		return wrapPGErrorf(err, "failed to insert import mapping with source: %s, kind: %s and foreign_id: %s", source, kind, foreignID)
+	}
+
+	return nil
+}
+
+// ClaimImportMappings 登记一批外部ID，返回此前未登记过的ID
+func (p *postgres) ClaimImportMappings(ses storage.Session, source, kind string, foreignIDs []string) ([]string, error) {
+	if len(foreignIDs) == 0 {
+		return nil, nil
+	}
+
+	sqlstr := rebind(`INSERT INTO "import_mapping"
+                  (source, kind, foreign_id)
+                  SELECT ?, ?, unnest(?::varchar[])
+                  ON CONFLICT (source, kind, foreign_id) DO NOTHING
+                  RETURNING foreign_id;`)
+
+	rows, err := ses.Query(sqlstr, source, kind, pq.Array(foreignIDs))
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to claim import mappings with source: %s and kind: %s", source, kind)
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan import mapping")
+		}
+		res = append(res, id)
+	}
+
+	return res, nil
+}
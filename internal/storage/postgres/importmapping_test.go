@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"context"
+)
+
+func (s *postgresSuite) TestClaimImportMappings() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	got, err := s.storage.ClaimImportMappings(ses, "test", "record", []string{"m1", "m2"})
+	s.Require().Nil(err)
+	s.Require().ElementsMatch([]string{"m1", "m2"}, got)
+
+	got, err = s.storage.ClaimImportMappings(ses, "test", "record", []string{"m2", "m3"})
+	s.Require().Nil(err)
+	s.Require().Equal([]string{"m3"}, got)
+}
@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+// UpsertInboxEntriesForRecordPrivate 将私聊双方的会话置顶，接收方未读数+1
+func (p *postgres) UpsertInboxEntriesForRecordPrivate(ses storage.Session, recordID int64, i *entity.RecordPrivate) error {
+	sqlstr := rebind(`INSERT INTO "inbox_entry"
+                  (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at, unread_count)
+                  VALUES
+                  (?, ?, ?, 0, ?, ?, ?, now(), 0),
+                  (?, ?, ?, 0, ?, ?, ?, now(), 1)
+                  ON CONFLICT (owner, kind, peer, group_id) DO UPDATE
+                  SET last_record_id = EXCLUDED.last_record_id,
+                      last_content = EXCLUDED.last_content,
+                      last_sender = EXCLUDED.last_sender,
+                      last_at = EXCLUDED.last_at,
+                      unread_count = "inbox_entry".unread_count + EXCLUDED.unread_count;`)
+	args := []any{
+		i.Sender, entity.RecordKindPrivate, i.Receiver, recordID, i.Content, i.Sender,
+		i.Receiver, entity.RecordKindPrivate, i.Sender, recordID, i.Content, i.Sender,
+	}
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to upsert inbox entries for record_private: %d", recordID)
+	}
+
+	return nil
+}
+
+// UpsertInboxEntriesForRecordGroup 将所有群成员的该群会话置顶，
+// 群会话的未读数由各频道的已读位置得出，这里不再累加
+func (p *postgres) UpsertInboxEntriesForRecordGroup(ses storage.Session, recordID int64, i *entity.RecordGroup) error {
+	sqlstr := rebind(`INSERT INTO "inbox_entry"
+                  (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at)
+                  SELECT user_subject, ?, '', group_id, ?, ?, ?, now()
+                  FROM "group_member"
+                  WHERE group_id = ?
+                  ON CONFLICT (owner, kind, peer, group_id) DO UPDATE
+                  SET last_record_id = EXCLUDED.last_record_id,
+                      last_content = EXCLUDED.last_content,
+                      last_sender = EXCLUDED.last_sender,
+                      last_at = EXCLUDED.last_at;`)
+	args := []any{
+		entity.RecordKindGroup, recordID, i.Content, i.Sender, i.GroupID,
+	}
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to upsert inbox entries for record_group: %d", recordID)
+	}
+
+	return nil
+}
+
+// upsertInboxEntriesForImportedPrivates 用会话中最新的一条消息更新双方的会话列表，
+// 导入的是历史消息，不增加未读数，也不覆盖更新的消息
+func (p *postgres) upsertInboxEntriesForImportedPrivates(ses storage.Session, conversationIDs []int64) error {
+	sqlstr := rebind(`INSERT INTO "inbox_entry"
+                  (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at)
+                  SELECT v.owner, ?, v.peer, 0, r.id, r.content, r.sender, r.created_at
+                  FROM (SELECT DISTINCT ON (conversation_id) id, content, sender, receiver, created_at
+                        FROM "record_private"
+                        WHERE conversation_id = ANY(?)
+                        ORDER BY conversation_id, created_at DESC, id DESC) AS r
+                           CROSS JOIN LATERAL (VALUES (r.sender, r.receiver), (r.receiver, r.sender)) AS v(owner, peer)
+                  ON CONFLICT (owner, kind, peer, group_id) DO UPDATE
+                  SET last_record_id = EXCLUDED.last_record_id,
+                      last_content = EXCLUDED.last_content,
+                      last_sender = EXCLUDED.last_sender,
+                      last_at = EXCLUDED.last_at
+                  WHERE EXCLUDED.last_at > "inbox_entry".last_at;`)
+
+	if _, err := ses.Exec(sqlstr, entity.RecordKindPrivate, pq.Array(conversationIDs)); err != nil {
+		return wrapPGErrorf(err, "failed to upsert inbox entries for imported record_private")
+	}
+
+	return nil
+}
+
+// upsertInboxEntriesForImportedGroups 用群内最新的一条消息更新所有群成员的会话列表，
+// 导入的是历史消息，不增加未读数，也不覆盖更新的消息
+func (p *postgres) upsertInboxEntriesForImportedGroups(ses storage.Session, groupIDs []int64) error {
+	sqlstr := rebind(`INSERT INTO "inbox_entry"
+                  (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at)
+                  SELECT gm.user_subject, ?, '', r.group_id, r.id, r.content, r.sender, r.created_at
+                  FROM "group_member" gm
+                           JOIN (SELECT DISTINCT ON (group_id) group_id, id, content, sender, created_at
+                                 FROM "record_group"
+                                 WHERE group_id = ANY(?)
+                                 ORDER BY group_id, created_at DESC, id DESC) AS r ON r.group_id = gm.group_id
+                  ON CONFLICT (owner, kind, peer, group_id) DO UPDATE
+                  SET last_record_id = EXCLUDED.last_record_id,
+                      last_content = EXCLUDED.last_content,
+                      last_sender = EXCLUDED.last_sender,
+                      last_at = EXCLUDED.last_at
+                  WHERE EXCLUDED.last_at > "inbox_entry".last_at;`)
+
+	if _, err := ses.Exec(sqlstr, entity.RecordKindGroup, pq.Array(groupIDs)); err != nil {
+		return wrapPGErrorf(err, "failed to upsert inbox entries for imported record_group")
+	}
+
+	return nil
+}
+
+// groupInboxUnread 群会话的未读数为owner在各频道未读数之和，与ListGroupChannelsByGroup一致
+const groupInboxUnread = `(SELECT COALESCE(SUM(GREATEST(c.last_seq - COALESCE(r.read_seq, 0), 0)), 0)
+                  FROM "group_channel" ch
+                  JOIN "conversation" c ON c.kind = 'group' AND c.party1 = '' AND c.party2 = '' AND c.group_id = ch.group_id AND c.channel_id = ch.id
+                  LEFT JOIN "group_channel_read" r ON r.channel_id = ch.id AND r.user_subject = "inbox_entry".owner
+                  WHERE ch.group_id = "inbox_entry".group_id)`
+
+func (p *postgres) listInboxEntries(ses storage.Session, where *entity.Where, cursor *entity.Cursor, limit int) ([]*entity.InboxEntry, error) {
+	projection := []string{
+		"id",
+		"owner",
+		"kind",
+		"peer",
+		"group_id",
+		"last_record_id",
+		"last_content",
+		"last_sender",
+		"last_at",
+		"CASE WHEN kind = 'group' THEN " + groupInboxUnread + " ELSE unread_count END",
+	}
+
+	var args []any
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "inbox_entry"`, strings.Join(projection, ", "))
+	if where != nil {
+		sel, selArgs, err := where.Parse()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, selArgs...)
+		sqlstr += sel
+	}
+	if cursor != nil {
+		sqlstr += ` AND (last_at, kind, id) < (?, ?, ?)`
+		args = append(args, cursor.CreatedAt, cursor.Kind, cursor.ID)
+	}
+	sqlstr += ` ORDER BY last_at DESC, kind DESC, id DESC`
+	if limit > 0 {
+		sqlstr += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	sqlstr = rebind(sqlstr)
+	rows, err := ses.Query(sqlstr, args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to list inbox entries")
+	}
+	defer rows.Close()
+
+	var res []*entity.InboxEntry
+	for rows.Next() {
+		r := entity.InboxEntry{}
+		if err = rows.Scan(&r.ID, &r.Owner, &r.Kind, &r.Peer, &r.GroupID, &r.LastRecordID, &r.LastContent, &r.LastSender, &r.LastAt, &r.UnreadCount); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan inbox entry")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) ListInboxEntriesByOwner(ses storage.Session, owner string, cursor *entity.Cursor, limit int) ([]*entity.InboxEntry, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"owner"},
+		FieldValues: []any{owner},
+	}
+
+	res, err := p.listInboxEntries(ses, w, cursor, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list inbox entries with owner: %s failed", owner)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) ListInboxEntriesByGroup(ses storage.Session, groupID int64) ([]*entity.InboxEntry, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"kind", "group_id"},
+		FieldValues: []any{entity.RecordKindGroup, groupID},
+	}
+
+	res, err := p.listInboxEntries(ses, w, nil, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list inbox entries with group_id: %d failed", groupID)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetInboxEntry(ses storage.Session, owner, kind, peer string, groupID int64) (*entity.InboxEntry, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"owner", "kind", "peer", "group_id"},
+		FieldValues: []any{owner, kind, peer, groupID},
+	}
+
+	res, err := p.listInboxEntries(ses, w, nil, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get inbox entry with owner: %s, kind: %s, peer: %s and group_id: %d failed", owner, kind, peer, groupID)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no inbox entry with owner: %s, kind: %s, peer: %s and group_id: %d found", owner, kind, peer, groupID)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) ResetInboxEntryUnreadCount(ses storage.Session, owner, kind, peer string, groupID int64) error {
+	sqlstr := rebind(`UPDATE "inbox_entry"
+                  SET unread_count = 0
+                  WHERE owner = ? AND kind = ? AND peer = ? AND group_id = ?;`)
+	_, err := ses.Exec(sqlstr, owner, kind, peer, groupID)
+	if err != nil {
+		return wrapPGErrorf(err, "reset unread_count of inbox entry with owner: %s, kind: %s, peer: %s and group_id: %d failed", owner, kind, peer, groupID)
+	}
+
+	return nil
+}
+
+func (p *postgres) DeleteInboxEntriesByGroup(ses storage.Session, groupID int64) error {
+	sqlstr := rebind(`DELETE FROM "inbox_entry" WHERE kind = ? AND group_id = ?;`)
+	_, err := ses.Exec(sqlstr, entity.RecordKindGroup, groupID)
+	if err != nil {
+		return wrapPGErrorf(err, "delete inbox entries with group_id: %d failed", groupID)
+	}
+
+	return nil
+}
+
+func (p *postgres) DeleteInboxEntry(ses storage.Session, owner, kind, peer string, groupID int64) error {
+	sqlstr := rebind(`DELETE FROM "inbox_entry" WHERE owner = ? AND kind = ? AND peer = ? AND group_id = ?;`)
+	_, err := ses.Exec(sqlstr, owner, kind, peer, groupID)
+	if err != nil {
+		return wrapPGErrorf(err, "delete inbox entry with owner: %s, kind: %s, peer: %s and group_id: %d failed", owner, kind, peer, groupID)
+	}
+
+	return nil
+}
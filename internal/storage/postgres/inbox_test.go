@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestBulkInsertRecordPrivatesUpsertsInbox() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	a, b := s.addUser(ses), s.addUser(ses)
+	now := time.Now().UTC()
+	s.Require().Nil(s.storage.BulkInsertRecordPrivates(ses, []*entity.RecordPrivate{
+		{Content: "first", Sender: a.Subject, Receiver: b.Subject, CreatedAt: now.Add(-2 * time.Hour)},
+		{Content: "last", Sender: b.Subject, Receiver: a.Subject, CreatedAt: now.Add(-time.Hour)},
+	}))
+
+	for _, owner := range []string{a.Subject, b.Subject} {
+		peer := b.Subject
+		if owner == b.Subject {
+			peer = a.Subject
+		}
+		e, err := s.storage.GetInboxEntry(ses, owner, entity.RecordKindPrivate, peer, 0)
+		s.Require().Nil(err)
+		s.Require().Equal("last", e.LastContent)
+		s.Require().Equal(0, e.UnreadCount)
+	}
+
+	// 导入更早的历史消息不覆盖会话列表中更新的消息
+	s.Require().Nil(s.storage.BulkInsertRecordPrivates(ses, []*entity.RecordPrivate{
+		{Content: "older", Sender: a.Subject, Receiver: b.Subject, CreatedAt: now.Add(-3 * time.Hour)},
+	}))
+	e, err := s.storage.GetInboxEntry(ses, a.Subject, entity.RecordKindPrivate, b.Subject, 0)
+	s.Require().Nil(err)
+	s.Require().Equal("last", e.LastContent)
+}
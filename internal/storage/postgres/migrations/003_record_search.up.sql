@@ -0,0 +1,16 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS record_private_content_tsv_idx ON "record_private" USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS record_group_content_tsv_idx ON "record_group" USING GIN (content_tsv);
+
+-- 中文等不以空格分词的文本使用trigram子串匹配
+CREATE INDEX IF NOT EXISTS record_private_content_trgm_idx ON "record_private" USING GIN (content gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS record_group_content_trgm_idx ON "record_group" USING GIN (content gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS record_private_created_at_idx ON "record_private" (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS record_group_created_at_idx ON "record_group" (created_at DESC, id DESC);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS "inbox_entry"
+(
+    id             serial       NOT NULL PRIMARY KEY,
+    owner          varchar(256) NOT NULL,
+    kind           varchar(32)  NOT NULL,
+    peer           varchar(256) NOT NULL DEFAULT '',
+    group_id       bigint       NOT NULL DEFAULT 0,
+    last_record_id bigint       NOT NULL,
+    last_content   varchar(256) NOT NULL,
+    last_sender    varchar(256) NOT NULL,
+    last_at        timestamp    NOT NULL DEFAULT now(),
+    unread_count   int          NOT NULL DEFAULT 0,
+    CONSTRAINT inbox_entry_uq UNIQUE (owner, kind, peer, group_id),
+    CONSTRAINT inbox_entry_owner_fk FOREIGN KEY (owner) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS inbox_entry_owner_last_at_idx ON "inbox_entry" (owner, last_at DESC, kind DESC, id DESC);
+CREATE INDEX IF NOT EXISTS inbox_entry_group_idx ON "inbox_entry" (group_id) WHERE group_id <> 0;
+
+-- 根据已有的聊天记录回填会话列表
+INSERT INTO "inbox_entry" (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at)
+SELECT DISTINCT ON (owner, peer) owner, 'private', peer, 0, id, content, sender, created_at
+FROM (SELECT sender AS owner, receiver AS peer, id, content, sender, created_at FROM "record_private"
+      UNION ALL
+      SELECT receiver AS owner, sender AS peer, id, content, sender, created_at FROM "record_private") AS r
+ORDER BY owner, peer, created_at DESC, id DESC
+ON CONFLICT DO NOTHING;
+
+INSERT INTO "inbox_entry" (owner, kind, peer, group_id, last_record_id, last_content, last_sender, last_at)
+SELECT gm.user_subject, 'group', '', r.group_id, r.id, r.content, r.sender, r.created_at
+FROM "group_member" gm
+         JOIN (SELECT DISTINCT ON (group_id) group_id, id, content, sender, created_at
+               FROM "record_group"
+               ORDER BY group_id, created_at DESC, id DESC) AS r ON r.group_id = gm.group_id
+ON CONFLICT DO NOTHING;
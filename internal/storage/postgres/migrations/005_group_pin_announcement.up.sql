@@ -0,0 +1,25 @@
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS announcement varchar(1024) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS "group_announcement_log"
+(
+    id         serial        NOT NULL PRIMARY KEY,
+    group_id   bigint        NOT NULL,
+    content    varchar(1024) NOT NULL,
+    edited_by  varchar(256)  NOT NULL,
+    created_at timestamp     NULL DEFAULT now(),
+    CONSTRAINT group_announcement_log_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_announcement_log_edited_by_fk FOREIGN KEY (edited_by) REFERENCES "user" (subject)
+);
+
+CREATE TABLE IF NOT EXISTS "group_pin"
+(
+    group_id   bigint       NOT NULL,
+    record_id  bigint       NOT NULL,
+    pinned_by  varchar(256) NOT NULL,
+    created_at timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_pin_uq UNIQUE (group_id, record_id),
+    CONSTRAINT group_pin_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_pin_record_fk FOREIGN KEY (record_id) REFERENCES "record_group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_pin_pinned_by_fk FOREIGN KEY (pinned_by) REFERENCES "user" (subject)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS "scheduled_message"
+(
+    id         serial       NOT NULL PRIMARY KEY,
+    sender     varchar(256) NOT NULL,
+    kind       varchar(32)  NOT NULL,
+    receiver   varchar(256) NOT NULL DEFAULT '',
+    group_id   bigint       NOT NULL DEFAULT 0,
+    content    varchar(256) NOT NULL,
+    send_at    timestamp    NOT NULL,
+    status     varchar(256) NOT NULL,
+    reason     varchar(256) NOT NULL DEFAULT '',
+    created_at timestamp    NULL DEFAULT now(),
+    CONSTRAINT scheduled_message_sender_fk FOREIGN KEY (sender) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_message_due_idx ON "scheduled_message" (send_at) WHERE status = '待发送';
+CREATE INDEX IF NOT EXISTS scheduled_message_sender_idx ON "scheduled_message" (sender);
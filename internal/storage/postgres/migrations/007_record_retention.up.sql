@@ -0,0 +1,24 @@
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS expires_at timestamp NULL;
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS expires_at timestamp NULL;
+ALTER TABLE "record_broadcast"
+    ADD COLUMN IF NOT EXISTS expires_at timestamp NULL;
+
+CREATE INDEX IF NOT EXISTS record_private_expires_at_idx ON "record_private" (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS record_group_expires_at_idx ON "record_group" (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS record_broadcast_expires_at_idx ON "record_broadcast" (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS record_private_unique_id_idx ON "record_private" (unique_id, created_at);
+CREATE INDEX IF NOT EXISTS record_group_group_id_idx ON "record_group" (group_id, created_at);
+
+-- 会话的保留策略，kind为private时conversation_key为私聊双方的unique_id，为group时为群id
+CREATE TABLE IF NOT EXISTS "retention_policy"
+(
+    kind             varchar(32)  NOT NULL,
+    conversation_key bigint       NOT NULL,
+    max_age_seconds  bigint       NOT NULL,
+    updated_by       varchar(256) NOT NULL,
+    updated_at       timestamp    NULL DEFAULT now(),
+    CONSTRAINT retention_policy_uq UNIQUE (kind, conversation_key),
+    CONSTRAINT retention_policy_updated_by_fk FOREIGN KEY (updated_by) REFERENCES "user" (subject)
+);
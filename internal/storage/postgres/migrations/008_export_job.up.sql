@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS "export_job"
+(
+    id          serial       NOT NULL PRIMARY KEY,
+    owner       varchar(256) NOT NULL,
+    kind        varchar(32)  NOT NULL,
+    peer        varchar(256) NOT NULL DEFAULT '',
+    group_id    bigint       NOT NULL DEFAULT 0,
+    format      varchar(32)  NOT NULL,
+    status      varchar(256) NOT NULL,
+    file_path   varchar(1024) NOT NULL DEFAULT '',
+    reason      varchar(256) NOT NULL DEFAULT '',
+    created_at  timestamp    NULL DEFAULT now(),
+    finished_at timestamp    NULL,
+    CONSTRAINT export_job_owner_fk FOREIGN KEY (owner) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS export_job_pending_idx ON "export_job" (id) WHERE status = '待导出';
+CREATE INDEX IF NOT EXISTS export_job_owner_idx ON "export_job" (owner);
@@ -0,0 +1,10 @@
+-- 导入时外部ID与本地ID的映射，保证重复导入不会重复创建
+CREATE TABLE IF NOT EXISTS "import_mapping"
+(
+    source     varchar(256) NOT NULL,
+    kind       varchar(32)  NOT NULL,
+    foreign_id varchar(256) NOT NULL,
+    local_id   varchar(256) NOT NULL DEFAULT '',
+    created_at timestamp    NULL DEFAULT now(),
+    CONSTRAINT import_mapping_uq UNIQUE (source, kind, foreign_id)
+);
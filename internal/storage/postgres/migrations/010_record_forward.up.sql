@@ -0,0 +1,4 @@
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS forward jsonb NULL;
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS forward jsonb NULL;
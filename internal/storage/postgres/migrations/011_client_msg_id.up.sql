@@ -0,0 +1,11 @@
+-- 客户端生成的消息ID，同一发送者唯一，用于重试时去重
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS client_msg_id varchar(64) NULL;
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS client_msg_id varchar(64) NULL;
+ALTER TABLE "record_broadcast"
+    ADD COLUMN IF NOT EXISTS client_msg_id varchar(64) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS record_private_client_msg_id_uq ON "record_private" (sender, client_msg_id) WHERE client_msg_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS record_group_client_msg_id_uq ON "record_group" (sender, client_msg_id) WHERE client_msg_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS record_broadcast_client_msg_id_uq ON "record_broadcast" (sender, client_msg_id) WHERE client_msg_id IS NOT NULL;
@@ -0,0 +1,84 @@
+-- 会话，kind为private时party1和party2为按字典序排列的私聊双方，为group时group_id为群id
+-- last_seq为会话内最后一条消息的序号，写入消息时在同一事务中递增
+CREATE TABLE IF NOT EXISTS "conversation"
+(
+    id         bigserial    NOT NULL primary key,
+    kind       varchar(32)  NOT NULL,
+    party1     varchar(256) NOT NULL DEFAULT '',
+    party2     varchar(256) NOT NULL DEFAULT '',
+    group_id   bigint       NOT NULL DEFAULT 0,
+    last_seq   bigint       NOT NULL DEFAULT 0,
+    created_at timestamp    NULL DEFAULT now(),
+    CONSTRAINT conversation_uq UNIQUE (kind, party1, party2, group_id)
+);
+
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS conversation_id bigint NULL,
+    ADD COLUMN IF NOT EXISTS seq             bigint NULL;
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS conversation_id bigint NULL,
+    ADD COLUMN IF NOT EXISTS seq             bigint NULL;
+
+-- 为已有的私聊双方和群创建会话，私聊双方按字节序排列，与代码中的字符串比较一致
+INSERT INTO "conversation" (kind, party1, party2)
+SELECT DISTINCT 'private', LEAST(sender COLLATE "C", receiver COLLATE "C"), GREATEST(sender COLLATE "C", receiver COLLATE "C")
+FROM "record_private"
+ON CONFLICT DO NOTHING;
+INSERT INTO "conversation" (kind, group_id)
+SELECT 'group', id
+FROM "group"
+ON CONFLICT DO NOTHING;
+
+-- 已有消息按id顺序编号
+UPDATE "record_private" r
+SET conversation_id = c.id,
+    seq             = s.seq
+FROM (SELECT id,
+             row_number() OVER (PARTITION BY LEAST(sender COLLATE "C", receiver COLLATE "C"), GREATEST(sender COLLATE "C", receiver COLLATE "C") ORDER BY id) AS seq
+      FROM "record_private") s,
+     "conversation" c
+WHERE s.id = r.id
+  AND c.kind = 'private'
+  AND c.party1 = LEAST(r.sender COLLATE "C", r.receiver COLLATE "C")
+  AND c.party2 = GREATEST(r.sender COLLATE "C", r.receiver COLLATE "C")
+  AND c.group_id = 0;
+
+UPDATE "record_group" r
+SET conversation_id = c.id,
+    seq             = s.seq
+FROM (SELECT id, row_number() OVER (PARTITION BY group_id ORDER BY id) AS seq
+      FROM "record_group") s,
+     "conversation" c
+WHERE s.id = r.id
+  AND c.kind = 'group'
+  AND c.group_id = r.group_id;
+
+UPDATE "conversation" c
+SET last_seq = m.last_seq
+FROM (SELECT conversation_id, max(seq) AS last_seq FROM "record_private" GROUP BY conversation_id
+      UNION ALL
+      SELECT conversation_id, max(seq) AS last_seq FROM "record_group" GROUP BY conversation_id) m
+WHERE m.conversation_id = c.id;
+
+-- 私聊的保留策略改为以会话id为键，没有消息的私聊无法还原出会话，其保留策略被删除
+UPDATE "retention_policy" rp
+SET conversation_key = r.conversation_id
+FROM (SELECT DISTINCT unique_id, conversation_id FROM "record_private") r
+WHERE rp.kind = 'private'
+  AND rp.conversation_key = r.unique_id;
+DELETE
+FROM "retention_policy"
+WHERE kind = 'private'
+  AND conversation_key NOT IN (SELECT id FROM "conversation" WHERE kind = 'private');
+
+ALTER TABLE "record_private"
+    ALTER COLUMN conversation_id SET NOT NULL,
+    ALTER COLUMN seq SET NOT NULL,
+    ADD CONSTRAINT record_private_conversation_fk FOREIGN KEY (conversation_id) REFERENCES "conversation" (id),
+    ADD CONSTRAINT record_private_seq_uq UNIQUE (conversation_id, seq),
+    DROP COLUMN IF EXISTS unique_id;
+ALTER TABLE "record_group"
+    ALTER COLUMN conversation_id SET NOT NULL,
+    ALTER COLUMN seq SET NOT NULL,
+    ADD CONSTRAINT record_group_conversation_fk FOREIGN KEY (conversation_id) REFERENCES "conversation" (id),
+    ADD CONSTRAINT record_group_seq_uq UNIQUE (conversation_id, seq);
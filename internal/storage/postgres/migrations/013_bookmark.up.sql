@@ -0,0 +1,14 @@
+-- 收藏的消息，只记录kind和record_id，列出时关联原消息，原消息被删除后显示为墓碑
+CREATE TABLE IF NOT EXISTS "bookmark"
+(
+    id         bigserial    NOT NULL PRIMARY KEY,
+    owner      varchar(256) NOT NULL,
+    kind       varchar(32)  NOT NULL,
+    record_id  bigint       NOT NULL,
+    note       varchar(256) NOT NULL DEFAULT '',
+    created_at timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT bookmark_uq UNIQUE (owner, kind, record_id),
+    CONSTRAINT bookmark_owner_fk FOREIGN KEY (owner) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS bookmark_owner_created_at_idx ON "bookmark" (owner, created_at DESC, kind DESC, id DESC);
@@ -0,0 +1,34 @@
+-- 群投票，投票消息是一条poll_id非空的群消息
+CREATE TABLE IF NOT EXISTS "poll"
+(
+    id           bigserial    NOT NULL PRIMARY KEY,
+    group_id     bigint       NOT NULL,
+    question     varchar(256) NOT NULL,
+    options      text[]       NOT NULL,
+    multi_choice bool         NOT NULL DEFAULT false,
+    anonymous    bool         NOT NULL DEFAULT false,
+    created_by   varchar(256) NOT NULL,
+    closes_at    timestamp    NULL,
+    closed_at    timestamp    NULL,
+    created_at   timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT poll_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id),
+    CONSTRAINT poll_created_by_fk FOREIGN KEY (created_by) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS poll_closes_at_idx ON "poll" (closes_at) WHERE closed_at IS NULL AND closes_at IS NOT NULL;
+
+-- 每个成员在每个选项上至多一票，单选投票由代码保证每个成员只有一行
+CREATE TABLE IF NOT EXISTS "poll_vote"
+(
+    poll_id    bigint       NOT NULL,
+    voter      varchar(256) NOT NULL,
+    option_idx int          NOT NULL,
+    created_at timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT poll_vote_uq UNIQUE (poll_id, voter, option_idx),
+    CONSTRAINT poll_vote_poll_fk FOREIGN KEY (poll_id) REFERENCES "poll" (id),
+    CONSTRAINT poll_vote_voter_fk FOREIGN KEY (voter) REFERENCES "user" (subject)
+);
+
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS poll_id bigint NULL,
+    ADD CONSTRAINT record_group_poll_fk FOREIGN KEY (poll_id) REFERENCES "poll" (id);
@@ -0,0 +1,12 @@
+-- 每个用户在每个私聊/群聊中至多一条未发送的草稿，键与inbox_entry一致
+CREATE TABLE IF NOT EXISTS "draft"
+(
+    owner      varchar(256) NOT NULL,
+    kind       varchar(32)  NOT NULL,
+    peer       varchar(256) NOT NULL DEFAULT '',
+    group_id   bigint       NOT NULL DEFAULT 0,
+    content    varchar(256) NOT NULL,
+    updated_at timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT draft_uq UNIQUE (owner, kind, peer, group_id),
+    CONSTRAINT draft_owner_fk FOREIGN KEY (owner) REFERENCES "user" (subject)
+);
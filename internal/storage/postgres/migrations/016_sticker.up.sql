@@ -0,0 +1,37 @@
+-- 表情包，group_id为空时是全局表情包，否则只能在该群中使用
+CREATE TABLE IF NOT EXISTS "sticker_pack"
+(
+    id         bigserial    NOT NULL PRIMARY KEY,
+    group_id   bigint       NULL,
+    name       varchar(64)  NOT NULL,
+    created_by varchar(256) NOT NULL,
+    created_at timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT sticker_pack_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id),
+    CONSTRAINT sticker_pack_created_by_fk FOREIGN KEY (created_by) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS sticker_pack_group_id_idx ON "sticker_pack" (group_id);
+
+-- 表情的文件存放在附件存储中，file_key是附件的key
+CREATE TABLE IF NOT EXISTS "sticker"
+(
+    id           bigserial    NOT NULL PRIMARY KEY,
+    pack_id      bigint       NOT NULL,
+    name         varchar(32)  NOT NULL,
+    content_type varchar(64)  NOT NULL,
+    size         bigint       NOT NULL,
+    file_key     varchar(256) NOT NULL,
+    created_at   timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT sticker_pack_fk FOREIGN KEY (pack_id) REFERENCES "sticker_pack" (id)
+);
+
+CREATE INDEX IF NOT EXISTS sticker_pack_id_idx ON "sticker" (pack_id);
+
+-- 表情消息是一条sticker_id非空的消息
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS sticker_id bigint NULL,
+    ADD CONSTRAINT record_group_sticker_fk FOREIGN KEY (sticker_id) REFERENCES "sticker" (id);
+
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS sticker_id bigint NULL,
+    ADD CONSTRAINT record_private_sticker_fk FOREIGN KEY (sticker_id) REFERENCES "sticker" (id);
@@ -0,0 +1,17 @@
+-- 端到端加密的公钥目录，每个设备一组身份公钥和签名预共享公钥，私钥只保存在客户端
+CREATE TABLE IF NOT EXISTS "device_key"
+(
+    subject                  varchar(256) NOT NULL,
+    device                   varchar(64)  NOT NULL,
+    identity_key             text         NOT NULL,
+    signed_prekey_id         bigint       NOT NULL,
+    signed_prekey            text         NOT NULL,
+    signed_prekey_signature  text         NOT NULL,
+    updated_at               timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT device_key_uq UNIQUE (subject, device),
+    CONSTRAINT device_key_subject_fk FOREIGN KEY (subject) REFERENCES "user" (subject)
+);
+
+-- 加密消息的密文，服务端不解析，content只保存占位内容，检索、会话摘要和导出都不会看到明文
+ALTER TABLE "record_private"
+    ADD COLUMN IF NOT EXISTS ciphertext text NULL;
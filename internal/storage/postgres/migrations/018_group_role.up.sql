@@ -0,0 +1,25 @@
+-- 群成员的角色取代is_admin，群创建者成为群主
+ALTER TABLE "group_member"
+    ADD COLUMN IF NOT EXISTS role varchar(32) NOT NULL DEFAULT 'member';
+
+UPDATE "group_member" SET role = 'admin' WHERE is_admin;
+
+UPDATE "group_member" m
+SET role = 'owner'
+FROM "group" g
+WHERE g.id = m.group_id
+  AND g.created_by = m.user_subject;
+
+ALTER TABLE "group_member"
+    DROP COLUMN IF EXISTS is_admin;
+
+-- 群的权限矩阵：自定义角色及对admin、member默认权限的修改，没有记录的内置角色使用默认权限
+CREATE TABLE IF NOT EXISTS "group_role"
+(
+    group_id    bigint      NOT NULL,
+    name        varchar(32) NOT NULL,
+    permissions text[]      NOT NULL,
+    updated_at  timestamp   NOT NULL DEFAULT now(),
+    CONSTRAINT group_role_pk PRIMARY KEY (group_id, name),
+    CONSTRAINT group_role_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE
+);
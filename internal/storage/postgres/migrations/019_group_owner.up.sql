@@ -0,0 +1,22 @@
+-- 群主可以转让，created_by保留群的创建者
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS owner varchar(256) NULL;
+
+UPDATE "group" SET owner = created_by WHERE owner IS NULL;
+
+ALTER TABLE "group"
+    ALTER COLUMN owner SET NOT NULL,
+    ADD CONSTRAINT group_owner_fk FOREIGN KEY (owner) REFERENCES "user" (subject);
+
+CREATE TABLE IF NOT EXISTS "group_owner_log"
+(
+    id           serial       NOT NULL PRIMARY KEY,
+    group_id     bigint       NOT NULL,
+    from_subject varchar(256) NOT NULL,
+    to_subject   varchar(256) NOT NULL,
+    reason       varchar(32)  NOT NULL,
+    created_at   timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_owner_log_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_owner_log_from_fk FOREIGN KEY (from_subject) REFERENCES "user" (subject),
+    CONSTRAINT group_owner_log_to_fk FOREIGN KEY (to_subject) REFERENCES "user" (subject)
+);
@@ -0,0 +1,29 @@
+-- 禁言到muted_until为止，NULL表示未被禁言
+ALTER TABLE "group_member"
+    ADD COLUMN IF NOT EXISTS muted_until timestamp NULL;
+
+CREATE INDEX IF NOT EXISTS group_member_muted_until_idx ON "group_member" (muted_until) WHERE muted_until IS NOT NULL;
+
+-- 全员禁言，群主和管理员不受限制
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS muted_all boolean NOT NULL DEFAULT false;
+
+-- 群的封禁名单，expires_at为NULL表示永久封禁
+CREATE TABLE IF NOT EXISTS "group_ban"
+(
+    group_id     bigint       NOT NULL,
+    user_subject varchar(256) NOT NULL,
+    banned_by    varchar(256) NOT NULL,
+    expires_at   timestamp    NULL,
+    created_at   timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_ban_pk PRIMARY KEY (group_id, user_subject),
+    CONSTRAINT group_ban_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_ban_user_fk FOREIGN KEY (user_subject) REFERENCES "user" (subject),
+    CONSTRAINT group_ban_banned_by_fk FOREIGN KEY (banned_by) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS group_ban_expires_at_idx ON "group_ban" (expires_at) WHERE expires_at IS NOT NULL;
+
+-- 系统消息，如禁言、封禁的通知
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS system boolean NOT NULL DEFAULT false;
@@ -0,0 +1,34 @@
+-- 可分享的入群邀请链接，max_uses为0表示不限次数，expires_at为NULL表示永不过期
+CREATE TABLE IF NOT EXISTS "group_invite_link"
+(
+    id                serial       NOT NULL PRIMARY KEY,
+    group_id          bigint       NOT NULL,
+    token             varchar(64)  NOT NULL,
+    created_by        varchar(256) NOT NULL,
+    expires_at        timestamp    NULL,
+    max_uses          integer      NOT NULL DEFAULT 0,
+    uses              integer      NOT NULL DEFAULT 0,
+    requires_approval boolean      NOT NULL DEFAULT false,
+    revoked_at        timestamp    NULL,
+    created_at        timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_invite_link_token_uq UNIQUE (token),
+    CONSTRAINT group_invite_link_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_invite_link_created_by_fk FOREIGN KEY (created_by) REFERENCES "user" (subject)
+);
+
+CREATE INDEX IF NOT EXISTS group_invite_link_group_idx ON "group_invite_link" (group_id);
+
+-- 每个用户对同一链接只能使用一次
+CREATE TABLE IF NOT EXISTS "group_invite_link_use"
+(
+    link_id      bigint       NOT NULL,
+    user_subject varchar(256) NOT NULL,
+    created_at   timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_invite_link_use_pk PRIMARY KEY (link_id, user_subject),
+    CONSTRAINT group_invite_link_use_link_fk FOREIGN KEY (link_id) REFERENCES "group_invite_link" (id) ON DELETE CASCADE,
+    CONSTRAINT group_invite_link_use_user_fk FOREIGN KEY (user_subject) REFERENCES "user" (subject)
+);
+
+-- 通过邀请链接产生的入群申请
+ALTER TABLE "group_request_log"
+    ADD COLUMN IF NOT EXISTS invite_link_id bigint NULL;
@@ -0,0 +1,4 @@
+-- 公开群目录按名称做前缀和子串匹配，只索引公开的群
+CREATE INDEX IF NOT EXISTS group_name_trgm_idx ON "group" USING GIN (name gin_trgm_ops) WHERE is_public;
+
+CREATE INDEX IF NOT EXISTS group_member_group_idx ON "group_member" (group_id);
@@ -0,0 +1,8 @@
+-- 入群方式：open直接入群，approval需要审批，invite_only只能被邀请，question需要回答问题后审批
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS join_policy   varchar(16) NOT NULL DEFAULT 'approval',
+    ADD COLUMN IF NOT EXISTS join_question text        NOT NULL DEFAULT '';
+
+-- 申请人对入群问题的回答，展示给审批的管理员
+ALTER TABLE "group_request_log"
+    ADD COLUMN IF NOT EXISTS answer text NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- 群资料：简介、头像（附件存储中的key）和标签
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS description text         NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar      varchar(128) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tags        text[]       NOT NULL DEFAULT '{}';
+
+-- 成员在群内的昵称，为空时使用用户自己的昵称
+ALTER TABLE "group_member"
+    ADD COLUMN IF NOT EXISTS nickname varchar(64) NOT NULL DEFAULT '';
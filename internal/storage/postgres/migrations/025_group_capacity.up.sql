@@ -0,0 +1,3 @@
+-- 群容量档位，对应的成员上限由配置GROUP_CAPACITY_TIERS决定
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS capacity_tier integer NOT NULL DEFAULT 0;
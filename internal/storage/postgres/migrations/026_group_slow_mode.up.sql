@@ -0,0 +1,7 @@
+-- 慢速模式：成员每slow_mode秒只能发一条消息，0表示关闭，群主和管理员不受限制
+ALTER TABLE "group"
+    ADD COLUMN IF NOT EXISTS slow_mode integer NOT NULL DEFAULT 0;
+
+-- 成员最近一次受慢速模式限制的发言时间，保存在数据库中以便多个实例共享
+ALTER TABLE "group_member"
+    ADD COLUMN IF NOT EXISTS last_posted_at timestamp NULL;
@@ -0,0 +1,62 @@
+-- 群内的频道（话题），所有群成员共享，每个群有且只有一个默认频道，不指定频道的消息发送到默认频道
+CREATE TABLE IF NOT EXISTS "group_channel"
+(
+    id         bigserial    NOT NULL PRIMARY KEY,
+    group_id   bigint       NOT NULL,
+    name       varchar(64)  NOT NULL,
+    topic      varchar(256) NOT NULL DEFAULT '',
+    admin_only boolean      NOT NULL DEFAULT false,
+    is_default boolean      NOT NULL DEFAULT false,
+    created_by varchar(256) NOT NULL,
+    created_at timestamp    NULL DEFAULT now(),
+    CONSTRAINT group_channel_name_uq UNIQUE (group_id, name),
+    CONSTRAINT group_channel_group_fk FOREIGN KEY (group_id) REFERENCES "group" (id) ON DELETE CASCADE,
+    CONSTRAINT group_channel_created_by_fk FOREIGN KEY (created_by) REFERENCES "user" (subject)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_channel_default_uq ON "group_channel" (group_id) WHERE is_default;
+
+INSERT INTO "group_channel" (group_id, name, is_default, created_by)
+SELECT id, 'general', true, owner
+FROM "group"
+ON CONFLICT DO NOTHING;
+
+-- 每个频道对应一个会话，已有的群会话归入默认频道
+ALTER TABLE "conversation"
+    ADD COLUMN IF NOT EXISTS channel_id bigint NOT NULL DEFAULT 0,
+    DROP CONSTRAINT IF EXISTS conversation_uq,
+    ADD CONSTRAINT conversation_uq UNIQUE (kind, party1, party2, group_id, channel_id);
+
+UPDATE "conversation" c
+SET channel_id = ch.id
+FROM "group_channel" ch
+WHERE c.kind = 'group'
+  AND ch.group_id = c.group_id
+  AND ch.is_default;
+
+ALTER TABLE "record_group"
+    ADD COLUMN IF NOT EXISTS channel_id bigint NULL;
+
+UPDATE "record_group" r
+SET channel_id = ch.id
+FROM "group_channel" ch
+WHERE ch.group_id = r.group_id
+  AND ch.is_default;
+
+ALTER TABLE "record_group"
+    ALTER COLUMN channel_id SET NOT NULL,
+    ADD CONSTRAINT record_group_channel_fk FOREIGN KEY (channel_id) REFERENCES "group_channel" (id);
+
+CREATE INDEX IF NOT EXISTS record_group_channel_idx ON "record_group" (channel_id, id);
+
+-- 成员在频道内的已读位置，为频道会话内已读的最后一条消息的序号
+CREATE TABLE IF NOT EXISTS "group_channel_read"
+(
+    channel_id   bigint       NOT NULL,
+    user_subject varchar(256) NOT NULL,
+    read_seq     bigint       NOT NULL DEFAULT 0,
+    updated_at   timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT group_channel_read_pk PRIMARY KEY (channel_id, user_subject),
+    CONSTRAINT group_channel_read_channel_fk FOREIGN KEY (channel_id) REFERENCES "group_channel" (id) ON DELETE CASCADE,
+    CONSTRAINT group_channel_read_user_fk FOREIGN KEY (user_subject) REFERENCES "user" (subject)
+);
@@ -0,0 +1,2 @@
+-- 按保留策略清理私聊消息时逐个会话按创建时间查询
+CREATE INDEX IF NOT EXISTS record_private_conversation_created_at_idx ON "record_private" (conversation_id, created_at);
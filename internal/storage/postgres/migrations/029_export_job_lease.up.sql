@@ -0,0 +1,18 @@
+-- 导出任务的租约：started_at为最近一次心跳时间，超时未更新的导出中任务可以被其他实例重新领取
+-- attempt每次领取时加一，只有持有当前attempt的实例才能写入文件和完成任务
+ALTER TABLE "export_job"
+    ADD COLUMN IF NOT EXISTS started_at timestamp NULL,
+    ADD COLUMN IF NOT EXISTS attempt    integer   NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS export_job_running_idx ON "export_job" (started_at) WHERE status = '导出中';
+
+-- 导出文件按顺序分块保存在数据库中，所有实例都可以下载
+CREATE TABLE IF NOT EXISTS "export_job_chunk"
+(
+    job_id  integer NOT NULL,
+    attempt integer NOT NULL,
+    seq     integer NOT NULL,
+    data    bytea   NOT NULL,
+    CONSTRAINT export_job_chunk_pk PRIMARY KEY (job_id, attempt, seq),
+    CONSTRAINT export_job_chunk_job_fk FOREIGN KEY (job_id) REFERENCES "export_job" (id) ON DELETE CASCADE
+);
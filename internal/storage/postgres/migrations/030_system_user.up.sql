@@ -0,0 +1,4 @@
+-- 群系统消息的发送者，不对应真实用户，密码随机生成，无法登录
+INSERT INTO "user" (subject, nickname, username, password, phone)
+VALUES ('system', '[系统]', '__system__', md5(random()::text), '')
+ON CONFLICT (subject) DO NOTHING;
@@ -0,0 +1,9 @@
+-- 入群申请引用的邀请链接，链接删除后只保留申请记录
+UPDATE "group_request_log" r
+SET invite_link_id = NULL
+WHERE invite_link_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM "group_invite_link" l WHERE l.id = r.invite_link_id);
+
+ALTER TABLE "group_request_log"
+    DROP CONSTRAINT IF EXISTS group_request_log_invite_link_fk,
+    ADD CONSTRAINT group_request_log_invite_link_fk FOREIGN KEY (invite_link_id) REFERENCES "group_invite_link" (id) ON DELETE SET NULL;
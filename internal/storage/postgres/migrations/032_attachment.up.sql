@@ -0,0 +1,8 @@
+-- 群头像、表情等附件保存在数据库中，所有实例共享
+CREATE TABLE IF NOT EXISTS "attachment"
+(
+    key        varchar(128) NOT NULL,
+    data       bytea        NOT NULL,
+    created_at timestamp    NOT NULL DEFAULT now(),
+    CONSTRAINT attachment_pk PRIMARY KEY (key)
+);
@@ -0,0 +1,19 @@
+-- 定时发送的群消息所在的频道，为0时发送到默认频道
+ALTER TABLE "scheduled_message"
+    ADD COLUMN IF NOT EXISTS channel_id bigint NOT NULL DEFAULT 0;
+
+-- 群会话的未读数改为由各频道的已读位置得出，按原有的未读数补齐已读位置，
+-- 旧的未读数都在默认频道，其余频道视为已读
+INSERT INTO "group_channel_read" (channel_id, user_subject, read_seq)
+SELECT ch.id,
+       gm.user_subject,
+       CASE WHEN ch.is_default THEN GREATEST(c.last_seq - COALESCE(ie.unread_count, 0), 0) ELSE c.last_seq END
+FROM "group_member" gm
+         JOIN "group_channel" ch ON ch.group_id = gm.group_id
+         JOIN "conversation" c ON c.kind = 'group' AND c.party1 = '' AND c.party2 = '' AND c.group_id = ch.group_id AND c.channel_id = ch.id
+         LEFT JOIN "inbox_entry" ie ON ie.owner = gm.user_subject AND ie.kind = 'group' AND ie.peer = '' AND ie.group_id = gm.group_id
+ON CONFLICT (channel_id, user_subject) DO NOTHING;
+
+UPDATE "inbox_entry"
+SET unread_count = 0
+WHERE kind = 'group';
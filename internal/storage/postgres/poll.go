@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+func (p *postgres) InsertPoll(ses storage.Session, i *entity.Poll) error {
+	sqlstr := rebind(`INSERT INTO "poll"
+                  (group_id, question, options, multi_choice, anonymous, created_by, closes_at)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?, ?)
+                  RETURNING id, created_at;`)
+	args := []any{
+		i.GroupID,
+		i.Question,
+		pq.Array(i.Options),
+		i.MultiChoice,
+		i.Anonymous,
+		i.CreatedBy,
+		i.ClosesAt,
+	}
+
+	if err := ses.QueryRow(sqlstr, args...).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert poll")
+	}
+
+	return nil
+}
+
+var pollProjection = []string{
+	"id",
+	"group_id",
+	"question",
+	"options",
+	"multi_choice",
+	"anonymous",
+	"created_by",
+	"closes_at",
+	"closed_at",
+	"created_at",
+}
+
+func scanPolls(rows *sql.Rows) ([]*entity.Poll, error) {
+	var res []*entity.Poll
+	for rows.Next() {
+		r := entity.Poll{}
+		if err := rows.Scan(&r.ID, &r.GroupID, &r.Question, pq.Array(&r.Options), &r.MultiChoice, &r.Anonymous, &r.CreatedBy, &r.ClosesAt, &r.ClosedAt, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan poll")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) getPoll(ses storage.Session, id int64, forUpdate bool) (*entity.Poll, error) {
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "poll" WHERE id = ?`, strings.Join(pollProjection, ", "))
+	if forUpdate {
+		sqlstr += ` FOR UPDATE`
+	}
+
+	rows, err := ses.Query(rebind(sqlstr), id)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get poll with id: %d failed", id)
+	}
+	defer rows.Close()
+
+	res, err := scanPolls(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no poll with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetPoll(ses storage.Session, id int64) (*entity.Poll, error) {
+	return p.getPoll(ses, id, false)
+}
+
+// GetPollForUpdate 锁定投票直到事务结束，投票与截止互斥
+func (p *postgres) GetPollForUpdate(ses storage.Session, id int64) (*entity.Poll, error) {
+	return p.getPoll(ses, id, true)
+}
+
+// ReplacePollVotes 用options替换voter在该投票中之前的选择
+func (p *postgres) ReplacePollVotes(ses storage.Session, pollID int64, voter string, options []int) error {
+	sqlstr := rebind(`DELETE FROM "poll_vote" WHERE poll_id = ? AND voter = ?;`)
+	if _, err := ses.Exec(sqlstr, pollID, voter); err != nil {
+		return wrapPGErrorf(err, "delete votes of poll: %d with voter: %s failed", pollID, voter)
+	}
+	if len(options) == 0 {
+		return nil
+	}
+
+	idx := make([]int64, 0, len(options))
+	for _, o := range options {
+		idx = append(idx, int64(o))
+	}
+	sqlstr = rebind(`INSERT INTO "poll_vote"
+                  (poll_id, voter, option_idx)
+                  SELECT ?, ?, unnest(?::int[]);`)
+	if _, err := ses.Exec(sqlstr, pollID, voter, pq.Array(idx)); err != nil {
+		return wrapPGErrorf(err, "insert votes of poll: %d with voter: %s failed", pollID, voter)
+	}
+
+	return nil
+}
+
+func (p *postgres) ListPollVotes(ses storage.Session, pollID int64) ([]*entity.PollVote, error) {
+	sqlstr := rebind(`SELECT poll_id, voter, option_idx, created_at
+                  FROM "poll_vote"
+                  WHERE poll_id = ?
+                  ORDER BY created_at, voter, option_idx;`)
+
+	rows, err := ses.Query(sqlstr, pollID)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list votes of poll: %d failed", pollID)
+	}
+	defer rows.Close()
+
+	var res []*entity.PollVote
+	for rows.Next() {
+		r := entity.PollVote{}
+		if err = rows.Scan(&r.PollID, &r.Voter, &r.Option, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan poll vote")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+// CloseDuePolls 截止一批已到截止时间的投票并返回它们
+func (p *postgres) CloseDuePolls(ses storage.Session, now time.Time, limit int) ([]*entity.Poll, error) {
+	sqlstr := rebind(fmt.Sprintf(`UPDATE "poll"
+                  SET closed_at = ?
+                  WHERE id IN (
+                      SELECT id
+                      FROM "poll"
+                      WHERE closed_at IS NULL AND closes_at <= ?
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING %s;`, strings.Join(pollProjection, ", ")))
+
+	rows, err := ses.Query(sqlstr, now, now, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "close due polls failed")
+	}
+	defer rows.Close()
+
+	return scanPolls(rows)
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestPollVotes() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	owner, voter := s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "poll", Type: entity.DefaultGroupType, CreatedBy: owner.Subject})
+	s.Require().Nil(err)
+
+	closesAt := time.Now().UTC().Add(-time.Minute)
+	poll := &entity.Poll{
+		GroupID:     groupID,
+		Question:    "lunch?",
+		Options:     []string{"rice", "noodles", "bread"},
+		MultiChoice: true,
+		CreatedBy:   owner.Subject,
+		ClosesAt:    &closesAt,
+	}
+	s.Require().Nil(s.storage.InsertPoll(ses, poll))
+
+	got, err := s.storage.GetPoll(ses, poll.ID)
+	s.Require().Nil(err)
+	s.Require().Equal(poll.Options, got.Options)
+
+	s.Require().Nil(s.storage.ReplacePollVotes(ses, poll.ID, voter.Subject, []int{0, 2}))
+	// 再次投票替换之前的选择
+	s.Require().Nil(s.storage.ReplacePollVotes(ses, poll.ID, voter.Subject, []int{1}))
+	votes, err := s.storage.ListPollVotes(ses, poll.ID)
+	s.Require().Nil(err)
+	s.Require().Len(votes, 1)
+	s.Require().Equal(1, votes[0].Option)
+
+	closed, err := s.storage.CloseDuePolls(ses, time.Now().UTC(), 100)
+	s.Require().Nil(err)
+	var ids []int64
+	for _, p := range closed {
+		ids = append(ids, p.ID)
+	}
+	s.Require().Contains(ids, poll.ID)
+
+	got, err = s.storage.GetPoll(ses, poll.ID)
+	s.Require().Nil(err)
+	s.Require().NotNil(got.ClosedAt)
+}
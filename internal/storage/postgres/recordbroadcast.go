@@ -3,25 +3,29 @@ package postgres
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/storage"
 )
 
 func (p *postgres) InsertRecordBroadcast(ses storage.Session, i *entity.RecordBroadcast) (int64, error) {
 	sqlstr := rebind(`INSERT INTO "record_broadcast" 
-                  (content, sender)
+                  (content, sender, client_msg_id, expires_at)
                   VALUES
-                  (?, ?)
-                  RETURNING id;`)
+                  (?, ?, NULLIF(?, ''), ?)
+                  RETURNING id, created_at;`)
 	args := []any{
 		i.Content,
 		i.Sender,
+		i.ClientMsgID,
+		i.ExpiresAt,
 	}
 
 	var id int64
 	var err error
-	err = ses.QueryRow(sqlstr, args...).Scan(&id)
+	err = ses.QueryRow(sqlstr, args...).Scan(&id, &i.CreatedAt)
 	if err != nil {
 		return 0, wrapPGErrorf(err, "failed to insert record_broadcast")
 	}
@@ -34,6 +38,8 @@ func (p *postgres) listRecordBroadcasts(ses storage.Session, where *entity.Where
 		"id",
 		"content",
 		"sender",
+		"COALESCE(client_msg_id, '')",
+		"expires_at",
 		"created_at",
 	}
 
@@ -45,8 +51,13 @@ func (p *postgres) listRecordBroadcasts(ses storage.Session, where *entity.Where
 			return nil, err
 		}
 		args = append(args, selArgs...)
-		sqlstr += sel
+		sqlstr += sel + " AND "
+	} else {
+		sqlstr += " WHERE "
 	}
+	// 过期但还未被清理的消息不可见
+	sqlstr += "(expires_at IS NULL OR expires_at > ?)"
+	args = append(args, time.Now().UTC())
 
 	sqlstr = rebind(sqlstr)
 	rows, err := ses.Query(sqlstr, args...)
@@ -58,7 +69,7 @@ func (p *postgres) listRecordBroadcasts(ses storage.Session, where *entity.Where
 	var res []*entity.RecordBroadcast
 	for rows.Next() {
 		r := entity.RecordBroadcast{}
-		if err = rows.Scan(&r.ID, &r.Content, &r.Sender, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.ID, &r.Content, &r.Sender, &r.ClientMsgID, &r.ExpiresAt, &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan record_broadcast")
 		}
 		res = append(res, &r)
@@ -89,3 +100,37 @@ func (p *postgres) ListRecordBroadcastsBySender(ses storage.Session, sender stri
 
 	return res, nil
 }
+
+func (p *postgres) GetRecordBroadcastByID(ses storage.Session, id int64) (*entity.RecordBroadcast, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listRecordBroadcasts(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_broadcast with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_broadcast with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetRecordBroadcastByClientMsgID(ses storage.Session, sender, clientMsgID string) (*entity.RecordBroadcast, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"sender", "client_msg_id"},
+		FieldValues: []any{sender, clientMsgID},
+	}
+
+	res, err := p.listRecordBroadcasts(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_broadcast with sender: %s and client_msg_id: %s failed", sender, clientMsgID)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_broadcast with sender: %s and client_msg_id: %s found", sender, clientMsgID)
+	}
+
+	return res[0], nil
+}
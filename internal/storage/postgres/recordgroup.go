@@ -3,39 +3,124 @@ package postgres
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/storage"
 )
 
+// InsertRecordGroup 写入群聊消息并分配频道会话内的序号，ChannelID为0时写入默认频道，须在事务中调用
 func (p *postgres) InsertRecordGroup(ses storage.Session, i *entity.RecordGroup) (int64, error) {
+	if i.ChannelID == 0 {
+		ch, err := p.GetDefaultGroupChannel(ses, i.GroupID)
+		if err != nil {
+			return 0, err
+		}
+		i.ChannelID = ch.ID
+	}
+	conversationID, seq, err := p.reserveConversationSeqs(ses, entity.RecordKindGroup, "", "", i.GroupID, i.ChannelID, 1)
+	if err != nil {
+		return 0, err
+	}
+
 	sqlstr := rebind(`INSERT INTO "record_group" 
-                  (group_id, content, sender)
+                  (group_id, channel_id, conversation_id, seq, content, sender, client_msg_id, forward, poll_id, sticker_id, expires_at, system)
                   VALUES
-                  (?, ?, ?)
-                  RETURNING id;`)
+                  (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?::bigint, 0), NULLIF(?::bigint, 0), ?, ?)
+                  RETURNING id, created_at;`)
 	args := []any{
 		i.GroupID,
+		i.ChannelID,
+		conversationID,
+		seq,
 		i.Content,
 		i.Sender,
+		i.ClientMsgID,
+		i.Forward,
+		i.PollID,
+		i.StickerID,
+		i.ExpiresAt,
+		i.System,
 	}
 
 	var id int64
-	var err error
-	err = ses.QueryRow(sqlstr, args...).Scan(&id)
+	err = ses.QueryRow(sqlstr, args...).Scan(&id, &i.CreatedAt)
 	if err != nil {
 		return 0, wrapPGErrorf(err, "failed to insert record_group")
 	}
+	i.ID, i.ConversationID, i.Seq = id, conversationID, seq
 
 	return id, nil
 }
 
-func (p *postgres) listRecordGroups(ses storage.Session, where *entity.Where) ([]*entity.RecordGroup, error) {
+// BulkInsertRecordGroups 批量插入群聊记录并保留原始的发送时间，用于导入，记录写入各群的默认频道，须在事务中调用，
+// 同一事务内更新群成员的会话列表
+func (p *postgres) BulkInsertRecordGroups(ses storage.Session, rs []*entity.RecordGroup) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	// 为每个群一次性预留序号，同一群内按rs的顺序编号
+	counts := make(map[int64]int)
+	var groupIDs []int64
+	for _, r := range rs {
+		if counts[r.GroupID] == 0 {
+			groupIDs = append(groupIDs, r.GroupID)
+		}
+		counts[r.GroupID]++
+	}
+	type reserved struct{ channelID, conversationID, nextSeq int64 }
+	seqs := make(map[int64]*reserved, len(groupIDs))
+	for _, groupID := range groupIDs {
+		ch, err := p.GetDefaultGroupChannel(ses, groupID)
+		if err != nil {
+			return err
+		}
+		id, lastSeq, err := p.reserveConversationSeqs(ses, entity.RecordKindGroup, "", "", groupID, ch.ID, counts[groupID])
+		if err != nil {
+			return err
+		}
+		seqs[groupID] = &reserved{channelID: ch.ID, conversationID: id, nextSeq: lastSeq - int64(counts[groupID]) + 1}
+	}
+
+	values := make([]string, 0, len(rs))
+	args := make([]any, 0, len(rs)*7)
+	for _, r := range rs {
+		rsv := seqs[r.GroupID]
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, r.GroupID, rsv.channelID, rsv.conversationID, rsv.nextSeq, r.Content, r.Sender, r.CreatedAt)
+		r.ChannelID = rsv.channelID
+		rsv.nextSeq++
+	}
+	sqlstr := rebind(fmt.Sprintf(`INSERT INTO "record_group"
+                  (group_id, channel_id, conversation_id, seq, content, sender, created_at)
+                  VALUES
+                  %s;`, strings.Join(values, ", ")))
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to bulk insert record_group")
+	}
+
+	return p.upsertInboxEntriesForImportedGroups(ses, groupIDs)
+}
+
+// listRecordGroups after和limit用于按column（id或seq）顺序分页，limit为0时不分页
+func (p *postgres) listRecordGroups(ses storage.Session, where *entity.Where, column string, after int64, limit int) ([]*entity.RecordGroup, error) {
 	projection := []string{
 		"id",
 		"group_id",
 		"content",
 		"sender",
+		"channel_id",
+		"conversation_id",
+		"seq",
+		"COALESCE(client_msg_id, '')",
+		"forward",
+		"COALESCE(poll_id, 0)",
+		"COALESCE(sticker_id, 0)",
+		"expires_at",
+		"system",
 		"created_at",
 	}
 
@@ -47,7 +132,16 @@ func (p *postgres) listRecordGroups(ses storage.Session, where *entity.Where) ([
 			return nil, err
 		}
 		args = append(args, selArgs...)
-		sqlstr += sel
+		sqlstr += sel + " AND "
+	} else {
+		sqlstr += " WHERE "
+	}
+	// 过期但还未被清理的消息不可见
+	sqlstr += "(expires_at IS NULL OR expires_at > ?)"
+	args = append(args, time.Now().UTC())
+	if limit > 0 {
+		sqlstr += fmt.Sprintf(" AND %s > ? ORDER BY %s LIMIT ?", column, column)
+		args = append(args, after, limit)
 	}
 
 	sqlstr = rebind(sqlstr)
@@ -60,7 +154,7 @@ func (p *postgres) listRecordGroups(ses storage.Session, where *entity.Where) ([
 	var res []*entity.RecordGroup
 	for rows.Next() {
 		r := entity.RecordGroup{}
-		if err = rows.Scan(&r.ID, &r.GroupID, &r.Content, &r.Sender, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.ID, &r.GroupID, &r.Content, &r.Sender, &r.ChannelID, &r.ConversationID, &r.Seq, &r.ClientMsgID, &r.Forward, &r.PollID, &r.StickerID, &r.ExpiresAt, &r.System, &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan record_group")
 		}
 		res = append(res, &r)
@@ -75,10 +169,92 @@ func (p *postgres) ListRecordGroupsByGroup(ses storage.Session, groupID int64) (
 		FieldValues: []any{groupID},
 	}
 
-	res, err := p.listRecordGroups(ses, w)
+	res, err := p.listRecordGroups(ses, w, "", 0, 0)
 	if err != nil {
 		return nil, wrapPGErrorf(err, "list record groups with group: %d failed", groupID)
 	}
 
 	return res, nil
 }
+
+func (p *postgres) ListRecordGroupsByChannel(ses storage.Session, channelID int64) ([]*entity.RecordGroup, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"channel_id"},
+		FieldValues: []any{channelID},
+	}
+
+	res, err := p.listRecordGroups(ses, w, "", 0, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list record groups with channel: %d failed", channelID)
+	}
+
+	return res, nil
+}
+
+// ListRecordGroupsByGroupAfter 按id顺序返回id大于afterID的至多limit条群聊记录
+func (p *postgres) ListRecordGroupsByGroupAfter(ses storage.Session, groupID, afterID int64, limit int) ([]*entity.RecordGroup, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"group_id"},
+		FieldValues: []any{groupID},
+	}
+
+	res, err := p.listRecordGroups(ses, w, "id", afterID, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list record groups with group: %d after id: %d failed", groupID, afterID)
+	}
+
+	return res, nil
+}
+
+// ListRecordGroupsBySeq 按序号顺序返回会话中序号在[fromSeq, toSeq]内的群聊记录，已被清理的消息不返回
+func (p *postgres) ListRecordGroupsBySeq(ses storage.Session, conversationID, fromSeq, toSeq int64) ([]*entity.RecordGroup, error) {
+	if toSeq < fromSeq {
+		return nil, nil
+	}
+
+	w := &entity.Where{
+		FieldNames:  []string{"conversation_id"},
+		FieldValues: []any{conversationID},
+	}
+
+	res, err := p.listRecordGroups(ses, w, "seq", fromSeq-1, int(toSeq-fromSeq+1))
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list record_group with conversation_id: %d and seq: [%d, %d] failed", conversationID, fromSeq, toSeq)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetRecordGroupByID(ses storage.Session, id int64) (*entity.RecordGroup, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listRecordGroups(ses, w, "", 0, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_group with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_group with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetRecordGroupByClientMsgID(ses storage.Session, sender, clientMsgID string) (*entity.RecordGroup, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"sender", "client_msg_id"},
+		FieldValues: []any{sender, clientMsgID},
+	}
+
+	res, err := p.listRecordGroups(ses, w, "", 0, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_group with sender: %s and client_msg_id: %s failed", sender, clientMsgID)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_group with sender: %s and client_msg_id: %s found", sender, clientMsgID)
+	}
+
+	return res[0], nil
+}
@@ -2,42 +2,115 @@ package postgres
 
 import (
 	"fmt"
-	"sort"
 	"strings"
+	"time"
 
 	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/storage"
 )
 
+// InsertRecordPrivate 写入私聊消息并分配会话内的序号，须在事务中调用
 func (p *postgres) InsertRecordPrivate(ses storage.Session, i *entity.RecordPrivate) (int64, error) {
+	conversationID, seq, err := p.reserveConversationSeqs(ses, entity.RecordKindPrivate, party1(i.Sender, i.Receiver), party2(i.Sender, i.Receiver), 0, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+
 	sqlstr := rebind(`INSERT INTO "record_private" 
-                  (unique_id, content, sender, receiver)
+                  (conversation_id, seq, content, sender, receiver, client_msg_id, forward, sticker_id, ciphertext, expires_at)
                   VALUES
-                  (?, ?, ?, ?)
-                  RETURNING id;`)
+                  (?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?::bigint, 0), NULLIF(?, ''), ?)
+                  RETURNING id, created_at;`)
 	args := []any{
-		uniqueID(i.Sender, i.Receiver),
+		conversationID,
+		seq,
 		i.Content,
 		i.Sender,
 		i.Receiver,
+		i.ClientMsgID,
+		i.Forward,
+		i.StickerID,
+		i.Ciphertext,
+		i.ExpiresAt,
 	}
 
 	var id int64
-	var err error
-	err = ses.QueryRow(sqlstr, args...).Scan(&id)
+	err = ses.QueryRow(sqlstr, args...).Scan(&id, &i.CreatedAt)
 	if err != nil {
 		return 0, wrapPGErrorf(err, "failed to insert record_private")
 	}
+	i.ID, i.ConversationID, i.Seq = id, conversationID, seq
 
 	return id, nil
 }
 
-func (p *postgres) listRecordPrivates(ses storage.Session, where *entity.Where) ([]*entity.RecordPrivate, error) {
+// BulkInsertRecordPrivates 批量插入私聊记录并保留原始的发送时间，用于导入，须在事务中调用，
+// 同一事务内更新双方的会话列表
+func (p *postgres) BulkInsertRecordPrivates(ses storage.Session, rs []*entity.RecordPrivate) error {
+	if len(rs) == 0 {
+		return nil
+	}
+
+	// 按私聊双方为每个会话一次性预留序号，同一会话内按rs的顺序编号
+	type key struct{ party1, party2 string }
+	counts := make(map[key]int)
+	var keys []key
+	for _, r := range rs {
+		k := key{party1(r.Sender, r.Receiver), party2(r.Sender, r.Receiver)}
+		if counts[k] == 0 {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	type reserved struct{ conversationID, nextSeq int64 }
+	seqs := make(map[key]*reserved, len(keys))
+	for _, k := range keys {
+		id, lastSeq, err := p.reserveConversationSeqs(ses, entity.RecordKindPrivate, k.party1, k.party2, 0, 0, counts[k])
+		if err != nil {
+			return err
+		}
+		seqs[k] = &reserved{conversationID: id, nextSeq: lastSeq - int64(counts[k]) + 1}
+	}
+
+	values := make([]string, 0, len(rs))
+	args := make([]any, 0, len(rs)*6)
+	for _, r := range rs {
+		rsv := seqs[key{party1(r.Sender, r.Receiver), party2(r.Sender, r.Receiver)}]
+		values = append(values, "(?, ?, ?, ?, ?, ?)")
+		args = append(args, rsv.conversationID, rsv.nextSeq, r.Content, r.Sender, r.Receiver, r.CreatedAt)
+		rsv.nextSeq++
+	}
+	sqlstr := rebind(fmt.Sprintf(`INSERT INTO "record_private"
+                  (conversation_id, seq, content, sender, receiver, created_at)
+                  VALUES
+                  %s;`, strings.Join(values, ", ")))
+
+	if _, err := ses.Exec(sqlstr, args...); err != nil {
+		return wrapPGErrorf(err, "failed to bulk insert record_private")
+	}
+
+	conversationIDs := make([]int64, 0, len(seqs))
+	for _, rsv := range seqs {
+		conversationIDs = append(conversationIDs, rsv.conversationID)
+	}
+	return p.upsertInboxEntriesForImportedPrivates(ses, conversationIDs)
+}
+
+// listRecordPrivates after和limit用于按column（id或seq）顺序分页，limit为0时不分页
+func (p *postgres) listRecordPrivates(ses storage.Session, where *entity.Where, column string, after int64, limit int) ([]*entity.RecordPrivate, error) {
 	projection := []string{
 		"id",
 		"content",
 		"sender",
 		"receiver",
+		"conversation_id",
+		"seq",
+		"COALESCE(client_msg_id, '')",
+		"forward",
+		"COALESCE(sticker_id, 0)",
+		"COALESCE(ciphertext, '')",
+		"expires_at",
 		"created_at",
 	}
 
@@ -49,7 +122,16 @@ func (p *postgres) listRecordPrivates(ses storage.Session, where *entity.Where)
 			return nil, err
 		}
 		args = append(args, selArgs...)
-		sqlstr += sel
+		sqlstr += sel + " AND "
+	} else {
+		sqlstr += " WHERE "
+	}
+	// 过期但还未被清理的消息不可见
+	sqlstr += "(expires_at IS NULL OR expires_at > ?)"
+	args = append(args, time.Now().UTC())
+	if limit > 0 {
+		sqlstr += fmt.Sprintf(" AND %s > ? ORDER BY %s LIMIT ?", column, column)
+		args = append(args, after, limit)
 	}
 
 	sqlstr = rebind(sqlstr)
@@ -62,7 +144,7 @@ func (p *postgres) listRecordPrivates(ses storage.Session, where *entity.Where)
 	var res []*entity.RecordPrivate
 	for rows.Next() {
 		r := entity.RecordPrivate{}
-		if err = rows.Scan(&r.ID, &r.Content, &r.Sender, &r.Receiver, &r.CreatedAt); err != nil {
+		if err = rows.Scan(&r.ID, &r.Content, &r.Sender, &r.Receiver, &r.ConversationID, &r.Seq, &r.ClientMsgID, &r.Forward, &r.StickerID, &r.Ciphertext, &r.ExpiresAt, &r.CreatedAt); err != nil {
 			return nil, wrapPGErrorf(err, "failed to scan record_private")
 		}
 		res = append(res, &r)
@@ -72,12 +154,20 @@ func (p *postgres) listRecordPrivates(ses storage.Session, where *entity.Where)
 }
 
 func (p *postgres) ListRecordPrivatesByParty(ses storage.Session, subject1, subject2 string) ([]*entity.RecordPrivate, error) {
+	c, err := p.GetPrivateConversation(ses, subject1, subject2)
+	if errors.Code(err) == errors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	w := &entity.Where{
-		FieldNames:  []string{"unique_id"},
-		FieldValues: []any{uniqueID(subject1, subject2)},
+		FieldNames:  []string{"conversation_id"},
+		FieldValues: []any{c.ID},
 	}
 
-	res, err := p.listRecordPrivates(ses, w)
+	res, err := p.listRecordPrivates(ses, w, "", 0, 0)
 	if err != nil {
 		return nil, wrapPGErrorf(err, "list record_private with party: %s, %s failed", subject1, subject2)
 	}
@@ -85,10 +175,78 @@ func (p *postgres) ListRecordPrivatesByParty(ses storage.Session, subject1, subj
 	return res, nil
 }
 
-// 无论subject1和subject2交换与否，保证它们的unique_id一致
-func uniqueID(subject1, subject2 string) int64 {
-	strs := []string{subject1, subject2}
-	sort.Strings(strs)
-	uniqueIDStr := strings.Join(strs, "-")
-	return hashCode(uniqueIDStr)
+func (p *postgres) GetRecordPrivateByID(ses storage.Session, id int64) (*entity.RecordPrivate, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listRecordPrivates(ses, w, "", 0, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_private with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_private with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) GetRecordPrivateByClientMsgID(ses storage.Session, sender, clientMsgID string) (*entity.RecordPrivate, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"sender", "client_msg_id"},
+		FieldValues: []any{sender, clientMsgID},
+	}
+
+	res, err := p.listRecordPrivates(ses, w, "", 0, 0)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get record_private with sender: %s and client_msg_id: %s failed", sender, clientMsgID)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no record_private with sender: %s and client_msg_id: %s found", sender, clientMsgID)
+	}
+
+	return res[0], nil
+}
+
+// ListRecordPrivatesByPartyAfter 按id顺序返回id大于afterID的至多limit条私聊记录
+func (p *postgres) ListRecordPrivatesByPartyAfter(ses storage.Session, subject1, subject2 string, afterID int64, limit int) ([]*entity.RecordPrivate, error) {
+	c, err := p.GetPrivateConversation(ses, subject1, subject2)
+	if errors.Code(err) == errors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w := &entity.Where{
+		FieldNames:  []string{"conversation_id"},
+		FieldValues: []any{c.ID},
+	}
+
+	res, err := p.listRecordPrivates(ses, w, "id", afterID, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list record_private with party: %s, %s after id: %d failed", subject1, subject2, afterID)
+	}
+
+	return res, nil
+}
+
+// ListRecordPrivatesBySeq 按序号顺序返回会话中序号在[fromSeq, toSeq]内的私聊记录，已被清理的消息不返回
+func (p *postgres) ListRecordPrivatesBySeq(ses storage.Session, conversationID, fromSeq, toSeq int64) ([]*entity.RecordPrivate, error) {
+	if toSeq < fromSeq {
+		return nil, nil
+	}
+
+	w := &entity.Where{
+		FieldNames:  []string{"conversation_id"},
+		FieldValues: []any{conversationID},
+	}
+
+	res, err := p.listRecordPrivates(ses, w, "seq", fromSeq-1, int(toSeq-fromSeq+1))
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list record_private with conversation_id: %d and seq: [%d, %d] failed", conversationID, fromSeq, toSeq)
+	}
+
+	return res, nil
 }
@@ -1,11 +1,153 @@
 package postgres
 
-func (s *postgresSuite) TestUniqueID() {
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+func (s *postgresSuite) TestParty() {
 	strA, strB := "foo", "bar"
-	id1 := uniqueID(strA, strB)
+	s.Require().Equal("bar", party1(strA, strB))
+	s.Require().Equal("foo", party2(strA, strB))
 
 	strA, strB = strB, strA
-	id2 := uniqueID(strA, strB)
+	s.Require().Equal("bar", party1(strA, strB))
+	s.Require().Equal("foo", party2(strA, strB))
+}
+
+func (s *postgresSuite) TestListRecordPrivatesByPartyAfter() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	sender, receiver := s.addUser(ses), s.addUser(ses)
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		id, err := s.storage.InsertRecordPrivate(ses, &entity.RecordPrivate{
+			Content:  "hello",
+			Sender:   sender.Subject,
+			Receiver: receiver.Subject,
+		})
+		s.Require().Nil(err)
+		ids = append(ids, id)
+	}
+
+	var got []int64
+	var afterID int64
+	for {
+		page, err := s.storage.ListRecordPrivatesByPartyAfter(ses, receiver.Subject, sender.Subject, afterID, 2)
+		s.Require().Nil(err)
+		for _, r := range page {
+			got = append(got, r.ID)
+			afterID = r.ID
+		}
+		if len(page) < 2 {
+			break
+		}
+	}
+	s.Require().Equal(ids, got)
+}
+
+func (s *postgresSuite) TestGetRecordPrivateByClientMsgID() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	sender, receiver := s.addUser(ses), s.addUser(ses)
+	i := &entity.RecordPrivate{
+		Content:     "hello",
+		Sender:      sender.Subject,
+		Receiver:    receiver.Subject,
+		ClientMsgID: "c-1",
+	}
+	id, err := s.storage.InsertRecordPrivate(ses, i)
+	s.Require().Nil(err)
+	s.Require().False(i.CreatedAt.IsZero())
+
+	// 不带客户端消息ID的消息不受唯一约束
+	for j := 0; j < 2; j++ {
+		_, err = s.storage.InsertRecordPrivate(ses, &entity.RecordPrivate{Content: "hello", Sender: sender.Subject, Receiver: receiver.Subject})
+		s.Require().Nil(err)
+	}
+
+	got, err := s.storage.GetRecordPrivateByClientMsgID(ses, sender.Subject, "c-1")
+	s.Require().Nil(err)
+	s.Require().Equal(id, got.ID)
+	s.Require().Equal("c-1", got.ClientMsgID)
+
+	_, err = s.storage.GetRecordPrivateByClientMsgID(ses, receiver.Subject, "c-1")
+	s.Require().Equal(errors.NotFound, errors.Code(err))
+
+	sp, err := ses.Begin()
+	s.Require().Nil(err)
+	_, err = s.storage.InsertRecordPrivate(sp, &entity.RecordPrivate{Content: "again", Sender: sender.Subject, Receiver: receiver.Subject, ClientMsgID: "c-1"})
+	s.Require().Equal(errors.AlreadyExists, errors.Code(err))
+	s.Require().Nil(sp.Rollback())
+}
+
+func (s *postgresSuite) TestListRecordPrivatesBySeq() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	sender, receiver := s.addUser(ses), s.addUser(ses)
+	var rs []*entity.RecordPrivate
+	for i := 0; i < 5; i++ {
+		r := &entity.RecordPrivate{Content: "hello", Sender: sender.Subject, Receiver: receiver.Subject}
+		if i%2 == 1 {
+			r.Sender, r.Receiver = r.Receiver, r.Sender
+		}
+		_, err = s.storage.InsertRecordPrivate(ses, r)
+		s.Require().Nil(err)
+		s.Require().Equal(int64(i+1), r.Seq)
+		rs = append(rs, r)
+	}
+	s.Require().Equal(rs[0].ConversationID, rs[4].ConversationID)
+
+	c, err := s.storage.GetPrivateConversation(ses, receiver.Subject, sender.Subject)
+	s.Require().Nil(err)
+	s.Require().Equal(rs[0].ConversationID, c.ID)
+	s.Require().Equal(int64(5), c.LastSeq)
+
+	got, err := s.storage.ListRecordPrivatesBySeq(ses, c.ID, 2, 4)
+	s.Require().Nil(err)
+	s.Require().Len(got, 3)
+	for i, r := range got {
+		s.Require().Equal(rs[i+1].ID, r.ID)
+		s.Require().Equal(int64(i+2), r.Seq)
+	}
+}
+
+func (s *postgresSuite) TestSearchRecordsSkipsEncrypted() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	sender, receiver := s.addUser(ses), s.addUser(ses)
+	plain := &entity.RecordPrivate{Content: "加密消息 plain", Sender: sender.Subject, Receiver: receiver.Subject}
+	_, err = s.storage.InsertRecordPrivate(ses, plain)
+	s.Require().Nil(err)
+	encrypted := &entity.RecordPrivate{Content: entity.EncryptedContent, Ciphertext: "c2VjcmV0", Sender: sender.Subject, Receiver: receiver.Subject}
+	_, err = s.storage.InsertRecordPrivate(ses, encrypted)
+	s.Require().Nil(err)
+
+	got, err := s.storage.GetRecordPrivateByID(ses, encrypted.ID)
+	s.Require().Nil(err)
+	s.Require().True(got.Encrypted())
+	s.Require().Equal("c2VjcmV0", got.Ciphertext)
 
-	s.Require().Equal(id1, id2)
+	res, err := s.storage.SearchRecords(ses, sender.Subject, &entity.RecordSearchFilter{Query: "加密消息", Trigram: true, Peer: receiver.Subject, Limit: 10})
+	s.Require().Nil(err)
+	s.Require().Len(res, 1)
+	s.Require().Equal(plain.ID, res[0].ID)
 }
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+// SearchRecords 在subject参与的私聊和所在的群聊中全文检索聊天记录
+func (p *postgres) SearchRecords(ses storage.Session, subject string, filter *entity.RecordSearchFilter) ([]*entity.RecordSearchResult, error) {
+	var branches []string
+	var args []any
+
+	if filter.GroupID == 0 {
+		// 加密消息只有密文，不参与检索
+		conds := []string{"(sender = ? OR receiver = ?)", "ciphertext IS NULL"}
+		brArgs := []any{subject, subject}
+		if filter.Peer != "" {
+			conds = append(conds, `conversation_id = (SELECT id FROM "conversation" WHERE kind = ? AND party1 = ? AND party2 = ? AND group_id = 0)`)
+			brArgs = append(brArgs, entity.RecordKindPrivate, party1(subject, filter.Peer), party2(subject, filter.Peer))
+		}
+		match, snippet, matchArgs, snippetArgs := searchMatch(filter)
+		conds = append(conds, match)
+		c, cArgs := searchCommonConds(filter)
+		conds = append(conds, c...)
+
+		branches = append(branches, fmt.Sprintf(`SELECT '%s' AS kind, id, 0 AS group_id, sender, receiver, content, %s AS snippet, created_at
+                  FROM "record_private"
+                  WHERE %s`, entity.RecordKindPrivate, snippet, strings.Join(conds, " AND ")))
+		args = append(args, snippetArgs...)
+		args = append(args, brArgs...)
+		args = append(args, matchArgs...)
+		args = append(args, cArgs...)
+	}
+
+	if filter.Peer == "" {
+		conds := []string{`group_id IN (SELECT group_id FROM "group_member" WHERE user_subject = ?)`}
+		brArgs := []any{subject}
+		if filter.GroupID != 0 {
+			conds = append(conds, "group_id = ?")
+			brArgs = append(brArgs, filter.GroupID)
+		}
+		match, snippet, matchArgs, snippetArgs := searchMatch(filter)
+		conds = append(conds, match)
+		c, cArgs := searchCommonConds(filter)
+		conds = append(conds, c...)
+
+		branches = append(branches, fmt.Sprintf(`SELECT '%s' AS kind, id, group_id, sender, '' AS receiver, content, %s AS snippet, created_at
+                  FROM "record_group"
+                  WHERE %s`, entity.RecordKindGroup, snippet, strings.Join(conds, " AND ")))
+		args = append(args, snippetArgs...)
+		args = append(args, brArgs...)
+		args = append(args, matchArgs...)
+		args = append(args, cArgs...)
+	}
+
+	sqlstr := fmt.Sprintf(`SELECT kind, id, group_id, sender, receiver, content, snippet, created_at
+                  FROM (%s) AS r`, strings.Join(branches, " UNION ALL "))
+	if filter.Cursor != nil {
+		sqlstr += ` WHERE (created_at, kind, id) < (?, ?, ?)`
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.Kind, filter.Cursor.ID)
+	}
+	sqlstr += ` ORDER BY created_at DESC, kind DESC, id DESC LIMIT ?;`
+	args = append(args, filter.Limit)
+
+	rows, err := ses.Query(rebind(sqlstr), args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to search records")
+	}
+	defer rows.Close()
+
+	var res []*entity.RecordSearchResult
+	for rows.Next() {
+		r := entity.RecordSearchResult{}
+		if err = rows.Scan(&r.Kind, &r.ID, &r.GroupID, &r.Sender, &r.Receiver, &r.Content, &r.Snippet, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan record search result")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+// searchMatch 返回匹配条件和高亮片段的表达式，trigram模式下片段由上层处理
+func searchMatch(filter *entity.RecordSearchFilter) (match, snippet string, matchArgs, snippetArgs []any) {
+	if filter.Trigram {
+		return "content ILIKE ?", "content", []any{"%" + escapeLike(filter.Query) + "%"}, nil
+	}
+
+	// 关键词用控制字符标记，由上层转义内容后再替换为<b></b>；内容中原有的标记字符先去掉，避免伪造高亮
+	return "content_tsv @@ plainto_tsquery('simple', ?)",
+		"ts_headline('simple', translate(content, ?, ''), plainto_tsquery('simple', ?), ?)",
+		[]any{filter.Query},
+		[]any{entity.SnippetStartSel + entity.SnippetStopSel, filter.Query, headlineOptions}
+}
+
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=2`, entity.SnippetStartSel, entity.SnippetStopSel)
+
+func searchCommonConds(filter *entity.RecordSearchFilter) ([]string, []any) {
+	conds := []string{"(expires_at IS NULL OR expires_at > ?)"}
+	args := []any{time.Now().UTC()}
+	if filter.Sender != "" {
+		conds = append(conds, "sender = ?")
+		args = append(args, filter.Sender)
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, filter.To)
+	}
+
+	return conds, args
+}
@@ -0,0 +1,274 @@
+package postgres
+
+import (
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+func (p *postgres) upsertRetentionPolicy(ses storage.Session, kind string, key int64, maxAge time.Duration, updatedBy string) error {
+	sqlstr := rebind(`INSERT INTO "retention_policy"
+                  (kind, conversation_key, max_age_seconds, updated_by)
+                  VALUES
+                  (?, ?, ?, ?)
+                  ON CONFLICT (kind, conversation_key) DO UPDATE
+                  SET max_age_seconds = EXCLUDED.max_age_seconds,
+                      updated_by = EXCLUDED.updated_by,
+                      updated_at = now();`)
+
+	_, err := ses.Exec(sqlstr, kind, key, int64(maxAge/time.Second), updatedBy)
+	if err != nil {
+		return wrapPGErrorf(err, "failed to upsert retention policy")
+	}
+
+	return nil
+}
+
+func (p *postgres) getRetentionPolicy(ses storage.Session, kind string, key int64) (*entity.RetentionPolicy, error) {
+	sqlstr := rebind(`SELECT kind, max_age_seconds, updated_by, updated_at
+                  FROM "retention_policy"
+                  WHERE kind = ? AND conversation_key = ?;`)
+
+	var res entity.RetentionPolicy
+	var seconds int64
+	err := ses.QueryRow(sqlstr, kind, key).Scan(&res.Kind, &seconds, &res.UpdatedBy, &res.UpdatedAt)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get retention policy with kind: %s and key: %d failed", kind, key)
+	}
+	res.MaxAge = time.Duration(seconds) * time.Second
+
+	return &res, nil
+}
+
+func (p *postgres) deleteRetentionPolicy(ses storage.Session, kind string, key int64) error {
+	sqlstr := rebind(`DELETE FROM "retention_policy" WHERE kind = ? AND conversation_key = ?;`)
+	if _, err := ses.Exec(sqlstr, kind, key); err != nil {
+		return wrapPGErrorf(err, "delete retention policy with kind: %s and key: %d failed", kind, key)
+	}
+
+	return nil
+}
+
+// UpsertPrivateRetentionPolicy 私聊的保留策略以会话id为键，还没有消息的私聊会先创建会话
+func (p *postgres) UpsertPrivateRetentionPolicy(ses storage.Session, subject1, subject2 string, maxAge time.Duration, updatedBy string) error {
+	conversationID, err := p.ensurePrivateConversation(ses, subject1, subject2)
+	if err != nil {
+		return err
+	}
+	return p.upsertRetentionPolicy(ses, entity.RecordKindPrivate, conversationID, maxAge, updatedBy)
+}
+
+func (p *postgres) GetPrivateRetentionPolicy(ses storage.Session, subject1, subject2 string) (*entity.RetentionPolicy, error) {
+	c, err := p.GetPrivateConversation(ses, subject1, subject2)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.getRetentionPolicy(ses, entity.RecordKindPrivate, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.Peer = subject2
+
+	return res, nil
+}
+
+func (p *postgres) DeletePrivateRetentionPolicy(ses storage.Session, subject1, subject2 string) error {
+	c, err := p.GetPrivateConversation(ses, subject1, subject2)
+	if errors.Code(err) == errors.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return p.deleteRetentionPolicy(ses, entity.RecordKindPrivate, c.ID)
+}
+
+func (p *postgres) UpsertGroupRetentionPolicy(ses storage.Session, groupID int64, maxAge time.Duration, updatedBy string) error {
+	return p.upsertRetentionPolicy(ses, entity.RecordKindGroup, groupID, maxAge, updatedBy)
+}
+
+func (p *postgres) GetGroupRetentionPolicy(ses storage.Session, groupID int64) (*entity.RetentionPolicy, error) {
+	res, err := p.getRetentionPolicy(ses, entity.RecordKindGroup, groupID)
+	if err != nil {
+		return nil, err
+	}
+	res.GroupID = groupID
+
+	return res, nil
+}
+
+func (p *postgres) DeleteGroupRetentionPolicy(ses storage.Session, groupID int64) error {
+	return p.deleteRetentionPolicy(ses, entity.RecordKindGroup, groupID)
+}
+
+// retentionRule 会话的保留时长，key为私聊的会话id或群id
+type retentionRule struct {
+	key    int64
+	maxAge int64 // 秒
+}
+
+func (p *postgres) listRetentionRules(ses storage.Session, kind string) ([]retentionRule, error) {
+	sqlstr := rebind(`SELECT conversation_key, max_age_seconds FROM "retention_policy" WHERE kind = ?;`)
+
+	rows, err := ses.Query(sqlstr, kind)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list retention policies with kind: %s failed", kind)
+	}
+	defer rows.Close()
+
+	var res []retentionRule
+	for rows.Next() {
+		var r retentionRule
+		if err = rows.Scan(&r.key, &r.maxAge); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan retention policy")
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// purgeExpired 先按expires_at清理TTL到期的消息，再逐个保留策略按(key, created_at)清理超期的消息，
+// 两类条件分开查询才能各自用上索引，总数不超过limit
+func (p *postgres) purgeExpired(ses storage.Session, kind string, now time.Time, limit int,
+	purge func(cond string, args []any, limit int) ([]*entity.ExpiredRecord, error)) ([]*entity.ExpiredRecord, error) {
+	res, err := purge("expires_at <= ?", []any{now}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := p.listRetentionRules(ses, kind)
+	if err != nil {
+		return nil, err
+	}
+	keyColumn := "conversation_id"
+	if kind == entity.RecordKindGroup {
+		keyColumn = "group_id"
+	}
+	for _, rule := range rules {
+		if len(res) >= limit {
+			break
+		}
+		batch, err := purge(keyColumn+" = ? AND created_at < now() - ? * interval '1 second'", []any{rule.key, rule.maxAge}, limit-len(res))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, batch...)
+	}
+
+	return res, nil
+}
+
+// PurgeExpiredRecordPrivates 删除一批TTL到期或超过保留策略的私聊消息
+func (p *postgres) PurgeExpiredRecordPrivates(ses storage.Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error) {
+	return p.purgeExpired(ses, entity.RecordKindPrivate, now, limit, func(cond string, args []any, limit int) ([]*entity.ExpiredRecord, error) {
+		sqlstr := rebind(`DELETE FROM "record_private"
+                  WHERE id IN (
+                      SELECT id
+                      FROM "record_private"
+                      WHERE ` + cond + `
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING id, sender, receiver;`)
+
+		rows, err := ses.Query(sqlstr, append(args, limit)...)
+		if err != nil {
+			return nil, wrapPGErrorf(err, "purge expired record_private failed")
+		}
+		defer rows.Close()
+
+		var res []*entity.ExpiredRecord
+		for rows.Next() {
+			r := entity.ExpiredRecord{Kind: entity.RecordKindPrivate}
+			if err = rows.Scan(&r.ID, &r.Sender, &r.Receiver); err != nil {
+				return nil, wrapPGErrorf(err, "failed to scan expired record_private")
+			}
+			res = append(res, &r)
+		}
+
+		return res, nil
+	})
+}
+
+// PurgeExpiredRecordGroups 删除一批TTL到期或超过保留策略的群聊消息
+func (p *postgres) PurgeExpiredRecordGroups(ses storage.Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error) {
+	return p.purgeExpired(ses, entity.RecordKindGroup, now, limit, func(cond string, args []any, limit int) ([]*entity.ExpiredRecord, error) {
+		sqlstr := rebind(`DELETE FROM "record_group"
+                  WHERE id IN (
+                      SELECT id
+                      FROM "record_group"
+                      WHERE ` + cond + `
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING id, group_id, sender;`)
+
+		rows, err := ses.Query(sqlstr, append(args, limit)...)
+		if err != nil {
+			return nil, wrapPGErrorf(err, "purge expired record_group failed")
+		}
+		defer rows.Close()
+
+		var res []*entity.ExpiredRecord
+		for rows.Next() {
+			r := entity.ExpiredRecord{Kind: entity.RecordKindGroup}
+			if err = rows.Scan(&r.ID, &r.GroupID, &r.Sender); err != nil {
+				return nil, wrapPGErrorf(err, "failed to scan expired record_group")
+			}
+			res = append(res, &r)
+		}
+
+		return res, nil
+	})
+}
+
+// PurgeExpiredRecordBroadcasts 删除一批TTL到期的广播消息
+func (p *postgres) PurgeExpiredRecordBroadcasts(ses storage.Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error) {
+	sqlstr := rebind(`DELETE FROM "record_broadcast"
+                  WHERE id IN (
+                      SELECT id
+                      FROM "record_broadcast"
+                      WHERE expires_at <= ?
+                      LIMIT ?
+                      FOR UPDATE SKIP LOCKED
+                  )
+                  RETURNING id, sender;`)
+
+	rows, err := ses.Query(sqlstr, now, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "purge expired record_broadcast failed")
+	}
+	defer rows.Close()
+
+	var res []*entity.ExpiredRecord
+	for rows.Next() {
+		r := entity.ExpiredRecord{Kind: entity.RecordKindBroadcast}
+		if err = rows.Scan(&r.ID, &r.Sender); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan expired record_broadcast")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+// ClearInboxEntriesPreview 清空最后一条消息已被删除的会话预览
+func (p *postgres) ClearInboxEntriesPreview(ses storage.Session, kind string, recordIDs []int64) error {
+	if len(recordIDs) == 0 {
+		return nil
+	}
+
+	sqlstr := rebind(`UPDATE "inbox_entry"
+                  SET last_content = ''
+                  WHERE kind = ? AND last_record_id = ANY(?);`)
+	if _, err := ses.Exec(sqlstr, kind, pq.Array(recordIDs)); err != nil {
+		return wrapPGErrorf(err, "clear inbox entries preview with kind: %s failed", kind)
+	}
+
+	return nil
+}
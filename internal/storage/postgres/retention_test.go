@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestPurgeExpiredRecordPrivates() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	a, b, c := s.addUser(ses), s.addUser(ses), s.addUser(ses)
+	past := time.Now().UTC().Add(-time.Minute)
+	ttlID, err := s.storage.InsertRecordPrivate(ses, &entity.RecordPrivate{Content: "ttl", Sender: a.Subject, Receiver: b.Subject, ExpiresAt: &past})
+	s.Require().Nil(err)
+	oldID, err := s.storage.InsertRecordPrivate(ses, &entity.RecordPrivate{Content: "old", Sender: a.Subject, Receiver: c.Subject})
+	s.Require().Nil(err)
+	freshID, err := s.storage.InsertRecordPrivate(ses, &entity.RecordPrivate{Content: "fresh", Sender: a.Subject, Receiver: c.Subject})
+	s.Require().Nil(err)
+
+	_, err = ses.Exec(rebind(`UPDATE "record_private" SET created_at = created_at - interval '2 days' WHERE id = ?;`), oldID)
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.UpsertPrivateRetentionPolicy(ses, a.Subject, c.Subject, 24*time.Hour, a.Subject))
+
+	res, err := s.storage.PurgeExpiredRecordPrivates(ses, time.Now().UTC(), 1000)
+	s.Require().Nil(err)
+	purged := make(map[int64]bool, len(res))
+	for _, r := range res {
+		purged[r.ID] = true
+	}
+	s.Require().True(purged[ttlID])
+	s.Require().True(purged[oldID])
+	s.Require().False(purged[freshID])
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+)
+
+func (p *postgres) InsertScheduledMessage(ses storage.Session, i *entity.ScheduledMessage) (int64, error) {
+	sqlstr := rebind(`INSERT INTO "scheduled_message"
+                  (sender, kind, receiver, group_id, channel_id, content, send_at, status)
+                  VALUES
+                  (?, ?, ?, ?, ?, ?, ?, ?)
+                  RETURNING id;`)
+	args := []any{
+		i.Sender,
+		i.Kind,
+		i.Receiver,
+		i.GroupID,
+		i.ChannelID,
+		i.Content,
+		i.SendAt,
+		i.Status,
+	}
+
+	var id int64
+	if err := ses.QueryRow(sqlstr, args...).Scan(&id); err != nil {
+		return 0, wrapPGErrorf(err, "failed to insert scheduled message")
+	}
+
+	return id, nil
+}
+
+var scheduledMessageProjection = []string{
+	"id",
+	"sender",
+	"kind",
+	"receiver",
+	"group_id",
+	"channel_id",
+	"content",
+	"send_at",
+	"status",
+	"reason",
+	"created_at",
+}
+
+func (p *postgres) listScheduledMessages(ses storage.Session, where *entity.Where) ([]*entity.ScheduledMessage, error) {
+	var args []any
+	sqlstr := fmt.Sprintf(`SELECT %s FROM "scheduled_message"`, strings.Join(scheduledMessageProjection, ", "))
+	if where != nil {
+		sel, selArgs, err := where.Parse()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, selArgs...)
+		sqlstr += sel
+	}
+	sqlstr += ` ORDER BY send_at`
+
+	sqlstr = rebind(sqlstr)
+	rows, err := ses.Query(sqlstr, args...)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "failed to list scheduled messages")
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+func scanScheduledMessages(rows *sql.Rows) ([]*entity.ScheduledMessage, error) {
+	var res []*entity.ScheduledMessage
+	for rows.Next() {
+		r := entity.ScheduledMessage{}
+		if err := rows.Scan(&r.ID, &r.Sender, &r.Kind, &r.Receiver, &r.GroupID, &r.ChannelID, &r.Content, &r.SendAt, &r.Status, &r.Reason, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan scheduled message")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetScheduledMessage(ses storage.Session, id int64) (*entity.ScheduledMessage, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"id"},
+		FieldValues: []any{id},
+	}
+
+	res, err := p.listScheduledMessages(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get scheduled message with id: %d failed", id)
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no scheduled message with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+func (p *postgres) ListScheduledMessagesBySender(ses storage.Session, sender string, status entity.ScheduleStatus) ([]*entity.ScheduledMessage, error) {
+	w := &entity.Where{
+		FieldNames:  []string{"sender", "status"},
+		FieldValues: []any{sender, status},
+	}
+
+	res, err := p.listScheduledMessages(ses, w)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list scheduled messages with sender: %s failed", sender)
+	}
+
+	return res, nil
+}
+
+// ListDueScheduledMessagesForUpdate 锁定到期且待发送的消息，SKIP LOCKED保证多个实例不会重复发送同一条
+func (p *postgres) ListDueScheduledMessagesForUpdate(ses storage.Session, now time.Time, limit int) ([]*entity.ScheduledMessage, error) {
+	sqlstr := rebind(fmt.Sprintf(`SELECT %s
+                  FROM "scheduled_message"
+                  WHERE status = ?
+                  AND send_at <= ?
+                  ORDER BY send_at
+                  LIMIT ?
+                  FOR UPDATE SKIP LOCKED;`, strings.Join(scheduledMessageProjection, ", ")))
+
+	rows, err := ses.Query(sqlstr, entity.ScheduleStatusPending, now, limit)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list due scheduled messages failed")
+	}
+	defer rows.Close()
+
+	return scanScheduledMessages(rows)
+}
+
+// UpdatePendingScheduledMessage 修改待发送消息的内容和发送时间，返回是否修改成功
+func (p *postgres) UpdatePendingScheduledMessage(ses storage.Session, id int64, content string, sendAt time.Time) (bool, error) {
+	sqlstr := rebind(`UPDATE "scheduled_message"
+                  SET content = ?, send_at = ?
+                  WHERE id = ? AND status = ?;`)
+
+	res, err := ses.Exec(sqlstr, content, sendAt, id, entity.ScheduleStatusPending)
+	if err != nil {
+		return false, wrapPGErrorf(err, "update scheduled message with id: %d failed", id)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "update scheduled message with id: %d failed", id)
+	}
+
+	return n > 0, nil
+}
+
+// UpdateScheduledMessageStatus 仅当消息处于from状态时才更新为to，返回是否更新成功
+func (p *postgres) UpdateScheduledMessageStatus(ses storage.Session, id int64, from, to entity.ScheduleStatus, reason string) (bool, error) {
+	sqlstr := rebind(`UPDATE "scheduled_message"
+                  SET status = ?, reason = ?
+                  WHERE id = ? AND status = ?;`)
+
+	res, err := ses.Exec(sqlstr, to, reason, id, from)
+	if err != nil {
+		return false, wrapPGErrorf(err, "update status of scheduled message with id: %d to %s failed", id, to.String())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapPGErrorf(err, "update status of scheduled message with id: %d to %s failed", id, to.String())
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+	"fangaoxs.com/go-chat/internal/storage"
+
+	"github.com/lib/pq"
+)
+
+// InsertStickerPack 写入表情包及其中的表情，须在事务中调用
+func (p *postgres) InsertStickerPack(ses storage.Session, i *entity.StickerPack) error {
+	sqlstr := rebind(`INSERT INTO "sticker_pack"
+                  (group_id, name, created_by)
+                  VALUES
+                  (NULLIF(?::bigint, 0), ?, ?)
+                  RETURNING id, created_at;`)
+	if err := ses.QueryRow(sqlstr, i.GroupID, i.Name, i.CreatedBy).Scan(&i.ID, &i.CreatedAt); err != nil {
+		return wrapPGErrorf(err, "failed to insert sticker_pack")
+	}
+
+	sqlstr = rebind(`INSERT INTO "sticker"
+                  (pack_id, name, content_type, size, file_key)
+                  VALUES
+                  (?, ?, ?, ?, ?)
+                  RETURNING id, created_at;`)
+	for _, s := range i.Stickers {
+		if err := ses.QueryRow(sqlstr, i.ID, s.Name, s.ContentType, s.Size, s.FileKey).Scan(&s.ID, &s.CreatedAt); err != nil {
+			return wrapPGErrorf(err, "failed to insert sticker")
+		}
+		s.PackID, s.GroupID = i.ID, i.GroupID
+	}
+
+	return nil
+}
+
+var stickerProjection = []string{
+	"s.id",
+	"s.pack_id",
+	"COALESCE(p.group_id, 0)",
+	"s.name",
+	"s.content_type",
+	"s.size",
+	"s.file_key",
+	"s.created_at",
+}
+
+func scanStickers(rows *sql.Rows) ([]*entity.Sticker, error) {
+	var res []*entity.Sticker
+	for rows.Next() {
+		r := entity.Sticker{}
+		if err := rows.Scan(&r.ID, &r.PackID, &r.GroupID, &r.Name, &r.ContentType, &r.Size, &r.FileKey, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan sticker")
+		}
+		res = append(res, &r)
+	}
+
+	return res, nil
+}
+
+func (p *postgres) GetSticker(ses storage.Session, id int64) (*entity.Sticker, error) {
+	sqlstr := fmt.Sprintf(`SELECT %s
+                  FROM "sticker" s JOIN "sticker_pack" p ON p.id = s.pack_id
+                  WHERE s.id = ?`, strings.Join(stickerProjection, ", "))
+
+	rows, err := ses.Query(rebind(sqlstr), id)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "get sticker with id: %d failed", id)
+	}
+	defer rows.Close()
+
+	res, err := scanStickers(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.Newf(errors.NotFound, nil, "no sticker with id: %d found", id)
+	}
+
+	return res[0], nil
+}
+
+// ListStickerPacksBySubject 列出全局表情包和subject所在群的表情包，按创建顺序排列
+func (p *postgres) ListStickerPacksBySubject(ses storage.Session, subject string) ([]*entity.StickerPack, error) {
+	sqlstr := rebind(`SELECT id, COALESCE(group_id, 0), name, created_by, created_at
+                  FROM "sticker_pack"
+                  WHERE group_id IS NULL
+                     OR group_id IN (SELECT group_id FROM "group_member" WHERE user_subject = ?)
+                  ORDER BY id;`)
+
+	rows, err := ses.Query(sqlstr, subject)
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list sticker packs of subject: %s failed", subject)
+	}
+	defer rows.Close()
+
+	var res []*entity.StickerPack
+	byID := make(map[int64]*entity.StickerPack)
+	var ids []int64
+	for rows.Next() {
+		r := entity.StickerPack{Stickers: []*entity.Sticker{}}
+		if err = rows.Scan(&r.ID, &r.GroupID, &r.Name, &r.CreatedBy, &r.CreatedAt); err != nil {
+			return nil, wrapPGErrorf(err, "failed to scan sticker pack")
+		}
+		res = append(res, &r)
+		byID[r.ID] = &r
+		ids = append(ids, r.ID)
+	}
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	sqlstr = fmt.Sprintf(`SELECT %s
+                  FROM "sticker" s JOIN "sticker_pack" p ON p.id = s.pack_id
+                  WHERE s.pack_id = ANY(?)
+                  ORDER BY s.id`, strings.Join(stickerProjection, ", "))
+	srows, err := ses.Query(rebind(sqlstr), pq.Array(ids))
+	if err != nil {
+		return nil, wrapPGErrorf(err, "list stickers of subject: %s failed", subject)
+	}
+	defer srows.Close()
+
+	stickers, err := scanStickers(srows)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stickers {
+		pack := byID[s.PackID]
+		pack.Stickers = append(pack.Stickers, s)
+	}
+
+	return res, nil
+}
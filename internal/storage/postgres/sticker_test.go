@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+
+	"fangaoxs.com/go-chat/internal/entity"
+)
+
+func (s *postgresSuite) TestListStickerPacksBySubject() {
+	ses, err := s.storage.NewSession(context.Background())
+	s.Require().Nil(err)
+	ses, err = ses.Begin()
+	s.Require().Nil(err)
+	defer ses.Rollback()
+
+	admin, member, outsider := s.addUser(ses), s.addUser(ses), s.addUser(ses)
+	groupID, err := s.storage.InsertGroup(ses, &entity.Group{Name: "sticker", Type: entity.DefaultGroupType, CreatedBy: admin.Subject})
+	s.Require().Nil(err)
+	s.Require().Nil(s.storage.InsertGroupMember(ses, &entity.GroupMember{UserSubject: member.Subject, GroupID: groupID}))
+
+	global := &entity.StickerPack{Name: "global", CreatedBy: admin.Subject, Stickers: []*entity.Sticker{
+		{Name: "smile", ContentType: "image/png", Size: 1, FileKey: "stickers/a.png"},
+	}}
+	s.Require().Nil(s.storage.InsertStickerPack(ses, global))
+	local := &entity.StickerPack{GroupID: groupID, Name: "local", CreatedBy: admin.Subject, Stickers: []*entity.Sticker{
+		{Name: "cat", ContentType: "image/gif", Size: 2, FileKey: "stickers/b.gif"},
+		{Name: "dog", ContentType: "image/gif", Size: 3, FileKey: "stickers/c.gif"},
+	}}
+	s.Require().Nil(s.storage.InsertStickerPack(ses, local))
+
+	got, err := s.storage.GetSticker(ses, local.Stickers[1].ID)
+	s.Require().Nil(err)
+	s.Require().Equal(groupID, got.GroupID)
+	s.Require().Equal("stickers/c.gif", got.FileKey)
+
+	// 群表情包只对群成员可见
+	packs, err := s.storage.ListStickerPacksBySubject(ses, member.Subject)
+	s.Require().Nil(err)
+	byID := make(map[int64]*entity.StickerPack)
+	for _, p := range packs {
+		byID[p.ID] = p
+	}
+	s.Require().Contains(byID, global.ID)
+	s.Require().Contains(byID, local.ID)
+	s.Require().Len(byID[local.ID].Stickers, 2)
+
+	packs, err = s.storage.ListStickerPacksBySubject(ses, outsider.Subject)
+	s.Require().Nil(err)
+	for _, p := range packs {
+		s.Require().NotEqual(local.ID, p.ID)
+	}
+}
@@ -43,10 +43,11 @@ func (s *postgresSuite) TestUser() {
 }
 
 func (s *postgresSuite) addUser(ses storage.Session) *entity.User {
+	subject := uuid.NewString()
 	u := &entity.User{
-		Subject:  uuid.NewString(),
-		Nickname: "foo_nick",
-		Username: "foo_name",
+		Subject:  subject,
+		Nickname: "foo_nick_" + subject,
+		Username: "foo_name_" + subject,
 		Password: "foo_pw",
 		Phone:    "foo_phone",
 	}
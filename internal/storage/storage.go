@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"fangaoxs.com/go-chat/internal/entity"
 )
@@ -50,28 +51,174 @@ type Storage interface {
 
 	InsertGroup(ses Session, i *entity.Group) (int64, error)
 	GetGroupByID(ses Session, id int64) (*entity.Group, error)
+	GetGroupByIDForUpdate(ses Session, id int64) (*entity.Group, error)
 	ListGroupsByCreatedBy(ses Session, createdBy string) ([]*entity.Group, error)
 	DeleteGroup(ses Session, id int64) error
 	UpdateGroupIsPublic(ses Session, id int64, isPublic bool) error
+	UpdateGroupJoinPolicy(ses Session, id int64, policy entity.GroupJoinPolicy, question string) error
+	UpdateGroupProfile(ses Session, id int64, description string, tags []string) error
+	UpdateGroupAvatar(ses Session, id int64, avatar string) error
+	UpdateGroupCapacityTier(ses Session, id int64, tier int) error
+	UpdateGroupSlowMode(ses Session, id int64, seconds int) error
+	UpdateGroupName(ses Session, id int64, name string) error
+	UpdateGroupOwner(ses Session, id int64, owner string) error
+	SearchGroupDirectory(ses Session, filter *entity.GroupDirectoryFilter) ([]*entity.GroupDirectoryEntry, error)
+
+	InsertGroupOwnerLog(ses Session, i *entity.GroupOwnerLog) error
+	ListGroupOwnerLogsByGroup(ses Session, groupID int64) ([]*entity.GroupOwnerLog, error)
+	UpdateGroupAnnouncement(ses Session, id int64, announcement string) error
+
+	InsertGroupAnnouncementLog(ses Session, i *entity.GroupAnnouncementLog) error
+	ListGroupAnnouncementLogsByGroup(ses Session, groupID int64) ([]*entity.GroupAnnouncementLog, error)
+
+	InsertGroupPin(ses Session, i *entity.GroupPin) error
+	DeleteGroupPin(ses Session, groupID, recordID int64) (bool, error)
+	CountGroupPinsByGroup(ses Session, groupID int64) (int, error)
+	ListGroupPinsByGroup(ses Session, groupID int64) ([]*entity.GroupPin, error)
 
 	InsertGroupMember(ses Session, i *entity.GroupMember) error
 	DeleteGroupMembersByGroupID(ses Session, groupID int64) error
 	DeleteGroupMember(ses Session, userSubject string, groupID int64) error
 	GetGroupMember(ses Session, userSubject string, groupID int64) (*entity.GroupMember, error)
+	CountGroupMembers(ses Session, groupID int64) (int, error)
+	ClaimGroupPostSlot(ses Session, userSubject string, groupID int64, interval time.Duration) (*time.Time, error)
 	IsMemberOfGroup(ses Session, userSubject string, groupID int64) (bool, error)
 	ListGroupMembersByGroupID(ses Session, groupID int64) ([]*entity.GroupMember, error)
 	ListGroupMembersByUserSubject(ses Session, userSubject string) ([]*entity.GroupMember, error)
 	IsAdminOfGroup(ses Session, subject string, groupID int64) (bool, error)
-	UpdateGroupMemberIsAdmin(ses Session, subject string, groupID int64, isAdmin bool) error
+	UpdateGroupMemberRole(ses Session, subject string, groupID int64, role string) error
+	UpdateGroupMemberNickname(ses Session, userSubject string, groupID int64, nickname string) error
+	ReplaceGroupMembersRole(ses Session, groupID int64, from, to string) error
 	ListGroupAdminsByGroupID(ses Session, groupID int64) ([]*entity.GroupMember, error)
 
+	UpdateGroupMemberMutedUntil(ses Session, subject string, groupID int64, until *time.Time) error
+	LiftExpiredMutes(ses Session, now time.Time, limit int) ([]*entity.GroupMember, error)
+	UpdateGroupMutedAll(ses Session, id int64, mutedAll bool) error
+
+	UpsertGroupBan(ses Session, i *entity.GroupBan) error
+	DeleteGroupBan(ses Session, groupID int64, subject string) (bool, error)
+	IsBannedFromGroup(ses Session, subject string, groupID int64, now time.Time) (bool, error)
+	ListGroupBansByGroup(ses Session, groupID int64) ([]*entity.GroupBan, error)
+	DeleteExpiredGroupBans(ses Session, now time.Time, limit int) ([]*entity.GroupBan, error)
+
+	InsertGroupInviteLink(ses Session, i *entity.GroupInviteLink) error
+	GetGroupInviteLink(ses Session, id int64) (*entity.GroupInviteLink, error)
+	GetGroupInviteLinkByTokenForUpdate(ses Session, token string) (*entity.GroupInviteLink, error)
+	ListGroupInviteLinksByGroup(ses Session, groupID int64) ([]*entity.GroupInviteLink, error)
+	RevokeGroupInviteLink(ses Session, id int64, now time.Time) error
+	InsertGroupInviteLinkUse(ses Session, i *entity.GroupInviteLinkUse) error
+	IsGroupInviteLinkUsedBy(ses Session, linkID int64, subject string) (bool, error)
+	ListGroupInviteLinkUses(ses Session, linkID int64) ([]*entity.GroupInviteLinkUse, error)
+
+	InsertGroupChannel(ses Session, i *entity.GroupChannel) error
+	GetGroupChannel(ses Session, id int64) (*entity.GroupChannel, error)
+	GetDefaultGroupChannel(ses Session, groupID int64) (*entity.GroupChannel, error)
+	ListGroupChannelsByGroup(ses Session, groupID int64, subject string) ([]*entity.GroupChannel, error)
+	UpdateGroupChannel(ses Session, i *entity.GroupChannel) error
+	UpsertGroupChannelRead(ses Session, channelID int64, subject string, seq int64, now time.Time) error
+	MarkGroupChannelsRead(ses Session, groupID int64, subject string, now time.Time) error
+
+	UpsertGroupRole(ses Session, i *entity.GroupRole) error
+	GetGroupRole(ses Session, groupID int64, name string) (*entity.GroupRole, error)
+	ListGroupRolesByGroup(ses Session, groupID int64) ([]*entity.GroupRole, error)
+	DeleteGroupRole(ses Session, groupID int64, name string) error
+
+	GetConversationByID(ses Session, id int64) (*entity.Conversation, error)
+	GetPrivateConversation(ses Session, subject1, subject2 string) (*entity.Conversation, error)
+	GetGroupConversation(ses Session, groupID, channelID int64) (*entity.Conversation, error)
+
 	InsertRecordBroadcast(ses Session, i *entity.RecordBroadcast) (int64, error)
+	GetRecordBroadcastByID(ses Session, id int64) (*entity.RecordBroadcast, error)
+	GetRecordBroadcastByClientMsgID(ses Session, sender, clientMsgID string) (*entity.RecordBroadcast, error)
 	ListAllRecordBroadcasts(ses Session) ([]*entity.RecordBroadcast, error)
 	ListRecordBroadcastsBySender(ses Session, sender string) ([]*entity.RecordBroadcast, error)
 
 	InsertRecordGroup(ses Session, i *entity.RecordGroup) (int64, error)
+	GetRecordGroupByID(ses Session, id int64) (*entity.RecordGroup, error)
+	GetRecordGroupByClientMsgID(ses Session, sender, clientMsgID string) (*entity.RecordGroup, error)
 	ListRecordGroupsByGroup(ses Session, groupID int64) ([]*entity.RecordGroup, error)
+	ListRecordGroupsByChannel(ses Session, channelID int64) ([]*entity.RecordGroup, error)
+	ListRecordGroupsByGroupAfter(ses Session, groupID, afterID int64, limit int) ([]*entity.RecordGroup, error)
+	ListRecordGroupsBySeq(ses Session, conversationID, fromSeq, toSeq int64) ([]*entity.RecordGroup, error)
+	BulkInsertRecordGroups(ses Session, rs []*entity.RecordGroup) error
 
 	InsertRecordPrivate(ses Session, i *entity.RecordPrivate) (int64, error)
+	GetRecordPrivateByID(ses Session, id int64) (*entity.RecordPrivate, error)
+	GetRecordPrivateByClientMsgID(ses Session, sender, clientMsgID string) (*entity.RecordPrivate, error)
 	ListRecordPrivatesByParty(ses Session, subject1, subject2 string) ([]*entity.RecordPrivate, error)
+	ListRecordPrivatesByPartyAfter(ses Session, subject1, subject2 string, afterID int64, limit int) ([]*entity.RecordPrivate, error)
+	ListRecordPrivatesBySeq(ses Session, conversationID, fromSeq, toSeq int64) ([]*entity.RecordPrivate, error)
+	BulkInsertRecordPrivates(ses Session, rs []*entity.RecordPrivate) error
+
+	InsertPoll(ses Session, i *entity.Poll) error
+	GetPoll(ses Session, id int64) (*entity.Poll, error)
+	GetPollForUpdate(ses Session, id int64) (*entity.Poll, error)
+	ReplacePollVotes(ses Session, pollID int64, voter string, options []int) error
+	ListPollVotes(ses Session, pollID int64) ([]*entity.PollVote, error)
+	CloseDuePolls(ses Session, now time.Time, limit int) ([]*entity.Poll, error)
+
+	UpsertDeviceKey(ses Session, i *entity.DeviceKey) error
+	DeleteDeviceKey(ses Session, subject, device string) error
+	ListDeviceKeysBySubject(ses Session, subject string) ([]*entity.DeviceKey, error)
+
+	InsertStickerPack(ses Session, i *entity.StickerPack) error
+	GetSticker(ses Session, id int64) (*entity.Sticker, error)
+	ListStickerPacksBySubject(ses Session, subject string) ([]*entity.StickerPack, error)
+
+	InsertAttachment(ses Session, key string, data []byte) error
+	GetAttachment(ses Session, key string) ([]byte, error)
+	DeleteAttachment(ses Session, key string) error
+
+	UpsertDraft(ses Session, i *entity.Draft) error
+	DeleteDraft(ses Session, owner, kind, peer string, groupID int64) (bool, error)
+	ListDraftsByOwner(ses Session, owner string) ([]*entity.Draft, error)
+
+	UpsertBookmark(ses Session, i *entity.Bookmark) error
+	DeleteBookmark(ses Session, owner, kind string, recordID int64) error
+	ListBookmarksByOwner(ses Session, owner string, cursor *entity.Cursor, limit int) ([]*entity.Bookmark, error)
+
+	UpsertInboxEntriesForRecordPrivate(ses Session, recordID int64, i *entity.RecordPrivate) error
+	UpsertInboxEntriesForRecordGroup(ses Session, recordID int64, i *entity.RecordGroup) error
+	ListInboxEntriesByOwner(ses Session, owner string, cursor *entity.Cursor, limit int) ([]*entity.InboxEntry, error)
+	ListInboxEntriesByGroup(ses Session, groupID int64) ([]*entity.InboxEntry, error)
+	GetInboxEntry(ses Session, owner, kind, peer string, groupID int64) (*entity.InboxEntry, error)
+	ResetInboxEntryUnreadCount(ses Session, owner, kind, peer string, groupID int64) error
+	DeleteInboxEntriesByGroup(ses Session, groupID int64) error
+	DeleteInboxEntry(ses Session, owner, kind, peer string, groupID int64) error
+
+	InsertScheduledMessage(ses Session, i *entity.ScheduledMessage) (int64, error)
+	GetScheduledMessage(ses Session, id int64) (*entity.ScheduledMessage, error)
+	ListScheduledMessagesBySender(ses Session, sender string, status entity.ScheduleStatus) ([]*entity.ScheduledMessage, error)
+	ListDueScheduledMessagesForUpdate(ses Session, now time.Time, limit int) ([]*entity.ScheduledMessage, error)
+	UpdatePendingScheduledMessage(ses Session, id int64, content string, sendAt time.Time) (bool, error)
+	UpdateScheduledMessageStatus(ses Session, id int64, from, to entity.ScheduleStatus, reason string) (bool, error)
+
+	UpsertPrivateRetentionPolicy(ses Session, subject1, subject2 string, maxAge time.Duration, updatedBy string) error
+	GetPrivateRetentionPolicy(ses Session, subject1, subject2 string) (*entity.RetentionPolicy, error)
+	DeletePrivateRetentionPolicy(ses Session, subject1, subject2 string) error
+	UpsertGroupRetentionPolicy(ses Session, groupID int64, maxAge time.Duration, updatedBy string) error
+	GetGroupRetentionPolicy(ses Session, groupID int64) (*entity.RetentionPolicy, error)
+	DeleteGroupRetentionPolicy(ses Session, groupID int64) error
+
+	PurgeExpiredRecordPrivates(ses Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error)
+	PurgeExpiredRecordGroups(ses Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error)
+	PurgeExpiredRecordBroadcasts(ses Session, now time.Time, limit int) ([]*entity.ExpiredRecord, error)
+	ClearInboxEntriesPreview(ses Session, kind string, recordIDs []int64) error
+
+	InsertExportJob(ses Session, i *entity.ExportJob) (int64, error)
+	GetExportJob(ses Session, id int64) (*entity.ExportJob, error)
+	ListExportJobsByOwner(ses Session, owner string) ([]*entity.ExportJob, error)
+	ListClaimableExportJobsForUpdate(ses Session, lease time.Duration, limit int) ([]*entity.ExportJob, error)
+	ClaimExportJob(ses Session, id int64) (int, error)
+	RenewExportJobLease(ses Session, id int64, attempt int) (bool, error)
+	FinishExportJob(ses Session, id int64, attempt int, status entity.ExportStatus, filePath, reason string) (bool, error)
+	InsertExportJobChunk(ses Session, id int64, attempt, seq int, data []byte) error
+	GetExportJobChunk(ses Session, id int64, attempt, seq int) ([]byte, error)
+	DeleteExportJobChunks(ses Session, id int64, attempt int) error
+
+	GetImportMapping(ses Session, source, kind, foreignID string) (string, error)
+	InsertImportMapping(ses Session, source, kind, foreignID, localID string) error
+	ClaimImportMappings(ses Session, source, kind string, foreignIDs []string) ([]string, error)
+
+	SearchRecords(ses Session, subject string, filter *entity.RecordSearchFilter) ([]*entity.RecordSearchResult, error)
 }
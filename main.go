@@ -24,6 +24,13 @@ func main() {
 
 	logging := logger.New(env)
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err = runImport(context.Background(), env, logging, os.Args[2:]); err != nil {
+			log.Fatalf("import failed: %v", err)
+		}
+		return
+	}
+
 	s, err := server.New(env, logging)
 	if err != nil {
 		log.Fatalf("init server failed: %v", err)
@@ -0,0 +1,101 @@
+package params
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/entity"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+// rest和websocket发送消息时共用的参数解析
+
+// ParseSendOptions 解析消息的ttl（秒），为空时消息不过期。客户端发送的消息会清除发送者在该会话的草稿
+func ParseSendOptions(ttl string) (records.SendOptions, error) {
+	if ttl == "" {
+		return records.SendOptions{ClearDraft: true}, nil
+	}
+
+	seconds, err := strconv.ParseInt(ttl, 10, 64)
+	if err != nil || seconds < 0 {
+		return records.SendOptions{}, errors.Newf(errors.InvalidArgument, err, "invalid ttl: %s", ttl)
+	}
+
+	return records.SendOptions{TTL: time.Duration(seconds) * time.Second, ClearDraft: true}, nil
+}
+
+// ParseClientMsgID 解析客户端生成的消息ID，定时消息使用的前缀是保留的
+func ParseClientMsgID(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, records.ScheduledClientMsgIDPrefix) {
+		return "", errors.Newf(errors.InvalidArgument, nil, "client_msg_id不能以%s开头", records.ScheduledClientMsgIDPrefix)
+	}
+	return s, nil
+}
+
+// ParseEncrypted 解析消息是否端到端加密，为空时不加密
+func ParseEncrypted(s string) (bool, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return false, nil
+	}
+
+	encrypted, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.Newf(errors.InvalidArgument, err, "invalid encrypted: %s", s)
+	}
+	return encrypted, nil
+}
+
+// ParseBundle 解析是否合并转发为一条聊天记录，为空时逐条转发
+func ParseBundle(s string) (bool, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return false, nil
+	}
+
+	bundle, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.Newf(errors.InvalidArgument, err, "invalid bundle: %s", s)
+	}
+	return bundle, nil
+}
+
+// ParseSticker 解析表情消息的表情ID，为空时不是表情消息
+func ParseSticker(stickerID string) (*entity.Sticker, error) {
+	if stickerID == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseInt(stickerID, 10, 64)
+	if err != nil {
+		return nil, errors.Newf(errors.InvalidArgument, err, "invalid sticker_id: %s", stickerID)
+	}
+
+	return &entity.Sticker{ID: id}, nil
+}
+
+// ParseChannelID 解析群消息的频道ID，为空时为默认频道
+func ParseChannelID(channelID string) (int64, error) {
+	if channelID == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(channelID, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.Newf(errors.InvalidArgument, err, "invalid channel_id: %s", channelID)
+	}
+
+	return id, nil
+}
+
+// ParseAllChannels 解析channels参数，为all时查看或接收所有频道的消息，为空时只有默认频道
+func ParseAllChannels(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "":
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return false, errors.Newf(errors.InvalidArgument, nil, "invalid channels: %s", s)
+}
@@ -0,0 +1,128 @@
+package params
+
+import (
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/infras/errors"
+)
+
+func TestParseSendOptions(t *testing.T) {
+	opts, err := ParseSendOptions("")
+	if err != nil || opts.TTL != 0 {
+		t.Errorf("expected no ttl, but got %s, %v", opts.TTL, err)
+	}
+
+	opts, err = ParseSendOptions("30")
+	if err != nil || opts.TTL != 30*time.Second {
+		t.Errorf("expected %s, but got %s, %v", 30*time.Second, opts.TTL, err)
+	}
+	if !opts.ClearDraft {
+		t.Errorf("expected client sends to clear the draft")
+	}
+
+	for _, v := range []string{"-1", "1s", "abc"} {
+		if _, err = ParseSendOptions(v); errors.Code(err) != errors.InvalidArgument {
+			t.Errorf("expected %v for ttl %q, but got %v", errors.InvalidArgument, v, err)
+		}
+	}
+}
+
+func TestParseClientMsgID(t *testing.T) {
+	id, err := ParseClientMsgID("  abc  ")
+	if err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if id != "abc" {
+		t.Errorf("expected abc, but got %q", id)
+	}
+
+	if _, err = ParseClientMsgID(" schedule-1"); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
+
+func TestParseEncrypted(t *testing.T) {
+	for s, want := range map[string]bool{"": false, "true": true, "0": false} {
+		got, err := ParseEncrypted(s)
+		if err != nil {
+			t.Fatalf("expected nil for %q, but got %v", s, err)
+		}
+		if got != want {
+			t.Errorf("expected %v for %q, but got %v", want, s, got)
+		}
+	}
+
+	if _, err := ParseEncrypted("yes"); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	for s, want := range map[string]bool{"": false, "true": true, "false": false} {
+		got, err := ParseBundle(s)
+		if err != nil {
+			t.Fatalf("expected nil for %q, but got %v", s, err)
+		}
+		if got != want {
+			t.Errorf("expected %v for %q, but got %v", want, s, got)
+		}
+	}
+
+	if _, err := ParseBundle("yes"); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
+
+func TestParseSticker(t *testing.T) {
+	s, err := ParseSticker("")
+	if err != nil || s != nil {
+		t.Fatalf("expected no sticker, but got %v, %v", s, err)
+	}
+
+	s, err = ParseSticker("42")
+	if err != nil {
+		t.Fatalf("expected nil, but got %v", err)
+	}
+	if s.ID != 42 {
+		t.Errorf("expected sticker 42, but got %d", s.ID)
+	}
+
+	if _, err = ParseSticker("abc"); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
+
+func TestParseChannelID(t *testing.T) {
+	for s, want := range map[string]int64{"": 0, "0": 0, "12": 12} {
+		got, err := ParseChannelID(s)
+		if err != nil {
+			t.Fatalf("expected nil for %q, but got %v", s, err)
+		}
+		if got != want {
+			t.Errorf("expected %d for %q, but got %d", want, s, got)
+		}
+	}
+
+	for _, s := range []string{"-1", "abc"} {
+		if _, err := ParseChannelID(s); errors.Code(err) != errors.InvalidArgument {
+			t.Errorf("expected InvalidArgument for %q, but got %v", s, err)
+		}
+	}
+}
+
+func TestParseAllChannels(t *testing.T) {
+	for s, want := range map[string]bool{"": false, "all": true} {
+		got, err := ParseAllChannels(s)
+		if err != nil {
+			t.Fatalf("expected nil for %q, but got %v", s, err)
+		}
+		if got != want {
+			t.Errorf("expected %v for %q, but got %v", want, s, got)
+		}
+	}
+
+	if _, err := ParseAllChannels("some"); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("expected InvalidArgument, but got %v", err)
+	}
+}
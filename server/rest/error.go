@@ -1,8 +1,12 @@
 package rest
 
 import (
+	stderr "errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"fangaoxs.com/go-chat/internal/domain/records"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 
 	"github.com/gin-gonic/gin"
@@ -23,9 +27,22 @@ func WrapGinError(c *gin.Context, err error) {
 		code = http.StatusUnauthorized
 	case errors.Unavailable:
 		code = http.StatusServiceUnavailable
+	case errors.FailedPrecondition:
+		code = http.StatusPreconditionFailed
+	case errors.ResourceExhausted:
+		code = http.StatusTooManyRequests
 	}
-	c.AbortWithStatusJSON(code, gin.H{
+	body := gin.H{
 		"code":    code,
 		"message": err.Error(),
-	})
+	}
+	// 慢速模式告诉客户端何时可以再次发言
+	var slow *records.SlowModeError
+	if stderr.As(err, &slow) {
+		seconds := int(slow.RetryAfter(time.Now().UTC()) / time.Second)
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		body["retry_at"] = slow.RetryAt
+		body["retry_after"] = seconds
+	}
+	c.AbortWithStatusJSON(code, body)
 }
@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/infras/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapGinErrorSlowMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	retryAt := time.Now().UTC().Add(10 * time.Second)
+	WrapGinError(c, &records.SlowModeError{GroupID: 1, RetryAt: retryAt})
+
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.Nil(t, err)
+	require.True(t, seconds >= 9 && seconds <= 10, seconds)
+
+	var body map[string]any
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, float64(seconds), body["retry_after"])
+	require.NotEmpty(t, body["retry_at"])
+}
+
+func TestWrapGinErrorWithoutRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	WrapGinError(c, errors.New(errors.ResourceExhausted, nil, "too many devices"))
+
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+}
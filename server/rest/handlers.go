@@ -1,20 +1,31 @@
 package rest
 
 import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/applications"
+	"fangaoxs.com/go-chat/internal/domain/export"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/importer"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/domain/schedule"
 	"fangaoxs.com/go-chat/internal/domain/user"
 	"fangaoxs.com/go-chat/internal/entity"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/server/params"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,6 +38,9 @@ func newHandlers(
 	hub hub.Hub,
 	record records.Records,
 	application applications.Applications,
+	schedule schedule.Schedule,
+	export export.Export,
+	importer importer.Importer,
 ) (handlers, error) {
 	return handlers{
 		logger:      logger,
@@ -35,6 +49,9 @@ func newHandlers(
 		hub:         hub,
 		record:      record,
 		application: application,
+		schedule:    schedule,
+		export:      export,
+		importer:    importer,
 	}, nil
 }
 
@@ -46,6 +63,9 @@ type handlers struct {
 	hub         hub.Hub
 	record      records.Records
 	application applications.Applications
+	schedule    schedule.Schedule
+	export      export.Export
+	importer    importer.Importer
 }
 
 func (h *handlers) RegisterUser() gin.HandlerFunc {
@@ -110,6 +130,128 @@ func (h *handlers) Me() gin.HandlerFunc {
 	}
 }
 
+func (h *handlers) MyConversations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		var limit int
+		var err error
+		if v := c.Query("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid limit"))
+				return
+			}
+		}
+
+		res, next, err := h.record.ListInbox(ctx, ui.Subject, c.Query("cursor"), limit)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"conversations": res,
+			"next_cursor":   next,
+		})
+	}
+}
+
+func (h *handlers) ReadConversation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		var peer string
+		var groupID int64
+		var err error
+		kind := strings.TrimSpace(c.PostForm("kind"))
+		switch kind {
+		case entity.RecordKindPrivate:
+			if peer = strings.TrimSpace(c.PostForm("peer")); peer == "" {
+				WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty peer"))
+				return
+			}
+		case entity.RecordKindGroup:
+			if groupID, err = strconv.ParseInt(c.PostForm("group_id"), 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+		default:
+			WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", kind))
+			return
+		}
+
+		if err = h.record.MarkInboxRead(ctx, ui.Subject, kind, peer, groupID); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) PrivateRetention() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		peer := strings.TrimSpace(c.Query("peer"))
+		if peer == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty peer"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.GetPrivateRetention(ctx, ui.Subject, peer)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) UpdatePrivateRetention() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 好友双方都可以设置私聊的保留天数，0表示永久保留
+		peer := strings.TrimSpace(c.PostForm("peer"))
+		if peer == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty peer"))
+			return
+		}
+		maxAge, err := parseRetentionDays(c.PostForm("days"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		ok, err := h.user.IsFriendOfUser(ctx, ui.Subject, peer)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "对方不是你的好友"))
+			return
+		}
+
+		if err = h.record.SetPrivateRetention(ctx, ui.Subject, peer, maxAge); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
 func (h *handlers) MyFriends() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
@@ -126,6 +268,68 @@ func (h *handlers) MyFriends() gin.HandlerFunc {
 	}
 }
 
+func (h *handlers) UploadDeviceKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 公钥和签名均为base64编码
+		prekeyID, err := strconv.ParseInt(c.PostForm("signed_prekey_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid signed_prekey_id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		key := &entity.DeviceKey{
+			Subject:               ui.Subject,
+			Device:                c.PostForm("device"),
+			IdentityKey:           strings.TrimSpace(c.PostForm("identity_key")),
+			SignedPreKeyID:        prekeyID,
+			SignedPreKey:          strings.TrimSpace(c.PostForm("signed_prekey")),
+			SignedPreKeySignature: strings.TrimSpace(c.PostForm("signed_prekey_signature")),
+		}
+		if err = h.user.UploadDeviceKey(ctx, key); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+func (h *handlers) DeleteDeviceKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// DELETE
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		if err := h.user.DeleteDeviceKey(ctx, ui.Subject, c.Param("device")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) DeviceKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只能查询自己和好友的公钥
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		keys, err := h.user.ListDeviceKeys(ctx, ui.Subject, c.Param("subject"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
 func (h *handlers) RemoveFriends() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
@@ -287,6 +491,7 @@ func (h *handlers) MyGroups() gin.HandlerFunc {
 func (h *handlers) ExitGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// DELETE
+		// 群主退群时自动由最早加入的管理员或成员接任
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -297,25 +502,13 @@ func (h *handlers) ExitGroup() gin.HandlerFunc {
 			return
 		}
 
-		g, err := h.group.GetGroupByID(ctx, id)
-		if err != nil {
-			WrapGinError(c, err)
-			return
-		}
-
-		ok, err := h.group.IsMemberOfGroup(ctx, g.ID, ui.Subject)
+		log, err := h.group.LeaveGroup(ctx, id, ui.Subject)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.Newf(errors.PermissionDenied, nil, "你不是该群成员"))
-			return
-		}
-
-		if err = h.group.RemoveMembersFromGroup(ctx, g.ID, ui.Subject); err != nil {
-			WrapGinError(c, err)
-			return
+		if log != nil {
+			h.pushOwnerChanged(ctx, log)
 		}
 
 		c.Status(http.StatusOK)
@@ -342,6 +535,7 @@ func (h *handlers) GroupRequestFromMe() gin.HandlerFunc {
 func (h *handlers) SendGroupRequest() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// POST
+		// 按群的入群方式处理，入群方式为question时需要填写answer；返回的申请状态为已接受时表示已经入群
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -351,12 +545,13 @@ func (h *handlers) SendGroupRequest() gin.HandlerFunc {
 			return
 		}
 
-		if err = h.application.CreateGroupRequest(ctx, ui.Subject, groupID); err != nil {
+		res, err := h.application.CreateGroupRequest(ctx, ui.Subject, groupID, c.PostForm("answer"))
+		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
@@ -473,6 +668,53 @@ func (h *handlers) CreateGroup() gin.HandlerFunc {
 	}
 }
 
+func (h *handlers) GroupDirectory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只返回公开的群，type为群类型名称，sort为popular或recent
+
+		ctx := c.Request.Context()
+
+		input := group.DirectoryInput{
+			Query: strings.TrimSpace(c.Query("q")),
+			Sort:  c.Query("sort"),
+		}
+
+		var err error
+		if v := c.Query("type"); v != "" {
+			t, ok := entity.GroupTypeFromString(v)
+			if !ok {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "invalid type: %s", v))
+				return
+			}
+			input.Type = &t
+		}
+		if v := c.Query("offset"); v != "" {
+			if input.Offset, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid offset"))
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if input.Limit, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid limit"))
+				return
+			}
+		}
+
+		res, next, err := h.group.SearchDirectory(ctx, input)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"groups":      res,
+			"next_offset": next,
+		})
+	}
+}
+
 func (h *handlers) GetGroupByID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
@@ -510,7 +752,7 @@ func (h *handlers) GetGroupByID() gin.HandlerFunc {
 func (h *handlers) DeleteGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// DELETE
-		// 只有群创建者能删除群
+		// 只有群主能解散群
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -521,15 +763,10 @@ func (h *handlers) DeleteGroup() gin.HandlerFunc {
 			return
 		}
 
-		g, err := h.group.GetGroupByID(ctx, id)
-		if err != nil {
+		if err = h.group.Authorize(ctx, id, ui.Subject, entity.GroupPermDelete); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if g.CreatedBy != ui.Subject {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以删除该群"))
-			return
-		}
 
 		err = h.group.DeleteGroup(ctx, id)
 		if err != nil {
@@ -544,7 +781,7 @@ func (h *handlers) DeleteGroup() gin.HandlerFunc {
 func (h *handlers) MakeGroupPublic() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
-		// 群管理员可以将群公开
+		// 拥有manage权限的成员可以将群公开
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -555,15 +792,10 @@ func (h *handlers) MakeGroupPublic() gin.HandlerFunc {
 			return
 		}
 
-		ok, err := h.group.IsAdminOfGroup(ctx, id, ui.Subject)
-		if err != nil {
+		if err = h.group.Authorize(ctx, id, ui.Subject, entity.GroupPermManage); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以操作该群"))
-			return
-		}
 
 		err = h.group.MakeGroupPublic(ctx, id)
 		if err != nil {
@@ -575,10 +807,10 @@ func (h *handlers) MakeGroupPublic() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) MakeGroupPrivate() gin.HandlerFunc {
+func (h *handlers) SetJoinPolicy() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
-		// 群管理员可以将群私有
+		// policy为open、approval、invite_only或question，question时需要填写question
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -589,13 +821,37 @@ func (h *handlers) MakeGroupPrivate() gin.HandlerFunc {
 			return
 		}
 
-		ok, err := h.group.IsAdminOfGroup(ctx, id, ui.Subject)
+		if err = h.group.Authorize(ctx, id, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		policy := entity.GroupJoinPolicy(c.PostForm("policy"))
+		if err = h.group.SetJoinPolicy(ctx, id, policy, c.PostForm("question")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) MakeGroupPrivate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有manage权限的成员可以将群私有
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以操作该群"))
+
+		if err = h.group.Authorize(ctx, id, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
 			return
 		}
 
@@ -609,10 +865,10 @@ func (h *handlers) MakeGroupPrivate() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) MembersOfGroup() gin.HandlerFunc {
+func (h *handlers) CapacityOfGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
-		// 只有群成员可以查看该群
+		// 只有群成员可以查看群的容量
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -633,24 +889,20 @@ func (h *handlers) MembersOfGroup() gin.HandlerFunc {
 			return
 		}
 
-		members, err := h.group.ListMembersOfGroup(ctx, groupID)
+		res, err := h.group.Capacity(ctx, groupID)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if len(members) == 0 {
-			WrapGinError(c, errors.New(errors.NotFound, nil, "没有群成员"))
-			return
-		}
 
-		c.JSON(http.StatusOK, members)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
-func (h *handlers) RemoveMembersFromGroup() gin.HandlerFunc {
+func (h *handlers) RaiseCapacityTier() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
-		// 群管理员可以移除成员
+		// 拥有manage权限的成员可以提升群的容量档位，tier为档位的序号
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -660,46 +912,31 @@ func (h *handlers) RemoveMembersFromGroup() gin.HandlerFunc {
 			WrapGinError(c, err)
 			return
 		}
-
-		subjects := c.PostFormArray("user_subject")
-		if len(subjects) == 0 {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subjects"))
+		tier, err := strconv.Atoi(c.PostForm("tier"))
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid tier"))
 			return
 		}
-		for _, subject := range subjects {
-			if subject = strings.TrimSpace(subject); subject == "" {
-				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "empty user subject"))
-				return
-			}
-			if subject == ui.Subject {
-				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "无法操作自己"))
-				return
-			}
-		}
 
-		ok, err := h.group.IsAdminOfGroup(ctx, groupID, ui.Subject)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以操作该群"))
-			return
-		}
 
-		if err = h.group.RemoveMembersFromGroup(ctx, groupID, subjects...); err != nil {
+		res, err := h.group.RaiseCapacityTier(ctx, groupID, tier)
+		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
-func (h *handlers) AdminsOfGroup() gin.HandlerFunc {
+func (h *handlers) MembersOfGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
-		// 只有群成员可以访问群管理员
+		// 只有群成员可以查看该群
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -720,24 +957,24 @@ func (h *handlers) AdminsOfGroup() gin.HandlerFunc {
 			return
 		}
 
-		admins, err := h.group.ListAdminsOfGroup(ctx, groupID)
+		members, err := h.group.ListMembersOfGroup(ctx, groupID)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if len(admins) == 0 {
-			WrapGinError(c, errors.New(errors.NotFound, nil, "没有群管理员"))
+		if len(members) == 0 {
+			WrapGinError(c, errors.New(errors.NotFound, nil, "没有群成员"))
 			return
 		}
 
-		c.JSON(http.StatusOK, admins)
+		c.JSON(http.StatusOK, members)
 	}
 }
 
-func (h *handlers) AssignAdminsToGroup() gin.HandlerFunc {
+func (h *handlers) RemoveMembersFromGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
-		// 只有群创建者可以添加管理员
+		// 拥有remove_members权限的成员可以移除成员，群主不能被移除
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -764,18 +1001,12 @@ func (h *handlers) AssignAdminsToGroup() gin.HandlerFunc {
 			}
 		}
 
-		g, err := h.group.GetGroupByID(ctx, groupID)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermRemoveMembers); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if g.CreatedBy != ui.Subject {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不是群组创建者"))
-			return
-		}
 
-		err = h.group.AssignAdminsToGroup(ctx, groupID, subjects...)
-		if err != nil {
+		if err = h.group.RemoveMembersFromGroup(ctx, groupID, subjects...); err != nil {
 			WrapGinError(c, err)
 			return
 		}
@@ -784,10 +1015,48 @@ func (h *handlers) AssignAdminsToGroup() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) RemoveAdminsFromGroup() gin.HandlerFunc {
+func (h *handlers) AdminsOfGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只有群成员可以访问群管理员
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
+			return
+		}
+
+		admins, err := h.group.ListAdminsOfGroup(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if len(admins) == 0 {
+			WrapGinError(c, errors.New(errors.NotFound, nil, "没有群管理员"))
+			return
+		}
+
+		c.JSON(http.StatusOK, admins)
+	}
+}
+
+func (h *handlers) AssignAdminsToGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
-		// 只有群创建者可以移除管理员
+		// 只有群主可以添加管理员
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
@@ -814,17 +1083,12 @@ func (h *handlers) RemoveAdminsFromGroup() gin.HandlerFunc {
 			}
 		}
 
-		g, err := h.group.GetGroupByID(ctx, groupID)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManageRoles); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if g.CreatedBy != ui.Subject {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不是群组创建者"))
-			return
-		}
 
-		err = h.group.RemoveAdminsFromGroup(ctx, groupID, subjects...)
+		err = h.group.AssignAdminsToGroup(ctx, groupID, subjects...)
 		if err != nil {
 			WrapGinError(c, err)
 			return
@@ -834,34 +1098,43 @@ func (h *handlers) RemoveAdminsFromGroup() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) SendGroupInvitation() gin.HandlerFunc {
+func (h *handlers) RemoveAdminsFromGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// POST
+		// PUT
+		// 只有群主可以移除管理员
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
-		groupID, err := strconv.ParseInt(c.PostForm("group_id"), 10, 64)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		userSubject := strings.TrimSpace(c.PostForm("user_subject"))
-		if userSubject == "" {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "invalid user_subject: empty"))
+
+		subjects := c.PostFormArray("user_subject")
+		if len(subjects) == 0 {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subjects"))
 			return
 		}
+		for _, subject := range subjects {
+			if subject = strings.TrimSpace(subject); subject == "" {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "empty user subject"))
+				return
+			}
+			if subject == ui.Subject {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "无法操作自己"))
+				return
+			}
+		}
 
-		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManageRoles); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.Newf(errors.PermissionDenied, nil, "你不是群[%d]成员", groupID))
-			return
-		}
 
-		if err = h.application.CreateGroupInvitation(ctx, ui.Subject, userSubject, groupID); err != nil {
+		err = h.group.RemoveAdminsFromGroup(ctx, groupID, subjects...)
+		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
@@ -870,29 +1143,31 @@ func (h *handlers) SendGroupInvitation() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) GroupRequestsToGroup() gin.HandlerFunc {
+func (h *handlers) ChannelsOfGroup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
+		// 只有群成员可以查看频道，附带访问者在各频道的已读位置和未读数
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
-		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		ok, err := h.group.IsAdminOfGroup(ctx, id, ui.Subject)
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 		if !ok {
-			WrapGinError(c, errors.Newf(errors.PermissionDenied, nil, "你不是群[%d]的管理员", id))
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
 			return
 		}
 
-		res, err := h.application.GroupRequestsTo(ctx, id)
+		res, err := h.group.ListChannels(ctx, groupID, ui.Subject)
 		if err != nil {
 			WrapGinError(c, err)
 			return
@@ -902,120 +1177,106 @@ func (h *handlers) GroupRequestsToGroup() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) AgreeGroupRequest() gin.HandlerFunc {
+func (h *handlers) CreateGroupChannel() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// PUT
+		// POST
+		// 拥有manage权限的成员可以新建频道，admin_only为true时只有拥有manage权限的成员可以在该频道发言
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
-		id, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-
-		request, err := h.application.GetGroupRequest(ctx, id)
+		input, err := parseChannelInput(c)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		ok, err := h.group.IsAdminOfGroup(ctx, request.GroupID, ui.Subject)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.Newf(errors.PermissionDenied, nil, "你不是群[%d]的管理员", id))
-			return
-		}
 
-		if err = h.application.AgreeGroupRequest(ctx, id, ui.Subject); err != nil {
+		res, err := h.group.CreateChannel(ctx, groupID, ui.Subject, input)
+		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
+		h.pushChannelEvent(ctx, "group_channel_created", res)
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
-func (h *handlers) RefuseGroupRequest() gin.HandlerFunc {
+func (h *handlers) UpdateGroupChannel() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// PUT
+		// 拥有manage权限的成员可以修改频道的名称、话题和admin_only
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
-		id, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-
-		request, err := h.application.GetGroupRequest(ctx, id)
+		channelID, err := strconv.ParseInt(c.Param("channel_id"), 10, 64)
 		if err != nil {
-			WrapGinError(c, err)
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid channel_id"))
 			return
 		}
-
-		ok, err := h.group.IsAdminOfGroup(ctx, request.GroupID, ui.Subject)
+		input, err := parseChannelInput(c)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.Newf(errors.PermissionDenied, nil, "你不是群[%d]的管理员", id))
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
 			return
 		}
 
-		if err = h.application.RefuseGroupRequest(ctx, id, ui.Subject); err != nil {
+		res, err := h.group.UpdateChannel(ctx, groupID, channelID, input)
+		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
+		h.pushChannelEvent(ctx, "group_channel_updated", res)
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
-// record
-
-func (h *handlers) BroadcastMessage() gin.HandlerFunc {
+func (h *handlers) MarkGroupChannelRead() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// POST
-		message := strings.TrimSpace(c.PostForm("message"))
-		if message == "" {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
-			return
-		}
+		// PUT
+		// seq为已读的最后一条消息的序号，为空时标记为全部已读
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
 
-		err := h.hub.SendBroadcastMessage(ctx, ui.Subject, message)
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-
-		c.Status(http.StatusOK)
-	}
-}
-
-func (h *handlers) GroupMessage() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// POST
-		message := strings.TrimSpace(c.PostForm("message"))
-		if message == "" {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
-			return
-		}
-		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		channelID, err := strconv.ParseInt(c.Param("channel_id"), 10, 64)
 		if err != nil {
-			WrapGinError(c, err)
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid channel_id"))
 			return
 		}
-
-		ctx := c.Request.Context()
-		ui := auth.FromContext(ctx)
+		var seq int64
+		if v := c.PostForm("seq"); v != "" {
+			if seq, err = strconv.ParseInt(v, 10, 64); err != nil {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, err, "invalid seq: %s", v))
+				return
+			}
+		}
 
 		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
 		if err != nil {
@@ -1027,8 +1288,7 @@ func (h *handlers) GroupMessage() gin.HandlerFunc {
 			return
 		}
 
-		err = h.hub.SendGroupMessage(ctx, ui.Subject, message, groupID)
-		if err != nil {
+		if err = h.group.MarkChannelRead(ctx, groupID, channelID, ui.Subject, seq); err != nil {
 			WrapGinError(c, err)
 			return
 		}
@@ -1037,110 +1297,2190 @@ func (h *handlers) GroupMessage() gin.HandlerFunc {
 	}
 }
 
-func (h *handlers) PrivateMessage() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// POST
-		message := strings.TrimSpace(c.PostForm("message"))
-		if message == "" {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
-			return
-		}
-		receiver := strings.TrimSpace(c.PostForm("receiver"))
-		if receiver == "" {
-			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty receiver"))
-			return
+// parseChannelInput 解析频道的name、topic和admin_only
+func parseChannelInput(c *gin.Context) (group.ChannelInput, error) {
+	input := group.ChannelInput{
+		Name:  c.PostForm("name"),
+		Topic: c.PostForm("topic"),
+	}
+	if v := c.PostForm("admin_only"); v != "" {
+		adminOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return input, errors.Newf(errors.InvalidArgument, err, "invalid admin_only: %s", v)
 		}
+		input.AdminOnly = adminOnly
+	}
+
+	return input, nil
+}
+
+func (h *handlers) pushChannelEvent(ctx context.Context, typ string, ch *entity.GroupChannel) {
+	event := map[string]any{
+		"type":     typ,
+		"group_id": ch.GroupID,
+		"channel":  ch,
+	}
+	if err := h.hub.SendGroupEvent(ctx, ch.GroupID, event); err != nil {
+		h.logger.Errorf("push %s event of group %d failed: %v", typ, ch.GroupID, err)
+	}
+}
+
+func (h *handlers) PinsOfGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只有群成员可以查看置顶消息
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
 
-		ok, err := h.user.IsFriendOfUser(ctx, ui.Subject, receiver)
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 		if !ok {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "对方不是你的好友"))
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
 			return
 		}
 
-		err = h.hub.SendPrivateMessage(ctx, ui.Subject, message, receiver)
+		res, err := h.group.ListPinsOfGroup(ctx, groupID)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, res)
 	}
 }
 
-func (h *handlers) GetRecordBroadcast() gin.HandlerFunc {
+func (h *handlers) PinRecord() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// GET
-		sender := c.Query("sender")
+		// PUT
+		// 拥有pin权限的成员可以置顶消息
 
 		ctx := c.Request.Context()
-		var res []*entity.RecordBroadcast
-		var err error
-		if sender = strings.TrimSpace(sender); sender == "" {
-			res, err = h.record.ListAllRecordBroadcasts(ctx)
-			if err != nil {
-				WrapGinError(c, err)
-				return
-			}
-		} else {
-			res, err = h.record.ListRecordBroadcastsBySender(ctx, sender)
-			if err != nil {
-				WrapGinError(c, err)
-				return
-			}
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		recordID, err := strconv.ParseInt(c.PostForm("record_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid record_id"))
+			return
 		}
 
-		c.JSON(http.StatusOK, res)
-	}
-}
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermPin); err != nil {
+			WrapGinError(c, err)
+			return
+		}
 
-func (h *handlers) GetRecordGroup() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// GET
-		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		pin, err := h.group.PinRecord(ctx, groupID, recordID, ui.Subject)
 		if err != nil {
-			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+			WrapGinError(c, err)
 			return
 		}
 
+		event := map[string]any{
+			"type":      "pinned",
+			"group_id":  groupID,
+			"record_id": recordID,
+			"pinned_by": ui.Subject,
+			"record":    pin.Record,
+		}
+		if err = h.hub.SendGroupEvent(ctx, groupID, event); err != nil {
+			h.logger.Errorf("push pinned event of group %d failed: %v", groupID, err)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) UnpinRecord() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有pin权限的成员可以取消置顶
+
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
 
-		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
 			WrapGinError(c, err)
 			return
 		}
-		if !ok {
-			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你无法查看该群组"))
+		recordID, err := strconv.ParseInt(c.PostForm("record_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid record_id"))
 			return
 		}
 
-		res, err := h.record.ListRecordGroups(ctx, groupID)
-		if err != nil {
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermPin); err != nil {
 			WrapGinError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, res)
+		if err = h.group.UnpinRecord(ctx, groupID, recordID); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		event := map[string]any{
+			"type":        "unpinned",
+			"group_id":    groupID,
+			"record_id":   recordID,
+			"unpinned_by": ui.Subject,
+		}
+		if err = h.hub.SendGroupEvent(ctx, groupID, event); err != nil {
+			h.logger.Errorf("push unpinned event of group %d failed: %v", groupID, err)
+		}
+
+		c.Status(http.StatusOK)
 	}
 }
 
-func (h *handlers) GetRecordPrivate() gin.HandlerFunc {
+func (h *handlers) AnnouncementHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// GET
-		receiver := c.Param("receiver")
+		// 只有群成员可以查看公告历史
 
 		ctx := c.Request.Context()
 		ui := auth.FromContext(ctx)
 
-		res, err := h.record.ListRecordPrivate(ctx, ui.Subject, receiver)
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
+			return
+		}
+
+		res, err := h.group.ListAnnouncementHistory(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) UpdateAnnouncement() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有announce权限的成员可以发布群公告
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		content := strings.TrimSpace(c.PostForm("content"))
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermAnnounce); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.UpdateAnnouncement(ctx, groupID, content, ui.Subject); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		event := map[string]any{
+			"type":         "announcement_updated",
+			"group_id":     groupID,
+			"announcement": content,
+			"edited_by":    ui.Subject,
+		}
+		if err = h.hub.SendGroupEvent(ctx, groupID, event); err != nil {
+			h.logger.Errorf("push announcement_updated event of group %d failed: %v", groupID, err)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) RenameGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有rename权限的成员可以修改群名称
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		name := strings.TrimSpace(c.PostForm("name"))
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermRename); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.RenameGroup(ctx, groupID, name); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		event := map[string]any{
+			"type":       "group_renamed",
+			"group_id":   groupID,
+			"name":       name,
+			"renamed_by": ui.Subject,
+		}
+		if err = h.hub.SendGroupEvent(ctx, groupID, event); err != nil {
+			h.logger.Errorf("push group_renamed event of group %d failed: %v", groupID, err)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) UpdateGroupProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有manage权限的成员可以修改群简介和标签，tags可以重复多次，不传时清空标签
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.group.UpdateProfile(ctx, groupID, c.PostForm("description"), c.PostFormArray("tags"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		h.pushProfileUpdated(ctx, res, ui.Subject)
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) SetGroupAvatar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有manage权限的成员可以上传群头像，文件字段为avatar
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		fh, err := c.FormFile("avatar")
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid avatar"))
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid file"))
+			return
+		}
+		defer f.Close()
+
+		res, err := h.group.SetAvatar(ctx, groupID, f)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		h.pushProfileUpdated(ctx, res, ui.Subject)
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) pushProfileUpdated(ctx context.Context, grp *entity.Group, updatedBy string) {
+	event := map[string]any{
+		"type":        "group_profile_updated",
+		"group_id":    grp.ID,
+		"description": grp.Description,
+		"avatar":      grp.Avatar,
+		"tags":        grp.Tags,
+		"updated_by":  updatedBy,
+	}
+	if err := h.hub.SendGroupEvent(ctx, grp.ID, event); err != nil {
+		h.logger.Errorf("push group_profile_updated event of group %d failed: %v", grp.ID, err)
+	}
+}
+
+func (h *handlers) GetGroupAvatar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 与查询群信息相同，群为公开或者访问者是群成员的时候才可以查看
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		g, err := h.group.GetGroupByID(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !g.IsPublic {
+			isMember, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+			if err != nil {
+				WrapGinError(c, err)
+				return
+			}
+			if !isMember {
+				WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
+				return
+			}
+		}
+
+		f, err := h.group.OpenAvatar(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		// 头像可能被替换，不能长期缓存
+		c.Header("Cache-Control", "private, no-cache")
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, f)
+	}
+}
+
+func (h *handlers) SetGroupNickname() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 成员修改自己在群内的昵称，nickname为空时清除
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		nickname := strings.TrimSpace(c.PostForm("nickname"))
+
+		if err = h.group.SetNickname(ctx, groupID, ui.Subject, nickname); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		event := map[string]any{
+			"type":         "member_nickname_changed",
+			"group_id":     groupID,
+			"user_subject": ui.Subject,
+			"nickname":     nickname,
+		}
+		if err = h.hub.SendGroupEvent(ctx, groupID, event); err != nil {
+			h.logger.Errorf("push member_nickname_changed event of group %d failed: %v", groupID, err)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) TransferOwnership() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 只有群主可以将群转让给群内的其他成员
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		to := strings.TrimSpace(c.PostForm("user_subject"))
+		if to == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subject"))
+			return
+		}
+
+		log, err := h.group.TransferOwnership(ctx, groupID, ui.Subject, to)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		h.pushOwnerChanged(ctx, log)
+
+		c.JSON(http.StatusOK, log)
+	}
+}
+
+func (h *handlers) pushOwnerChanged(ctx context.Context, log *entity.GroupOwnerLog) {
+	event := map[string]any{
+		"type":     "owner_changed",
+		"group_id": log.GroupID,
+		"from":     log.FromSubject,
+		"to":       log.ToSubject,
+		"reason":   log.Reason,
+	}
+	if err := h.hub.SendGroupEvent(ctx, log.GroupID, event); err != nil {
+		h.logger.Errorf("push owner_changed event of group %d failed: %v", log.GroupID, err)
+	}
+}
+
+func (h *handlers) OwnerHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只有群成员可以查看群主变更记录
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不是该群成员"))
+			return
+		}
+
+		res, err := h.group.ListOwnerHistory(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) MuteMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有mute权限的成员可以禁言其他成员duration秒，只有群主可以禁言管理员
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		subject := strings.TrimSpace(c.PostForm("user_subject"))
+		if subject == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subject"))
+			return
+		}
+		d, err := parseSeconds("duration", c.PostForm("duration"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermMute); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		until, err := h.group.MuteMember(ctx, groupID, ui.Subject, subject, d)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		h.postSystemMessage(ctx, groupID, fmt.Sprintf("%s 被禁言，解除时间 %s UTC", subject, until.Format(time.DateTime)))
+
+		c.JSON(http.StatusOK, gin.H{"muted_until": until})
+	}
+}
+
+func (h *handlers) UnmuteMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		subject := strings.TrimSpace(c.PostForm("user_subject"))
+		if subject == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subject"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermMute); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		lifted, err := h.group.UnmuteMember(ctx, groupID, ui.Subject, subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if lifted {
+			h.postSystemMessage(ctx, groupID, fmt.Sprintf("%s 被解除禁言", subject))
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) MuteAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// muted为true时开启全员禁言，群主和管理员不受限制
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		muted, err := strconv.ParseBool(c.PostForm("muted"))
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid muted"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermMute); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		changed, err := h.group.SetMuteAll(ctx, groupID, muted)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if changed {
+			content := "已关闭全员禁言"
+			if muted {
+				content = "已开启全员禁言"
+			}
+			h.postSystemMessage(ctx, groupID, content)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) SlowMode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有mute权限的成员可以设置慢速模式，seconds为每个成员两次发言的最小间隔，0表示关闭
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		seconds, err := strconv.Atoi(c.PostForm("seconds"))
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid seconds"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermMute); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		changed, err := h.group.SetSlowMode(ctx, groupID, time.Duration(seconds)*time.Second)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if changed {
+			content := "已关闭慢速模式"
+			if seconds > 0 {
+				content = fmt.Sprintf("已开启慢速模式，每%d秒只能发言一次", seconds)
+			}
+			h.postSystemMessage(ctx, groupID, content)
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) BanMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有remove_members权限的成员可以将用户移出群并封禁duration秒，duration为空或0时永久封禁
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		subject := strings.TrimSpace(c.PostForm("user_subject"))
+		if subject == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subject"))
+			return
+		}
+		var d time.Duration
+		if v := c.PostForm("duration"); v != "" && v != "0" {
+			if d, err = parseSeconds("duration", v); err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermRemoveMembers); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ban, err := h.group.BanMember(ctx, groupID, ui.Subject, subject, d)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		content := fmt.Sprintf("%s 被移出群并永久封禁", subject)
+		if ban.ExpiresAt != nil {
+			content = fmt.Sprintf("%s 被移出群并封禁，解除时间 %s UTC", subject, ban.ExpiresAt.Format(time.DateTime))
+		}
+		h.postSystemMessage(ctx, groupID, content)
+
+		event := map[string]any{
+			"type":     "group_banned",
+			"group_id": groupID,
+			"ban":      ban,
+		}
+		if err = h.hub.SendUserEvent(ctx, subject, event); err != nil {
+			h.logger.Errorf("push group_banned event to %s failed: %v", subject, err)
+		}
+
+		c.JSON(http.StatusOK, ban)
+	}
+}
+
+func (h *handlers) UnbanMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		subject := strings.TrimSpace(c.PostForm("user_subject"))
+		if subject == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subject"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermRemoveMembers); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.UnbanMember(ctx, groupID, subject); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		h.postSystemMessage(ctx, groupID, fmt.Sprintf("%s 被解除封禁", subject))
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) BansOfGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermRemoveMembers); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.group.ListBans(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// postSystemMessage 在群里发送系统消息，失败时只记录日志
+func (h *handlers) postSystemMessage(ctx context.Context, groupID int64, content string) {
+	if _, err := h.hub.SendGroupMessage(ctx, entity.SystemSubject, content, groupID, records.SendOptions{System: true}); err != nil {
+		h.logger.Errorf("send system message to group %d failed: %v", groupID, err)
+	}
+}
+
+func (h *handlers) RolesOfGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只有群成员可以查看群的角色及权限
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不是该群成员"))
+			return
+		}
+
+		res, err := h.group.ListGroupRoles(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) SaveGroupRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 只有群主可以新建角色或修改角色的权限，permissions可以重复多次，为空表示没有任何权限
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		name := strings.TrimSpace(c.PostForm("name"))
+		var perms []entity.GroupPermission
+		for _, p := range c.PostFormArray("permissions") {
+			perms = append(perms, entity.GroupPermission(strings.TrimSpace(p)))
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManageRoles); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.group.SaveGroupRole(ctx, groupID, name, perms)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) DeleteGroupRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// DELETE
+		// 只有群主可以删除角色，拥有该角色的成员变为member
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManageRoles); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.DeleteGroupRole(ctx, groupID, c.Param("name")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) AssignGroupRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 只有群主可以修改成员的角色
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		role := strings.TrimSpace(c.PostForm("role"))
+		if role == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty role"))
+			return
+		}
+
+		subjects := c.PostFormArray("user_subject")
+		if len(subjects) == 0 {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty user subjects"))
+			return
+		}
+		for _, subject := range subjects {
+			if subject = strings.TrimSpace(subject); subject == "" {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "empty user subject"))
+				return
+			}
+			if subject == ui.Subject {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "无法操作自己"))
+				return
+			}
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManageRoles); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.AssignRole(ctx, groupID, role, subjects...); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) GroupRetention() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只有群成员可以查看保留策略
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该群"))
+			return
+		}
+
+		res, err := h.record.GetGroupRetention(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) UpdateGroupRetention() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 拥有manage权限的成员可以设置群消息的保留天数，0表示永久保留
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		maxAge, err := parseRetentionDays(c.PostForm("days"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.record.SetGroupRetention(ctx, groupID, maxAge, ui.Subject); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) SendGroupInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+		groupID, err := strconv.ParseInt(c.PostForm("group_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		userSubject := strings.TrimSpace(c.PostForm("user_subject"))
+		if userSubject == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "invalid user_subject: empty"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermInvite); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.application.CreateGroupInvitation(ctx, ui.Subject, userSubject, groupID); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) GroupRequestsToGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, id, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.application.GroupRequestsTo(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) AgreeGroupRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+		id, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		request, err := h.application.GetGroupRequest(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, request.GroupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.application.AgreeGroupRequest(ctx, id, ui.Subject); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) RefuseGroupRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+		id, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		request, err := h.application.GetGroupRequest(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, request.GroupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.application.RefuseGroupRequest(ctx, id, ui.Subject); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+// record
+
+func (h *handlers) CreateInviteLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// 拥有approve_requests权限的成员可以创建邀请链接，ttl（秒）和max_uses为空或0时不限制
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		var input applications.InviteLinkInput
+		if v := c.PostForm("ttl"); v != "" && v != "0" {
+			if input.TTL, err = parseSeconds("ttl", v); err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		}
+		if v := c.PostForm("max_uses"); v != "" {
+			if input.MaxUses, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, err, "invalid max_uses: %s", v))
+				return
+			}
+		}
+		if v := c.PostForm("requires_approval"); v != "" {
+			if input.RequiresApproval, err = strconv.ParseBool(v); err != nil {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, err, "invalid requires_approval: %s", v))
+				return
+			}
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.application.CreateInviteLink(ctx, ui.Subject, groupID, input)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) InviteLinksOfGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.application.ListInviteLinks(ctx, groupID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) RevokeInviteLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// DELETE
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		linkID, err := strconv.ParseInt(c.Param("link_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid link_id"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		if err = h.application.RevokeInviteLink(ctx, groupID, linkID); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) InviteLinkUses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		linkID, err := strconv.ParseInt(c.Param("link_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid link_id"))
+			return
+		}
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermApprove); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.application.ListInviteLinkUses(ctx, groupID, linkID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) RedeemInviteLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// 链接不需要审批时直接入群，否则提交入群申请
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		token := strings.TrimSpace(c.PostForm("token"))
+		if token == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty token"))
+			return
+		}
+
+		res, err := h.application.RedeemInviteLink(ctx, ui.Subject, token)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) BroadcastMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		message := strings.TrimSpace(c.PostForm("message"))
+		if message == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
+			return
+		}
+
+		opts, err := params.ParseSendOptions(c.PostForm("ttl"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.ClientMsgID, err = params.ParseClientMsgID(c.PostForm("client_msg_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.hub.SendBroadcastMessage(ctx, ui.Subject, message, opts)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) GroupMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// 带sticker_id时为表情消息，message可以为空；不带channel_id时发送到默认频道
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		opts, err := params.ParseSendOptions(c.PostForm("ttl"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.ChannelID, err = params.ParseChannelID(c.PostForm("channel_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.ClientMsgID, err = params.ParseClientMsgID(c.PostForm("client_msg_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.Sticker, err = params.ParseSticker(c.PostForm("sticker_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		message := strings.TrimSpace(c.PostForm("message"))
+		if message == "" && opts.Sticker == nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermPost); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.hub.SendGroupMessage(ctx, ui.Subject, message, groupID, opts)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) PrivateMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// 带sticker_id时为表情消息，message可以为空；encrypted为true时message是端到端加密的密文
+		receiver := strings.TrimSpace(c.PostForm("receiver"))
+		if receiver == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty receiver"))
+			return
+		}
+		opts, err := params.ParseSendOptions(c.PostForm("ttl"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.ClientMsgID, err = params.ParseClientMsgID(c.PostForm("client_msg_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.Sticker, err = params.ParseSticker(c.PostForm("sticker_id")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if opts.Encrypted, err = params.ParseEncrypted(c.PostForm("encrypted")); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		message := strings.TrimSpace(c.PostForm("message"))
+		if message == "" && opts.Sticker == nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		ok, err := h.user.IsFriendOfUser(ctx, ui.Subject, receiver)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "对方不是你的好友"))
+			return
+		}
+
+		res, err := h.hub.SendPrivateMessage(ctx, ui.Subject, message, receiver, opts)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) CreatePoll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// options可以重复多次，closes_at为RFC3339格式，为空时不自动截止；不带channel_id时发送到默认频道
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+			return
+		}
+		poll := &entity.Poll{
+			Question: c.PostForm("question"),
+			Options:  c.PostFormArray("options"),
+		}
+		poll.MultiChoice, _ = strconv.ParseBool(c.PostForm("multi_choice"))
+		poll.Anonymous, _ = strconv.ParseBool(c.PostForm("anonymous"))
+		if v := c.PostForm("closes_at"); v != "" {
+			closesAt, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid closes_at"))
+				return
+			}
+			poll.ClosesAt = &closesAt
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermPost); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		clientMsgID, err := params.ParseClientMsgID(c.PostForm("client_msg_id"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		channelID, err := params.ParseChannelID(c.PostForm("channel_id"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		opts := records.SendOptions{
+			Poll:        poll,
+			ChannelID:   channelID,
+			ClientMsgID: clientMsgID,
+			ClearDraft:  true,
+		}
+		res, err := h.hub.SendGroupMessage(ctx, ui.Subject, poll.Summary(), groupID, opts)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"record": res,
+			"poll":   poll,
+		})
+	}
+}
+
+func (h *handlers) GetPoll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		pollID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.GetPollTally(ctx, ui.Subject, pollID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) VotePoll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// options为选项的下标，多选投票可以重复多次
+		pollID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+		var options []int
+		for _, v := range c.PostFormArray("options") {
+			o, err := strconv.Atoi(v)
+			if err != nil {
+				WrapGinError(c, errors.Newf(errors.InvalidArgument, err, "invalid option: %s", v))
+				return
+			}
+			options = append(options, o)
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.VotePoll(ctx, ui.Subject, pollID, options)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		event := map[string]any{
+			"type":  "poll_tally",
+			"tally": res,
+		}
+		if err = h.hub.SendGroupEvent(ctx, res.Poll.GroupID, event); err != nil {
+			h.logger.Errorf("push poll_tally event of poll %d failed: %v", pollID, err)
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) ForwardRecords() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// records形如private:1,group:2，bundle为true时合并转发为一条聊天记录；转发到群时不带channel_id发送到默认频道
+		sources, err := parseForwardSources(c.PostForm("records"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		bundle, err := params.ParseBundle(c.PostForm("bundle"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		kind := strings.TrimSpace(c.PostForm("kind"))
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		var receiver string
+		var groupID, channelID int64
+		switch kind {
+		case entity.RecordKindPrivate:
+			receiver = strings.TrimSpace(c.PostForm("receiver"))
+			ok, err := h.user.IsFriendOfUser(ctx, ui.Subject, receiver)
+			if err != nil {
+				WrapGinError(c, err)
+				return
+			}
+			if !ok {
+				WrapGinError(c, errors.New(errors.PermissionDenied, nil, "对方不是你的好友"))
+				return
+			}
+		case entity.RecordKindGroup:
+			if groupID, err = strconv.ParseInt(c.PostForm("group_id"), 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+			if channelID, err = params.ParseChannelID(c.PostForm("channel_id")); err != nil {
+				WrapGinError(c, err)
+				return
+			}
+			if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermPost); err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		default:
+			WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "invalid kind: %s", kind))
+			return
+		}
+
+		forwards, err := h.record.BuildForward(ctx, ui.Subject, sources, bundle)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		res, err := h.hub.SendForwardMessages(ctx, ui.Subject, records.ForwardTarget{Kind: kind, Receiver: receiver, GroupID: groupID, ChannelID: channelID}, forwards)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) GetRecordBroadcast() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		sender := c.Query("sender")
+
+		ctx := c.Request.Context()
+		var res []*entity.RecordBroadcast
+		var err error
+		if sender = strings.TrimSpace(sender); sender == "" {
+			res, err = h.record.ListAllRecordBroadcasts(ctx)
+			if err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		} else {
+			res, err = h.record.ListRecordBroadcastsBySender(ctx, sender)
+			if err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) GetRecordGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 带channel_id时只返回该频道的消息，不带时返回默认频道的消息，channels=all时返回所有频道的消息
+		groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+			return
+		}
+		channelID, err := params.ParseChannelID(c.Query("channel_id"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		allChannels, err := params.ParseAllChannels(c.Query("channels"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if allChannels {
+			if channelID != 0 {
+				WrapGinError(c, errors.New(errors.InvalidArgument, nil, "channel_id和channels=all不能同时指定"))
+				return
+			}
+			channelID = records.AllChannels
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		ok, err := h.group.IsMemberOfGroup(ctx, groupID, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if !ok {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你无法查看该群组"))
+			return
+		}
+
+		res, err := h.record.ListRecordGroups(ctx, groupID, channelID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) GetRecordPrivate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		receiver := c.Param("receiver")
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.ListRecordPrivate(ctx, ui.Subject, receiver)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) SearchRecords() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只能检索自己参与的私聊和所在群的群聊
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		input := records.SearchInput{
+			Query:  strings.TrimSpace(c.Query("q")),
+			Sender: strings.TrimSpace(c.Query("sender")),
+			Peer:   strings.TrimSpace(c.Query("peer")),
+			Cursor: c.Query("cursor"),
+		}
+		if input.Query == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty q"))
+			return
+		}
+
+		var err error
+		if v := c.Query("group_id"); v != "" {
+			if input.GroupID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+		}
+		if v := c.Query("from"); v != "" {
+			if input.From, err = time.Parse(time.RFC3339, v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid from"))
+				return
+			}
+		}
+		if v := c.Query("to"); v != "" {
+			if input.To, err = time.Parse(time.RFC3339, v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid to"))
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if input.Limit, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid limit"))
+				return
+			}
+		}
+
+		res, next, err := h.record.SearchRecords(ctx, ui.Subject, input)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"records":     res,
+			"next_cursor": next,
+		})
+	}
+}
+
+func (h *handlers) GetConversationRecords() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 客户端发现会话内的序号不连续时，按from_seq和to_seq补齐缺失的消息
+		conversationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+		fromSeq, err := strconv.ParseInt(c.Query("from_seq"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid from_seq"))
+			return
+		}
+		var toSeq int64
+		if v := c.Query("to_seq"); v != "" {
+			if toSeq, err = strconv.ParseInt(v, 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid to_seq"))
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.ListRecordsBySeq(ctx, ui.Subject, conversationID, fromSeq, toSeq)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) MyBookmarks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		var limit int
+		if v := c.Query("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid limit"))
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, next, err := h.record.ListBookmarks(ctx, ui.Subject, c.Query("cursor"), limit)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"bookmarks":   res,
+			"next_cursor": next,
+		})
+	}
+}
+
+func (h *handlers) AddBookmark() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		kind := strings.TrimSpace(c.PostForm("kind"))
+		recordID, err := strconv.ParseInt(c.PostForm("record_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid record_id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.AddBookmark(ctx, ui.Subject, kind, recordID, c.PostForm("note"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) RemoveBookmark() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// DELETE
+		recordID, err := strconv.ParseInt(c.Param("record_id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid record_id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		err = h.record.RemoveBookmark(ctx, ui.Subject, c.Param("kind"), recordID)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) StickerCatalogue() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 返回ETag，客户端带If-None-Match请求时表情包未变化则返回304
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.ListStickerPacks(ctx, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		body, err := json.Marshal(gin.H{"packs": res})
+		if err != nil {
+			WrapGinError(c, errors.New(errors.Internal, err, "marshal sticker catalogue failed"))
+			return
+		}
+
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+func (h *handlers) GetStickerFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 表情文件上传后不再变化，客户端可以长期缓存
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		s, f, err := h.record.OpenSticker(ctx, ui.Subject, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Header("Content-Type", s.ContentType)
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+		http.ServeContent(c.Writer, c.Request, "", s.CreatedAt, f)
+	}
+}
+
+func (h *handlers) CreateGlobalStickerPack() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// stickers可以重复多次，表情名称为文件名去掉扩展名
+		h.createStickerPack(c, 0)
+	}
+}
+
+func (h *handlers) CreateGroupStickerPack() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// stickers可以重复多次，表情名称为文件名去掉扩展名，需要manage权限
+		groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+		if err = h.group.Authorize(ctx, groupID, ui.Subject, entity.GroupPermManage); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		h.createStickerPack(c, groupID)
+	}
+}
+
+func (h *handlers) createStickerPack(c *gin.Context, groupID int64) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid form"))
+		return
+	}
+
+	uploads := make([]records.StickerUpload, 0, len(form.File["stickers"]))
+	for _, fh := range form.File["stickers"] {
+		f, err := fh.Open()
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid file"))
+			return
+		}
+		defer f.Close()
+
+		name := strings.TrimSuffix(filepath.Base(fh.Filename), filepath.Ext(fh.Filename))
+		uploads = append(uploads, records.StickerUpload{Name: name, Body: f})
+	}
+
+	ctx := c.Request.Context()
+	ui := auth.FromContext(ctx)
+
+	res, err := h.record.CreateStickerPack(ctx, ui.Subject, groupID, c.PostForm("name"), uploads)
+	if err != nil {
+		WrapGinError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *handlers) MyDrafts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.ListDrafts(ctx, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) SaveDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		kind := strings.TrimSpace(c.PostForm("kind"))
+		var groupID int64
+		if v := c.PostForm("group_id"); v != "" {
+			var err error
+			if groupID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.record.SaveDraft(ctx, ui.Subject, kind, strings.TrimSpace(c.PostForm("peer")), groupID, c.PostForm("content"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		// 同步到该账号所有在线的设备
+		if err = h.hub.SendUserEvent(ctx, ui.Subject, map[string]any{"type": "draft", "draft": res}); err != nil {
+			h.logger.Errorf("push draft event to %s failed: %v", ui.Subject, err)
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) MyScheduledMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.schedule.ListPendingScheduledMessages(ctx, ui.Subject)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func (h *handlers) ScheduleMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		message := strings.TrimSpace(c.PostForm("message"))
+		if message == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
+			return
+		}
+		sendAt, err := time.Parse(time.RFC3339, c.PostForm("send_at"))
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid send_at"))
+			return
+		}
+
+		input := schedule.CreateInput{
+			Sender:  ui.Subject,
+			Kind:    strings.TrimSpace(c.PostForm("kind")),
+			Content: message,
+			SendAt:  sendAt,
+		}
+		switch input.Kind {
+		case entity.RecordKindPrivate:
+			if input.Receiver = strings.TrimSpace(c.PostForm("receiver")); input.Receiver == "" {
+				WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty receiver"))
+				return
+			}
+		case entity.RecordKindGroup:
+			if input.GroupID, err = strconv.ParseInt(c.PostForm("group_id"), 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+			if input.ChannelID, err = params.ParseChannelID(c.PostForm("channel_id")); err != nil {
+				WrapGinError(c, err)
+				return
+			}
+		}
+
+		id, err := h.schedule.CreateScheduledMessage(ctx, input)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"id": id})
+	}
+}
+
+func (h *handlers) UpdateScheduledMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// PUT
+		// 只能修改自己的定时消息
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+		message := strings.TrimSpace(c.PostForm("message"))
+		if message == "" {
+			WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty message"))
+			return
+		}
+		sendAt, err := time.Parse(time.RFC3339, c.PostForm("send_at"))
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid send_at"))
+			return
+		}
+
+		m, err := h.schedule.GetScheduledMessage(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if m.Sender != ui.Subject {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以操作该定时消息"))
+			return
+		}
+
+		if err = h.schedule.UpdateScheduledMessage(ctx, id, message, sendAt); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) CancelScheduledMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// DELETE
+		// 只能取消自己的定时消息
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		m, err := h.schedule.GetScheduledMessage(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if m.Sender != ui.Subject {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以操作该定时消息"))
+			return
+		}
+
+		if err = h.schedule.CancelScheduledMessage(ctx, id); err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func (h *handlers) MyExportJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		res, err := h.export.ListExportJobs(ctx, ui.Subject)
 		if err != nil {
 			WrapGinError(c, err)
 			return
@@ -1149,3 +3489,195 @@ func (h *handlers) GetRecordPrivate() gin.HandlerFunc {
 		c.JSON(http.StatusOK, res)
 	}
 }
+
+func (h *handlers) CreateExportJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// 导出在后台执行，通过任务状态查询进度；导出文件为zip，包含聊天记录和消息引用的表情等附件
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		input := export.CreateInput{
+			Owner:  ui.Subject,
+			Kind:   strings.TrimSpace(c.PostForm("kind")),
+			Format: strings.TrimSpace(c.PostForm("format")),
+		}
+		var err error
+		switch input.Kind {
+		case entity.RecordKindPrivate:
+			if input.Peer = strings.TrimSpace(c.PostForm("peer")); input.Peer == "" {
+				WrapGinError(c, errors.New(errors.InvalidArgument, nil, "empty peer"))
+				return
+			}
+		case entity.RecordKindGroup:
+			if input.GroupID, err = strconv.ParseInt(c.PostForm("group_id"), 10, 64); err != nil {
+				WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid group_id"))
+				return
+			}
+		}
+
+		id, err := h.export.CreateExportJob(ctx, input)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"id": id})
+	}
+}
+
+func (h *handlers) GetExportJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只能查看自己的导出任务
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		job, err := h.export.GetExportJob(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if job.Owner != ui.Subject {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以查看该导出任务"))
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+func (h *handlers) DownloadExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// GET
+		// 只能下载自己已完成的导出任务
+
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid id"))
+			return
+		}
+
+		job, err := h.export.GetExportJob(ctx, id)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+		if job.Owner != ui.Subject {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "你不可以下载该导出任务"))
+			return
+		}
+		if job.Status != entity.ExportStatusDone {
+			WrapGinError(c, errors.Newf(errors.FailedPrecondition, nil, "导出任务%s", job.Status.String()))
+			return
+		}
+
+		// 文件分块保存在数据库中，写出响应头后逐块发送
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, job.FilePath))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Status(http.StatusOK)
+		if err = h.export.WriteExportFile(ctx, job, c.Writer); err != nil {
+			h.logger.Errorf("write export file of job %d failed: %v", job.ID, err)
+		}
+	}
+}
+
+// admin
+
+func (h *handlers) ImportArchive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// POST
+		// format为json时file是JSON格式的导入数据，为slack时file是Slack导出的zip文件
+		format := strings.TrimSpace(c.PostForm("format"))
+		fh, err := c.FormFile("file")
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "empty file"))
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid file"))
+			return
+		}
+		defer f.Close()
+
+		var a *importer.Archive
+		switch format {
+		case "json":
+			a, err = importer.ReadJSON(f)
+		case "slack":
+			var zr *zip.Reader
+			zr, err = zip.NewReader(f, fh.Size)
+			if err == nil {
+				a, err = importer.ReadSlack(zr, strings.TrimSpace(c.PostForm("source")))
+			}
+		default:
+			err = fmt.Errorf("invalid format: %s", format)
+		}
+		if err != nil {
+			WrapGinError(c, errors.New(errors.InvalidArgument, err, "invalid archive"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		report, err := h.importer.Import(ctx, a)
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// parseSeconds 解析以秒为单位的正整数时长
+func parseSeconds(name, v string) (time.Duration, error) {
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds <= 0 {
+		return 0, errors.Newf(errors.InvalidArgument, err, "invalid %s: %s", name, v)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// parseForwardSources 解析形如private:1,group:2的原消息列表
+func parseForwardSources(s string) ([]records.ForwardSource, error) {
+	var res []records.ForwardSource
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, id, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, errors.Newf(errors.InvalidArgument, nil, "invalid record: %s", part)
+		}
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, errors.Newf(errors.InvalidArgument, err, "invalid record: %s", part)
+		}
+		res = append(res, records.ForwardSource{Kind: kind, ID: n})
+	}
+
+	return res, nil
+}
+
+// parseRetentionDays 解析保留天数，0表示取消保留策略
+func parseRetentionDays(days string) (time.Duration, error) {
+	n, err := strconv.ParseInt(days, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Newf(errors.InvalidArgument, err, "invalid days: %s", days)
+	}
+
+	return time.Duration(n) * 24 * time.Hour, nil
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"fangaoxs.com/go-chat/internal/auth"
+	"fangaoxs.com/go-chat/internal/domain/user"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +36,26 @@ func AuthMiddleware(authorizer auth.Authorizer) gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware 只允许用户名为adminName的用户访问，需要在AuthMiddleware之后使用
+func AdminMiddleware(user user.User, adminName string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ui := auth.FromContext(ctx)
+
+		u, err := user.GetUserBySubject(ctx, ui.Subject)
+		if err != nil {
+			WrapGinError(c, errors.New(errors.PermissionDenied, err, "仅管理员可以访问"))
+			return
+		}
+		if u.Username != adminName {
+			WrapGinError(c, errors.New(errors.PermissionDenied, nil, "仅管理员可以访问"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func parse(r *http.Request) (token, agent string, err error) {
 	for _, cookie := range r.Cookies() {
 		if cookie.Name == "authorization" {
@@ -8,9 +8,12 @@ import (
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/applications"
+	"fangaoxs.com/go-chat/internal/domain/export"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/importer"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/domain/schedule"
 	"fangaoxs.com/go-chat/internal/domain/user"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 
@@ -27,8 +30,11 @@ func New(
 	hub hub.Hub,
 	record records.Records,
 	application applications.Applications,
+	schedule schedule.Schedule,
+	export export.Export,
+	importer importer.Importer,
 ) (*Server, error) {
-	hdls, err := newHandlers(env, logger, user, group, hub, record, application)
+	hdls, err := newHandlers(env, logger, user, group, hub, record, application, schedule, export, importer)
 	if err != nil {
 		return nil, fmt.Errorf("create rest handlers failed: %w", err)
 	}
@@ -39,6 +45,14 @@ func New(
 	p := v1.Group("personal", AuthMiddleware(authorizer))
 	{
 		p.GET("me", hdls.Me())
+		p.GET("conversations", hdls.MyConversations())
+		p.PUT("readConversation", hdls.ReadConversation())
+		p.GET("retention", hdls.PrivateRetention())
+		p.PUT("retention", hdls.UpdatePrivateRetention())
+
+		p.PUT("deviceKey", hdls.UploadDeviceKey())
+		p.DELETE("deviceKey/:device", hdls.DeleteDeviceKey())
+		p.GET("deviceKeys/:subject", hdls.DeviceKeys())
 
 		p.GET("myFriends", hdls.MyFriends())
 		p.DELETE("removeFriends", hdls.RemoveFriends())
@@ -57,28 +71,75 @@ func New(
 		p.GET("groupInvitationsToMe", hdls.GroupInvitationsToMe())
 		p.PUT("agreeGroupInvitation/:invitation_id", hdls.AgreeGroupInvitation())
 		p.PUT("refuseGroupInvitation/:invitation_id", hdls.RefuseGroupInvitation())
+		p.POST("redeemInviteLink", hdls.RedeemInviteLink())
 	}
 
 	g := v1.Group("group", AuthMiddleware(authorizer))
 	{
 		g.POST("", hdls.CreateGroup())
+		g.GET("directory", hdls.GroupDirectory())
 		g.GET(":id", hdls.GetGroupByID())
 		g.DELETE(":id", hdls.DeleteGroup())
 		g.PUT("toPublic/:id", hdls.MakeGroupPublic())
 		g.PUT("toPrivate/:id", hdls.MakeGroupPrivate())
+		g.PUT("joinPolicy/:id", hdls.SetJoinPolicy())
+		g.PUT("rename/:id", hdls.RenameGroup())
+		g.PUT("profile/:id", hdls.UpdateGroupProfile())
+		g.PUT("avatar/:id", hdls.SetGroupAvatar())
+		g.GET("avatar/:id", hdls.GetGroupAvatar())
+		g.PUT("nickname/:id", hdls.SetGroupNickname())
+		g.PUT("transferOwner/:id", hdls.TransferOwnership())
+		g.GET("owners/:id", hdls.OwnerHistory())
+
+		g.PUT("mute/:id", hdls.MuteMember())
+		g.PUT("unmute/:id", hdls.UnmuteMember())
+		g.PUT("muteAll/:id", hdls.MuteAll())
+		g.PUT("slowMode/:id", hdls.SlowMode())
+		g.PUT("ban/:id", hdls.BanMember())
+		g.PUT("unban/:id", hdls.UnbanMember())
+		g.GET("bans/:id", hdls.BansOfGroup())
 
 		g.GET("members/:id", hdls.MembersOfGroup())
+		g.GET("capacity/:id", hdls.CapacityOfGroup())
+		g.PUT("capacity/:id", hdls.RaiseCapacityTier())
 		g.PUT("removeMembers/:id", hdls.RemoveMembersFromGroup())
 
 		g.GET("admins/:id", hdls.AdminsOfGroup())
 		g.PUT("removeAdmins/:id", hdls.RemoveAdminsFromGroup())
 		g.PUT("assignAdmins/:id", hdls.AssignAdminsToGroup())
 
+		g.GET("roles/:id", hdls.RolesOfGroup())
+		g.PUT("role/:id", hdls.SaveGroupRole())
+		g.DELETE("role/:id/:name", hdls.DeleteGroupRole())
+		g.PUT("assignRole/:id", hdls.AssignGroupRole())
+
+		g.GET("channels/:id", hdls.ChannelsOfGroup())
+		g.POST("channel/:id", hdls.CreateGroupChannel())
+		g.PUT("channel/:id/:channel_id", hdls.UpdateGroupChannel())
+		g.PUT("channelRead/:id/:channel_id", hdls.MarkGroupChannelRead())
+
+		g.GET("pins/:id", hdls.PinsOfGroup())
+		g.PUT("pin/:id", hdls.PinRecord())
+		g.PUT("unpin/:id", hdls.UnpinRecord())
+
+		g.GET("announcements/:id", hdls.AnnouncementHistory())
+		g.PUT("announcement/:id", hdls.UpdateAnnouncement())
+
+		g.GET("retention/:id", hdls.GroupRetention())
+		g.PUT("retention/:id", hdls.UpdateGroupRetention())
+
+		g.POST("stickerPack/:id", hdls.CreateGroupStickerPack())
+
 		g.POST("sendGroupInvitation", hdls.SendGroupInvitation())
 
 		g.GET("groupRequestsToGroup/:id", hdls.GroupRequestsToGroup())
 		g.PUT("agreeGroupRequest/:request_id", hdls.AgreeGroupRequest())
 		g.PUT("refuseGroupRequest/:request_id", hdls.RefuseGroupRequest())
+
+		g.POST("inviteLink/:id", hdls.CreateInviteLink())
+		g.GET("inviteLinks/:id", hdls.InviteLinksOfGroup())
+		g.DELETE("inviteLink/:id/:link_id", hdls.RevokeInviteLink())
+		g.GET("inviteLinkUses/:id/:link_id", hdls.InviteLinkUses())
 	}
 
 	r := v1.Group("record", AuthMiddleware(authorizer))
@@ -88,7 +149,38 @@ func New(
 		r.GET("private/:receiver", hdls.GetRecordPrivate())
 		r.POST("broadcast", hdls.BroadcastMessage())
 		r.POST("group/:group_id", hdls.GroupMessage())
+		r.POST("group/:group_id/poll", hdls.CreatePoll())
+		r.GET("poll/:id", hdls.GetPoll())
+		r.POST("poll/:id/vote", hdls.VotePoll())
 		r.POST("private", hdls.PrivateMessage())
+		r.POST("forward", hdls.ForwardRecords())
+		r.GET("search", hdls.SearchRecords())
+		r.GET("conversation/:id", hdls.GetConversationRecords())
+
+		r.GET("bookmarks", hdls.MyBookmarks())
+		r.POST("bookmark", hdls.AddBookmark())
+		r.DELETE("bookmark/:kind/:record_id", hdls.RemoveBookmark())
+		r.GET("stickers", hdls.StickerCatalogue())
+		r.GET("sticker/:id", hdls.GetStickerFile())
+
+		r.GET("drafts", hdls.MyDrafts())
+		r.PUT("draft", hdls.SaveDraft())
+
+		r.GET("schedules", hdls.MyScheduledMessages())
+		r.POST("schedule", hdls.ScheduleMessage())
+		r.PUT("schedule/:id", hdls.UpdateScheduledMessage())
+		r.DELETE("schedule/:id", hdls.CancelScheduledMessage())
+
+		r.GET("exports", hdls.MyExportJobs())
+		r.POST("export", hdls.CreateExportJob())
+		r.GET("export/:id", hdls.GetExportJob())
+		r.GET("export/:id/download", hdls.DownloadExport())
+	}
+
+	a := v1.Group("admin", AuthMiddleware(authorizer), AdminMiddleware(user, env.AdminName))
+	{
+		a.POST("import", hdls.ImportArchive())
+		a.POST("stickerPack", hdls.CreateGlobalStickerPack())
 	}
 
 	s := &http.Server{
@@ -2,14 +2,20 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/applications"
+	"fangaoxs.com/go-chat/internal/domain/export"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/importer"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/domain/schedule"
 	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/entity"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 	"fangaoxs.com/go-chat/server/rest"
 	"fangaoxs.com/go-chat/server/websocket"
@@ -40,18 +46,21 @@ func newServer(
 	group group.Group,
 	record records.Records,
 	application applications.Applications,
+	schedule schedule.Schedule,
+	export export.Export,
+	importer importer.Importer,
 ) (*Server, error) {
 	hb, err := hub.NewHub(env, logger, record, group)
 	if err != nil {
 		return nil, err
 	}
 
-	restServer, err := rest.New(env, logger, httpServer, authorizer, user, group, hb, record, application)
+	restServer, err := rest.New(env, logger, httpServer, authorizer, user, group, hb, record, application, schedule, export, importer)
 	if err != nil {
 		return nil, err
 	}
 
-	wsServer, err := websocket.New(env, logger, httpServer, authorizer, user, group, hb)
+	wsServer, err := websocket.New(env, logger, httpServer, authorizer, user, group, hb, record)
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +71,10 @@ func newServer(
 		restServer: restServer,
 		wsServer:   wsServer,
 		hub:        hb,
+		group:      group,
+		record:     record,
+		schedule:   schedule,
+		export:     export,
 	}, nil
 }
 
@@ -72,7 +85,11 @@ type Server struct {
 	restServer *rest.Server
 	wsServer   *websocket.Server
 
-	hub hub.Hub
+	hub      hub.Hub
+	group    group.Group
+	record   records.Records
+	schedule schedule.Schedule
+	export   export.Export
 }
 
 func (s *Server) Run(ctx context.Context) error {
@@ -98,6 +115,27 @@ func (s *Server) Run(ctx context.Context) error {
 		return nil
 	})
 
+	g.Go(func() error {
+		s.logger.Infof("scheduled message dispatcher started, interval %s", s.env.SchedulerInterval)
+		s.runDispatcher(ctx)
+		s.logger.Info("scheduled message dispatcher stopped")
+		return nil
+	})
+
+	g.Go(func() error {
+		s.logger.Infof("expired record janitor started, interval %s", s.env.JanitorInterval)
+		s.runJanitor(ctx)
+		s.logger.Info("expired record janitor stopped")
+		return nil
+	})
+
+	g.Go(func() error {
+		s.logger.Infof("export worker started, interval %s", s.env.ExportInterval)
+		s.runExporter(ctx)
+		s.logger.Info("export worker stopped")
+		return nil
+	})
+
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -114,6 +152,131 @@ func (s *Server) Run(ctx context.Context) error {
 	return nil
 }
 
+// runDispatcher 定期发送到期的定时消息，直到ctx被取消
+func (s *Server) runDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(s.env.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.schedule.DispatchDueMessages(ctx, s.hub)
+			if err != nil {
+				s.logger.Errorf("dispatch scheduled messages failed: %v", err)
+				continue
+			}
+			if n > 0 {
+				s.logger.Infof("dispatched %d scheduled messages", n)
+			}
+		}
+	}
+}
+
+// runJanitor 定期清理过期的消息、截止到期的投票、解除到期的禁言和封禁并通知在线的客户端，直到ctx被取消
+func (s *Server) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(s.env.JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.record.PurgeExpiredRecords(ctx)
+			// 部分批次可能已经提交，仍需通知
+			for _, rcd := range expired {
+				s.notifyExpired(ctx, rcd)
+			}
+			// 每项任务各自失败，不影响后续任务
+			if err != nil {
+				s.logger.Errorf("purge expired records failed: %v", err)
+			} else if len(expired) > 0 {
+				s.logger.Infof("purged %d expired records", len(expired))
+			}
+
+			closed, err := s.record.CloseDuePolls(ctx)
+			for _, tally := range closed {
+				event := map[string]any{
+					"type":  "poll_closed",
+					"tally": tally,
+				}
+				if err := s.hub.SendGroupEvent(ctx, tally.Poll.GroupID, event); err != nil {
+					s.logger.Errorf("push poll_closed event of poll %d failed: %v", tally.Poll.ID, err)
+				}
+			}
+			if err != nil {
+				s.logger.Errorf("close due polls failed: %v", err)
+			}
+
+			mutes, bans, err := s.group.LiftExpiredModeration(ctx)
+			for _, m := range mutes {
+				s.postSystemMessage(ctx, m.GroupID, fmt.Sprintf("%s 的禁言已到期解除", m.UserSubject))
+			}
+			for _, b := range bans {
+				s.postSystemMessage(ctx, b.GroupID, fmt.Sprintf("%s 的封禁已到期解除", b.UserSubject))
+			}
+			if err != nil {
+				s.logger.Errorf("lift expired moderation failed: %v", err)
+			}
+		}
+	}
+}
+
+// postSystemMessage 在群里发送系统消息，失败时只记录日志
+func (s *Server) postSystemMessage(ctx context.Context, groupID int64, content string) {
+	if _, err := s.hub.SendGroupMessage(ctx, entity.SystemSubject, content, groupID, records.SendOptions{System: true}); err != nil {
+		s.logger.Errorf("send system message to group %d failed: %v", groupID, err)
+	}
+}
+
+func (s *Server) notifyExpired(ctx context.Context, rcd *entity.ExpiredRecord) {
+	event := map[string]any{
+		"type":   "message_expired",
+		"record": rcd,
+	}
+
+	var err error
+	switch rcd.Kind {
+	case entity.RecordKindPrivate:
+		for _, subject := range []string{rcd.Sender, rcd.Receiver} {
+			if err = s.hub.SendUserEvent(ctx, subject, event); err != nil {
+				break
+			}
+		}
+	case entity.RecordKindGroup:
+		err = s.hub.SendGroupEvent(ctx, rcd.GroupID, event)
+	case entity.RecordKindBroadcast:
+		err = s.hub.SendBroadcastEvent(ctx, event)
+	}
+	if err != nil {
+		s.logger.Errorf("push message_expired event of %s record %d failed: %v", rcd.Kind, rcd.ID, err)
+	}
+}
+
+// runExporter 定期执行待导出的任务，直到ctx被取消
+func (s *Server) runExporter(ctx context.Context) {
+	ticker := time.NewTicker(s.env.ExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.export.RunPendingJobs(ctx)
+			if err != nil {
+				s.logger.Errorf("run export jobs failed: %v", err)
+				continue
+			}
+			if n > 0 {
+				s.logger.Infof("finished %d export jobs", n)
+			}
+		}
+	}
+}
+
 func (s *Server) Close() error {
 	s.hub.Close()
 	s.restServer.Close()
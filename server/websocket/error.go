@@ -23,6 +23,10 @@ func WrapGinError(c *gin.Context, err error) {
 		code = http.StatusUnauthorized
 	case errors.Unavailable:
 		code = http.StatusServiceUnavailable
+	case errors.FailedPrecondition:
+		code = http.StatusPreconditionFailed
+	case errors.ResourceExhausted:
+		code = http.StatusTooManyRequests
 	}
 	c.AbortWithStatusJSON(code, gin.H{
 		"code":    code,
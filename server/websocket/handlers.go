@@ -2,37 +2,45 @@ package websocket
 
 import (
 	"encoding/json"
+	stderr "errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/records"
 	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/entity"
 	"fangaoxs.com/go-chat/internal/infras/errors"
 	"fangaoxs.com/go-chat/internal/infras/logger"
+	"fangaoxs.com/go-chat/server/params"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-func newHandlers(env environment.Env, logger logger.Logger, user user.User, group group.Group, hub hub.Hub) (handlers, error) {
+func newHandlers(env environment.Env, logger logger.Logger, user user.User, group group.Group, hub hub.Hub, record records.Records) (handlers, error) {
 	return handlers{
 		logger: logger,
 		user:   user,
 		group:  group,
 		hub:    hub,
+		record: record,
 	}, nil
 }
 
 type handlers struct {
 	logger logger.Logger
 
-	user  user.User
-	group group.Group
-	hub   hub.Hub
+	user   user.User
+	group  group.Group
+	hub    hub.Hub
+	record records.Records
 }
 
 func (h *handlers) Shack(authorizer auth.Authorizer) gin.HandlerFunc {
@@ -59,6 +67,18 @@ func (h *handlers) Shack(authorizer auth.Authorizer) gin.HandlerFunc {
 		c.Request = c.Request.Clone(ctx)
 		ui := auth.FromContext(ctx)
 		subject := ui.Subject
+		// 同一账号可以在多个设备上同时在线，device区分设备，为空时视为默认设备
+		device := strings.TrimSpace(c.Query("device"))
+		if utf8.RuneCountInString(device) > hub.MaxDeviceLen {
+			WrapGinError(c, errors.Newf(errors.InvalidArgument, nil, "device不能超过%d个字符", hub.MaxDeviceLen))
+			return
+		}
+		// 认识群频道的客户端带上channels=all接收所有频道的消息，否则只接收默认频道的消息
+		allChannels, err := params.ParseAllChannels(c.Query("channels"))
+		if err != nil {
+			WrapGinError(c, err)
+			return
+		}
 
 		u, err := h.user.GetUserBySubject(ctx, subject)
 		if err != nil {
@@ -76,9 +96,14 @@ func (h *handlers) Shack(authorizer auth.Authorizer) gin.HandlerFunc {
 		}
 		defer conn.Close()
 
-		h.hub.RegisterClient(ctx, subject, conn)
+		client, err := h.hub.RegisterClient(ctx, subject, device, allChannels, conn)
+		if err != nil {
+			h.logger.Errorf("register client %s on device %s failed: %v", subject, device, err)
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+			return
+		}
 		h.logger.Infof("[%s] login", u.Nickname)
-		conn.WriteMessage(websocket.TextMessage, []byte("Welcome! "+u.Nickname))
+		client.WriteMessage(websocket.TextMessage, []byte("Welcome! "+u.Nickname))
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
@@ -87,44 +112,63 @@ func (h *handlers) Shack(authorizer auth.Authorizer) gin.HandlerFunc {
 
 			// 心跳检测
 			if messageType == websocket.PingMessage || string(message) == "PING" || string(message) == "ping" {
-				conn.WriteMessage(websocket.TextMessage, []byte("PONG"))
+				client.WriteMessage(websocket.TextMessage, []byte("PONG"))
 				continue
 			}
 
 			var m map[string]string
 			if err = json.Unmarshal(message, &m); err != nil {
-				conn.WriteJSON(KV{"error": err.Error()})
+				client.WriteJSON(KV{"error": err.Error()})
+				continue
+			}
+
+			opts, err := params.ParseSendOptions(m["ttl"])
+			if err != nil {
+				client.WriteJSON(KV{"error": err.Error()})
+				continue
+			}
+			if opts.ClientMsgID, err = params.ParseClientMsgID(m["client_msg_id"]); err != nil {
+				client.WriteJSON(KV{"error": err.Error()})
+				continue
+			}
+			if opts.Sticker, err = params.ParseSticker(m["sticker_id"]); err != nil {
+				client.WriteJSON(KV{"error": err.Error()})
+				continue
+			}
+			// 端到端加密的私聊消息，content是密文
+			if opts.Encrypted, err = params.ParseEncrypted(m["encrypted"]); err != nil {
+				client.WriteJSON(KV{"error": err.Error()})
 				continue
 			}
 
+			var res *records.SendResult
 			switch m["type"] {
 			case "broadcast":
 				content := m["content"]
-				if err = h.hub.SendBroadcastMessage(ctx, subject, content); err != nil {
+				if res, err = h.hub.SendBroadcastMessage(ctx, subject, content, opts); err != nil {
 					h.logger.Errorf("%s send broadcast message failed: %w", subject, err)
-					conn.WriteJSON(KV{"error": err.Error()})
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
 			case "group":
 				groupID, err := strconv.ParseInt(m["group_id"], 10, 64)
 				if err != nil {
-					conn.WriteJSON(KV{"error": err.Error()})
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
-				content := m["content"]
-				ok, err := h.group.IsMemberOfGroup(ctx, groupID, subject)
-				if err != nil {
-					conn.WriteJSON(KV{"error": err.Error()})
+				if opts.ChannelID, err = params.ParseChannelID(m["channel_id"]); err != nil {
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
-				if !ok {
-					conn.WriteJSON(KV{"error": "你不是该群成员"})
+				content := m["content"]
+				if err = h.group.Authorize(ctx, groupID, subject, entity.GroupPermPost); err != nil {
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
 
-				if err = h.hub.SendGroupMessage(ctx, subject, content, groupID); err != nil {
+				if res, err = h.hub.SendGroupMessage(ctx, subject, content, groupID, opts); err != nil {
 					h.logger.Errorf("%s send group message to %d failed: %w", subject, groupID, err)
-					conn.WriteJSON(KV{"error": err.Error()})
+					client.WriteJSON(errorKV(err))
 					break
 				}
 			case "private":
@@ -132,28 +176,66 @@ func (h *handlers) Shack(authorizer auth.Authorizer) gin.HandlerFunc {
 				receiver := m["receiver"]
 				ok, err := h.user.IsFriendOfUser(ctx, subject, receiver)
 				if err != nil {
-					conn.WriteJSON(KV{"error": err.Error()})
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
 				if !ok {
-					conn.WriteJSON(KV{"error": "对方不是你的好友"})
+					client.WriteJSON(KV{"error": "对方不是你的好友"})
 					break
 				}
 
-				if err = h.hub.SendPrivateMessage(ctx, subject, content, receiver); err != nil {
+				if res, err = h.hub.SendPrivateMessage(ctx, subject, content, receiver, opts); err != nil {
 					h.logger.Errorf("%s send private message to %d failed: %w", subject, receiver, err)
-					conn.WriteJSON(KV{"error": err.Error()})
+					client.WriteJSON(KV{"error": err.Error()})
 					break
 				}
+			case "draft":
+				// 私聊草稿不带group_id
+				var groupID int64
+				if v := m["group_id"]; v != "" {
+					if groupID, err = strconv.ParseInt(v, 10, 64); err != nil {
+						client.WriteJSON(KV{"error": errors.New(errors.InvalidArgument, err, "invalid group_id").Error()})
+						break
+					}
+				}
+				draft, err := h.record.SaveDraft(ctx, subject, m["kind"], m["peer"], groupID, m["content"])
+				if err != nil {
+					client.WriteJSON(KV{"error": err.Error()})
+					break
+				}
+				// 同步到该账号的其他设备
+				if err = h.hub.SyncUserEvent(ctx, subject, client.Device(), KV{"type": "draft", "draft": draft}); err != nil {
+					h.logger.Errorf("sync draft of %s failed: %v", subject, err)
+				}
+				client.WriteJSON(KV{"type": "ack", "draft": draft})
 			default:
-				conn.WriteJSON(KV{"error": "invalid message type"})
+				client.WriteJSON(KV{"error": "invalid message type"})
+			}
+
+			// 回执服务端ID和时间，客户端据此确认发送成功
+			if res != nil {
+				client.WriteJSON(KV{"type": "ack", "result": res})
 			}
 		}
-		h.hub.UnregisterClient(ctx, subject)
+		h.hub.UnregisterClient(ctx, subject, client)
 		h.logger.Infof("[%s] logout", u.Nickname)
 	}
 }
 
+// errorKV 慢速模式的错误额外返回可以再次发言的时间
+func errorKV(err error) KV {
+	kv := KV{"error": err.Error()}
+	var slow *records.SlowModeError
+	if stderr.As(err, &slow) {
+		kv["code"] = "slow_mode"
+		kv["group_id"] = slow.GroupID
+		kv["retry_at"] = slow.RetryAt
+		kv["retry_after"] = int(slow.RetryAfter(time.Now().UTC()) / time.Second)
+	}
+
+	return kv
+}
+
 // update http to websocket
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -9,6 +9,7 @@ import (
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/group"
 	"fangaoxs.com/go-chat/internal/domain/hub"
+	"fangaoxs.com/go-chat/internal/domain/records"
 	"fangaoxs.com/go-chat/internal/domain/user"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 
@@ -23,8 +24,9 @@ func New(
 	user user.User,
 	group group.Group,
 	hub hub.Hub,
+	record records.Records,
 ) (*Server, error) {
-	hdls, err := newHandlers(env, logger, user, group, hub)
+	hdls, err := newHandlers(env, logger, user, group, hub, record)
 	if err != nil {
 		return nil, fmt.Errorf("create websocket handlers failed: %w", err)
 	}
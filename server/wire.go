@@ -7,9 +7,13 @@ import (
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/applications"
+	"fangaoxs.com/go-chat/internal/domain/export"
 	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/importer"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/domain/schedule"
 	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 	"fangaoxs.com/go-chat/internal/storage/postgres"
 
@@ -20,10 +24,14 @@ import (
 func initServer(env environment.Env, logger logger.Logger, httpServer *gin.Engine) (*Server, error) {
 	panic(wire.Build(
 		postgres.New,
+		attachment.New,
 		user.New,
 		group.New,
 		records.New,
 		applications.New,
+		schedule.New,
+		export.New,
+		importer.New,
 		auth.NewAuthorizer,
 		newServer,
 	))
@@ -10,9 +10,13 @@ import (
 	"fangaoxs.com/go-chat/environment"
 	"fangaoxs.com/go-chat/internal/auth"
 	"fangaoxs.com/go-chat/internal/domain/applications"
+	"fangaoxs.com/go-chat/internal/domain/export"
 	"fangaoxs.com/go-chat/internal/domain/group"
+	"fangaoxs.com/go-chat/internal/domain/importer"
 	"fangaoxs.com/go-chat/internal/domain/records"
+	"fangaoxs.com/go-chat/internal/domain/schedule"
 	"fangaoxs.com/go-chat/internal/domain/user"
+	"fangaoxs.com/go-chat/internal/infras/attachment"
 	"fangaoxs.com/go-chat/internal/infras/logger"
 	"fangaoxs.com/go-chat/internal/storage/postgres"
 	"github.com/gin-gonic/gin"
@@ -33,19 +37,29 @@ func initServer(env environment.Env, logger2 logger.Logger, httpServer *gin.Engi
 	if err != nil {
 		return nil, err
 	}
-	groupGroup, err := group.New(env, storage)
+	store := attachment.New(storage)
+	groupGroup, err := group.New(env, logger2, storage, store)
 	if err != nil {
 		return nil, err
 	}
-	recordsRecords, err := records.New(env, logger2, storage)
+	recordsRecords, err := records.New(env, logger2, storage, groupGroup, store)
 	if err != nil {
 		return nil, err
 	}
-	applicationsApplications, err := applications.New(env, logger2, storage)
+	applicationsApplications, err := applications.New(env, logger2, storage, groupGroup)
 	if err != nil {
 		return nil, err
 	}
-	server, err := newServer(env, logger2, httpServer, authorizer, userUser, groupGroup, recordsRecords, applicationsApplications)
+	scheduleSchedule, err := schedule.New(env, logger2, storage, recordsRecords, groupGroup)
+	if err != nil {
+		return nil, err
+	}
+	exportExport := export.New(logger2, storage, store)
+	importerImporter, err := importer.New(env, logger2, storage, userUser, groupGroup)
+	if err != nil {
+		return nil, err
+	}
+	server, err := newServer(env, logger2, httpServer, authorizer, userUser, groupGroup, recordsRecords, applicationsApplications, scheduleSchedule, exportExport, importerImporter)
 	if err != nil {
 		return nil, err
 	}